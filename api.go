@@ -0,0 +1,452 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"github.com/maddyonline/goonj/cui"
+	"github.com/maddyonline/goonj/judge"
+	"github.com/maddyonline/goonj/problem"
+	"github.com/maddyonline/goonj/webhook"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const API_PREFIX = "/api/v1"
+
+// openapiDoc describes the JSON API. api_test.go checks it against apiRoutes
+// and the JSON encoding of the cui types.
+//
+//go:embed openapi.json
+var openapiDoc []byte
+
+type apiRoute struct {
+	Method  string
+	Path    string
+	Handler echo.HandlerFunc
+}
+
+// apiRoutes is the JSON counterpart of the XML handlers in addCuiHandlers.
+// Both go through the same cui functions.
+var apiRoutes = []apiRoute{
+	{"GET", "/status", apiStatus},
+	{"POST", "/tickets", apiCreateTicket},
+	{"GET", "/tickets/:ticket", apiGetTicket},
+	{"POST", "/tickets/:ticket/start", apiStartTicket},
+	{"GET", "/tickets/:ticket/clock", apiClock},
+	{"GET", "/tickets/:ticket/tasks/:task", apiGetTask},
+	{"PUT", "/tickets/:ticket/tasks/:task/solution", apiSaveSolution},
+	{"POST", "/tickets/:ticket/tasks/:task/run", apiVerify(cui.VERIFY)},
+	{"POST", "/tickets/:ticket/tasks/:task/judge", apiVerify(cui.JUDGE)},
+	{"POST", "/tickets/:ticket/tasks/:task/final", apiVerify(cui.FINAL)},
+	{"POST", "/tickets/:ticket/events", apiRecordEvent},
+	{"POST", "/drafts", apiAdmin(apiCreateDraft)},
+	{"POST", "/drafts/:ticket/validate", apiAdmin(apiValidateDraft)},
+	{"POST", "/drafts/:ticket/publish", apiAdmin(apiPublishDraft)},
+	{"GET", "/problems", apiListProblems},
+	{"GET", "/problems/:problem", apiGetProblem},
+	{"GET", "/admin/submissions", apiAdmin(apiListSubmissions)},
+	{"POST", "/admin/rejudge", apiAdmin(apiRejudge)},
+	{"GET", "/admin/rejudge/:job", apiAdmin(apiGetRejudge)},
+	{"GET", "/admin/tickets/:ticket/scores", apiAdmin(apiGetScores)},
+	{"GET", "/admin/tickets/:ticket/clock", apiAdmin(apiGetClockState)},
+	{"POST", "/admin/tickets/:ticket/clock", apiAdmin(apiChangeClock)},
+	{"POST", "/admin/tickets/:ticket/observers", apiAdmin(apiCreateObserverLink)},
+	{"GET", "/admin/tickets/:ticket/chat", apiAdmin(apiGetChat)},
+	{"POST", "/admin/tickets/:ticket/chat", apiAdmin(apiPostChat)},
+	{"GET", "/admin/tickets/:ticket/integrity", apiAdmin(apiGetIntegrity)},
+	{"GET", "/admin/tickets/:ticket/report", apiAdmin(apiGetReport)},
+	{"GET", "/admin/reports/tickets", apiAdmin(apiGetTicketsCSV)},
+	{"GET", "/admin/similarity", apiAdmin(apiGetSimilarity)},
+	{"GET", "/admin/webhooks", apiAdmin(apiListWebhookDeliveries)},
+}
+
+func addApiHandlers(e *echo.Echo) {
+	api := e.Group(API_PREFIX)
+	for _, route := range apiRoutes {
+		switch route.Method {
+		case "GET":
+			api.Get(route.Path, route.Handler)
+		case "POST":
+			api.Post(route.Path, route.Handler)
+		case "PUT":
+			api.Put(route.Path, route.Handler)
+		}
+	}
+	api.Get("/openapi.json", func(c *echo.Context) error {
+		c.Response().Header().Set("Content-Type", "application/json; charset=utf-8")
+		c.Response().WriteHeader(http.StatusOK)
+		_, err := c.Response().Write(openapiDoc)
+		return err
+	})
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func apiErrorf(c *echo.Context, code int, format string, a ...interface{}) error {
+	return c.JSON(code, &apiError{Error: fmt.Sprintf(format, a...)})
+}
+
+type apiTicket struct {
+	Id           string       `json:"ticket_id"`
+	Organisation string       `json:"organisation"`
+	Options      *cui.Options `json:"options"`
+	Draft        *cui.Draft   `json:"draft,omitempty"`
+	// State is one of the cui.SESSION_* stages; TaskTime the seconds spent
+	// on each task so far.
+	State    string         `json:"state"`
+	TaskTime map[string]int `json:"task_time_sec,omitempty"`
+}
+
+func newApiTicket(session *cui.Session) *apiTicket {
+	session.Lock()
+	defer session.Unlock()
+	return apiTicketAt(session, time.Now(), sessionExpiry())
+}
+
+// apiTicketAt describes session at now to the API and the command line.
+func apiTicketAt(session *cui.Session, now time.Time, expiry time.Duration) *apiTicket {
+	ticket := session.Ticket
+	session.UpdateOptions(now)
+	// The options change with the session after it is unlocked.
+	options := *ticket.Options
+	return &apiTicket{
+		Id:           ticket.Id,
+		Organisation: ticket.Organisation,
+		Options:      &options,
+		Draft:        ticket.Draft,
+		State:        session.State(now, expiry),
+		TaskTime:     session.TaskSeconds(now),
+	}
+}
+
+// apiTicketRequest creates a ticket with one task per problem reference
+// ("id" or "id@version"), or the default task when Problems is empty.
+type apiTicketRequest struct {
+	Organisation string   `json:"organisation"`
+	Sequential   bool     `json:"sequential"`
+	Problems     []string `json:"problems"`
+}
+
+type apiDraftRequest struct {
+	ProblemId string `json:"problem_id"`
+	Title     string `json:"title"`
+	From      string `json:"from"`
+	// QueryLimit applies to interactive problems, see problem.Manifest.
+	QueryLimit int `json:"query_limit"`
+}
+
+// apiValidation reports the cross-validation of a draft. Version is set
+// once the draft has been published.
+type apiValidation struct {
+	OK        bool   `json:"ok"`
+	Tests     int    `json:"tests"`
+	Message   string `json:"message"`
+	ProblemId string `json:"problem_id"`
+	Version   int    `json:"version,omitempty"`
+}
+
+type apiProblem struct {
+	Id        string `json:"id"`
+	Title     string `json:"title"`
+	Version   int    `json:"version"`
+	Versions  []int  `json:"versions"`
+	Statement string `json:"statement"`
+}
+
+// apiTaskScore shows reviewers how a task was scored. Score is nil until
+// the task has been finalized.
+type apiTaskScore struct {
+	TaskId    string       `json:"task_id"`
+	Finalized bool         `json:"finalized"`
+	Score     *judge.Score `json:"score"`
+}
+
+type apiScores struct {
+	TicketId string         `json:"ticket_id"`
+	Tasks    []apiTaskScore `json:"tasks"`
+}
+
+func apiSession(c *echo.Context) (*cui.Session, error) {
+	session, ok := lookupSession(c.Param("ticket"))
+	if !ok {
+		return nil, apiErrorf(c, http.StatusNotFound, "no ticket %q", c.Param("ticket"))
+	}
+	return session, nil
+}
+
+func apiStatus(c *echo.Context) error {
+	return c.JSON(http.StatusOK, cui.GetVerifyStatus(runner, nil, nil, nil, cui.VERIFY))
+}
+
+func apiCreateTicket(c *echo.Context) error {
+	ticketReq := &apiTicketRequest{}
+	if err := json.NewDecoder(c.Request().Body).Decode(ticketReq); err != nil && err != io.EOF {
+		return apiErrorf(c, http.StatusBadRequest, "invalid request body: %v", err)
+	}
+	// The organisation receives the webhooks of the ticket.
+	if ticketReq.Organisation != "" {
+		if status, msg := checkAdmin(c); status != 0 {
+			return apiErrorf(c, status, "organisation: %s", msg)
+		}
+	}
+	ticket, err := newTicket(ticketReq.Problems)
+	if err != nil {
+		return apiErrorf(c, http.StatusBadRequest, "%v", err)
+	}
+	ticket.Organisation = ticketReq.Organisation
+	ticket.Options.Sequential = ticketReq.Sequential
+	session := registerTicket(ticket, newUserContext())
+	return c.JSON(http.StatusCreated, newApiTicket(session))
+}
+
+func apiGetTicket(c *echo.Context) error {
+	session, err := apiSession(c)
+	if session == nil {
+		return err
+	}
+	expireSession(session.Ticket.Id, time.Now(), TIMEOUT_GRACE)
+	return c.JSON(http.StatusOK, newApiTicket(session))
+}
+
+func apiStartTicket(c *echo.Context) error {
+	session, err := apiSession(c)
+	if session == nil {
+		return err
+	}
+	session.Lock()
+	defer session.Unlock()
+	started, err := session.Start(time.Now(), sessionExpiry())
+	if err != nil {
+		return apiErrorf(c, http.StatusConflict, "%v", err)
+	}
+	if started {
+		saveSession(session)
+		notify(webhook.TicketStarted, session.Ticket.Id, "")
+	}
+	return c.JSON(http.StatusOK, map[string]string{"result": "OK"})
+}
+
+func apiClock(c *echo.Context) error {
+	if session, err := apiSession(c); session == nil {
+		return err
+	}
+	clkReq := &cui.ClockRequest{TicketId: c.Param("ticket")}
+	if old := c.Query("old_timelimit"); old != "" {
+		n, err := strconv.Atoi(old)
+		if err != nil {
+			return apiErrorf(c, http.StatusBadRequest, "old_timelimit: %v", err)
+		}
+		clkReq.OldTimeLimit = n
+	}
+	return c.JSON(http.StatusOK, getClock(clkReq))
+}
+
+func apiGetTask(c *echo.Context) error {
+	session, err := apiSession(c)
+	if session == nil {
+		return err
+	}
+	msg := &cui.MessageGetTask{
+		Task:                 c.Param("task"),
+		Ticket:               session.Ticket.Id,
+		ProgLang:             c.Query("prg_lang"),
+		HumanLang:            c.Query("human_lang"),
+		PreferServerProgLang: c.Query("prg_lang") != "",
+	}
+	if msg.HumanLang == "" {
+		msg.HumanLang = session.Ticket.Options.CurrentHumanLang
+	}
+	task, err := getTask(msg)
+	if err != nil {
+		return apiErrorf(c, http.StatusNotFound, "no task %q in ticket %q", msg.Task, msg.Ticket)
+	}
+	return c.JSON(http.StatusOK, task)
+}
+
+// apiGetScores lists the scores of the final submissions of a ticket,
+// including the hidden test groups and checker messages candidates do not
+// see, which is why it is an admin route.
+func apiGetScores(c *echo.Context) error {
+	session, err := apiSession(c)
+	if session == nil {
+		return err
+	}
+	session.Lock()
+	defer session.Unlock()
+	scores := &apiScores{TicketId: session.Ticket.Id, Tasks: []apiTaskScore{}}
+	for _, taskId := range session.Ticket.Options.TaskNames {
+		taskScore := apiTaskScore{TaskId: taskId, Finalized: session.IsFinalized(taskId)}
+		if task, ok := findTask(session.Ticket.Id, taskId); ok {
+			taskScore.Score = task.GetScore()
+		}
+		scores.Tasks = append(scores.Tasks, taskScore)
+	}
+	return c.JSON(http.StatusOK, scores)
+}
+
+// apiSolutionRequest decodes the JSON body of the solution endpoints; the
+// ticket and task always come from the URL.
+func apiSolutionRequest(c *echo.Context) (*cui.SolutionRequest, error) {
+	solnReq := &cui.SolutionRequest{}
+	if err := json.NewDecoder(c.Request().Body).Decode(solnReq); err != nil {
+		return nil, apiErrorf(c, http.StatusBadRequest, "invalid request body: %v", err)
+	}
+	solnReq.Ticket = c.Param("ticket")
+	solnReq.Task = c.Param("task")
+	if solnReq.ProgLang == "" {
+		return nil, apiErrorf(c, http.StatusBadRequest, "prg_lang is required")
+	}
+	log.Info("%s %s: %#v", c.Request().Method, c.Request().URL, solnReq)
+	return solnReq, nil
+}
+
+// apiStoreError reports why storeSolution refused a solution: unknown tasks
+// are not found, tasks that are locked or closed conflict with the ticket.
+func apiStoreError(c *echo.Context, solnReq *cui.SolutionRequest, err error) error {
+	if err == cui.ErrNoSuchTask {
+		return apiErrorf(c, http.StatusNotFound, "no task %q in ticket %q", solnReq.Task, solnReq.Ticket)
+	}
+	return apiErrorf(c, http.StatusConflict, "%v", err)
+}
+
+func apiSaveSolution(c *echo.Context) error {
+	solnReq, err := apiSolutionRequest(c)
+	if solnReq == nil {
+		return err
+	}
+	if _, err := storeSolution(solnReq); err != nil {
+		return apiStoreError(c, solnReq, err)
+	}
+	return c.JSON(http.StatusOK, map[string]string{"result": "OK"})
+}
+
+func apiVerify(mode cui.Mode) echo.HandlerFunc {
+	return func(c *echo.Context) error {
+		solnReq, err := apiSolutionRequest(c)
+		if solnReq == nil {
+			return err
+		}
+		task, err := storeSolution(solnReq)
+		if err != nil {
+			return apiStoreError(c, solnReq, err)
+		}
+		if status, msg := checkDraft(c, solnReq.Ticket); status != 0 {
+			return apiErrorf(c, status, "%s", msg)
+		}
+		resp := verifyStatus(task, solnReq, mode)
+		if mode == cui.FINAL {
+			finalizeTask(solnReq.Ticket, solnReq.Task, resp)
+		}
+		return c.JSON(http.StatusOK, resp)
+	}
+}
+
+func apiDraftSession(c *echo.Context) (*cui.Session, error) {
+	session, err := apiSession(c)
+	if session == nil {
+		return nil, err
+	}
+	if session.Ticket.Draft == nil {
+		return nil, apiErrorf(c, http.StatusNotFound, "ticket %q is not a draft", session.Ticket.Id)
+	}
+	return session, nil
+}
+
+func apiCreateDraft(c *echo.Context) error {
+	draftReq := &apiDraftRequest{}
+	if err := json.NewDecoder(c.Request().Body).Decode(draftReq); err != nil {
+		return apiErrorf(c, http.StatusBadRequest, "invalid request body: %v", err)
+	}
+	ticket, err := newDraft(draftReq.ProblemId, draftReq.Title, draftReq.From, draftReq.QueryLimit)
+	if err != nil {
+		return apiErrorf(c, http.StatusBadRequest, "%v", err)
+	}
+	session, _ := lookupSession(ticket.Id)
+	return c.JSON(http.StatusCreated, newApiTicket(session))
+}
+
+func newApiValidation(ticket *cui.Ticket, report *judge.Report, err error) *apiValidation {
+	v := &apiValidation{ProblemId: ticket.Draft.ProblemId}
+	if report != nil {
+		v.OK, v.Tests, v.Message = report.OK(), report.Tests, report.String()
+	}
+	if err != nil {
+		v.OK, v.Message = false, err.Error()
+	}
+	return v
+}
+
+// apiSeed reads the optional seed query parameter used to replay the
+// generated tests of an earlier report.
+func apiSeed(c *echo.Context) (int64, error) {
+	if c.Query("seed") == "" {
+		return 0, nil
+	}
+	seed, err := strconv.ParseInt(c.Query("seed"), 10, 64)
+	if err != nil {
+		return 0, apiErrorf(c, http.StatusBadRequest, "seed: %v", err)
+	}
+	return seed, nil
+}
+
+func apiValidateDraft(c *echo.Context) error {
+	session, err := apiDraftSession(c)
+	if session == nil {
+		return err
+	}
+	seed, err := apiSeed(c)
+	if err != nil {
+		return err
+	}
+	_, report, err := cui.ValidateDraft(judge.CodeRunner(runner), local.Interact, ticketTasks(session.Ticket.Id), session.Ticket, seed)
+	return c.JSON(http.StatusOK, newApiValidation(session.Ticket, report, err))
+}
+
+func apiPublishDraft(c *echo.Context) error {
+	session, err := apiDraftSession(c)
+	if session == nil {
+		return err
+	}
+	p, report, err := publishDraft(session.Ticket)
+	v := newApiValidation(session.Ticket, report, err)
+	if p == nil {
+		return c.JSON(http.StatusUnprocessableEntity, v)
+	}
+	v.Version = p.Version
+	return c.JSON(http.StatusCreated, v)
+}
+
+func apiListProblems(c *echo.Context) error {
+	manifests, err := bank.List()
+	if err != nil {
+		return apiErrorf(c, http.StatusInternalServerError, "%v", err)
+	}
+	problems := []*apiProblem{}
+	for _, m := range manifests {
+		problems = append(problems, &apiProblem{Id: m.Id, Title: m.Title, Version: m.Version})
+	}
+	return c.JSON(http.StatusOK, problems)
+}
+
+func apiGetProblem(c *echo.Context) error {
+	id, version, err := problem.ParseRef(c.Param("problem"))
+	if err != nil {
+		return apiErrorf(c, http.StatusBadRequest, "%v", err)
+	}
+	versions, err := bank.Versions(id)
+	if err != nil || len(versions) == 0 {
+		return apiErrorf(c, http.StatusNotFound, "no problem %q", c.Param("problem"))
+	}
+	p, err := bank.Get(id, version)
+	if err != nil {
+		return apiErrorf(c, http.StatusNotFound, "%v", err)
+	}
+	return c.JSON(http.StatusOK, &apiProblem{Id: p.Id, Title: p.Title, Version: p.Version, Versions: versions, Statement: p.Statement})
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"github.com/gorilla/schema"
+	"github.com/labstack/echo"
+	"github.com/maddyonline/goonj/config"
+	"github.com/maddyonline/goonj/cui"
+	"github.com/maddyonline/goonj/judge"
+	"github.com/maddyonline/goonj/problem"
+	"github.com/maddyonline/goonj/similarity"
+	"github.com/maddyonline/goonj/submission"
+	"github.com/maddyonline/goonj/webhook"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+type openapiSpec struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+func loadSpec(t *testing.T) *openapiSpec {
+	spec := &openapiSpec{}
+	if err := json.Unmarshal(openapiDoc, spec); err != nil {
+		t.Fatalf("openapi.json: %v", err)
+	}
+	return spec
+}
+
+// openapiPath turns an echo route like /tickets/:ticket into /tickets/{ticket}.
+func openapiPath(route string) string {
+	parts := strings.Split(route, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") {
+			parts[i] = "{" + part[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	spec := loadSpec(t)
+	documented := map[string]bool{}
+	for path, ops := range spec.Paths {
+		for method := range ops {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+	for _, route := range apiRoutes {
+		key := route.Method + " " + openapiPath(route.Path)
+		if !documented[key] {
+			t.Errorf("route %s is not documented in openapi.json", key)
+		}
+		delete(documented, key)
+	}
+	for key := range documented {
+		t.Errorf("openapi.json documents %s which has no handler", key)
+	}
+}
+
+func jsonFields(v interface{}) []string {
+	fields := []string{}
+	typ := reflect.TypeOf(v)
+	for i := 0; i < typ.NumField(); i++ {
+		name := strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func TestOpenAPISchemasMatchTypes(t *testing.T) {
+	spec := loadSpec(t)
+	types := map[string]interface{}{
+		"Task":               cui.Task{},
+		"SolutionRequest":    cui.SolutionRequest{},
+		"ClockResponse":      cui.ClockResponse{},
+		"Status":             cui.Status{},
+		"MainStatus":         cui.MainStatus{},
+		"Annotation":         cui.Annotation{},
+		"VerifyStatus":       cui.VerifyStatus{},
+		"Options":            cui.Options{},
+		"ObserverLink":       apiObserverLink{},
+		"Chat":               apiChat{},
+		"ChatMessage":        cui.ChatMessage{},
+		"ChatRequest":        apiChatRequest{},
+		"SimilarityReport":   apiSimilarityReport{},
+		"EventRequest":       apiEventRequest{},
+		"IntegrityEvent":     cui.IntegrityEvent{},
+		"IntegritySummary":   cui.IntegritySummary{},
+		"Integrity":          apiIntegrity{},
+		"SimilarPair":        apiSimilarPair{},
+		"SimilarSource":      apiSimilarSource{},
+		"SimilarMatch":       similarity.Match{},
+		"LineRegion":         similarity.Region{},
+		"Ticket":             apiTicket{},
+		"TicketRequest":      apiTicketRequest{},
+		"Draft":              cui.Draft{},
+		"DraftRequest":       apiDraftRequest{},
+		"Validation":         apiValidation{},
+		"Problem":            apiProblem{},
+		"Group":              problem.Group{},
+		"Scores":             apiScores{},
+		"TaskScore":          apiTaskScore{},
+		"Score":              judge.Score{},
+		"GroupScore":         judge.GroupScore{},
+		"TestResult":         judge.TestResult{},
+		"Verdict":            submission.Verdict{},
+		"Submission":         submission.Submission{},
+		"RejudgeRequest":     apiRejudgeRequest{},
+		"RejudgeResult":      submission.Result{},
+		"RejudgeJob":         submission.Job{},
+		"ClockChange":        cui.ClockChange{},
+		"ClockChangeRequest": apiClockChange{},
+		"ClockState":         apiClockState{},
+		"Delivery":           webhook.Delivery{},
+		"Error":              apiError{},
+	}
+	for name, v := range types {
+		schema, ok := spec.Components.Schemas[name]
+		if !ok {
+			t.Errorf("schema %s missing from openapi.json", name)
+			continue
+		}
+		documented := []string{}
+		for prop := range schema.Properties {
+			documented = append(documented, prop)
+		}
+		sort.Strings(documented)
+		if want := jsonFields(v); !reflect.DeepEqual(documented, want) {
+			t.Errorf("schema %s has properties %v, type encodes %v", name, documented, want)
+		}
+	}
+}
+
+// newTestServer serves the XML and JSON handlers from a fresh work
+// directory, with a ticket of the default task.
+func newTestServer(t *testing.T) (*echo.Echo, *cui.Ticket, string) {
+	dir, err := ioutil.TempDir("", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	Cfg, TMP_DIR = config.Default(), dir
+	schemaDecoder = schema.NewDecoder()
+	tasks, cuiSessions = map[cui.TaskKey]*cui.Task{}, map[string]*cui.Session{}
+	submissions = submission.NewStore(dir)
+	deliveries, _ := webhook.NewDeliveryLog("")
+	webhooks = webhook.NewDispatcher(nil, deliveries)
+	if local, err = judge.NewLocal(filepath.Join(dir, "run")); err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	addCuiHandlers(e)
+	addApiHandlers(e)
+	ticket, err := newTicket(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registerTicket(ticket, &UserContext{})
+	return e, ticket, dir
+}
+
+// postForm posts form to path as the CUI does.
+func postForm(e *echo.Echo, path string, form url.Values) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+// callAPI sends body, if any, as JSON to the API.
+func callAPI(e *echo.Echo, method, path string, body interface{}) *httptest.ResponseRecorder {
+	content := ""
+	if body != nil {
+		encoded, _ := json.Marshal(body)
+		content = string(encoded)
+	}
+	req, _ := http.NewRequest(method, API_PREFIX+path, strings.NewReader(content))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+// decodeBoth decodes the XML and the JSON response into fresh values of
+// the type of v and checks that they are the same.
+func decodeBoth(t *testing.T, what string, xmlRec, jsonRec *httptest.ResponseRecorder, v interface{}) {
+	if xmlRec.Code != http.StatusOK || jsonRec.Code != http.StatusOK {
+		t.Fatalf("%s: expected 200 from both, got %d (XML) and %d (JSON): %s %s", what, xmlRec.Code, jsonRec.Code, xmlRec.Body, jsonRec.Body)
+	}
+	typ := reflect.TypeOf(v).Elem()
+	fromXML, fromJSON := reflect.New(typ).Interface(), reflect.New(typ).Interface()
+	if err := xml.Unmarshal(xmlRec.Body.Bytes(), fromXML); err != nil {
+		t.Fatalf("%s: XML: %v", what, err)
+	}
+	if err := json.Unmarshal(jsonRec.Body.Bytes(), fromJSON); err != nil {
+		t.Fatalf("%s: JSON: %v", what, err)
+	}
+	// Only the XML encoding names its root element.
+	if field := reflect.ValueOf(fromXML).Elem().FieldByName("XMLName"); field.IsValid() {
+		field.Set(reflect.Zero(field.Type()))
+	}
+	if !reflect.DeepEqual(fromXML, fromJSON) {
+		t.Errorf("%s: the encodings differ:\nXML:  %+v\nJSON: %+v", what, fromXML, fromJSON)
+	}
+}
+
+func TestXMLAndJSONHandlersAgree(t *testing.T) {
+	e, ticket, dir := newTestServer(t)
+	defer os.RemoveAll(dir)
+	taskId := ticket.Options.TaskNames[0]
+	form := url.Values{"ticket": {ticket.Id}, "task": {taskId}}
+
+	xmlRec := postForm(e, "/c/_get_task", url.Values{"ticket": {ticket.Id}, "task": {taskId}, "human_lang": {"en"}})
+	jsonRec := callAPI(e, "GET", "/tickets/"+ticket.Id+"/tasks/"+taskId+"?human_lang=en", nil)
+	decodeBoth(t, "task", xmlRec, jsonRec, &cui.Task{})
+
+	if rec := postForm(e, "/c/_start", form); rec.Code != http.StatusOK {
+		t.Errorf("expected /c/_start to start the ticket, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := callAPI(e, "POST", "/tickets/"+ticket.Id+"/start", nil); rec.Code != http.StatusOK {
+		t.Errorf("expected starting again to succeed, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// A paused clock reads the same from both.
+	session, _ := lookupSession(ticket.Id)
+	if err := session.ChangeClock(time.Now(), "test", cui.CLOCK_PAUSE, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	xmlRec = postForm(e, "/chk/clock", url.Values{"ticket": {ticket.Id}, "old_timelimit": {"3600"}})
+	jsonRec = callAPI(e, "GET", "/tickets/"+ticket.Id+"/clock?old_timelimit=3600", nil)
+	decodeBoth(t, "clock", xmlRec, jsonRec, &cui.ClockResponse{})
+
+	if _, err := exec.LookPath("g++"); err == nil {
+		// Solutions that do not compile are not run, which needs no runner.
+		solution := "int main() {\n    return y;\n}\n"
+		xmlRec = postForm(e, "/chk/verify", url.Values{"ticket": {ticket.Id}, "task": {taskId}, "prg_lang": {"cpp"}, "solution": {solution}})
+		jsonRec = callAPI(e, "POST", "/tickets/"+ticket.Id+"/tasks/"+taskId+"/run", &cui.SolutionRequest{ProgLang: "cpp", Solution: solution})
+		decodeBoth(t, "verify", xmlRec, jsonRec, &cui.VerifyStatus{})
+	}
+
+	closeSession(ticket.Id, webhook.TicketClosed)
+	solution := url.Values{"ticket": {ticket.Id}, "task": {taskId}, "prg_lang": {"cpp"}, "solution": {"int main() {}\n"}}
+	if rec := postForm(e, "/chk/save", solution); rec.Code != http.StatusForbidden {
+		t.Errorf("expected /chk/save to refuse a closed ticket, got %d", rec.Code)
+	}
+	jsonRec = callAPI(e, "PUT", "/tickets/"+ticket.Id+"/tasks/"+taskId+"/solution", &cui.SolutionRequest{ProgLang: "cpp", Solution: "int main() {}\n"})
+	if jsonRec.Code != http.StatusConflict {
+		t.Errorf("expected the API to refuse a closed ticket, got %d", jsonRec.Code)
+	}
+	xmlRec = postForm(e, "/chk/verify", solution)
+	status, apiErr := &cui.VerifyStatus{}, &apiError{}
+	xml.Unmarshal(xmlRec.Body.Bytes(), status)
+	json.Unmarshal(jsonRec.Body.Bytes(), apiErr)
+	if status.Result != "ERROR" || status.Message != cui.ErrTicketClosed.Error() || apiErr.Error != status.Message {
+		t.Errorf("expected both to report %q, got %+v and %+v", cui.ErrTicketClosed, status, apiErr)
+	}
+}
+
+func TestUnknownTicket(t *testing.T) {
+	e, ticket, dir := newTestServer(t)
+	defer os.RemoveAll(dir)
+	for _, path := range []string{"/tickets/nope", "/tickets/nope/clock", "/tickets/nope/tasks/task1", "/tickets/" + ticket.Id + "/tasks/nope"} {
+		rec := callAPI(e, "GET", path, nil)
+		apiErr := &apiError{}
+		if err := json.Unmarshal(rec.Body.Bytes(), apiErr); rec.Code != http.StatusNotFound || err != nil || apiErr.Error == "" {
+			t.Errorf("GET %s: expected a 404 error, got %d: %s", path, rec.Code, rec.Body)
+		}
+	}
+	if rec := postForm(e, "/c/_start", url.Values{"ticket": {"nope"}}); rec.Code == http.StatusOK {
+		t.Errorf("expected /c/_start to refuse an unknown ticket, got %d", rec.Code)
+	}
+	for _, form := range []url.Values{{"ticket": {"nope"}, "task": {"task1"}}, {"ticket": {ticket.Id}, "task": {"nope"}}} {
+		if rec := postForm(e, "/c/_get_task", form); rec.Code != http.StatusNotFound {
+			t.Errorf("expected /c/_get_task to refuse %v, got %d", form, rec.Code)
+		}
+	}
+	if n := len(tasks); n != len(ticket.Options.TaskNames) {
+		t.Errorf("expected only the tasks of the ticket, got %d", n)
+	}
+}
+
+func TestCreateTicketWithOrganisation(t *testing.T) {
+	e, _, dir := newTestServer(t)
+	defer os.RemoveAll(dir)
+	Cfg.Admin.Token = "secret"
+	create := func(auth string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", API_PREFIX+"/tickets", strings.NewReader(`{"organisation": "acme"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if auth != "" {
+			req.Header.Set("Authorization", "Bearer "+auth)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := create(""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected an organisation to require the admin token, got %d: %s", rec.Code, rec.Body)
+	}
+	rec := create("secret")
+	created := &apiTicket{}
+	if err := json.Unmarshal(rec.Body.Bytes(), created); rec.Code != http.StatusCreated || err != nil || created.Organisation != "acme" {
+		t.Errorf("expected a ticket of acme, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := callAPI(e, "POST", "/tickets", nil); rec.Code != http.StatusCreated {
+		t.Errorf("expected anonymous tickets without the token, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestDraftsNeedAdminToken(t *testing.T) {
+	e, _, dir := newTestServer(t)
+	defer os.RemoveAll(dir)
+	Cfg.Admin.Token = "secret"
+	ticket, err := newDraft("palindrome", "Palindrome", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	taskId := ticket.Options.TaskNames[0]
+	form := url.Values{"ticket": {ticket.Id}, "task": {taskId}, "prg_lang": {"c"}, "solution": {"int main() {}\n"}}
+	for _, path := range []string{"/chk/verify", "/chk/judge", "/chk/final"} {
+		resp := &cui.VerifyStatus{}
+		rec := postForm(e, path, form)
+		if err := xml.Unmarshal(rec.Body.Bytes(), resp); err != nil || resp.Result != "ERROR" {
+			t.Errorf("%s: expected a draft to be refused, got %d: %s", path, rec.Code, rec.Body)
+		}
+	}
+	for _, action := range []string{"run", "judge", "final"} {
+		path := "/tickets/" + ticket.Id + "/tasks/" + taskId + "/" + action
+		if rec := callAPI(e, "POST", path, map[string]string{"prg_lang": "c", "solution": "int main() {}\n"}); rec.Code != http.StatusUnauthorized {
+			t.Errorf("POST %s: expected a draft to need the admin token, got %d: %s", path, rec.Code, rec.Body)
+		}
+	}
+	if session, _ := lookupSession(ticket.Id); session.Closed || len(session.Finalized) != 0 {
+		t.Errorf("expected the draft to stay open, got %+v", session)
+	}
+}
+
+func TestListWebhookDeliveries(t *testing.T) {
+	e, _, dir := newTestServer(t)
+	defer os.RemoveAll(dir)
+	Cfg.Admin.Token = "secret"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	webhooks = webhook.NewDispatcher([]webhook.Endpoint{{URL: server.URL}}, webhooks.Log)
+	ticket, err := newTicket(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registerTicket(ticket, &UserContext{})
+	webhooks.Wait()
+
+	req, _ := http.NewRequest("GET", API_PREFIX+"/admin/webhooks?ticket="+ticket.Id, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	deliveries := []*webhook.Delivery{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &deliveries); rec.Code != http.StatusOK || err != nil {
+		t.Fatalf("expected the deliveries, got %d: %s", rec.Code, rec.Body)
+	}
+	if len(deliveries) != 1 || deliveries[0].EventType != webhook.TicketCreated || !deliveries[0].Delivered {
+		t.Errorf("expected the delivery of %s, got %s", webhook.TicketCreated, rec.Body)
+	}
+	if rec := callAPI(e, "GET", "/admin/webhooks", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected the deliveries to need the admin token, got %d", rec.Code)
+	}
+}
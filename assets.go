@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"github.com/labstack/echo"
+	"html/template"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The CUI assets and templates and the client-app are compiled into the
+// binary so that it runs outside a source checkout.
+//
+//go:embed static_cui/cui/static/cui static_cui/cui/templates client-app
+var embeddedAssets embed.FS
+
+const (
+	cuiStaticDir    = "static_cui/cui/static/cui"
+	cuiTemplatesDir = "static_cui/cui/templates"
+	clientAppDir    = "client-app"
+)
+
+// Assets serves static files and templates either from the embedded copy or,
+// for development, straight from a directory laid out like the repository.
+type Assets struct {
+	fs  fs.FS
+	dev bool
+
+	mu     sync.Mutex
+	hashes map[string]string
+}
+
+// NewAssets returns the embedded assets when root is empty and the files
+// under root otherwise.
+func NewAssets(root string) (*Assets, error) {
+	if root == "" {
+		return &Assets{fs: embeddedAssets, hashes: map[string]string{}}, nil
+	}
+	if _, err := os.Stat(filepath.Join(root, cuiStaticDir)); err != nil {
+		return nil, fmt.Errorf("assets: %s does not look like a goonj checkout: %v", root, err)
+	}
+	return &Assets{fs: os.DirFS(root), dev: true, hashes: map[string]string{}}, nil
+}
+
+// Hash returns a short content hash of the named file, or "" if it cannot
+// be read. Hashes of embedded files are computed once.
+func (a *Assets) Hash(name string) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if h, ok := a.hashes[name]; ok && !a.dev {
+		return h
+	}
+	content, err := fs.ReadFile(a.fs, name)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(content)
+	h := hex.EncodeToString(sum[:])[:12]
+	a.hashes[name] = h
+	return h
+}
+
+// StaticURL returns the URL of a CUI static file with its content hash
+// appended, so that browsers can cache it for as long as it is unchanged.
+func (a *Assets) StaticURL(name string) string {
+	url := "/static/cui/" + name
+	if h := a.Hash(path.Join(cuiStaticDir, name)); h != "" {
+		url += "?v=" + h
+	}
+	return url
+}
+
+func (a *Assets) LoadTemplates() (*Template, error) {
+	funcs := template.FuncMap{"static": a.StaticURL}
+	t, err := template.New("cui").Funcs(funcs).ParseFS(a.fs, path.Join(cuiTemplatesDir, "*.html"))
+	if err != nil {
+		return nil, err
+	}
+	return &Template{templates: t}, nil
+}
+
+// ServeFile writes the named file with an ETag derived from its content.
+// Requests carrying the current hash in ?v= are cached for a year, all
+// others must revalidate.
+func (a *Assets) ServeFile(w http.ResponseWriter, r *http.Request, name string) error {
+	f, err := a.fs.Open(name)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		read, err := ioutil.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		content = bytes.NewReader(read)
+	}
+	hash := a.Hash(name)
+	w.Header().Set("ETag", fmt.Sprintf(`"%s"`, hash))
+	if v := r.URL.Query().Get("v"); v != "" && v == hash && !a.dev {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	modTime := info.ModTime()
+	if !a.dev {
+		modTime = time.Time{}
+	}
+	http.ServeContent(w, r, info.Name(), modTime, content)
+	return nil
+}
+
+// Handler serves the files under dir at the URL prefix.
+func (a *Assets) Handler(prefix, dir string) echo.HandlerFunc {
+	return func(c *echo.Context) error {
+		name := strings.TrimPrefix(c.Request().URL.Path, prefix)
+		name = path.Clean("/" + name)[1:]
+		if name == "" {
+			return echo.NewHTTPError(http.StatusNotFound)
+		}
+		return a.ServeFile(c.Response(), c.Request(), path.Join(dir, name))
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/labstack/echo"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+func TestAssets(t *testing.T) {
+	const name = "css/cui_css.css"
+	embedded, err := NewAssets("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(cuiStaticDir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	embeddedHash := contentHash(content)
+
+	root, err := ioutil.TempDir("", "assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	file := filepath.Join(root, cuiStaticDir, name)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, []byte("body {}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	override, err := NewAssets(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	overrideHash := contentHash([]byte("body {}"))
+
+	if url := embedded.StaticURL(name); url != "/static/cui/"+name+"?v="+embeddedHash {
+		t.Errorf("expected the embedded file's hash in its URL, got %s", url)
+	}
+	if url := override.StaticURL(name); url != "/static/cui/"+name+"?v="+overrideHash {
+		t.Errorf("expected the override's hash in its URL, got %s", url)
+	}
+	if url := embedded.StaticURL("css/missing.css"); url != "/static/cui/css/missing.css" {
+		t.Errorf("expected no hash for a missing file, got %s", url)
+	}
+
+	for _, tc := range []struct {
+		desc        string
+		assets      *Assets
+		path        string
+		ifNoneMatch string
+		code        int
+		etag        string
+		cache       string
+		body        string
+	}{
+		{"embedded", embedded, name, "", http.StatusOK, embeddedHash, "no-cache", string(content)},
+		{"embedded, current hash", embedded, name + "?v=" + embeddedHash, "", http.StatusOK, embeddedHash, "public, max-age=31536000, immutable", string(content)},
+		{"embedded, stale hash", embedded, name + "?v=0123456789ab", "", http.StatusOK, embeddedHash, "no-cache", string(content)},
+		{"embedded, revalidated", embedded, name, `"` + embeddedHash + `"`, http.StatusNotModified, embeddedHash, "no-cache", ""},
+		{"embedded, changed", embedded, name, `"` + overrideHash + `"`, http.StatusOK, embeddedHash, "no-cache", string(content)},
+		{"override", override, name, "", http.StatusOK, overrideHash, "no-cache", "body {}"},
+		{"override, current hash", override, name + "?v=" + overrideHash, "", http.StatusOK, overrideHash, "no-cache", "body {}"},
+		{"override, revalidated", override, name, `"` + overrideHash + `"`, http.StatusNotModified, overrideHash, "no-cache", ""},
+		{"missing", embedded, "css/missing.css", "", http.StatusNotFound, "", "", ""},
+		{"directory", embedded, "css", "", http.StatusNotFound, "", "", ""},
+	} {
+		e := echo.New()
+		e.Get("/static/cui/*", tc.assets.Handler("/static/cui/", cuiStaticDir))
+		req, _ := http.NewRequest("GET", "/static/cui/"+tc.path, nil)
+		if tc.ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", tc.ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != tc.code {
+			t.Errorf("%s: expected %d, got %d", tc.desc, tc.code, rec.Code)
+			continue
+		}
+		if tc.code == http.StatusNotFound {
+			continue
+		}
+		if etag := rec.Header().Get("ETag"); etag != `"`+tc.etag+`"` {
+			t.Errorf("%s: expected ETag %q, got %q", tc.desc, tc.etag, etag)
+		}
+		if cache := rec.Header().Get("Cache-Control"); cache != tc.cache {
+			t.Errorf("%s: expected Cache-Control %q, got %q", tc.desc, tc.cache, cache)
+		}
+		if tc.code == http.StatusOK && rec.Body.String() != tc.body {
+			t.Errorf("%s: expected %d bytes, got %d", tc.desc, len(tc.body), rec.Body.Len())
+		}
+	}
+
+	// Overrides are read again as they are edited.
+	if err := ioutil.WriteFile(file, []byte("body { margin: 0 }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if h := override.Hash(filepath.ToSlash(filepath.Join(cuiStaticDir, name))); h != contentHash([]byte("body { margin: 0 }")) {
+		t.Errorf("expected the hash of the edited file, got %s", h)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"github.com/maddyonline/goonj/cui"
+	"github.com/maddyonline/goonj/judge"
+	"github.com/maddyonline/goonj/problem"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var bank *problem.Bank
+
+// lookupProblems loads problem references like "palindrome" or
+// "palindrome@2" from b.
+func lookupProblems(b *problem.Bank, refs []string) ([]*problem.Problem, error) {
+	problems := []*problem.Problem{}
+	seen := map[string]bool{}
+	for _, ref := range refs {
+		p, err := b.Lookup(ref)
+		if err != nil {
+			return nil, err
+		}
+		if seen[p.Id] {
+			return nil, fmt.Errorf("problem %s is listed twice", p.Id)
+		}
+		seen[p.Id] = true
+		problems = append(problems, p)
+	}
+	return problems, nil
+}
+
+// newTicket creates a ticket of the problems named by refs, or of the
+// default task without any.
+func newTicket(refs []string) (*cui.Ticket, error) {
+	if len(refs) == 0 {
+		tasksMu.Lock()
+		defer tasksMu.Unlock()
+		return cui.NewTicket(tasks, nil), nil
+	}
+	problems, err := lookupProblems(bank, refs)
+	if err == nil {
+		err = checkInteractive(Cfg, problems)
+	}
+	if err != nil {
+		return nil, err
+	}
+	tasksMu.Lock()
+	defer tasksMu.Unlock()
+	return cui.NewProblemTicket(tasks, problems, nil), nil
+}
+
+// newDraft opens a draft ticket for problem id. A draft starts from the
+// published version named by from, if any, and from the template
+// otherwise. Drafts of a published problem keep its id unless id is set.
+// A queryLimit other than 0 replaces that of the problem.
+func newDraft(id, title, from string, queryLimit int) (*cui.Ticket, error) {
+	p := cui.DraftTemplate(id, title)
+	if from != "" {
+		published, err := bank.Lookup(from)
+		if err != nil {
+			return nil, err
+		}
+		p = published
+		if id != "" && id != p.Id {
+			p.Id, p.Version = id, 0
+		}
+		if title != "" {
+			p.Title = title
+		}
+	}
+	if p.Id == "" {
+		return nil, fmt.Errorf("a problem id is required")
+	}
+	if queryLimit < 0 {
+		return nil, fmt.Errorf("the query limit must not be negative")
+	}
+	if queryLimit != 0 {
+		p.QueryLimit = queryLimit
+	}
+	tasksMu.Lock()
+	ticket := cui.NewDraftTicket(tasks, p, nil)
+	tasksMu.Unlock()
+	registerTicket(ticket, &UserContext{})
+	return ticket, nil
+}
+
+// publishDraft cross-validates the draft of ticket and, if it passes,
+// publishes it as the next version of its problem.
+func publishDraft(ticket *cui.Ticket) (*problem.Problem, *judge.Report, error) {
+	p, report, err := cui.ValidateDraft(judge.CodeRunner(runner), local.Interact, ticketTasks(ticket.Id), ticket, 0)
+	if err != nil || !report.OK() {
+		return nil, report, err
+	}
+	if _, err := bank.Publish(p); err != nil {
+		return nil, report, err
+	}
+	if session, ok := lookupSession(ticket.Id); ok {
+		session.Lock()
+		defer session.Unlock()
+	}
+	ticket.Draft.BaseVersion = p.Version
+	log.Info("Published problem %s version %d from draft %s", p.Id, p.Version, ticket.Id)
+	return p, report, nil
+}
+
+// checkDraft refuses to run the programs of a draft ticket, or to publish
+// it, unless c carries the admin token, like checkAdmin.
+func checkDraft(c *echo.Context, ticketId string) (int, string) {
+	session, ok := lookupSession(ticketId)
+	if !ok || session.Ticket.Draft == nil {
+		return 0, ""
+	}
+	if status, msg := checkAdmin(c); status != 0 {
+		return status, "draft: " + msg
+	}
+	return 0, ""
+}
+
+// verifyStatus runs or judges a solution. Final submissions of a draft
+// publish it instead of closing the task. Solutions of interactive problems
+// run locally, next to their interactor.
+func verifyStatus(task *cui.Task, solnReq *cui.SolutionRequest, mode cui.Mode) *cui.VerifyStatus {
+	if task == nil {
+		return cui.GetVerifyStatus(runner, local.CompileOnly, task, solnReq, mode)
+	}
+	if task.Problem != nil && task.Problem.Interactive() {
+		return cui.InteractiveVerifyStatus(local.Interact, local.CompileOnly, judge.CodeRunner(runner), task, solnReq, mode)
+	}
+	session, ok := lookupSession(solnReq.Ticket)
+	if !ok || session.Ticket.Draft == nil {
+		return cui.GetVerifyStatus(runner, local.CompileOnly, task, solnReq, mode)
+	}
+	if mode != cui.FINAL {
+		return cui.DraftVerifyStatus(judge.CodeRunner(runner), local.Interact, ticketTasks(session.Ticket.Id), session.Ticket, task, solnReq, mode)
+	}
+	p, report, err := publishDraft(session.Ticket)
+	if report != nil && report.OK() && err != nil {
+		// Cross-validation passed but the bank refused the problem.
+		return cui.ErrorStatus(err)
+	}
+	resp := cui.DraftReportStatus(report, err)
+	if p != nil {
+		resp.Extra.Example.Message += fmt.Sprintf("\nPublished %s version %d.", p.Id, p.Version)
+	}
+	return resp
+}
+
+func addAuthoringHandlers(e *echo.Echo) {
+	// Drafts run any program and publish to the bank, so only admins may
+	// open them.
+	e.Get("/cui/draft", apiAdmin(func(c *echo.Context) error {
+		queryLimit := 0
+		if s := c.Query("query_limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "query_limit must be a number")
+			}
+			queryLimit = n
+		}
+		ticket, err := newDraft(c.Query("id"), c.Query("title"), c.Query("from"), queryLimit)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return c.JSON(http.StatusOK, map[string]string{"ticket_id": ticket.Id})
+	}))
+}
+
+// splitRefs splits a comma separated list of problem references.
+func splitRefs(s string) []string {
+	refs := []string{}
+	for _, ref := range strings.Split(s, ",") {
+		if ref = strings.TrimSpace(ref); ref != "" {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
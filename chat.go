@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/labstack/echo"
+	"github.com/maddyonline/goonj/cui"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// CHAT_POLL_TIMEOUT is how long a poll for new chat messages waits before
+// returning empty; clients poll again right away.
+const CHAT_POLL_TIMEOUT = 25 * time.Second
+
+// chatBoard guards the chat transcripts of the sessions and wakes up the
+// polls waiting on a ticket when a message is posted.
+type chatBoard struct {
+	mu      sync.Mutex
+	updated map[string]chan struct{}
+}
+
+var chats = &chatBoard{updated: map[string]chan struct{}{}}
+
+func (b *chatBoard) post(session *cui.Session, from, author, text string) (*cui.ChatMessage, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	session.Lock()
+	defer session.Unlock()
+	msg, err := session.PostChat(time.Now(), from, author, text)
+	if err != nil {
+		return nil, err
+	}
+	saveSession(session)
+	if ch, ok := b.updated[session.Ticket.Id]; ok {
+		close(ch)
+		delete(b.updated, session.Ticket.Id)
+	}
+	return msg, nil
+}
+
+// since returns the messages after seq and a channel closed when the next
+// message arrives.
+func (b *chatBoard) since(session *cui.Session, seq int) ([]cui.ChatMessage, <-chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch, ok := b.updated[session.Ticket.Id]
+	if !ok {
+		ch = make(chan struct{})
+		b.updated[session.Ticket.Id] = ch
+	}
+	session.Lock()
+	defer session.Unlock()
+	return session.ChatSince(seq), ch
+}
+
+// wait returns the messages after seq, waiting up to timeout for one.
+func (b *chatBoard) wait(session *cui.Session, seq int, timeout time.Duration) []cui.ChatMessage {
+	msgs, updated := b.since(session, seq)
+	if len(msgs) > 0 || timeout <= 0 {
+		return msgs
+	}
+	select {
+	case <-updated:
+	case <-time.After(timeout):
+	}
+	msgs, _ = b.since(session, seq)
+	return msgs
+}
+
+// apiChat is the chat transcript of a ticket after the message a client
+// already has.
+type apiChat struct {
+	TicketId string            `json:"ticket_id"`
+	Closed   bool              `json:"closed"`
+	Messages []cui.ChatMessage `json:"messages"`
+}
+
+type apiChatRequest struct {
+	Author string `json:"author"`
+	Text   string `json:"text"`
+}
+
+func chatStatus(err error) int {
+	if err == cui.ErrTicketClosed || err == cui.ErrChatFull {
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+func getChat(c *echo.Context, session *cui.Session, timeout time.Duration) error {
+	after, _ := strconv.Atoi(c.Query("after"))
+	msgs := chats.wait(session, after, timeout)
+	return c.JSON(http.StatusOK, &apiChat{TicketId: session.Ticket.Id, Closed: session.Closed, Messages: msgs})
+}
+
+// apiGetChat returns the transcript of a ticket. With ?wait=SECONDS it
+// waits for a message after ?after= like the CUI does.
+func apiGetChat(c *echo.Context) error {
+	session, err := apiSession(c)
+	if session == nil {
+		return err
+	}
+	wait, _ := strconv.Atoi(c.Query("wait"))
+	timeout := time.Duration(wait) * time.Second
+	if timeout > CHAT_POLL_TIMEOUT {
+		timeout = CHAT_POLL_TIMEOUT
+	}
+	return getChat(c, session, timeout)
+}
+
+// apiPostChat writes to the candidate of a ticket as the named interviewer.
+func apiPostChat(c *echo.Context) error {
+	session, err := apiSession(c)
+	if session == nil {
+		return err
+	}
+	chatReq := &apiChatRequest{}
+	if err := json.NewDecoder(c.Request().Body).Decode(chatReq); err != nil {
+		return apiErrorf(c, http.StatusBadRequest, "invalid request body: %v", err)
+	}
+	msg, err := chats.post(session, cui.CHAT_INTERVIEWER, chatReq.Author, chatReq.Text)
+	if err != nil {
+		return apiErrorf(c, chatStatus(err), "%v", err)
+	}
+	return c.JSON(http.StatusCreated, msg)
+}
+
+// addChatHandlers serves the chat of the CUI, which long-polls for the
+// messages of the interviewer.
+func addChatHandlers(e *echo.Echo) {
+	e.Get("/c/chat/:ticket", func(c *echo.Context) error {
+		session, ok := lookupSession(c.Param("ticket"))
+		if !ok {
+			return echo.NewHTTPError(http.StatusNotFound, "No valid session found")
+		}
+		return getChat(c, session, CHAT_POLL_TIMEOUT)
+	})
+	e.Post("/c/chat/:ticket", func(c *echo.Context) error {
+		session, ok := lookupSession(c.Param("ticket"))
+		if !ok {
+			return echo.NewHTTPError(http.StatusNotFound, "No valid session found")
+		}
+		msg, err := chats.post(session, cui.CHAT_CANDIDATE, "", c.Form("text"))
+		if err != nil {
+			return c.JSON(chatStatus(err), &apiError{Error: err.Error()})
+		}
+		return c.JSON(http.StatusOK, msg)
+	})
+}
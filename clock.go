@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"github.com/maddyonline/goonj/cui"
+	"net/http"
+	"time"
+)
+
+// apiClockChange is a change of the clock of a ticket made by actor, the
+// interviewer or admin the audit log names.
+type apiClockChange struct {
+	Action  string `json:"action"`
+	Seconds int    `json:"seconds,omitempty"`
+	Actor   string `json:"actor"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// apiClockState is the clock of a ticket as admins see it.
+type apiClockState struct {
+	TicketId      string            `json:"ticket_id"`
+	TimeLimit     int               `json:"time_limit_sec"`
+	Extension     int               `json:"extension_sec"`
+	TimeRemaining int               `json:"time_remaining_sec"`
+	Paused        bool              `json:"paused"`
+	Closed        bool              `json:"closed"`
+	Log           []cui.ClockChange `json:"log"`
+}
+
+// newApiClockState describes the clock of session, whose lock the caller
+// holds.
+func newApiClockState(session *cui.Session) *apiClockState {
+	changes := append([]cui.ClockChange{}, session.ClockLog...)
+	if changes == nil {
+		changes = []cui.ClockChange{}
+	}
+	return &apiClockState{
+		TicketId:      session.Ticket.Id,
+		TimeLimit:     session.TimeLimit,
+		Extension:     session.Extension,
+		TimeRemaining: session.Remaining(time.Now()),
+		Paused:        !session.PausedAt.IsZero(),
+		Closed:        session.Closed,
+		Log:           changes,
+	}
+}
+
+func apiGetClockState(c *echo.Context) error {
+	session, err := apiSession(c)
+	if session == nil {
+		return err
+	}
+	session.Lock()
+	defer session.Unlock()
+	return c.JSON(http.StatusOK, newApiClockState(session))
+}
+
+// apiChangeClock extends, pauses or resumes the clock of a ticket. The
+// CUI picks the new time limit up with its next clock request.
+func apiChangeClock(c *echo.Context) error {
+	session, err := apiSession(c)
+	if session == nil {
+		return err
+	}
+	change := &apiClockChange{}
+	if err := json.NewDecoder(c.Request().Body).Decode(change); err != nil {
+		return apiErrorf(c, http.StatusBadRequest, "invalid request body: %v", err)
+	}
+	session.Lock()
+	defer session.Unlock()
+	err = session.ChangeClock(time.Now(), change.Actor, change.Action, change.Seconds, change.Reason)
+	switch err {
+	case nil:
+	case cui.ErrTicketClosed, cui.ErrClockPaused, cui.ErrClockRunning, cui.ErrNotStarted:
+		return apiErrorf(c, http.StatusConflict, "%v", err)
+	default:
+		return apiErrorf(c, http.StatusBadRequest, "%v", err)
+	}
+	log.Info("Clock of ticket %s: %s %ds by %s (%s)", session.Ticket.Id, change.Action, change.Seconds, change.Actor, change.Reason)
+	saveSession(session)
+	return c.JSON(http.StatusOK, newApiClockState(session))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"github.com/maddyonline/goonj/config"
+	"github.com/maddyonline/goonj/problem"
+	"github.com/maddyonline/goonj/submission"
+	"os"
+	"strings"
+)
+
+// command is a subcommand of goonj. Commands other than serve work on the
+// work directory and problem bank of the configuration, without a running
+// server.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"serve", "run the web server, the default", serveCommand},
+		{"config", "check the configuration", configCommand},
+		{"ticket", "create, list, show and close tickets", ticketCommand},
+		{"task", "import, validate and list the problems of the bank", taskCommand},
+		{"submission", "export the final submissions", submissionCommand},
+		{"rejudge", "judge stored submissions again", rejudgeCommand},
+		{"similarity", "find similar submissions of a task", similarityCommand},
+		{"report", "write ticket reports", reportCommand},
+		{"judge", "judge a solution on a problem directory", judgeCommand},
+		{"store", "migrate the work directory", storeCommand},
+		{"help", "show this list", helpCommand},
+	}
+}
+
+// runCommand runs the command named by the first of args. Without one, or
+// when args start with flags, goonj serves as it always has.
+func runCommand(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return serveCommand(args)
+	}
+	return dispatch("goonj", commands, args)
+}
+
+// dispatch runs the command of cmds named by args[0] with the rest of args.
+func dispatch(prefix string, cmds []command, args []string) int {
+	if len(args) > 0 {
+		for _, cmd := range cmds {
+			if cmd.name == args[0] {
+				return cmd.run(args[1:])
+			}
+		}
+		fmt.Fprintf(os.Stderr, "%s: unknown command %q\n", prefix, args[0])
+	}
+	printCommands(prefix, cmds)
+	return 2
+}
+
+func printCommands(prefix string, cmds []command) {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", prefix)
+	for _, cmd := range cmds {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun %s <command> -h for the flags of a command.\n", prefix)
+}
+
+func helpCommand(args []string) int {
+	printCommands("goonj", commands)
+	return 0
+}
+
+// openLocal loads the configuration and opens the problem bank and the
+// submissions of its work directory.
+func openLocal(configFile string) (*config.Config, *problem.Bank, *submission.Store, error) {
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	bank, err := problem.NewBank(cfg.Storage.Bank())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return cfg, bank, submission.NewStore(cfg.Storage.WorkDir), nil
+}
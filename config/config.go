@@ -0,0 +1,402 @@
+// Package config holds the typed configuration of the goonj server.
+//
+// Values are resolved in this order, later sources winning: built-in
+// defaults, the TOML config file, the legacy JSON .env file, environment
+// variables and finally command line flags (applied by the caller).
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/maddyonline/goonj/utils"
+	"github.com/maddyonline/goonj/webhook"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	ENV_CONFIG_FILE      = "CUI_CONFIG"
+	ENV_PORT_NAME        = "CUI_PORT"
+	ENV_STATIC_FILES_DIR = "CUI_STATIC_FILES_DIR"
+	ENV_RUNNER_PATH      = "CUI_RUNNER_PATH"
+	ENV_WORK_DIR         = "CUI_WORK_DIR"
+	ENV_AUTH0_DOMAIN     = "CUI_AUTH0_DOMAIN"
+	ENV_AUTH0_TOKEN      = "AUTH0_TOKEN"
+	ENV_GISTS_KEY        = "THINK_GISTS_KEY"
+	ENV_TIME_LIMIT       = "CUI_TIME_LIMIT"
+	ENV_SESSION_EXPIRY   = "CUI_SESSION_EXPIRY"
+	ENV_ADMIN_TOKEN      = "CUI_ADMIN_TOKEN"
+)
+
+const DEFAULT_PORT = "3000"
+
+type ServerConfig struct {
+	Port string `toml:"port"`
+	// StaticFilesRoot, when set, serves static files and templates from a
+	// source checkout instead of the copy embedded in the binary.
+	StaticFilesRoot string `toml:"static_files_root"`
+}
+
+type StorageConfig struct {
+	WorkDir string `toml:"work_dir"`
+	// BankDir holds published problems, work_dir/bank when empty.
+	BankDir string `toml:"bank_dir"`
+}
+
+// Bank returns the directory of the problem bank.
+func (s StorageConfig) Bank() string {
+	if s.BankDir == "" {
+		return filepath.Join(s.WorkDir, "bank")
+	}
+	return s.BankDir
+}
+
+type RunnerConfig struct {
+	Path string `toml:"path"`
+}
+
+// AuthConfig controls the Auth0 backed /secured/ping login flow.
+type AuthConfig struct {
+	Enabled     bool   `toml:"enabled"`
+	Auth0Domain string `toml:"auth0_domain"`
+	Auth0Token  string `toml:"auth0_token"`
+}
+
+// ArchiveConfig controls archiving of candidate solutions as GitHub gists.
+type ArchiveConfig struct {
+	Enabled  bool   `toml:"enabled"`
+	GistsKey string `toml:"gists_key"`
+}
+
+// AdminConfig protects the admin API. Requests must carry the token as
+// "Authorization: Bearer <token>"; the admin API is off while it is empty.
+type AdminConfig struct {
+	Token string `toml:"token"`
+}
+
+type LimitsConfig struct {
+	TimeLimit     int `toml:"time_limit_sec"`
+	SessionExpiry int `toml:"session_expiry_sec"`
+}
+
+// IntegrityConfig sets when the integrity events of a session flag it for
+// review: pastes larger than max_paste_chars, more than max_pasted_chars
+// pasted in all, leaving the window more than max_blurs times or for longer
+// than max_away_sec, or opening the developer tools. Zero disables a
+// threshold.
+type IntegrityConfig struct {
+	MaxPasteChars  int  `toml:"max_paste_chars"`
+	MaxPastedChars int  `toml:"max_pasted_chars"`
+	MaxBlurs       int  `toml:"max_blurs"`
+	MaxAwaySec     int  `toml:"max_away_sec"`
+	FlagDevtools   bool `toml:"flag_devtools"`
+}
+
+// SandboxConfig confines the programs the server compiles and runs
+// itself: solutions compiled for diagnostics and the solutions and
+// interactors of interactive problems. Limits apply to each program and 0
+// disables one. Running as user and in namespaces isolates candidates'
+// code from the server; both need root on Linux, and interactive problems
+// are only served with one of them. Programs are compiled in dir, by
+// default work_dir/run, or a directory outside the work dir with a user.
+type SandboxConfig struct {
+	Dir        string `toml:"dir"`
+	User       string `toml:"user"`
+	Namespaces bool   `toml:"namespaces"`
+	MemoryMB   int    `toml:"memory_mb"`
+	MaxFileMB  int    `toml:"max_file_mb"`
+	MaxProcs   int    `toml:"max_procs"`
+}
+
+// Isolated tells whether candidates' programs are kept away from the files
+// and the network of the server, not only limited.
+func (s SandboxConfig) Isolated() bool {
+	return s.User != "" || s.Namespaces
+}
+
+// RunDir returns the directory programs are compiled in. The sandbox user
+// must not read the work dir, so it is outside of it when user is set.
+func (s SandboxConfig) RunDir(workDir string) string {
+	switch {
+	case s.Dir != "":
+		return s.Dir
+	case s.User != "":
+		return filepath.Join(os.TempDir(), "goonj-sandbox")
+	}
+	return filepath.Join(workDir, "run")
+}
+
+// WebhookConfig registers an endpoint notified of ticket lifecycle events.
+// An empty organisation receives events of all organisations and an empty
+// events list subscribes to every event.
+type WebhookConfig struct {
+	Organisation string   `toml:"organisation"`
+	URL          string   `toml:"url"`
+	Secret       string   `toml:"secret"`
+	Events       []string `toml:"events"`
+}
+
+type Config struct {
+	Server    ServerConfig    `toml:"server"`
+	Storage   StorageConfig   `toml:"storage"`
+	Runner    RunnerConfig    `toml:"runner"`
+	Auth      AuthConfig      `toml:"auth"`
+	Archive   ArchiveConfig   `toml:"archive"`
+	Limits    LimitsConfig    `toml:"limits"`
+	Admin     AdminConfig     `toml:"admin"`
+	Integrity IntegrityConfig `toml:"integrity"`
+	Sandbox   SandboxConfig   `toml:"sandbox"`
+	Webhooks  []WebhookConfig `toml:"webhooks"`
+
+	// File is the config file the values were read from, if any.
+	File string `toml:"-"`
+	// undecoded collects keys present in the file that match no field.
+	undecoded []string
+	// invalid collects environment variables whose value could not be
+	// parsed.
+	invalid []string
+}
+
+func defaultWorkDir() string {
+	u, err := user.Current()
+	if err != nil {
+		return "goonj-workdir"
+	}
+	return filepath.Join(u.HomeDir, "goonj-workdir")
+}
+
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port: DEFAULT_PORT,
+		},
+		Storage: StorageConfig{
+			WorkDir: defaultWorkDir(),
+		},
+		Runner: RunnerConfig{
+			Path: utils.DefaultDir("src/github.com/maddyonline/code"),
+		},
+		Auth: AuthConfig{
+			Auth0Domain: "thinkhike.auth0.com",
+		},
+		Limits: LimitsConfig{
+			TimeLimit:     3600,
+			SessionExpiry: 300,
+		},
+		Integrity: IntegrityConfig{
+			MaxPasteChars:  200,
+			MaxPastedChars: 1000,
+			MaxBlurs:       10,
+			MaxAwaySec:     300,
+			FlagDevtools:   true,
+		},
+		Sandbox: SandboxConfig{
+			MemoryMB:  512,
+			MaxFileMB: 64,
+			MaxProcs:  64,
+		},
+	}
+}
+
+// Load builds a Config from defaults, the TOML file at path (skipped when
+// path is empty), the legacy .env file in the static root and environment
+// variables. It does not validate the result.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path == "" {
+		path = os.Getenv(ENV_CONFIG_FILE)
+	}
+	if path != "" {
+		md, err := toml.DecodeFile(path, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("config: reading %s: %v", path, err)
+		}
+		for _, key := range md.Undecoded() {
+			cfg.undecoded = append(cfg.undecoded, key.String())
+		}
+		cfg.File = path
+	}
+	if root := os.Getenv(ENV_STATIC_FILES_DIR); root != "" {
+		cfg.Server.StaticFilesRoot = root
+	}
+	if err := cfg.applyDotEnv(filepath.Join(cfg.Server.StaticFilesRoot, ".env")); err != nil {
+		return nil, err
+	}
+	cfg.applyEnv(os.Getenv)
+	return cfg, nil
+}
+
+// applyDotEnv reads the JSON .env file older deployments keep their
+// secrets in, found in the static files root or the working directory.
+// A missing file is not an error. Any secret found there
+// enables the feature it belongs to, as it always did and as the same
+// variable in the environment does.
+func (cfg *Config) applyDotEnv(path string) error {
+	read, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("config: reading %s: %v", path, err)
+	}
+	env := map[string]string{}
+	if err := json.Unmarshal(read, &env); err != nil {
+		return fmt.Errorf("config: parsing %s: %v", path, err)
+	}
+	if key, ok := env[ENV_GISTS_KEY]; ok {
+		cfg.setGistsKey(key)
+	}
+	if token, ok := env[ENV_AUTH0_TOKEN]; ok {
+		cfg.setAuth0Token(token)
+	}
+	return nil
+}
+
+// setGistsKey sets the key of the gists archive and enables archiving.
+func (cfg *Config) setGistsKey(key string) {
+	cfg.Archive.GistsKey = key
+	cfg.Archive.Enabled = true
+}
+
+// setAuth0Token sets the Auth0 token and enables logins.
+func (cfg *Config) setAuth0Token(token string) {
+	cfg.Auth.Auth0Token = token
+	cfg.Auth.Enabled = true
+}
+
+func (cfg *Config) applyEnv(getenv func(string) string) {
+	assign := func(v *string, name string) {
+		if val := getenv(name); val != "" {
+			*v = val
+		}
+	}
+	assignInt := func(v *int, name string) {
+		if val := getenv(name); val != "" {
+			n, err := strconv.Atoi(val)
+			if err != nil {
+				cfg.invalid = append(cfg.invalid, fmt.Sprintf("$%s: %q is not a number", name, val))
+				return
+			}
+			*v = n
+		}
+	}
+	assign(&cfg.Server.Port, ENV_PORT_NAME)
+	assign(&cfg.Server.StaticFilesRoot, ENV_STATIC_FILES_DIR)
+	assign(&cfg.Runner.Path, ENV_RUNNER_PATH)
+	assign(&cfg.Storage.WorkDir, ENV_WORK_DIR)
+	assign(&cfg.Auth.Auth0Domain, ENV_AUTH0_DOMAIN)
+	if token := getenv(ENV_AUTH0_TOKEN); token != "" {
+		cfg.setAuth0Token(token)
+	}
+	if key := getenv(ENV_GISTS_KEY); key != "" {
+		cfg.setGistsKey(key)
+	}
+	assign(&cfg.Admin.Token, ENV_ADMIN_TOKEN)
+	assignInt(&cfg.Limits.TimeLimit, ENV_TIME_LIMIT)
+	assignInt(&cfg.Limits.SessionExpiry, ENV_SESSION_EXPIRY)
+}
+
+// ValidationError lists every problem found in a Config.
+type ValidationError []string
+
+func (v ValidationError) Error() string {
+	return fmt.Sprintf("invalid configuration:\n  - %s", strings.Join(v, "\n  - "))
+}
+
+// Validate checks the whole configuration and reports all problems at
+// once. Secrets are only required for the features that are enabled.
+func (cfg *Config) Validate() error {
+	var problems ValidationError
+	for _, key := range cfg.undecoded {
+		problems = append(problems, fmt.Sprintf("unknown setting %s", key))
+	}
+	for _, value := range cfg.invalid {
+		problems = append(problems, fmt.Sprintf("invalid value for %s", value))
+	}
+	if port, err := strconv.Atoi(cfg.Server.Port); err != nil || port < 1 || port > 65535 {
+		problems = append(problems, fmt.Sprintf("server.port: %q is not a valid port", cfg.Server.Port))
+	}
+	if cfg.Server.StaticFilesRoot != "" {
+		if _, err := os.Stat(cfg.Server.StaticFilesRoot); err != nil {
+			problems = append(problems, fmt.Sprintf("server.static_files_root: %v", err))
+		}
+	}
+	if cfg.Storage.WorkDir == "" {
+		problems = append(problems, "storage.work_dir: must be set")
+	}
+	if cfg.Runner.Path == "" {
+		problems = append(problems, "runner.path: must be set")
+	} else if _, err := os.Stat(cfg.Runner.Path); err != nil {
+		problems = append(problems, fmt.Sprintf("runner.path: %v", err))
+	}
+	if cfg.Auth.Enabled {
+		if cfg.Auth.Auth0Domain == "" {
+			problems = append(problems, "auth.auth0_domain: required when auth is enabled")
+		}
+		if cfg.Auth.Auth0Token == "" {
+			problems = append(problems, fmt.Sprintf("auth.auth0_token: required when auth is enabled (or set $%s)", ENV_AUTH0_TOKEN))
+		}
+	}
+	if cfg.Archive.Enabled && cfg.Archive.GistsKey == "" {
+		problems = append(problems, fmt.Sprintf("archive.gists_key: required when archive is enabled (or set $%s)", ENV_GISTS_KEY))
+	}
+	if cfg.Limits.TimeLimit <= 0 {
+		problems = append(problems, "limits.time_limit_sec: must be positive")
+	}
+	if cfg.Limits.SessionExpiry <= 0 {
+		problems = append(problems, "limits.session_expiry_sec: must be positive")
+	}
+	for _, threshold := range []struct {
+		name  string
+		value int
+	}{
+		{"max_paste_chars", cfg.Integrity.MaxPasteChars},
+		{"max_pasted_chars", cfg.Integrity.MaxPastedChars},
+		{"max_blurs", cfg.Integrity.MaxBlurs},
+		{"max_away_sec", cfg.Integrity.MaxAwaySec},
+	} {
+		if threshold.value < 0 {
+			problems = append(problems, fmt.Sprintf("integrity.%s: must not be negative", threshold.name))
+		}
+	}
+	for _, limit := range []struct {
+		name  string
+		value int
+	}{
+		{"memory_mb", cfg.Sandbox.MemoryMB},
+		{"max_file_mb", cfg.Sandbox.MaxFileMB},
+		{"max_procs", cfg.Sandbox.MaxProcs},
+	} {
+		if limit.value < 0 {
+			problems = append(problems, fmt.Sprintf("sandbox.%s: must not be negative", limit.name))
+		}
+	}
+	if cfg.Sandbox.User != "" {
+		if _, err := user.Lookup(cfg.Sandbox.User); err != nil {
+			problems = append(problems, fmt.Sprintf("sandbox.user: %v", err))
+		}
+	}
+	for i, hook := range cfg.Webhooks {
+		if u, err := url.Parse(hook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("webhooks[%d].url: %q is not an http(s) URL", i, hook.URL))
+		}
+		if hook.Secret == "" {
+			problems = append(problems, fmt.Sprintf("webhooks[%d].secret: must be set to sign payloads", i))
+		}
+		for _, ev := range hook.Events {
+			if !webhook.IsKnownEvent(ev) {
+				problems = append(problems, fmt.Sprintf("webhooks[%d].events: unknown event %q (known: %s)", i, ev, strings.Join(webhook.Events, ", ")))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
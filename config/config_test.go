@@ -0,0 +1,151 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateListsEveryProblem(t *testing.T) {
+	cfg := Default()
+	cfg.Server.Port = "http"
+	cfg.Runner.Path = ""
+	cfg.Auth.Enabled = true
+	cfg.Auth.Auth0Token = ""
+	cfg.Archive.Enabled = true
+	cfg.Limits.TimeLimit = 0
+	cfg.Integrity.MaxBlurs = -1
+	cfg.Sandbox.MemoryMB = -1
+	cfg.Sandbox.User = "no-such-goonj-user"
+
+	err := cfg.Validate()
+	problems, ok := err.(ValidationError)
+	if !ok {
+		t.Fatalf("expected ValidationError, got %#v", err)
+	}
+	for _, want := range []string{"server.port", "runner.path", "auth.auth0_token", "archive.gists_key", "limits.time_limit_sec", "integrity.max_blurs", "sandbox.memory_mb", "sandbox.user"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected a problem about %s in %v", want, problems)
+		}
+	}
+	if len(problems) != 8 {
+		t.Errorf("expected 8 problems, got %d: %v", len(problems), problems)
+	}
+}
+
+func TestSecretsOptionalWhenFeaturesDisabled(t *testing.T) {
+	cfg := Default()
+	cfg.Runner.Path = os.TempDir()
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("expected default config to validate, got %v", err)
+	}
+}
+
+func TestLoadFileAndEnvOverrides(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goonj-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "goonj.toml")
+	contents := `
+[server]
+port = "4000"
+static_files_root = "` + dir + `"
+
+[archive]
+enabled = true
+
+[limits]
+time_limit_sec = 1800
+bogus = 1
+
+[[webhooks]]
+organisation = "acme"
+url = "https://ats.example.com/goonj"
+secret = "hmac-secret"
+events = ["ticket.created", "task.finalized"]
+
+[[webhooks]]
+url = "ftp://example.com"
+events = ["ticket.exploded"]
+`
+	if err := ioutil.WriteFile(file, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv(ENV_GISTS_KEY, "secret")
+	os.Setenv(ENV_PORT_NAME, "5000")
+	defer os.Unsetenv(ENV_GISTS_KEY)
+	defer os.Unsetenv(ENV_PORT_NAME)
+
+	cfg, err := Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != "5000" {
+		t.Errorf("expected env to override port, got %s", cfg.Server.Port)
+	}
+	if cfg.Archive.GistsKey != "secret" || cfg.Limits.TimeLimit != 1800 {
+		t.Errorf("unexpected config: %#v", cfg)
+	}
+	if len(cfg.Webhooks) != 2 || cfg.Webhooks[0].Organisation != "acme" || len(cfg.Webhooks[0].Events) != 2 {
+		t.Errorf("unexpected webhooks: %#v", cfg.Webhooks)
+	}
+	err = cfg.Validate()
+	for _, want := range []string{"limits.bogus", "webhooks[1].url", "webhooks[1].secret", "ticket.exploded"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %s to be reported, got %v", want, err)
+		}
+	}
+	if err != nil && strings.Contains(err.Error(), "webhooks[0]") {
+		t.Errorf("expected webhooks[0] to be valid, got %v", err)
+	}
+}
+
+func TestEnvEnablesFeaturesAsDotEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goonj-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dotEnv := filepath.Join(dir, ".env")
+	if err := ioutil.WriteFile(dotEnv, []byte(`{"AUTH0_TOKEN": "token", "THINK_GISTS_KEY": "key"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fromFile := Default()
+	if err := fromFile.applyDotEnv(dotEnv); err != nil {
+		t.Fatal(err)
+	}
+	fromEnv := Default()
+	fromEnv.applyEnv(func(name string) string {
+		return map[string]string{ENV_AUTH0_TOKEN: "token", ENV_GISTS_KEY: "key"}[name]
+	})
+	for _, cfg := range []*Config{fromFile, fromEnv} {
+		if !cfg.Auth.Enabled || cfg.Auth.Auth0Token != "token" || !cfg.Archive.Enabled || cfg.Archive.GistsKey != "key" {
+			t.Errorf("expected auth and archive to be enabled, got %#v and %#v", cfg.Auth, cfg.Archive)
+		}
+	}
+}
+
+func TestInvalidEnvValue(t *testing.T) {
+	cfg := Default()
+	cfg.Runner.Path = os.TempDir()
+	cfg.applyEnv(func(name string) string {
+		if name == ENV_TIME_LIMIT {
+			return "1h"
+		}
+		return ""
+	})
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "invalid value for $"+ENV_TIME_LIMIT) {
+		t.Errorf("expected $%s to be reported as invalid, got %v", ENV_TIME_LIMIT, err)
+	}
+	if err != nil && strings.Contains(err.Error(), "unknown setting") {
+		t.Errorf("expected no unknown setting, got %v", err)
+	}
+	if cfg.Limits.TimeLimit != 3600 {
+		t.Errorf("expected the default time limit to be kept, got %d", cfg.Limits.TimeLimit)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// configCommand implements `goonj config check`, which loads the
+// configuration exactly as the server would, flags included, and reports
+// every problem.
+func configCommand(args []string) int {
+	if len(args) < 1 || args[0] != "check" {
+		fmt.Fprintf(os.Stderr, "Usage: goonj config check [-config file] [-port port] [-static dir] [-runner path]\n")
+		return 2
+	}
+	cfg, err := initializeConfig(flag.NewFlagSet("config check", flag.ExitOnError), args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	source := cfg.File
+	if source == "" {
+		source = "defaults and environment"
+	}
+	fmt.Printf("Configuration from %s is valid.\n", source)
+	fmt.Printf("  port=%s static=%s runner=%s work_dir=%s\n", cfg.Server.Port, cfg.Server.StaticFilesRoot, cfg.Runner.Path, cfg.Storage.WorkDir)
+	fmt.Printf("  auth=%v archive=%v time_limit=%ds\n", cfg.Auth.Enabled, cfg.Archive.Enabled, cfg.Limits.TimeLimit)
+	return 0
+}
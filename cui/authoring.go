@@ -0,0 +1,343 @@
+package cui
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/maddyonline/code"
+	"github.com/maddyonline/goonj/judge"
+	"github.com/maddyonline/goonj/problem"
+	"github.com/maddyonline/goonj/utils"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Roles of the tasks of a draft ticket. Each task holds one part of the
+// problem being authored.
+const (
+	DRAFT_STATEMENT  = "statement"
+	DRAFT_GENERATOR  = "generator"
+	DRAFT_REFERENCE  = "reference"
+	DRAFT_BRUTE      = "brute"
+	DRAFT_CHECKER    = "checker"
+	DRAFT_INTERACTOR = "interactor"
+	DRAFT_TESTS      = "tests"
+)
+
+// Draft identifies the problem authored in a draft ticket. BaseVersion is
+// the version it was loaded from or last published as, 0 for a new problem.
+// QueryLimit applies when the draft has an interactor.
+type Draft struct {
+	ProblemId   string `json:"problem_id"`
+	Title       string `json:"title"`
+	BaseVersion int    `json:"base_version"`
+	QueryLimit  int    `json:"query_limit,omitempty"`
+	// Template, Groups, Languages, Translations and the known-wrong
+	// solutions, by file name, are kept from the published version the
+	// draft started from.
+	Template     string            `json:"template,omitempty"`
+	Groups       []problem.Group   `json:"groups,omitempty"`
+	Languages    []string          `json:"languages,omitempty"`
+	Translations map[string]string `json:"translations,omitempty"`
+	Wrong        map[string]string `json:"wrong,omitempty"`
+}
+
+var draftDescriptions = map[string]string{
+	DRAFT_STATEMENT:  "### Statement\n\nThe problem statement in markdown, as candidates will see it. *Run* previews it.",
+	DRAFT_GENERATOR:  "### Generator\n\nReads a seed and a size from 1 to 100 on stdin, like `42 10`, and prints a random test input of about that size. The same seed and size must always give the same input.",
+	DRAFT_REFERENCE:  "### Reference solution\n\nIts answers are the expected outputs. *Run* tries it on the custom input, *Verify* cross-validates the problem.",
+	DRAFT_BRUTE:      "### Brute solution\n\nAn independent, possibly slow solution. When present, its answers must match the reference on every test.",
+	DRAFT_CHECKER:    "### Checker\n\nIn *Plain text*, the name of a built-in checker: `exact`, `tokens`, `whitespace` (ignores spacing within lines), `case` (case-insensitive tokens) or `float 1e-6` (numbers within a tolerance). Otherwise a program that reads `input.txt`, `expected.txt` and `output.txt` and prints `OK` or `WA` on its first line, followed by a message.",
+	DRAFT_INTERACTOR: "### Interactor\n\nLeave it empty unless the problem is interactive. An interactor is started with the name of a file holding the test input, talks to the solution over stdin and stdout, and accepts it by exiting with status 0. What it writes on stderr is shown as the verdict. *Run* lets it talk to the reference solution on the custom input.",
+	DRAFT_TESTS:      "### Fixed tests\n\nTest inputs separated by lines containing only `---`. Expected outputs are computed by the reference solution.",
+}
+
+func draftTaskId(role string) string {
+	return strings.Join([]string{"task", role, "main"}, "-")
+}
+
+func draftRole(taskId string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(taskId, "task-"), "-main")
+}
+
+func addDraftTask(tasks map[TaskKey]*Task, ticketId, role, progLang, content string, progLangs ...string) *Task {
+	task := NewTask()
+	task.Id = draftTaskId(role)
+	task.Description = string(getDescFromMarkdown([]byte(draftDescriptions[role])))
+	// Parts of a problem start empty in every language; a template would
+	// turn into a brute solution or interactor once saved.
+	task.Templates = map[string]string{}
+	task.SetSolution(progLang, content)
+	if len(progLangs) > 0 {
+		list, _ := json.Marshal(progLangs)
+		task.ProgLangList = string(list)
+	}
+	tasks[TaskKey{ticketId, task.Id}] = task
+	return task
+}
+
+func addDraftProgram(tasks map[TaskKey]*Task, ticketId, role string, prog *code.Input) *Task {
+	progLang := "cpp"
+	if prog != nil && LanguageFromRunner(prog.Language) != "" {
+		progLang = LanguageFromRunner(prog.Language)
+	}
+	_, source := problem.Source(prog)
+	return addDraftTask(tasks, ticketId, role, progLang, source)
+}
+
+const DRAFT_GENERATOR_TEMPL = `import random
+import sys
+
+seed, size = map(int, sys.stdin.read().split())
+random.seed(seed)
+print(''.join(random.choice('ab') for _ in range(random.randint(1, size))))
+`
+
+// addDraftChecker shows a built-in checker by name in plain text and a
+// checker program as source.
+func addDraftChecker(tasks map[TaskKey]*Task, ticketId string, p *problem.Problem) *Task {
+	var task *Task
+	if p.Manifest.Checker.Type == problem.CHECKER_PROGRAM {
+		task = addDraftProgram(tasks, ticketId, DRAFT_CHECKER, p.Checker)
+	} else {
+		task = addDraftTask(tasks, ticketId, DRAFT_CHECKER, "txt", problem.FormatChecker(p.Manifest.Checker))
+	}
+	list, _ := json.Marshal(append([]string{"txt"}, PROGRAMMING_LANGUAGES...))
+	task.ProgLangList = string(list)
+	return task
+}
+
+// DraftTemplate is the problem a new draft starts from.
+func DraftTemplate(id, title string) *problem.Problem {
+	return &problem.Problem{
+		Manifest:  problem.Manifest{Id: id, Title: title},
+		Statement: DESC_TEMPL,
+		Generator: problem.NewProgram("generator.py", DRAFT_GENERATOR_TEMPL),
+		Reference: problem.NewProgram("reference.cpp", SOLN_TEMPL_CPP),
+		Tests:     problem.ParseTests("appease" + problem.TESTS_SEPARATOR + "appeal"),
+	}
+}
+
+// NewDraftTicket opens p for editing: its statement, generator, reference
+// and brute solutions, checker, interactor and fixed tests each become a
+// task of the ticket.
+func NewDraftTicket(tasks map[TaskKey]*Task, p *problem.Problem, opts *Options) *Ticket {
+	ticketId := utils.RandId()
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	opts.ProgLangList["md"] = ProgLang{Version: "Markdown", Name: "Markdown"}
+	opts.ProgLangList["txt"] = ProgLang{Version: "text", Name: "Plain text"}
+	statement := addDraftTask(tasks, ticketId, DRAFT_STATEMENT, "md", p.Statement, "md")
+	statement.Assets = p.Assets
+	ticket := ticketFromTasks(ticketId, []*Task{
+		statement,
+		addDraftProgram(tasks, ticketId, DRAFT_GENERATOR, p.Generator),
+		addDraftProgram(tasks, ticketId, DRAFT_REFERENCE, p.Reference),
+		addDraftProgram(tasks, ticketId, DRAFT_BRUTE, p.Brute),
+		addDraftChecker(tasks, ticketId, p),
+		addDraftProgram(tasks, ticketId, DRAFT_INTERACTOR, p.Interactor),
+		addDraftTask(tasks, ticketId, DRAFT_TESTS, "txt", problem.FormatTests(p.Tests), "txt"),
+	}, opts)
+	ticket.Draft = &Draft{ProblemId: p.Id, Title: p.Title, BaseVersion: p.Version, QueryLimit: p.QueryLimit,
+		Template: p.Template, Groups: p.Groups, Languages: p.Languages, Translations: p.Translations}
+	for _, prog := range p.Wrong {
+		if ticket.Draft.Wrong == nil {
+			ticket.Draft.Wrong = map[string]string{}
+		}
+		filename, source := problem.Source(prog)
+		ticket.Draft.Wrong[filename] = source
+	}
+	return ticket
+}
+
+func draftProgram(task *Task, role string) *code.Input {
+	if task == nil || strings.TrimSpace(task.CurrentSolution) == "" {
+		return nil
+	}
+	return problem.NewProgram(role+filepath.Ext(FileNameForCode(task.ProgLang)), task.CurrentSolution)
+}
+
+// DraftProblem collects the current contents of the tasks of a draft ticket
+// into a problem.
+func DraftProblem(tasks map[TaskKey]*Task, ticket *Ticket) *problem.Problem {
+	task := func(role string) *Task {
+		return tasks[TaskKey{ticket.Id, draftTaskId(role)}]
+	}
+	p := &problem.Problem{
+		Manifest: problem.Manifest{Id: ticket.Draft.ProblemId, Title: ticket.Draft.Title, Template: ticket.Draft.Template,
+			Groups: ticket.Draft.Groups, Languages: ticket.Draft.Languages},
+		Translations: ticket.Draft.Translations,
+		Generator:    draftProgram(task(DRAFT_GENERATOR), DRAFT_GENERATOR),
+		Reference:    draftProgram(task(DRAFT_REFERENCE), DRAFT_REFERENCE),
+		Brute:        draftProgram(task(DRAFT_BRUTE), DRAFT_BRUTE),
+		Tests:        []*problem.Test{},
+	}
+	filenames := []string{}
+	for filename := range ticket.Draft.Wrong {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	for _, filename := range filenames {
+		p.Wrong = append(p.Wrong, problem.NewProgram(filename, ticket.Draft.Wrong[filename]))
+	}
+	if t := task(DRAFT_STATEMENT); t != nil {
+		p.Statement, p.Assets = t.CurrentSolution, t.Assets
+	}
+	if t := task(DRAFT_TESTS); t != nil {
+		p.Tests = problem.ParseTests(t.CurrentSolution)
+	}
+	if t := task(DRAFT_CHECKER); t != nil && t.ProgLang == "txt" {
+		p.Manifest.Checker = problem.ParseChecker(t.CurrentSolution)
+	} else if p.Checker = draftProgram(t, DRAFT_CHECKER); p.Checker != nil {
+		p.Manifest.Checker = problem.CheckerConfig{Type: problem.CHECKER_PROGRAM}
+	}
+	if p.Interactor = draftProgram(task(DRAFT_INTERACTOR), DRAFT_INTERACTOR); p.Interactor != nil {
+		p.Type = problem.TYPE_INTERACTIVE
+		p.QueryLimit = ticket.Draft.QueryLimit
+	}
+	return p
+}
+
+// ValidateDraft checks the structure of the draft problem and
+// cross-validates it, replaying the generated tests of seed unless it is
+// 0. The report is nil if the problem is incomplete. interact runs the
+// solutions of interactive problems.
+func ValidateDraft(run judge.RunFunc, interact judge.InteractFunc, tasks map[TaskKey]*Task, ticket *Ticket, seed int64) (*problem.Problem, *judge.Report, error) {
+	p := DraftProblem(tasks, ticket)
+	report, err := ValidateProblem(run, interact, p, seed)
+	return p, report, err
+}
+
+// ValidateProblem checks the structure of p and cross-validates it like
+// ValidateDraft, for problem packages authored outside the CUI.
+func ValidateProblem(run judge.RunFunc, interact judge.InteractFunc, p *problem.Problem, seed int64) (*judge.Report, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	cfg := judge.DefaultStress
+	cfg.Seed = seed
+	cfg.Interact = interact
+	return judge.CrossValidate(p, run, cfg), nil
+}
+
+// DraftReportStatus shows the outcome of ValidateDraft in the CUI.
+func DraftReportStatus(report *judge.Report, err error) *VerifyStatus {
+	resp := newVerifyStatus()
+	if err != nil {
+		resp.Extra.Example = Status{0, err.Error()}
+		return resp
+	}
+	resp.Extra.Example.Message = report.String()
+	if !report.OK() {
+		resp.Extra.Example.OK = 0
+	}
+	return resp
+}
+
+// DraftVerifyStatus is GetVerifyStatus for draft tickets. Running the
+// statement previews it and running a program shows its output on the
+// custom input; verifying any task cross-validates the whole draft. In
+// interactive drafts, running the reference, brute or interactor shows
+// how the solution and the interactor talk instead.
+func DraftVerifyStatus(run judge.RunFunc, interact judge.InteractFunc, tasks map[TaskKey]*Task, ticket *Ticket, task *Task, solnReq *SolutionRequest, mode Mode) *VerifyStatus {
+	if mode != VERIFY {
+		_, report, err := ValidateDraft(run, interact, tasks, ticket, solnReq.Seed)
+		return DraftReportStatus(report, err)
+	}
+	resp := newVerifyStatus()
+	role := draftRole(task.Id)
+	switch role {
+	case DRAFT_STATEMENT:
+		resp.Extra.Example.Message, _ = RenderStatement(task.CurrentSolution, AssetURL(ticket.Id, task.Id))
+	case DRAFT_TESTS:
+		resp.Extra.Example.Message = fmt.Sprintf("%d tests", len(problem.ParseTests(task.CurrentSolution)))
+	default:
+		prog := draftProgram(task, role)
+		if prog == nil {
+			resp.Extra.Example = Status{0, fmt.Sprintf("The %s is empty", role)}
+			return resp
+		}
+		if p := DraftProblem(tasks, ticket); p.Interactive() && role != DRAFT_GENERATOR && role != DRAFT_CHECKER {
+			return draftInteraction(interact, p, prog, role, solnReq.TestData0, resp)
+		}
+		out, err := run(prog, solnReq.TestData0)
+		if err != nil {
+			return errorResponse(err, resp)
+		}
+		resp.Extra.Example.Message = out
+	}
+	return resp
+}
+
+// draftInteraction runs prog, or the reference when prog is the
+// interactor, against the interactor of p on input.
+func draftInteraction(interact judge.InteractFunc, p *problem.Problem, prog *code.Input, role, input string, resp *VerifyStatus) *VerifyStatus {
+	if interact == nil {
+		return errorResponse(judge.ErrNoInteract, resp)
+	}
+	soln := prog
+	if role == DRAFT_INTERACTOR {
+		if soln = p.Reference; soln == nil {
+			resp.Extra.Example = Status{0, "The reference is empty"}
+			return resp
+		}
+	}
+	in, err := interact(p.Interactor, soln, input, p.QueryLimit)
+	if err != nil {
+		return errorResponse(err, resp)
+	}
+	return interactionStatus(in, resp)
+}
+
+// exampleInput is the input of the first test of the visible groups of p.
+func exampleInput(p *problem.Problem) string {
+	for _, group := range p.TestGroups() {
+		if group.Visible && len(group.Tests) > 0 {
+			if test := p.Test(group.Tests[0]); test != nil {
+				return test.Input
+			}
+		}
+	}
+	return ""
+}
+
+// NewProblemTicket creates a candidate ticket with one task per problem
+// from the bank, judged against the problem's reference solution.
+func NewProblemTicket(tasks map[TaskKey]*Task, problems []*problem.Problem, opts *Options) *Ticket {
+	ticketId := utils.RandId()
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	ticket := ticketFromTasks(ticketId, AddProblemTasks(tasks, ticketId, problems, opts), opts)
+	if ticket != nil {
+		for _, p := range problems {
+			ticket.Problems = append(ticket.Problems, fmt.Sprintf("%s@%d", p.Id, p.Version))
+		}
+	}
+	return ticket
+}
+
+// AddProblemTasks adds a task of ticketId for each problem to tasks and
+// returns them in order.
+func AddProblemTasks(tasks map[TaskKey]*Task, ticketId string, problems []*problem.Problem, opts *Options) []*Task {
+	ticketTasks := []*Task{}
+	for _, p := range problems {
+		task := NewTask()
+		task.Id = p.Id
+		descriptions, langs, example := problemDescriptions(p, opts, AssetURL(ticketId, task.Id))
+		task.Descriptions, task.HumanLangList, task.Assets = descriptions, langs, p.Assets
+		task.SelectHumanLang(opts.CurrentHumanLang)
+		task.Templates = SolutionTemplates(p.Template)
+		task.SelectProgLang(task.ProgLang)
+		if task.ExampleInput = example; example == "" {
+			task.ExampleInput = exampleInput(p)
+		}
+		task.Generator = p.Generator
+		task.JudgeSolution = p.Reference
+		task.Problem = p
+		tasks[TaskKey{ticketId, task.Id}] = task
+		ticketTasks = append(ticketTasks, task)
+	}
+	return ticketTasks
+}
@@ -0,0 +1,77 @@
+package cui
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Authors of chat messages.
+const (
+	CHAT_CANDIDATE   = "candidate"
+	CHAT_INTERVIEWER = "interviewer"
+)
+
+// MAX_CHAT_MESSAGE is the longest message in characters, MAX_CHAT_MESSAGES
+// the most a ticket keeps.
+const (
+	MAX_CHAT_MESSAGE  = 2000
+	MAX_CHAT_MESSAGES = 500
+)
+
+var (
+	ErrEmptyMessage  = errors.New("the message is empty")
+	ErrLongMessage   = errors.New("the message is too long")
+	ErrChatFull      = errors.New("the chat of this ticket is full")
+	ErrUnknownAuthor = errors.New("messages are from the candidate or the interviewer")
+	ErrNoChatAuthor  = errors.New("the name of the interviewer is required")
+)
+
+// ChatMessage is a line of the chat transcript of a ticket. Seq numbers
+// the messages from 1 so clients can ask for those after the last one they
+// have.
+type ChatMessage struct {
+	Seq    int       `json:"seq"`
+	Time   time.Time `json:"time"`
+	From   string    `json:"from"`
+	Author string    `json:"author,omitempty"`
+	Text   string    `json:"text"`
+}
+
+// PostChat adds a message from the candidate or from the named interviewer
+// to the transcript of s. Candidates cannot write once the ticket is closed.
+func (s *Session) PostChat(now time.Time, from, author, text string) (*ChatMessage, error) {
+	text = strings.TrimSpace(text)
+	switch {
+	case from != CHAT_CANDIDATE && from != CHAT_INTERVIEWER:
+		return nil, ErrUnknownAuthor
+	case from == CHAT_INTERVIEWER && author == "":
+		return nil, ErrNoChatAuthor
+	case from == CHAT_CANDIDATE && s.Closed:
+		return nil, ErrTicketClosed
+	case text == "":
+		return nil, ErrEmptyMessage
+	case utf8.RuneCountInString(text) > MAX_CHAT_MESSAGE:
+		return nil, ErrLongMessage
+	case len(s.Chat) >= MAX_CHAT_MESSAGES:
+		return nil, ErrChatFull
+	}
+	if from == CHAT_CANDIDATE {
+		author = ""
+	}
+	msg := ChatMessage{Seq: len(s.Chat) + 1, Time: now.UTC(), From: from, Author: author, Text: text}
+	s.Chat = append(s.Chat, msg)
+	return &msg, nil
+}
+
+// ChatSince returns the messages of s after the one numbered seq.
+func (s *Session) ChatSince(seq int) []ChatMessage {
+	if seq < 0 {
+		seq = 0
+	}
+	if seq >= len(s.Chat) {
+		return []ChatMessage{}
+	}
+	return append([]ChatMessage{}, s.Chat[seq:]...)
+}
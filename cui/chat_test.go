@@ -0,0 +1,53 @@
+package cui
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPostChat(t *testing.T) {
+	now := time.Date(2016, 1, 1, 10, 0, 0, 0, time.UTC)
+	s := &Session{}
+	if _, err := s.PostChat(now, CHAT_CANDIDATE, "", "  hello?\n"); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := s.PostChat(now, CHAT_INTERVIEWER, "ann", "Hi, how can I help?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Seq != 2 || msg.Author != "ann" {
+		t.Errorf("expected message 2 by ann, got %+v", msg)
+	}
+	for _, bad := range []struct {
+		from, author, text string
+		err                error
+	}{
+		{"someone", "", "hi", ErrUnknownAuthor},
+		{CHAT_INTERVIEWER, "", "hi", ErrNoChatAuthor},
+		{CHAT_CANDIDATE, "", " \n", ErrEmptyMessage},
+		{CHAT_CANDIDATE, "", strings.Repeat("é", MAX_CHAT_MESSAGE+1), ErrLongMessage},
+	} {
+		if _, err := s.PostChat(now, bad.from, bad.author, bad.text); err != bad.err {
+			t.Errorf("%s %q: expected %v, got %v", bad.from, bad.author, bad.err, err)
+		}
+	}
+
+	if got := s.ChatSince(0); len(got) != 2 || got[0].Text != "hello?" || got[0].Author != "" {
+		t.Errorf("expected the whole transcript, got %+v", got)
+	}
+	if got := s.ChatSince(1); len(got) != 1 || got[0].Seq != 2 {
+		t.Errorf("expected the second message, got %+v", got)
+	}
+	if got := s.ChatSince(2); len(got) != 0 {
+		t.Errorf("expected no message, got %+v", got)
+	}
+
+	s.Close(now)
+	if _, err := s.PostChat(now, CHAT_CANDIDATE, "", "one more thing"); err != ErrTicketClosed {
+		t.Errorf("expected candidates not to write to closed tickets, got %v", err)
+	}
+	if _, err := s.PostChat(now, CHAT_INTERVIEWER, "ann", "Thanks!"); err != nil {
+		t.Errorf("expected interviewers to write to closed tickets, got %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package cui
+
+import (
+	"errors"
+	"time"
+)
+
+// Changes admins make to the clock of a session.
+const (
+	CLOCK_EXTEND = "extend"
+	CLOCK_PAUSE  = "pause"
+	CLOCK_RESUME = "resume"
+)
+
+var (
+	ErrClockPaused   = errors.New("the clock is already paused")
+	ErrClockRunning  = errors.New("the clock is not paused")
+	ErrBadExtension  = errors.New("the extension must be a positive number of seconds")
+	ErrUnknownChange = errors.New("unknown clock change")
+	ErrNoActor       = errors.New("the actor making the change is required")
+	ErrNotStarted    = errors.New("the session has not been started")
+)
+
+// ClockChange records who changed the clock of a session, how and why.
+type ClockChange struct {
+	Time    time.Time `json:"time"`
+	Actor   string    `json:"actor"`
+	Action  string    `json:"action"`
+	Seconds int       `json:"seconds,omitempty"`
+	Reason  string    `json:"reason,omitempty"`
+}
+
+// Elapsed is the time the candidate has had at now, pauses excluded. The
+// clock stops when the session is closed.
+func (s *Session) Elapsed(now time.Time) time.Duration {
+	if s.StartTime.IsZero() {
+		return 0
+	}
+	if s.Closed && !s.ClosedAt.IsZero() && now.After(s.ClosedAt) {
+		now = s.ClosedAt
+	}
+	elapsed := now.Sub(s.StartTime) - s.PausedFor
+	if !s.PausedAt.IsZero() {
+		elapsed -= now.Sub(s.PausedAt)
+	}
+	return elapsed
+}
+
+// Remaining is the number of seconds left at now, extensions included.
+func (s *Session) Remaining(now time.Time) int {
+	remaining := s.TimeLimit + s.Extension - int(s.Elapsed(now)/time.Second)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// TimedOut tells whether the time of a started session that is still open
+// was up grace before now.
+func (s *Session) TimedOut(now time.Time, grace time.Duration) bool {
+	if s.Closed || s.StartTime.IsZero() {
+		return false
+	}
+	return s.Elapsed(now) >= time.Duration(s.TimeLimit+s.Extension)*time.Second+grace
+}
+
+// ChangeClock extends, pauses or resumes the clock of the session on
+// behalf of actor and records the change.
+func (s *Session) ChangeClock(now time.Time, actor, action string, seconds int, reason string) error {
+	if actor == "" {
+		return ErrNoActor
+	}
+	if s.Closed {
+		return ErrTicketClosed
+	}
+	switch action {
+	case CLOCK_EXTEND:
+		if seconds <= 0 {
+			return ErrBadExtension
+		}
+		s.Extension += seconds
+	case CLOCK_PAUSE:
+		if s.StartTime.IsZero() {
+			return ErrNotStarted
+		}
+		if !s.PausedAt.IsZero() {
+			return ErrClockPaused
+		}
+		s.PausedAt = now
+		seconds = 0
+	case CLOCK_RESUME:
+		if s.PausedAt.IsZero() {
+			return ErrClockRunning
+		}
+		s.PausedFor += now.Sub(s.PausedAt)
+		s.PausedAt = time.Time{}
+		seconds = 0
+	default:
+		return ErrUnknownChange
+	}
+	s.ClockLog = append(s.ClockLog, ClockChange{Time: now.UTC(), Actor: actor, Action: action, Seconds: seconds, Reason: reason})
+	return nil
+}
@@ -0,0 +1,70 @@
+package cui
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChangeClock(t *testing.T) {
+	start := time.Date(2016, 1, 1, 10, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+	s := &Session{TimeLimit: 3600}
+	if err := s.ChangeClock(at(0), "ann", CLOCK_PAUSE, 0, ""); err != ErrNotStarted {
+		t.Errorf("expected pausing before the start to fail, got %v", err)
+	}
+	s.StartTime = start
+	if remaining := s.Remaining(at(10)); remaining != 3000 {
+		t.Errorf("expected 50 minutes left, got %ds", remaining)
+	}
+	if err := s.ChangeClock(at(10), "", CLOCK_EXTEND, 600, ""); err != ErrNoActor {
+		t.Errorf("expected the actor to be required, got %v", err)
+	}
+	if err := s.ChangeClock(at(10), "ann", CLOCK_EXTEND, 600, "connection dropped"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ChangeClock(at(20), "ann", CLOCK_PAUSE, 0, "break"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ChangeClock(at(25), "ann", CLOCK_PAUSE, 0, ""); err != ErrClockPaused {
+		t.Errorf("expected the clock to be paused already, got %v", err)
+	}
+	if remaining := s.Remaining(at(30)); remaining != 3000 {
+		t.Errorf("expected the paused clock to keep 50 minutes, got %ds", remaining)
+	}
+	if err := s.ChangeClock(at(35), "bob", CLOCK_RESUME, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	if remaining := s.Remaining(at(45)); remaining != 2400 {
+		t.Errorf("expected 40 minutes left, got %ds", remaining)
+	}
+	if remaining := s.Remaining(at(200)); remaining != 0 {
+		t.Errorf("expected no time left, got %ds", remaining)
+	}
+	if len(s.ClockLog) != 3 || s.ClockLog[0].Seconds != 600 || s.ClockLog[2].Actor != "bob" {
+		t.Errorf("unexpected audit log %#v", s.ClockLog)
+	}
+	s.Closed = true
+	if err := s.ChangeClock(at(50), "ann", CLOCK_EXTEND, 60, ""); err != ErrTicketClosed {
+		t.Errorf("expected closed tickets to keep their clock, got %v", err)
+	}
+}
+
+func TestTimedOut(t *testing.T) {
+	start := time.Date(2016, 1, 1, 10, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+	s := &Session{TimeLimit: 3600}
+	if s.TimedOut(at(120), time.Minute) {
+		t.Errorf("expected a session that never started not to time out")
+	}
+	s.StartTime = start
+	if s.TimedOut(at(60), time.Minute) {
+		t.Errorf("expected the grace period to be left to the CUI")
+	}
+	if !s.TimedOut(at(61), time.Minute) {
+		t.Errorf("expected the session to time out after the grace period")
+	}
+	s.Close(at(61))
+	if s.TimedOut(at(70), time.Minute) {
+		t.Errorf("expected a closed session not to time out again")
+	}
+}
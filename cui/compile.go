@@ -0,0 +1,43 @@
+package cui
+
+import (
+	"github.com/maddyonline/goonj/judge"
+	"path/filepath"
+	"strings"
+)
+
+var annotationTypes = map[string]string{
+	judge.SEVERITY_ERROR:   "error",
+	judge.SEVERITY_WARNING: "warning",
+	judge.SEVERITY_NOTE:    "info",
+}
+
+// CompileStatus reports the compilation of the solution in filename. Its
+// diagnostics are listed in the message and those in filename also become
+// annotations of the editor.
+func CompileStatus(c *judge.Compilation, filename string) (Status, []Annotation) {
+	var annotations []Annotation
+	lines := []string{}
+	for _, d := range c.Diagnostics {
+		lines = append(lines, d.String())
+		if filepath.Base(d.File) != filename || d.Line < 1 {
+			continue
+		}
+		column := d.Column - 1
+		if column < 0 {
+			column = 0
+		}
+		annotations = append(annotations, Annotation{Row: d.Line - 1, Column: column, Type: annotationTypes[d.Severity], Text: d.Message})
+	}
+	details := strings.Join(lines, "\n")
+	if details == "" {
+		details = strings.TrimSpace(c.Output)
+	}
+	switch {
+	case !c.OK:
+		return Status{0, "Compilation failed:\n" + details}, annotations
+	case details != "":
+		return Status{1, "The solution compiled with warnings:\n" + details}, annotations
+	}
+	return Status{1, "The solution compiled flawlessly."}, annotations
+}
@@ -7,12 +7,13 @@ import (
 	"fmt"
 	"github.com/labstack/gommon/log"
 	"github.com/maddyonline/code"
+	"github.com/maddyonline/goonj/judge"
+	"github.com/maddyonline/goonj/problem"
 	"github.com/maddyonline/goonj/utils"
-	"github.com/microcosm-cc/bluemonday"
-	"github.com/russross/blackfriday"
 	"io/ioutil"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -26,7 +27,7 @@ type ProgLang struct {
 
 type Options struct {
 	TicketId         string               `json:"ticket_id"`
-	TimeElapsed      int                  `json:"time_elpased_sec"`
+	TimeElapsed      int                  `json:"time_elapsed_sec"`
 	TimeRemaining    int                  `json:"time_remaining_sec"`
 	CurrentHumanLang string               `json:"current_human_lang"`
 	CurrentProgLang  string               `json:"current_prg_lang"`
@@ -37,22 +38,65 @@ type Options struct {
 	ShowSurvey       bool                 `json:"show_survey"`
 	ShowHelp         bool                 `json:"show_help"`
 	ShowWelcome      bool                 `json:"show_welcome"`
+	ShowChat         bool                 `json:"show_chat"`
 	Sequential       bool                 `json:"sequential"`
 	SaveOften        bool                 `json:"save_often"`
 	Urls             map[string]string    `json:"urls"`
 }
 
 type Ticket struct {
-	Id      string
-	Options *Options
-}
-
+	Id           string   `json:"id"`
+	Organisation string   `json:"organisation,omitempty"`
+	Options      *Options `json:"options"`
+	// Draft is set on tickets used to author a problem.
+	Draft *Draft `json:"draft,omitempty"`
+	// Problems are the bank references ("id@version") the tasks of the
+	// ticket were created from.
+	Problems []string `json:"problems,omitempty"`
+	// ObserverToken lets interviewers watch the editor of the candidate.
+	ObserverToken string `json:"observer_token,omitempty"`
+}
+
+// Session is the state of a ticket, saved with SaveSession; see State for
+// its lifecycle.
 type Session struct {
-	Ticket    *Ticket
-	StartTime time.Time
-	Created   time.Time
-	Started   bool
-	TimeLimit int
+	Ticket    *Ticket         `json:"ticket"`
+	Created   time.Time       `json:"created"`
+	Opened    time.Time       `json:"opened"`
+	StartTime time.Time       `json:"started"`
+	ClosedAt  time.Time       `json:"closed_at"`
+	TimeLimit int             `json:"time_limit_sec"`
+	Finalized map[string]bool `json:"finalized,omitempty"`
+	Closed    bool            `json:"closed"`
+	// Extension adds seconds to TimeLimit. While the clock is paused
+	// PausedAt is set; PausedFor sums the earlier pauses. ClockLog audits
+	// these changes, see ChangeClock.
+	Extension int           `json:"extension_sec"`
+	PausedAt  time.Time     `json:"paused_at"`
+	PausedFor time.Duration `json:"paused_for"`
+	ClockLog  []ClockChange `json:"clock_log,omitempty"`
+	// TaskTime is the clock time spent on each task before the candidate
+	// switched to CurrentTask, which they have been on since the clock
+	// showed TaskSince.
+	TaskTime    map[string]time.Duration `json:"task_time,omitempty"`
+	CurrentTask string                   `json:"current_task,omitempty"`
+	TaskSince   time.Duration            `json:"task_since"`
+	// Solutions hold the last solution saved of each task and
+	// LangSolutions the last one saved in each language of each task, see
+	// SaveSolution.
+	Solutions     map[string]SavedSolution            `json:"solutions,omitempty"`
+	LangSolutions map[string]map[string]SavedSolution `json:"lang_solutions,omitempty"`
+	// Chat is the transcript of the chat with the interviewer.
+	Chat []ChatMessage `json:"chat,omitempty"`
+	// Events are the integrity events reported by the CUI, see RecordEvent.
+	Events []IntegrityEvent `json:"integrity_events,omitempty"`
+	// DroppedEvents adds up the events beyond MAX_INTEGRITY_EVENTS.
+	DroppedEvents *IntegrityTally `json:"dropped_integrity_events,omitempty"`
+	// Survey holds the answers to the survey shown at the end, if any.
+	Survey *Survey `json:"survey,omitempty"`
+
+	// mu serializes the requests on the session, see Lock.
+	mu sync.Mutex
 }
 
 func addToTask(tasks map[TaskKey]*Task, ticketId string, input *code.Input, prefix string) *Task {
@@ -63,8 +107,7 @@ func addToTask(tasks map[TaskKey]*Task, ticketId string, input *code.Input, pref
 	file := input.Files[0]
 	taskName := strings.Join([]string{"task", prefix, "main"}, "-")
 	task.Id = taskName
-	task.CurrentSolution = file.Content
-	task.ProgLang = LanguageFromRunner(input.Language)
+	task.SetSolution(LanguageFromRunner(input.Language), file.Content)
 	tasks[TaskKey{ticketId, taskName}] = task
 	return task
 }
@@ -92,16 +135,24 @@ func ticketFromTasks(ticketId string, tasks []*Task, opts *Options) *Ticket {
 
 func LoadTicket(tasks map[TaskKey]*Task, opts *Options) *Ticket {
 	ticketId := utils.RandId()
+	return ticketFromTasks(ticketId, []*Task{addGistTask(tasks, ticketId)}, opts)
+}
+
+func NewTicket(tasks map[TaskKey]*Task, opts *Options) *Ticket {
+	ticketId := utils.RandId()
+	return ticketFromTasks(ticketId, []*Task{addDefaultTask(tasks, ticketId)}, opts)
+}
+
+func addGistTask(tasks map[TaskKey]*Task, ticketId string) *Task {
 	gistId := "4f1bae999b5fbea43624"
 	evalContext := code.GistFetch(gistId)
 	task := addToTask(tasks, ticketId, evalContext.Test, "test")
 	task.JudgeSolution = evalContext.Solution
 	task.Generator = evalContext.Generator
-	return ticketFromTasks(ticketId, []*Task{task}, opts)
+	return task
 }
 
-func NewTicket(tasks map[TaskKey]*Task, opts *Options) *Ticket {
-	ticketId := utils.RandId()
+func addDefaultTask(tasks map[TaskKey]*Task, ticketId string) *Task {
 	input := &code.Input{
 		Language: "c",
 		Files: []code.File{
@@ -111,36 +162,30 @@ func NewTicket(tasks map[TaskKey]*Task, opts *Options) *Ticket {
 			},
 		},
 	}
-	task := addToTask(tasks, ticketId, input, "solution")
-	return ticketFromTasks(ticketId, []*Task{task}, opts)
-}
-
-func NewDraftTicket(tasks map[TaskKey]*Task, opts *Options) *Ticket {
-	ticketId := utils.RandId()
-	gistId := "4f1bae999b5fbea43624"
-	evalContext := code.GistFetch(gistId)
-	t1 := addToTask(tasks, ticketId, evalContext.Generator, "generator")
-	t2 := addToTask(tasks, ticketId, evalContext.Solution, "solution")
-	t3 := addToTask(tasks, ticketId, evalContext.Test, "test")
-
-	t1.SelfSolution = code.MakeInput(t1.ProgLang, t1.Filename, t1.CurrentSolution, code.StdinFile(""))
-	t2.SelfSolution = code.MakeInput(t2.ProgLang, t2.Filename, t2.CurrentSolution, code.StdinFile(""))
-	t3.SelfSolution = code.MakeInput(t3.ProgLang, t3.Filename, t3.CurrentSolution, code.StdinFile(""))
-
-	t2.JudgeSolution = t3.SelfSolution
-	t2.Generator = t1.SelfSolution
-	t3.JudgeSolution = t2.SelfSolution
-	t3.Generator = t1.SelfSolution
-
-	return ticketFromTasks(ticketId, []*Task{t1, t2, t3}, opts)
-
+	return addToTask(tasks, ticketId, input, "solution")
+}
+
+// AddTicketTasks adds again to tasks the tasks of a ticket made by
+// NewTicket or LoadTicket and returns them, for tickets that do not come
+// from the problem bank.
+func AddTicketTasks(tasks map[TaskKey]*Task, ticket *Ticket) []*Task {
+	added := []*Task{}
+	for _, taskId := range ticket.Options.TaskNames {
+		switch taskId {
+		case "task-solution-main":
+			added = append(added, addDefaultTask(tasks, ticket.Id))
+		case "task-test-main":
+			added = append(added, addGistTask(tasks, ticket.Id))
+		}
+	}
+	return added
 }
 
 func DefaultOptions() *Options {
 	opts := &Options{
 		TicketId:         "",
-		TimeElapsed:      5,
-		TimeRemaining:    3600,
+		TimeElapsed:      0,
+		TimeRemaining:    0,
 		CurrentHumanLang: "en",
 		CurrentProgLang:  "c",
 		CurrentTaskName:  "task1",
@@ -159,6 +204,7 @@ func DefaultOptions() *Options {
 		},
 		ShowSurvey:  false,
 		ShowWelcome: false,
+		ShowChat:    true,
 		Sequential:  false,
 		SaveOften:   true,
 		Urls: map[string]string{
@@ -173,6 +219,9 @@ func DefaultOptions() *Options {
 			"timeout_action": "/chk/timeout_action/",
 			"final":          "/chk/final/",
 			"start_ticket":   "/c/_start/",
+			"mirror":         "/c/mirror/",
+			"chat":           "/c/chat/",
+			"integrity":      "/c/integrity/",
 		},
 	}
 	return opts
@@ -192,68 +241,102 @@ type MessageGetTask struct {
 }
 
 type Task struct {
-	XMLName          xml.Name    `xml:"response"`
+	XMLName          xml.Name    `xml:"response" json:"-"`
 	Id               string      `xml:"id" json:"id"`
-	Status           string      `xml:"task_status" json: "task_status"`
-	Description      string      `xml:"task_description"`
-	Type             string      `xml:"task_type"`
-	SolutionTemplate string      `xml:"solution_template"`
-	CurrentSolution  string      `xml:"current_solution"`
-	ExampleInput     string      `xml:"example_input"`
-	ProgLangList     string      `xml:"prg_lang_list"`
-	HumanLangList    string      `xml:"human_lang_list"`
-	ProgLang         string      `xml:"prg_lang"`
-	HumanLang        string      `xml:"human_lang"`
-	Src              string      `xml:"-"`
-	Filename         string      `xml:"-"`
-	Generator        *code.Input `xml:"-"`
-	JudgeSolution    *code.Input `xml:"-"`
-	SelfSolution     *code.Input `xml:"-"`
+	Status           string      `xml:"task_status" json:"task_status"`
+	Description      string      `xml:"task_description" json:"task_description"`
+	Type             string      `xml:"task_type" json:"task_type"`
+	SolutionTemplate string      `xml:"solution_template" json:"solution_template"`
+	CurrentSolution  string      `xml:"current_solution" json:"current_solution"`
+	ExampleInput     string      `xml:"example_input" json:"example_input"`
+	ProgLangList     string      `xml:"prg_lang_list" json:"prg_lang_list"`
+	HumanLangList    string      `xml:"human_lang_list" json:"human_lang_list"`
+	ProgLang         string      `xml:"prg_lang" json:"prg_lang"`
+	HumanLang        string      `xml:"human_lang" json:"human_lang"`
+	NextTask         string      `xml:"next_task" json:"next_task"`
+	Src              string      `xml:"-" json:"-"`
+	Filename         string      `xml:"-" json:"-"`
+	Generator        *code.Input `xml:"-" json:"-"`
+	JudgeSolution    *code.Input `xml:"-" json:"-"`
+	SelfSolution     *code.Input `xml:"-" json:"-"`
+	// Templates hold the solution template of each programming language
+	// and Solutions the code saved in each, see SelectProgLang.
+	Templates map[string]string `xml:"-" json:"-"`
+	Solutions map[string]string `xml:"-" json:"-"`
+	// Descriptions hold the description in each human language of the
+	// task, see SelectHumanLang.
+	Descriptions map[string]string `xml:"-" json:"-"`
+	// Assets are the images the description links to, see AssetURL.
+	Assets map[string][]byte `xml:"-" json:"-"`
+	// Problem is the published problem the task was created from, if any.
+	Problem *problem.Problem `xml:"-" json:"-"`
+	// Groups are the tests final submissions are scored on, see TaskGroups,
+	// and Score the outcome of the final submission, see SetScore.
+	Groups []*judge.Group `xml:"-" json:"-"`
+	Score  *judge.Score   `xml:"-" json:"-"`
 }
 
 type ClockRequest struct {
-	TicketId     string `schema:"ticket"`
-	OldTimeLimit int    `schema:"old_timelimit"`
+	TicketId     string `schema:"ticket" json:"ticket"`
+	OldTimeLimit int    `schema:"old_timelimit" json:"old_timelimit"`
 }
 type ClockResponse struct {
-	XMLName      xml.Name `xml:"response"`
-	Result       string   `xml:"result"`
-	NewTimeLimit int      `xml:"new_timelimit"`
+	XMLName      xml.Name `xml:"response" json:"-"`
+	Result       string   `xml:"result" json:"result"`
+	NewTimeLimit int      `xml:"new_timelimit" json:"new_timelimit"`
+	// NewTimeElapsed keeps the clock of every tab of the CUI in step.
+	NewTimeElapsed int `xml:"new_time_elapsed" json:"new_time_elapsed"`
 }
 
 type SolutionRequest struct {
-	Ticket    string `schema:"ticket"`
-	Task      string `schema:"task"`
-	ProgLang  string `scheam:"prg_lang"`
-	Solution  string `schema:"solution"`
-	TestData0 string `schema:"test_data0"`
-	TestData1 string `schema:"test_data1"`
-	TestData2 string `schema:"test_data2"`
-	TestData3 string `schema:"test_data3"`
-	TestData4 string `schema:"test_data4"`
+	Ticket    string `schema:"ticket" json:"ticket"`
+	Task      string `schema:"task" json:"task"`
+	ProgLang  string `schema:"prg_lang" json:"prg_lang"`
+	Solution  string `schema:"solution" json:"solution"`
+	TestData0 string `schema:"test_data0" json:"test_data0,omitempty"`
+	TestData1 string `schema:"test_data1" json:"test_data1,omitempty"`
+	TestData2 string `schema:"test_data2" json:"test_data2,omitempty"`
+	TestData3 string `schema:"test_data3" json:"test_data3,omitempty"`
+	TestData4 string `schema:"test_data4" json:"test_data4,omitempty"`
+	// Seed replays the generated tests of an earlier judgement; 0 picks a
+	// new one.
+	Seed int64 `schema:"seed" json:"seed,omitempty"`
 }
 
 type Status struct {
-	OK      int    `xml:"ok"`
-	Message string `xml:"message"`
+	OK      int    `xml:"ok" json:"ok"`
+	Message string `xml:"message" json:"message"`
+}
+
+// Annotation is a compiler diagnostic in the form the Ace editor shows:
+// Row and Column count from 0 and Type is error, warning or info.
+type Annotation struct {
+	Row    int    `xml:"row" json:"row"`
+	Column int    `xml:"column" json:"column"`
+	Type   string `xml:"type" json:"type"`
+	Text   string `xml:"text" json:"text"`
 }
 type MainStatus struct {
-	Compile   Status `xml:"compile"`
-	Example   Status `xml:"example"`
-	TestData0 Status `xml:"test_data0"`
-	TestData1 Status `xml:"test_data1"`
-	TestData2 Status `xml:"test_data2"`
-	TestData3 Status `xml:"test_data3"`
-	TestData4 Status `xml:"test_data4"`
+	Compile   Status `xml:"compile" json:"compile"`
+	Example   Status `xml:"example" json:"example"`
+	TestData0 Status `xml:"test_data0" json:"test_data0"`
+	TestData1 Status `xml:"test_data1" json:"test_data1"`
+	TestData2 Status `xml:"test_data2" json:"test_data2"`
+	TestData3 Status `xml:"test_data3" json:"test_data3"`
+	TestData4 Status `xml:"test_data4" json:"test_data4"`
+	// Annotations mark the diagnostics of Compile in the editor.
+	Annotations []Annotation `xml:"annotation,omitempty" json:"annotations,omitempty"`
 }
 type VerifyStatus struct {
-	XMLName xml.Name   `xml:"response"`
-	Result  string     `xml:"result"`
-	Message string     `xml:"message"`
-	Id      string     `xml:"id"`
-	Delay   int        `xml:"delay"`
-	Extra   MainStatus `xml:"extra"`
-	//NextTask string     `xml:"next_task"`
+	XMLName xml.Name   `xml:"response" json:"-"`
+	Result  string     `xml:"result" json:"result"`
+	Message string     `xml:"message" json:"message"`
+	Id      string     `xml:"id" json:"id"`
+	Delay   int        `xml:"delay" json:"delay"`
+	Extra   MainStatus `xml:"extra" json:"extra"`
+	// NextTask is set by final submissions to the task the candidate
+	// continues with, "" once the ticket is closed.
+	NextTask string `xml:"next_task" json:"next_task"`
 }
 
 func laterReply() *VerifyStatus {
@@ -295,6 +378,8 @@ func FileNameForCode(progLang string) string {
 		"py3": "py",
 		"go":  "go",
 		"js":  "js",
+		"md":  "md",
+		"txt": "txt",
 	}[progLang]
 	return fmt.Sprintf("main.%s", ext)
 }
@@ -316,8 +401,8 @@ func LanguageFromRunner(progLang string) string {
 		"c":          "cpp",
 		"cpp":        "cpp",
 		"go":         "go",
-		"javascript": "javascript",
-		"py3":        "python",
+		"javascript": "js",
+		"python":     "py3",
 	}[progLang]
 }
 
@@ -329,9 +414,8 @@ func errorResponse(err error, v *VerifyStatus) *VerifyStatus {
 	return v
 }
 
-func GetVerifyStatus(runner *code.Runner, task *Task, solnReq *SolutionRequest, mode Mode) *VerifyStatus {
-	//return laterReply()
-	resp := &VerifyStatus{
+func newVerifyStatus() *VerifyStatus {
+	return &VerifyStatus{
 		Result: "OK",
 		Extra: MainStatus{
 			Compile:   Status{1, "The solution compiled flawlessly."},
@@ -343,6 +427,14 @@ func GetVerifyStatus(runner *code.Runner, task *Task, solnReq *SolutionRequest,
 			TestData4: Status{1, "OK"},
 		},
 	}
+}
+
+// GetVerifyStatus runs or judges the solution of task. When compile is set
+// the solution is compiled first, and runs only if that succeeds, except
+// for final submissions which are scored either way.
+func GetVerifyStatus(runner *code.Runner, compile judge.CompileFunc, task *Task, solnReq *SolutionRequest, mode Mode) *VerifyStatus {
+	//return laterReply()
+	resp := newVerifyStatus()
 	if task == nil {
 		return resp
 	}
@@ -361,6 +453,17 @@ func GetVerifyStatus(runner *code.Runner, task *Task, solnReq *SolutionRequest,
 	}
 	log.Info("In VerifyStatus, input: %s", input)
 	log.Info("In mode %s", mode)
+	if compile != nil {
+		compilation, err := compile(input)
+		if err != nil {
+			return errorResponse(err, resp)
+		}
+		resp.Extra.Compile, resp.Extra.Annotations = CompileStatus(compilation, filename)
+		if !compilation.OK && mode != FINAL {
+			resp.Extra.Example = Status{0, "The solution was not run because it did not compile."}
+			return resp
+		}
+	}
 	switch mode {
 	case VERIFY:
 		out, err := runner.Run(input)
@@ -389,9 +492,23 @@ func GetVerifyStatus(runner *code.Runner, task *Task, solnReq *SolutionRequest,
 		log.Info("Task self: %#v", task.SelfSolution)
 
 		if task.Generator != nil && task.JudgeSolution != nil {
-			result := code.Evaluate(task.Generator, mysoln, task.JudgeSolution, runner)
-			log.Info("Got result of evaluation: %#v", result)
-			resp.Extra.Example.Message = fmt.Sprintf("%#v", result)
+			run := judge.CodeRunner(runner)
+			if mode == FINAL {
+				evaluate, err := judge.ProblemEvaluator(TaskProblem(task), mysoln, run, nil)
+				if err != nil {
+					return errorResponse(err, resp)
+				}
+				return ScoreStatus(task, run, evaluate, resp)
+			}
+			report, err := StressSolution(TaskProblem(task), mysoln, run, nil, solnReq.Seed)
+			if err != nil {
+				return errorResponse(err, resp)
+			}
+			log.Info("Got result of stress testing: %s", report)
+			resp.Extra.Example.Message = report.String()
+			if !report.OK() {
+				resp.Extra.Example.OK = 0
+			}
 		} else {
 			log.Info("Skipping evaluation: Missing JudgeSoln and/or Generator")
 		}
@@ -399,19 +516,19 @@ func GetVerifyStatus(runner *code.Runner, task *Task, solnReq *SolutionRequest,
 	return resp
 }
 
-func GetClock(sessions map[string]*Session, clkReq *ClockRequest) *ClockResponse {
-	session, ok := sessions[clkReq.TicketId]
-	if !ok {
+// GetClock answers a clock request on session, nil when the ticket has none.
+func GetClock(session *Session, clkReq *ClockRequest) *ClockResponse {
+	if session == nil {
 		return &ClockResponse{Result: "OK", NewTimeLimit: clkReq.OldTimeLimit}
 	}
-	elapsed := int(time.Since(session.StartTime) / time.Second)
-	remaining := session.TimeLimit - elapsed
-	log.Info("elapsed: %s, remaining: %s", time.Duration(elapsed)*time.Second, time.Duration(remaining)*time.Second)
-	if remaining < 0 {
-		remaining = 0
+	if session.Closed {
+		return &ClockResponse{Result: "OK", NewTimeLimit: 0}
 	}
+	now := time.Now()
+	remaining := session.Remaining(now)
+	log.Info("elapsed: %s, remaining: %s", session.Elapsed(now), time.Duration(remaining)*time.Second)
 	log.Info("newTimeLimit: %v, that is, %s", remaining, time.Duration(remaining)*time.Second)
-	return &ClockResponse{Result: "OK", NewTimeLimit: remaining}
+	return &ClockResponse{Result: "OK", NewTimeLimit: remaining, NewTimeElapsed: int(session.Elapsed(now) / time.Second)}
 }
 
 const SOLN_TEMPL_CPP = `# include <iostream>
@@ -452,30 +569,31 @@ What is a good algorithm for this?
 `
 
 func getDescFromMarkdown(input []byte) []byte {
-	unsafe := blackfriday.MarkdownCommon(input)
-	html := bluemonday.UGCPolicy().SanitizeBytes(unsafe)
-	return html
+	html, _ := RenderStatement(string(input), "")
+	return []byte(html)
 }
 
 func NewTask() *Task {
 	task := &Task{
-		Id:               "",
-		Status:           "open",
-		Description:      "Placeholder",
-		Type:             "algo",
-		SolutionTemplate: "This is just a template",
-		CurrentSolution:  "",
-		ExampleInput:     "",
-		ProgLangList:     ProgrammingLanguageList(),
-		HumanLangList:    HumanLanguageList(),
-		ProgLang:         "cpp",
-		HumanLang:        "en",
+		Id:            "",
+		Status:        "open",
+		Description:   "Placeholder",
+		Type:          "algo",
+		ExampleInput:  "",
+		ProgLangList:  ProgrammingLanguageList(),
+		HumanLangList: HumanLanguageList(),
+		HumanLang:     "en",
+		Templates:     SolutionTemplates(problem.TEMPLATE_STDIO),
+		Solutions:     map[string]string{},
 	}
+	task.SelectProgLang("cpp")
 	return task
 }
 
+var PROGRAMMING_LANGUAGES = []string{"c", "cpp", "py2", "py3", "go", "js"}
+
 func ProgrammingLanguageList() string {
-	prg_lang_list, _ := json.Marshal([]string{"c", "cpp", "py2", "py3", "go", "js"})
+	prg_lang_list, _ := json.Marshal(PROGRAMMING_LANGUAGES)
 	return string(prg_lang_list)
 }
 
@@ -484,34 +602,46 @@ func HumanLanguageList() string {
 	return string(human_lang_list)
 }
 
-func GetTask(tasks map[TaskKey]*Task, msg *MessageGetTask) *Task {
+// GetTask returns the requested task of a ticket. Sequential tickets only
+// serve the task the candidate is currently on, so asking for a later one
+// returns the current task instead.
+// GetTask serves msg.Task of the ticket of session, nil when the ticket has
+// none. It returns ErrNoSuchTask unless the task is one of the ticket's.
+func GetTask(session *Session, tasks map[TaskKey]*Task, msg *MessageGetTask) (*Task, error) {
+	if session == nil || !session.HasTask(msg.Task) {
+		return nil, ErrNoSuchTask
+	}
+	if session.Ticket.Options.Sequential && !session.IsFinalized(msg.Task) {
+		if active := session.ActiveTask(); active != "" && active != msg.Task {
+			log.Info("Task %s of sequential ticket %s is locked, serving %s", msg.Task, msg.Ticket, active)
+			msg.Task = active
+		}
+	}
 	key := TaskKey{msg.Ticket, msg.Task}
 	task, ok := tasks[key]
 	log.Info("Looking for %s in tasks: %v", key, ok)
 
 	if !ok || task == nil {
+		// The task of the ticket could not be restored.
 		log.Info("Serving task based on nil request")
-		task = &Task{
-			Id:               msg.Task,
-			Status:           "open",
-			Description:      string(getDescFromMarkdown([]byte(DESC_TEMPL))),
-			Type:             "algo",
-			SolutionTemplate: "This is just a template",
-			CurrentSolution:  SOLN_TEMPL_CPP,
-			ExampleInput:     "",
-			ProgLangList:     ProgrammingLanguageList(),
-			HumanLangList:    HumanLanguageList(),
-			ProgLang:         msg.ProgLang,
-			HumanLang:        msg.HumanLang,
+		task = NewTask()
+		task.Id = msg.Task
+		task.Description = string(getDescFromMarkdown([]byte(DESC_TEMPL)))
+		if msg.ProgLang != "" {
+			task.SelectProgLang(msg.ProgLang)
 		}
 		tasks[key] = task
 	}
 	log.Info("PREFER-SERVER-LANG: %v", msg.PreferServerProgLang)
-	if msg.PreferServerProgLang {
+	if msg.PreferServerProgLang && msg.ProgLang != "" {
 		log.Info("Updating task %s prog-lang form %s to %s", task.Id, task.ProgLang, msg.ProgLang)
-		task.ProgLang = msg.ProgLang
+		task.SelectProgLang(msg.ProgLang)
 	}
-	log.Info("Updating task %s prog-lang form %s to %s", task.Id, task.HumanLang, msg.HumanLang)
-	task.HumanLang = msg.HumanLang
-	return task
+	log.Info("Updating task %s human-lang from %s to %s", task.Id, task.HumanLang, msg.HumanLang)
+	task.SelectHumanLang(msg.HumanLang)
+	task.NextTask = session.NextTask(task.Id)
+	if session.CheckTaskOpen(task.Id) != nil {
+		task.Status = "closed"
+	}
+	return task, nil
 }
@@ -1,6 +1,7 @@
 package cui
 
 import (
+	"encoding/json"
 	"fmt"
 	"testing"
 )
@@ -94,6 +95,9 @@ func TestOptions(t *testing.T) {
 		},
 	}
 
-	fmt.Println(opts)
-	Render(opts)
+	out, err := json.Marshal(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(string(out))
 }
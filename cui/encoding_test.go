@@ -0,0 +1,107 @@
+package cui
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"github.com/maddyonline/goonj/judge"
+	"testing"
+)
+
+// The CUI client parses the XML encodings and the /api/v1 clients the JSON
+// ones; both must keep their field names.
+
+func checkEncodings(t *testing.T, v interface{}, wantXML, wantJSON string) {
+	gotXML, err := xml.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(gotXML) != wantXML {
+		t.Errorf("xml:\n got %s\nwant %s", gotXML, wantXML)
+	}
+	gotJSON, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(gotJSON) != wantJSON {
+		t.Errorf("json:\n got %s\nwant %s", gotJSON, wantJSON)
+	}
+}
+
+func TestClockResponseEncoding(t *testing.T) {
+	checkEncodings(t, &ClockResponse{Result: "OK", NewTimeLimit: 1200, NewTimeElapsed: 600},
+		`<response><result>OK</result><new_timelimit>1200</new_timelimit><new_time_elapsed>600</new_time_elapsed></response>`,
+		`{"result":"OK","new_timelimit":1200,"new_time_elapsed":600}`)
+}
+
+func TestVerifyStatusEncoding(t *testing.T) {
+	resp := &VerifyStatus{
+		Result: "OK",
+		Extra: MainStatus{
+			Compile: Status{1, "The solution compiled flawlessly."},
+			Example: Status{0, "wrong answer"},
+		},
+		NextTask: "task2",
+	}
+	checkEncodings(t, resp,
+		`<response><result>OK</result><message></message><id></id><delay>0</delay><extra>`+
+			`<compile><ok>1</ok><message>The solution compiled flawlessly.</message></compile>`+
+			`<example><ok>0</ok><message>wrong answer</message></example>`+
+			`<test_data0><ok>0</ok><message></message></test_data0>`+
+			`<test_data1><ok>0</ok><message></message></test_data1>`+
+			`<test_data2><ok>0</ok><message></message></test_data2>`+
+			`<test_data3><ok>0</ok><message></message></test_data3>`+
+			`<test_data4><ok>0</ok><message></message></test_data4>`+
+			`</extra><next_task>task2</next_task></response>`,
+		`{"result":"OK","message":"","id":"","delay":0,"extra":{`+
+			`"compile":{"ok":1,"message":"The solution compiled flawlessly."},`+
+			`"example":{"ok":0,"message":"wrong answer"},`+
+			`"test_data0":{"ok":0,"message":""},"test_data1":{"ok":0,"message":""},`+
+			`"test_data2":{"ok":0,"message":""},"test_data3":{"ok":0,"message":""},`+
+			`"test_data4":{"ok":0,"message":""}},"next_task":"task2"}`)
+}
+
+func TestTaskEncoding(t *testing.T) {
+	task := &Task{
+		Id:              "task1",
+		Status:          "open",
+		Description:     "<p>desc</p>",
+		Type:            "algo",
+		CurrentSolution: "int main() {}",
+		ProgLangList:    `["c"]`,
+		HumanLangList:   `["en"]`,
+		ProgLang:        "c",
+		HumanLang:       "en",
+		NextTask:        "task2",
+		Src:             "/tmp/secret/path",
+	}
+	checkEncodings(t, task,
+		`<response><id>task1</id><task_status>open</task_status><task_description>&lt;p&gt;desc&lt;/p&gt;</task_description>`+
+			`<task_type>algo</task_type><solution_template></solution_template><current_solution>int main() {}</current_solution>`+
+			`<example_input></example_input><prg_lang_list>[&#34;c&#34;]</prg_lang_list><human_lang_list>[&#34;en&#34;]</human_lang_list>`+
+			`<prg_lang>c</prg_lang><human_lang>en</human_lang><next_task>task2</next_task></response>`,
+		`{"id":"task1","task_status":"open","task_description":"\u003cp\u003edesc\u003c/p\u003e","task_type":"algo",`+
+			`"solution_template":"","current_solution":"int main() {}","example_input":"",`+
+			`"prg_lang_list":"[\"c\"]","human_lang_list":"[\"en\"]","prg_lang":"c","human_lang":"en","next_task":"task2"}`)
+}
+
+func TestCompileStatusAnnotations(t *testing.T) {
+	c := &judge.Compilation{OK: false, Diagnostics: judge.ParseDiagnostics(
+		"main.cpp:5:5: error: 'foo' was not declared in this scope\n/usr/include/x.h:1:1: note: declared here\n")}
+	compile, annotations := CompileStatus(c, "main.cpp")
+	checkEncodings(t, &MainStatus{Compile: compile, Annotations: annotations},
+		`<MainStatus><compile><ok>0</ok><message>Compilation failed:&#xA;main.cpp:5:5: error: &#39;foo&#39; was not declared in this scope&#xA;`+
+			`/usr/include/x.h:1:1: note: declared here</message></compile>`+
+			`<example><ok>0</ok><message></message></example>`+
+			`<test_data0><ok>0</ok><message></message></test_data0>`+
+			`<test_data1><ok>0</ok><message></message></test_data1>`+
+			`<test_data2><ok>0</ok><message></message></test_data2>`+
+			`<test_data3><ok>0</ok><message></message></test_data3>`+
+			`<test_data4><ok>0</ok><message></message></test_data4>`+
+			`<annotation><row>4</row><column>4</column><type>error</type><text>&#39;foo&#39; was not declared in this scope</text></annotation></MainStatus>`,
+		`{"compile":{"ok":0,"message":"Compilation failed:\nmain.cpp:5:5: error: 'foo' was not declared in this scope\n/usr/include/x.h:1:1: note: declared here"},`+
+			`"example":{"ok":0,"message":""},`+
+			`"test_data0":{"ok":0,"message":""},"test_data1":{"ok":0,"message":""},`+
+			`"test_data2":{"ok":0,"message":""},"test_data3":{"ok":0,"message":""},`+
+			`"test_data4":{"ok":0,"message":""},`+
+			`"annotations":[{"row":4,"column":4,"type":"error","text":"'foo' was not declared in this scope"}]}`)
+}
@@ -0,0 +1,200 @@
+package cui
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Integrity events the CUI reports: text pasted into the editor, the
+// window losing and regaining focus and the developer tools being opened.
+const (
+	EVENT_PASTE    = "paste"
+	EVENT_BLUR     = "blur"
+	EVENT_FOCUS    = "focus"
+	EVENT_DEVTOOLS = "devtools"
+)
+
+// MAX_INTEGRITY_EVENTS is the most events a ticket keeps. Later events are
+// only counted, and flag the session.
+const MAX_INTEGRITY_EVENTS = 2000
+
+var (
+	ErrUnknownEvent = errors.New("unknown integrity event")
+	ErrPasteSize    = errors.New("paste events need a positive size")
+)
+
+// IntegrityEvent is something the candidate did that reviewers may want to
+// look at. Size is the number of characters pasted.
+type IntegrityEvent struct {
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+	Task string    `json:"task,omitempty"`
+	Size int       `json:"size,omitempty"`
+}
+
+// IntegrityThresholds flag a session for review when any of them is
+// exceeded. Zero disables a threshold.
+type IntegrityThresholds struct {
+	// MaxPaste is the largest single paste, MaxPasted all pastes together,
+	// in characters.
+	MaxPaste  int
+	MaxPasted int
+	MaxBlurs  int
+	// MaxAway is how long the candidate may spend outside the CUI.
+	MaxAway      time.Duration
+	FlagDevtools bool
+}
+
+// IntegritySummary sums up the integrity events of a session. Reasons
+// lists the thresholds exceeded; the session is flagged if there are any.
+// DroppedEvents counts the events beyond MAX_INTEGRITY_EVENTS, which are
+// summed up but not kept.
+type IntegritySummary struct {
+	Pastes        int      `json:"pastes"`
+	PastedChars   int      `json:"pasted_chars"`
+	LargestPaste  int      `json:"largest_paste"`
+	Blurs         int      `json:"blurs"`
+	AwaySec       int      `json:"away_sec"`
+	Devtools      int      `json:"devtools"`
+	DroppedEvents int      `json:"dropped_events"`
+	Flagged       bool     `json:"flagged"`
+	Reasons       []string `json:"reasons"`
+}
+
+// IntegrityTally adds up integrity events. A session keeps the tally of
+// the events it no longer has room for. Time away runs from a blur to the
+// next focus.
+type IntegrityTally struct {
+	Events       int           `json:"events"`
+	Pastes       int           `json:"pastes"`
+	PastedChars  int           `json:"pasted_chars"`
+	LargestPaste int           `json:"largest_paste"`
+	Blurs        int           `json:"blurs"`
+	Away         time.Duration `json:"away"`
+	AwaySince    time.Time     `json:"away_since"`
+	Devtools     int           `json:"devtools"`
+}
+
+func (t *IntegrityTally) add(ev IntegrityEvent) {
+	t.Events++
+	switch ev.Type {
+	case EVENT_PASTE:
+		t.Pastes++
+		t.PastedChars += ev.Size
+		if ev.Size > t.LargestPaste {
+			t.LargestPaste = ev.Size
+		}
+	case EVENT_BLUR:
+		if t.AwaySince.IsZero() {
+			t.Blurs++
+			t.AwaySince = ev.Time
+		}
+	case EVENT_FOCUS:
+		if !t.AwaySince.IsZero() {
+			t.Away += ev.Time.Sub(t.AwaySince)
+			t.AwaySince = time.Time{}
+		}
+	case EVENT_DEVTOOLS:
+		t.Devtools++
+	}
+}
+
+// tally adds up the events of s, the kept ones and the dropped ones.
+func (s *Session) tally() *IntegrityTally {
+	t := &IntegrityTally{}
+	for _, ev := range s.Events {
+		t.add(ev)
+	}
+	if d := s.DroppedEvents; d != nil {
+		t.Events += d.Events
+		t.Pastes += d.Pastes
+		t.PastedChars += d.PastedChars
+		if d.LargestPaste > t.LargestPaste {
+			t.LargestPaste = d.LargestPaste
+		}
+		t.Blurs += d.Blurs
+		t.Away += d.Away
+		t.AwaySince = d.AwaySince
+		t.Devtools += d.Devtools
+	}
+	return t
+}
+
+// RecordEvent adds ev, which happened at now, to the events of s and
+// returns it as recorded. Past MAX_INTEGRITY_EVENTS it is only counted in
+// s.DroppedEvents. Events stop being recorded when the ticket is closed.
+func (s *Session) RecordEvent(now time.Time, ev IntegrityEvent) (IntegrityEvent, error) {
+	switch {
+	case ev.Type != EVENT_PASTE && ev.Type != EVENT_BLUR && ev.Type != EVENT_FOCUS && ev.Type != EVENT_DEVTOOLS:
+		return ev, ErrUnknownEvent
+	case ev.Type == EVENT_PASTE && ev.Size <= 0:
+		return ev, ErrPasteSize
+	case s.Closed:
+		return ev, ErrTicketClosed
+	}
+	if ev.Type != EVENT_PASTE {
+		ev.Size = 0
+	}
+	ev.Time = now
+	if len(s.Events) < MAX_INTEGRITY_EVENTS {
+		s.Events = append(s.Events, ev)
+		return ev, nil
+	}
+	if s.DroppedEvents == nil {
+		// Carry on from where the kept events leave the candidate.
+		s.DroppedEvents = &IntegrityTally{AwaySince: s.tally().AwaySince}
+	}
+	s.DroppedEvents.add(ev)
+	return ev, nil
+}
+
+// IntegritySummary sums up the events of s at now and flags the session
+// if it exceeds thresholds. Time away runs from a blur to the next focus,
+// or to the end of the session when the candidate never came back.
+func (s *Session) IntegritySummary(now time.Time, thresholds IntegrityThresholds) *IntegritySummary {
+	if s.Closed && !s.ClosedAt.IsZero() {
+		now = s.ClosedAt
+	}
+	t := s.tally()
+	away := t.Away
+	if !t.AwaySince.IsZero() && now.After(t.AwaySince) {
+		away += now.Sub(t.AwaySince)
+	}
+	sum := &IntegritySummary{
+		Pastes:       t.Pastes,
+		PastedChars:  t.PastedChars,
+		LargestPaste: t.LargestPaste,
+		Blurs:        t.Blurs,
+		AwaySec:      int(away / time.Second),
+		Devtools:     t.Devtools,
+		Reasons:      []string{},
+	}
+	if s.DroppedEvents != nil {
+		sum.DroppedEvents = s.DroppedEvents.Events
+	}
+
+	flag := func(format string, a ...interface{}) {
+		sum.Reasons = append(sum.Reasons, fmt.Sprintf(format, a...))
+	}
+	if thresholds.MaxPaste > 0 && sum.LargestPaste > thresholds.MaxPaste {
+		flag("pasted %d characters at once, more than %d", sum.LargestPaste, thresholds.MaxPaste)
+	}
+	if thresholds.MaxPasted > 0 && sum.PastedChars > thresholds.MaxPasted {
+		flag("pasted %d characters in all, more than %d", sum.PastedChars, thresholds.MaxPasted)
+	}
+	if thresholds.MaxBlurs > 0 && sum.Blurs > thresholds.MaxBlurs {
+		flag("left the window %d times, more than %d", sum.Blurs, thresholds.MaxBlurs)
+	}
+	if thresholds.MaxAway > 0 && away > thresholds.MaxAway {
+		flag("spent %s outside the window, more than %s", away/time.Second*time.Second, thresholds.MaxAway)
+	}
+	if thresholds.FlagDevtools && sum.Devtools > 0 {
+		flag("opened the developer tools")
+	}
+	if sum.DroppedEvents > 0 {
+		flag("reported %d events, more than the %d kept", t.Events, MAX_INTEGRITY_EVENTS)
+	}
+	sum.Flagged = len(sum.Reasons) > 0
+	return sum
+}
@@ -0,0 +1,92 @@
+package cui
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIntegritySummary(t *testing.T) {
+	start := time.Date(2016, 1, 1, 10, 0, 0, 0, time.UTC)
+	at := func(sec int) time.Time { return start.Add(time.Duration(sec) * time.Second) }
+	s := &Session{}
+	for _, ev := range []struct {
+		sec int
+		ev  IntegrityEvent
+	}{
+		{10, IntegrityEvent{Type: EVENT_PASTE, Task: "task1", Size: 40}},
+		{20, IntegrityEvent{Type: EVENT_BLUR}},
+		{25, IntegrityEvent{Type: EVENT_BLUR}},
+		{80, IntegrityEvent{Type: EVENT_FOCUS}},
+		{90, IntegrityEvent{Type: EVENT_PASTE, Task: "task1", Size: 300}},
+		{100, IntegrityEvent{Type: EVENT_FOCUS, Size: 7}},
+		{200, IntegrityEvent{Type: EVENT_BLUR}},
+	} {
+		if _, err := s.RecordEvent(at(ev.sec), ev.ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, bad := range []struct {
+		ev  IntegrityEvent
+		err error
+	}{
+		{IntegrityEvent{Type: "print"}, ErrUnknownEvent},
+		{IntegrityEvent{Type: EVENT_PASTE}, ErrPasteSize},
+	} {
+		if _, err := s.RecordEvent(at(210), bad.ev); err != bad.err {
+			t.Errorf("%+v: expected %v, got %v", bad.ev, bad.err, err)
+		}
+	}
+	if s.Events[5].Size != 0 || !s.Events[0].Time.Equal(at(10)) {
+		t.Errorf("expected timestamped events with sizes only for pastes, got %+v", s.Events)
+	}
+
+	// Still away since 200.
+	sum := s.IntegritySummary(at(260), IntegrityThresholds{MaxPaste: 500, MaxBlurs: 2, MaxAway: 2 * time.Minute})
+	if sum.Pastes != 2 || sum.PastedChars != 340 || sum.LargestPaste != 300 || sum.Blurs != 2 || sum.AwaySec != 120 {
+		t.Errorf("wrong summary %+v", sum)
+	}
+	if sum.Flagged {
+		t.Errorf("expected no threshold to be exceeded, got %v", sum.Reasons)
+	}
+	sum = s.IntegritySummary(at(261), IntegrityThresholds{MaxPaste: 200, MaxPasted: 1000, MaxAway: 2 * time.Minute})
+	if !sum.Flagged || len(sum.Reasons) != 2 {
+		t.Errorf("expected the paste and the time away to be flagged, got %+v", sum)
+	}
+
+	s.Close(at(230))
+	if _, err := s.RecordEvent(at(240), IntegrityEvent{Type: EVENT_DEVTOOLS}); err != ErrTicketClosed {
+		t.Errorf("expected no events after the ticket is closed, got %v", err)
+	}
+	if sum = s.IntegritySummary(at(1000), IntegrityThresholds{}); sum.AwaySec != 90 || sum.Flagged {
+		t.Errorf("expected time away to stop when the ticket closed, got %+v", sum)
+	}
+}
+
+func TestIntegrityEventsBeyondTheLimit(t *testing.T) {
+	start := time.Date(2016, 1, 1, 10, 0, 0, 0, time.UTC)
+	s := &Session{}
+	s.RecordEvent(start, IntegrityEvent{Type: EVENT_BLUR})
+	for len(s.Events) < MAX_INTEGRITY_EVENTS {
+		s.RecordEvent(start, IntegrityEvent{Type: EVENT_DEVTOOLS})
+	}
+	for _, ev := range []IntegrityEvent{
+		{Type: EVENT_FOCUS},
+		{Type: EVENT_PASTE, Size: 5000},
+		{Type: EVENT_BLUR},
+		{Type: EVENT_PASTE, Size: 20},
+	} {
+		if _, err := s.RecordEvent(start.Add(time.Minute), ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(s.Events) != MAX_INTEGRITY_EVENTS {
+		t.Errorf("expected %d events kept, got %d", MAX_INTEGRITY_EVENTS, len(s.Events))
+	}
+	sum := s.IntegritySummary(start.Add(2*time.Minute), IntegrityThresholds{})
+	if sum.Pastes != 2 || sum.PastedChars != 5020 || sum.LargestPaste != 5000 || sum.Blurs != 2 || sum.AwaySec != 120 || sum.DroppedEvents != 4 {
+		t.Errorf("expected the dropped events to be counted, got %+v", sum)
+	}
+	if !sum.Flagged || len(sum.Reasons) != 1 {
+		t.Errorf("expected the session to be flagged for its dropped events, got %+v", sum)
+	}
+}
@@ -0,0 +1,74 @@
+package cui
+
+import (
+	"fmt"
+	"github.com/labstack/gommon/log"
+	"github.com/maddyonline/code"
+	"github.com/maddyonline/goonj/judge"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// interactionStatus shows the verdict of the interactor and the transcript.
+func interactionStatus(in *judge.Interaction, resp *VerifyStatus) *VerifyStatus {
+	verdict := in.Message
+	if in.OK && verdict == "" {
+		verdict = "accepted"
+	}
+	resp.Extra.Example.Message = fmt.Sprintf("Verdict: %s\nQueries: %d\nTranscript:\n%s", verdict, in.Queries, in.TranscriptString())
+	if !in.OK {
+		resp.Extra.Example.OK = 0
+	}
+	return resp
+}
+
+// InteractiveVerifyStatus is GetVerifyStatus for tasks of interactive
+// problems. Running a solution lets it talk to the interactor given the
+// custom input; judging stress tests it on generated inputs and final
+// submissions are scored like those of other tasks.
+func InteractiveVerifyStatus(interact judge.InteractFunc, compile judge.CompileFunc, run judge.RunFunc, task *Task, solnReq *SolutionRequest, mode Mode) *VerifyStatus {
+	resp := newVerifyStatus()
+	p := task.Problem
+	content, err := ioutil.ReadFile(task.Src)
+	if err != nil {
+		return errorResponse(err, resp)
+	}
+	soln := code.MakeInput(LanguageForRunner(task.ProgLang), filepath.Base(task.Src), string(content), code.StdinFile(""))
+	task.SelfSolution = soln
+	if compile != nil {
+		compilation, err := compile(soln)
+		if err != nil {
+			return errorResponse(err, resp)
+		}
+		resp.Extra.Compile, resp.Extra.Annotations = CompileStatus(compilation, filepath.Base(task.Src))
+		if !compilation.OK && mode != FINAL {
+			resp.Extra.Example = Status{0, "The solution was not run because it did not compile."}
+			return resp
+		}
+	}
+	switch mode {
+	case VERIFY:
+		in, err := interact(p.Interactor, soln, solnReq.TestData0, p.QueryLimit)
+		if err != nil {
+			return errorResponse(err, resp)
+		}
+		return interactionStatus(in, resp)
+	case FINAL:
+		evaluate, err := judge.ProblemEvaluator(p, soln, run, interact)
+		if err != nil {
+			return errorResponse(err, resp)
+		}
+		return ScoreStatus(task, run, evaluate, resp)
+	case JUDGE:
+		report, err := StressSolution(p, soln, run, interact, solnReq.Seed)
+		if err != nil {
+			return errorResponse(err, resp)
+		}
+		log.Info("Got result of interactive stress testing: %s", report)
+		resp.Extra.Example.Message = report.String()
+		if !report.OK() {
+			resp.Extra.Example.OK = 0
+		}
+	}
+	return resp
+}
@@ -0,0 +1,132 @@
+package cui
+
+import (
+	"fmt"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/russross/blackfriday"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Statements are markdown with tables, images, LaTeX math between $ ... $
+// or $$ ... $$, and example blocks written as fenced code blocks:
+//
+//	```example-input
+//	appease
+//	```
+//	```example-output
+//	1
+//	```
+//
+// Math and examples are cut out before blackfriday sees them, so neither
+// its emphasis nor the sanitizer can mangle them, and put back as escaped
+// text afterwards. The CUI typesets the math if MathJax loaded.
+const (
+	EXAMPLE_INPUT  = "example-input"
+	EXAMPLE_OUTPUT = "example-output"
+)
+
+var (
+	fencedBlock = regexp.MustCompile("(?ms)^```([\\w-]*)[ \t]*\n(.*?)^```[ \t]*$")
+	codeSpan    = regexp.MustCompile("`[^`\n]+`")
+	displayMath = regexp.MustCompile(`(?s)\$\$(.+?)\$\$`)
+	inlineMath  = regexp.MustCompile(`\$([^\s$](?:[^$\n]*[^\s$\\])?)\$`)
+	imageSrc    = regexp.MustCompile(`(<img [^>]*src=")([^"]*)(")`)
+	placeholder = regexp.MustCompile(`<p>GOONJSNIPPET(\d+)X</p>|GOONJSNIPPET(\d+)X`)
+)
+
+var exampleTitles = map[string]string{
+	EXAMPLE_INPUT:  "Example input",
+	EXAMPLE_OUTPUT: "Example output",
+}
+
+// statementPolicy is bluemonday's policy for user content, which already
+// drops scripts, event handlers and javascript: URLs, with the language
+// classes blackfriday puts on code blocks.
+func statementPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w-]+$`)).OnElements("code")
+	return p
+}
+
+// snippets holds the HTML of the parts cut out of a statement.
+type snippets []string
+
+func (s *snippets) add(html string) string {
+	*s = append(*s, html)
+	return fmt.Sprintf("GOONJSNIPPET%dX", len(*s)-1)
+}
+
+// cutMath replaces the math in text that is not code by placeholders.
+func (s *snippets) cutMath(text string) string {
+	code := codeSpan.FindAllStringIndex(text, -1)
+	out := ""
+	last := 0
+	for _, span := range append(code, []int{len(text), len(text)}) {
+		prose := text[last:span[0]]
+		prose = displayMath.ReplaceAllStringFunc(prose, func(m string) string {
+			tex := displayMath.FindStringSubmatch(m)[1]
+			return "\n\n" + s.add(`<div class="math math-display">\[`+html.EscapeString(tex)+`\]</div>`) + "\n\n"
+		})
+		prose = inlineMath.ReplaceAllStringFunc(prose, func(m string) string {
+			tex := inlineMath.FindStringSubmatch(m)[1]
+			return s.add(`<span class="math math-inline">\(` + html.EscapeString(tex) + `\)</span>`)
+		})
+		out += prose + text[span[0]:span[1]]
+		last = span[1]
+	}
+	return out
+}
+
+// AssetURL is where the CUI serves the assets of a task.
+func AssetURL(ticketId, taskId string) string {
+	return fmt.Sprintf("/c/assets/%s/%s/", ticketId, taskId)
+}
+
+// RenderStatement turns a markdown statement into sanitized HTML and
+// returns it with the content of its first example input block. Relative
+// image links are resolved against assetURL, with the assets/ directory of
+// problem packages stripped.
+func RenderStatement(markdown, assetURL string) (string, string) {
+	s := &snippets{}
+	exampleInput := ""
+	foundExample := false
+	text := ""
+	last := 0
+	for _, m := range fencedBlock.FindAllStringSubmatchIndex(markdown, -1) {
+		text += s.cutMath(markdown[last:m[0]])
+		block, info, content := markdown[m[0]:m[1]], markdown[m[2]:m[3]], markdown[m[4]:m[5]]
+		if title, ok := exampleTitles[info]; ok {
+			if info == EXAMPLE_INPUT && !foundExample {
+				exampleInput, foundExample = content, true
+			}
+			block = "\n" + s.add(fmt.Sprintf(`<div class="example %s"><div class="example-title">%s</div><pre>%s</pre></div>`,
+				info, title, html.EscapeString(content))) + "\n"
+		}
+		text += block
+		last = m[1]
+	}
+	text += s.cutMath(markdown[last:])
+
+	unsafe := blackfriday.MarkdownCommon([]byte(text))
+	safe := string(statementPolicy().SanitizeBytes(unsafe))
+	safe = imageSrc.ReplaceAllStringFunc(safe, func(img string) string {
+		m := imageSrc.FindStringSubmatch(img)
+		src := html.UnescapeString(m[2])
+		if assetURL == "" || strings.Contains(src, ":") || strings.HasPrefix(src, "/") {
+			return img
+		}
+		return m[1] + html.EscapeString(assetURL+strings.TrimPrefix(src, "assets/")) + m[3]
+	})
+	safe = placeholder.ReplaceAllStringFunc(safe, func(p string) string {
+		m := placeholder.FindStringSubmatch(p)
+		i, err := strconv.Atoi(m[1] + m[2])
+		if err != nil || i >= len(*s) {
+			return p
+		}
+		return (*s)[i]
+	})
+	return safe, exampleInput
+}
@@ -0,0 +1,60 @@
+package cui
+
+import (
+	"github.com/maddyonline/goonj/problem"
+	"strings"
+	"testing"
+)
+
+func TestRenderStatement(t *testing.T) {
+	markdown := "# Sums\n\nGiven $a_i$ and $b_i$ with `$x$` in code, for $5 and $10,\n\n" +
+		"$$\\sum_{i=1}^n a_i < 10^9$$\n\n" +
+		"| n | answer |\n|---|--------|\n| 1 | 2 |\n\n" +
+		"![tree](assets/tree.png) ![logo](https://example.com/logo.png)\n\n" +
+		"```example-input\n1 2\n```\n\n```example-output\n3\n```\n\n" +
+		"```example-input\n4 5\n```\n\n" +
+		"<script>alert(1)</script><img src=x onerror=alert(2)> [link](javascript:alert(3)) $<script>$\n"
+	html, example := RenderStatement(markdown, "/c/assets/t/task1/")
+	if example != "1 2\n" {
+		t.Errorf("expected the first example input, got %q", example)
+	}
+	for _, want := range []string{
+		`<span class="math math-inline">\(a_i\)</span> and <span class="math math-inline">\(b_i\)</span>`,
+		"<code>$x$</code>",
+		"for $5 and $10",
+		`<div class="math math-display">\[\sum_{i=1}^n a_i &lt; 10^9\]</div>`,
+		"<table>",
+		`src="/c/assets/t/task1/tree.png"`,
+		`src="https://example.com/logo.png"`,
+		`<div class="example example-input"><div class="example-title">Example input</div><pre>1 2` + "\n</pre></div>",
+		`<div class="example example-output"><div class="example-title">Example output</div><pre>3` + "\n</pre></div>",
+		`<span class="math math-inline">\(&lt;script&gt;\)</span>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("expected %s in\n%s", want, html)
+		}
+	}
+	for _, unwanted := range []string{"<script", "onerror", "javascript:", "GOONJSNIPPET", "<p><div"} {
+		if strings.Contains(html, unwanted) {
+			t.Errorf("unexpected %s in\n%s", unwanted, html)
+		}
+	}
+}
+
+func TestProblemTicketUsesStatementExample(t *testing.T) {
+	tasks := map[TaskKey]*Task{}
+	p := &problem.Problem{
+		Manifest:  problem.Manifest{Id: "sum"},
+		Statement: "Add.\n\n```example-input\n1 2\n```\n\n![plot](assets/plot.png)\n",
+		Tests:     problem.ParseTests("3 4"),
+		Assets:    map[string][]byte{"plot.png": []byte("png")},
+	}
+	ticket := NewProblemTicket(tasks, []*problem.Problem{p}, nil)
+	task := tasks[TaskKey{ticket.Id, "sum"}]
+	if task.ExampleInput != "1 2\n" {
+		t.Errorf("expected the example of the statement, got %q", task.ExampleInput)
+	}
+	if url := AssetURL(ticket.Id, "sum") + "plot.png"; !strings.Contains(task.Description, url) || task.Assets["plot.png"] == nil {
+		t.Errorf("expected the image at %s, got %s", url, task.Description)
+	}
+}
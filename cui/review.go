@@ -0,0 +1,299 @@
+package cui
+
+import (
+	"fmt"
+	"github.com/maddyonline/code"
+	"github.com/maddyonline/goonj/judge"
+	"github.com/maddyonline/goonj/problem"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Checks of a problem review, in the order ReviewProblem runs them.
+const (
+	CHECK_STRUCTURE = "structure"
+	CHECK_STATEMENT = "statement"
+	CHECK_TEMPLATES = "templates"
+	CHECK_REFERENCE = "reference"
+	CHECK_CHECKER   = "checker"
+	CHECK_GENERATOR = "generator"
+	CHECK_WRONG     = "wrong_solutions"
+	CHECK_CROSS     = "cross_validation"
+)
+
+// ReviewConfig holds what ReviewProblem runs programs with. Seed picks the
+// generated inputs, a random seed when 0. The reference may take up to
+// TimeLimit on each test.
+type ReviewConfig struct {
+	Run       judge.RunFunc
+	Interact  judge.InteractFunc
+	Compile   judge.CompileFunc
+	Seed      int64
+	TimeLimit time.Duration
+}
+
+// ReviewCheck is the outcome of one check. Details list what was checked,
+// failures first. Checks that need a sound problem are skipped when its
+// structure is not.
+type ReviewCheck struct {
+	Name     string   `json:"name"`
+	OK       bool     `json:"ok"`
+	Skipped  bool     `json:"skipped,omitempty"`
+	Details  []string `json:"details"`
+	failures int
+}
+
+// Review is the machine-readable report of ReviewProblem.
+type Review struct {
+	ProblemId string         `json:"problem_id"`
+	Title     string         `json:"title"`
+	Version   int            `json:"version"`
+	Seed      int64          `json:"seed"`
+	OK        bool           `json:"ok"`
+	Checks    []*ReviewCheck `json:"checks"`
+}
+
+func (c *ReviewCheck) fail(format string, a ...interface{}) {
+	c.OK = false
+	c.Details = append(c.Details, "")
+	copy(c.Details[c.failures+1:], c.Details[c.failures:])
+	c.Details[c.failures] = fmt.Sprintf(format, a...)
+	c.failures++
+}
+
+func (c *ReviewCheck) pass(format string, a ...interface{}) {
+	c.Details = append(c.Details, fmt.Sprintf(format, a...))
+}
+
+// ReviewProblem checks p before it goes live: its structure, that its
+// statements render, that every solution template compiles, that the
+// reference passes every test within the time limit and is accepted by the
+// checker, that the generator is deterministic, that the known-wrong
+// solutions fail a test, and finally cross-validates it.
+func ReviewProblem(p *problem.Problem, cfg ReviewConfig) *Review {
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+	review := &Review{ProblemId: p.Id, Title: p.Title, Version: p.Version, Seed: cfg.Seed, Checks: []*ReviewCheck{}}
+	check := func(name string) *ReviewCheck {
+		c := &ReviewCheck{Name: name, OK: true, Details: []string{}}
+		review.Checks = append(review.Checks, c)
+		return c
+	}
+	structure := check(CHECK_STRUCTURE)
+	if err := p.Validate(); err != nil {
+		structure.fail("%v", err)
+	} else {
+		structure.pass("%d tests, %d known-wrong solutions", len(p.Tests), len(p.Wrong))
+	}
+	reviewStatements(p, check(CHECK_STATEMENT))
+	reviewTemplates(p, cfg, check(CHECK_TEMPLATES))
+	if !structure.OK {
+		for _, name := range []string{CHECK_REFERENCE, CHECK_CHECKER, CHECK_GENERATOR, CHECK_WRONG, CHECK_CROSS} {
+			c := check(name)
+			c.Skipped = true
+			c.pass("skipped, the problem is incomplete")
+		}
+	} else {
+		groups := reviewReference(p, cfg, check(CHECK_REFERENCE), check(CHECK_CHECKER))
+		reviewGenerator(p, cfg, check(CHECK_GENERATOR))
+		reviewWrong(p, cfg, groups, check(CHECK_WRONG))
+		cross := check(CHECK_CROSS)
+		stress := judge.DefaultStress
+		stress.Seed = cfg.Seed
+		stress.Interact = cfg.Interact
+		if report := judge.CrossValidate(p, cfg.Run, stress); report.OK() {
+			cross.pass("%s", report)
+		} else {
+			cross.fail("%s", report)
+		}
+	}
+	review.OK = true
+	for _, c := range review.Checks {
+		review.OK = review.OK && c.OK
+	}
+	return review
+}
+
+var (
+	fenceLine   = regexp.MustCompile("(?m)^```")
+	lostSnippet = regexp.MustCompile(`GOONJSNIPPET\d+X`)
+)
+
+// reviewStatements renders the statement in every language as the CUI
+// would and flags statements that come out empty, with an unterminated
+// code block, or with math or examples that could not be put back.
+func reviewStatements(p *problem.Problem, c *ReviewCheck) {
+	for _, lang := range p.StatementLanguages() {
+		statement, _ := p.StatementIn(lang)
+		html, example := RenderStatement(statement, AssetURL("TICKET", p.Id))
+		switch {
+		case strings.TrimSpace(html) == "":
+			c.fail("%s: renders empty", lang)
+		case len(fenceLine.FindAllString(statement, -1))%2 != 0:
+			c.fail("%s: a ``` code block is not terminated", lang)
+		case lostSnippet.MatchString(html):
+			c.fail("%s: math or an example block was lost in rendering", lang)
+		case example == "":
+			c.pass("%s: rendered, without an %s block", lang, EXAMPLE_INPUT)
+		default:
+			c.pass("%s: rendered", lang)
+		}
+	}
+}
+
+// reviewTemplates compiles the solution template of every programming
+// language candidates may pick.
+func reviewTemplates(p *problem.Problem, cfg ReviewConfig, c *ReviewCheck) {
+	templates := SolutionTemplates(p.Template)
+	progLangs := []string{}
+	for progLang := range templates {
+		progLangs = append(progLangs, progLang)
+	}
+	sort.Strings(progLangs)
+	for _, progLang := range progLangs {
+		input := code.MakeInput(LanguageForRunner(progLang), FileNameForCode(progLang), templates[progLang], code.StdinFile(""))
+		compilation, err := cfg.Compile(input)
+		switch {
+		case err != nil:
+			c.fail("%s: %v", progLang, err)
+		case !compilation.OK:
+			c.fail("%s: compilation failed: %s", progLang, strings.TrimSpace(compilation.Output))
+		default:
+			c.pass("%s: compiled", progLang)
+		}
+	}
+}
+
+// reviewReference runs the reference on every test of the groups of p,
+// timing it, and has the checker or interactor judge its answers. Tests
+// without an expected output are judged against the answer the reference
+// gave when the groups were made. It returns the groups, nil if they could
+// not be made.
+func reviewReference(p *problem.Problem, cfg ReviewConfig, ref, checker *ReviewCheck) []*judge.Group {
+	groups, err := judge.ProblemGroups(p, cfg.Run)
+	if err != nil {
+		ref.fail("%v", err)
+		checker.Skipped = true
+		checker.pass("skipped, the tests could not be made")
+		return nil
+	}
+	var evaluate judge.Evaluator
+	if p.Interactive() {
+		if cfg.Interact == nil {
+			ref.fail("%v", judge.ErrNoInteract)
+			return groups
+		}
+		evaluate = judge.InteractEvaluator(cfg.Interact, p.Interactor, p.Reference, p.QueryLimit)
+	} else {
+		check, err := judge.ProblemChecker(p, cfg.Run)
+		if err != nil {
+			checker.fail("%v", err)
+			return groups
+		}
+		evaluate = func(test *problem.Test) (*judge.Verdict, error) {
+			got, err := cfg.Run(p.Reference, test.Input)
+			if err != nil {
+				return nil, err
+			}
+			verdict, err := check(test.Input, test.Output, got)
+			if err != nil {
+				// The checker failed, not the reference.
+				return &judge.Verdict{Message: fmt.Sprintf("the checker failed: %v", err)}, nil
+			}
+			return verdict, nil
+		}
+	}
+	for _, group := range groups {
+		for _, test := range group.Cases {
+			start := time.Now()
+			verdict, err := evaluate(test)
+			elapsed := time.Since(start)
+			switch {
+			case err != nil:
+				ref.fail("test %s: %v", test.Name, err)
+				continue
+			case cfg.TimeLimit > 0 && elapsed > cfg.TimeLimit:
+				ref.fail("test %s: took %s, over the limit of %s", test.Name, elapsed.Round(time.Millisecond), cfg.TimeLimit)
+			default:
+				ref.pass("test %s: %s", test.Name, elapsed.Round(time.Millisecond))
+			}
+			if verdict.OK {
+				checker.pass("test %s: accepted", test.Name)
+			} else {
+				checker.fail("test %s: the reference answer was not accepted: %s", test.Name, verdict.Message)
+			}
+		}
+	}
+	return groups
+}
+
+// reviewGenerator runs the generator twice on the same seed and sizes and
+// expects the same input.
+func reviewGenerator(p *problem.Problem, cfg ReviewConfig, c *ReviewCheck) {
+	for _, size := range []int{1, judge.DefaultStress.MaxSize / 10, judge.DefaultStress.MaxSize} {
+		stdin := judge.GeneratorStdin(cfg.Seed, size)
+		first, err := cfg.Run(p.Generator, stdin)
+		if err != nil {
+			c.fail("size %d: %v", size, err)
+			continue
+		}
+		second, err := cfg.Run(p.Generator, stdin)
+		switch {
+		case err != nil:
+			c.fail("size %d: %v", size, err)
+		case strings.TrimSpace(first) == "":
+			c.fail("size %d: printed nothing", size)
+		case first != second:
+			c.fail("size %d: printed different inputs for the same seed", size)
+		default:
+			c.pass("size %d: deterministic, %d bytes", size, len(first))
+		}
+	}
+}
+
+// reviewWrong judges each known-wrong solution on the groups of p and
+// expects it to fail at least one test.
+func reviewWrong(p *problem.Problem, cfg ReviewConfig, groups []*judge.Group, c *ReviewCheck) {
+	if len(p.Wrong) == 0 {
+		c.pass("no known-wrong solutions in %s/", problem.WRONG_DIR)
+		return
+	}
+	if groups == nil {
+		c.Skipped = true
+		c.pass("skipped, the tests could not be made")
+		return
+	}
+	for _, wrong := range p.Wrong {
+		filename, _ := problem.Source(wrong)
+		evaluate, err := judge.ProblemEvaluator(p, wrong, cfg.Run, cfg.Interact)
+		if err != nil {
+			c.fail("%s: %v", filename, err)
+			continue
+		}
+		score, err := judge.ScoreGroups(groups, evaluate)
+		if err != nil {
+			c.fail("%s: %v", filename, err)
+			continue
+		}
+		if failed := failedTest(score); failed != "" {
+			c.pass("%s: scored %d, fails test %s", filename, score.Score, failed)
+		} else {
+			c.fail("%s: passed every test", filename)
+		}
+	}
+}
+
+// failedTest names the first test failed in score, "" if none was.
+func failedTest(score *judge.Score) string {
+	for _, group := range score.Groups {
+		for _, result := range group.Results {
+			if !result.OK {
+				return result.Test
+			}
+		}
+	}
+	return ""
+}
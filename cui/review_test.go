@@ -0,0 +1,123 @@
+package cui
+
+import (
+	"github.com/maddyonline/code"
+	"github.com/maddyonline/goonj/judge"
+	"github.com/maddyonline/goonj/problem"
+	"strings"
+	"testing"
+)
+
+// reviewRun runs programs whose source is a Go func of the input, keyed by
+// file name.
+func reviewRun(progs map[string]func(string) string) judge.RunFunc {
+	return func(prog *code.Input, stdin string) (string, error) {
+		filename, _ := problem.Source(prog)
+		return progs[filename](stdin), nil
+	}
+}
+
+func compileAll(prog *code.Input) (*judge.Compilation, error) {
+	return &judge.Compilation{OK: true}, nil
+}
+
+func reviewProblem() *problem.Problem {
+	return &problem.Problem{
+		Manifest:  problem.Manifest{Id: "upper"},
+		Statement: "Upper-case the input.\n\n```example-input\nab\n```\n",
+		Generator: problem.NewProgram("generator.py", "gen"),
+		Reference: problem.NewProgram("reference.cpp", "ref"),
+		Wrong:     []*code.Input{problem.NewProgram("echo.py", "echo")},
+		Tests:     problem.ParseTests("ab\n---\nAb"),
+	}
+}
+
+func reviewCheck(t *testing.T, review *Review, name string) *ReviewCheck {
+	for _, c := range review.Checks {
+		if c.Name == name {
+			return c
+		}
+	}
+	t.Fatalf("no check %s in %+v", name, review)
+	return nil
+}
+
+func TestReviewProblem(t *testing.T) {
+	upper := func(in string) string { return strings.ToUpper(in) }
+	review := ReviewProblem(reviewProblem(), ReviewConfig{
+		Run: reviewRun(map[string]func(string) string{
+			"generator.py":  func(in string) string { return "ab" + in },
+			"reference.cpp": upper,
+			// Right on the first test only.
+			"echo.py": func(in string) string {
+				if in == "ab\n" {
+					return "AB\n"
+				}
+				return in
+			},
+		}),
+		Compile: compileAll,
+		Seed:    1,
+	})
+	for _, c := range review.Checks {
+		if !c.OK {
+			t.Errorf("%s: %q", c.Name, c.Details)
+		}
+	}
+	if !review.OK || len(review.Checks) != 8 {
+		t.Fatalf("expected the 8 checks to pass")
+	}
+	if details := reviewCheck(t, review, CHECK_WRONG).Details; len(details) != 1 || details[0] != "echo.py: scored 0, fails test 02" {
+		t.Errorf("unexpected details %q", details)
+	}
+}
+
+func TestReviewProblemFailures(t *testing.T) {
+	calls := 0
+	review := ReviewProblem(reviewProblem(), ReviewConfig{
+		Run: reviewRun(map[string]func(string) string{
+			"generator.py": func(string) string {
+				calls++
+				return strings.Repeat("a", calls)
+			},
+			"reference.cpp": strings.ToUpper,
+			"echo.py":       strings.ToUpper,
+		}),
+		Compile: func(prog *code.Input) (*judge.Compilation, error) {
+			return &judge.Compilation{OK: prog.Language != "go", Output: "main.go:1:1: error"}, nil
+		},
+		Seed: 1,
+	})
+	if review.OK {
+		t.Fatalf("expected the review to fail")
+	}
+	for name, ok := range map[string]bool{
+		CHECK_STRUCTURE: true,
+		CHECK_STATEMENT: true,
+		CHECK_TEMPLATES: false,
+		CHECK_REFERENCE: true,
+		CHECK_CHECKER:   true,
+		CHECK_GENERATOR: false,
+		CHECK_WRONG:     false,
+	} {
+		if c := reviewCheck(t, review, name); c.OK != ok {
+			t.Errorf("%s: expected ok=%v, got %q", name, ok, c.Details)
+		}
+	}
+	if details := reviewCheck(t, review, CHECK_TEMPLATES).Details; !strings.HasPrefix(details[0], "go: compilation failed") {
+		t.Errorf("expected the failure first, got %q", details)
+	}
+}
+
+func TestReviewIncompleteProblem(t *testing.T) {
+	p := reviewProblem()
+	p.Reference = nil
+	p.Statement = "Unterminated\n```example-input\nab\n"
+	review := ReviewProblem(p, ReviewConfig{Run: reviewRun(nil), Compile: compileAll, Seed: 1})
+	if review.OK || reviewCheck(t, review, CHECK_STRUCTURE).OK || reviewCheck(t, review, CHECK_STATEMENT).OK {
+		t.Fatalf("expected the structure and statement to fail, got %+v", review)
+	}
+	if c := reviewCheck(t, review, CHECK_REFERENCE); !c.Skipped {
+		t.Errorf("expected the reference check to be skipped, got %+v", c)
+	}
+}
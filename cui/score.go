@@ -0,0 +1,96 @@
+package cui
+
+import (
+	"github.com/labstack/gommon/log"
+	"github.com/maddyonline/code"
+	"github.com/maddyonline/goonj/judge"
+	"github.com/maddyonline/goonj/problem"
+	"sync"
+)
+
+// scoreMu guards the Score of every task, which rejudging replaces while
+// handlers read it.
+var scoreMu sync.Mutex
+
+// SetScore records the score of the final submission of t.
+func (t *Task) SetScore(score *judge.Score) {
+	scoreMu.Lock()
+	defer scoreMu.Unlock()
+	t.Score = score
+}
+
+// GetScore returns the score of the final submission of t, nil until it
+// is judged.
+func (t *Task) GetScore() *judge.Score {
+	scoreMu.Lock()
+	defer scoreMu.Unlock()
+	return t.Score
+}
+
+// TaskProblem returns the problem task was created from. Tasks of gists
+// get a problem of their generator and judge solution, with the example
+// input as their only fixed test.
+func TaskProblem(task *Task) *problem.Problem {
+	if task.Problem != nil {
+		return task.Problem
+	}
+	p := &problem.Problem{Generator: task.Generator, Reference: task.JudgeSolution, Tests: []*problem.Test{}}
+	if task.ExampleInput != "" {
+		p.Tests = append(p.Tests, &problem.Test{Name: "example", Input: task.ExampleInput})
+	}
+	return p
+}
+
+// TaskGroups resolves the test groups of task on first use.
+func TaskGroups(task *Task, run judge.RunFunc) ([]*judge.Group, error) {
+	if task.Groups != nil {
+		return task.Groups, nil
+	}
+	groups, err := judge.ProblemGroups(TaskProblem(task), run)
+	if err != nil {
+		return nil, err
+	}
+	task.Groups = groups
+	return groups, nil
+}
+
+// ScoreStatus scores a final submission on every test group of task and
+// stores the score in the task for reviewers. The candidate only sees the
+// results of the visible groups.
+func ScoreStatus(task *Task, run judge.RunFunc, evaluate judge.Evaluator, resp *VerifyStatus) *VerifyStatus {
+	groups, err := TaskGroups(task, run)
+	if err != nil {
+		return errorResponse(err, resp)
+	}
+	score, err := judge.ScoreGroups(groups, evaluate)
+	if err != nil {
+		return errorResponse(err, resp)
+	}
+	task.SetScore(score)
+	log.Info("Scored task %s: %s", task.Id, score)
+	resp.Extra.Example.Message = score.Examples()
+	if !score.ExamplesOK() {
+		resp.Extra.Example.OK = 0
+	}
+	return resp
+}
+
+// StressSolution stress tests soln on inputs generated from seed, as
+// judging a solution does: against the reference with the checker of p, or
+// with the interactor of interactive problems. An error means the checker
+// could not be made.
+func StressSolution(p *problem.Problem, soln *code.Input, run judge.RunFunc, interact judge.InteractFunc, seed int64) (*judge.StressReport, error) {
+	cfg := judge.DefaultStress
+	cfg.Seed = seed
+	if p.Interactive() {
+		cfg.Interact = interact
+		cfg.QueryLimit = p.QueryLimit
+		return judge.StressInteractive(p.Generator, soln, p.Interactor, run, cfg), nil
+	}
+	check, err := judge.ProblemChecker(p, run)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Checker = check
+	return judge.Stress(p.Generator, soln, p.Reference, run, cfg), nil
+}
@@ -0,0 +1,113 @@
+package cui
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrNoSuchTask    = errors.New("no such task")
+	ErrTicketClosed  = errors.New("the ticket is closed")
+	ErrTaskFinalized = errors.New("the task has already been submitted")
+	ErrTaskLocked    = errors.New("the task is locked until the current task is submitted")
+)
+
+// ErrorStatus reports err to the CUI, which shows the message of any
+// result other than OK and LATER.
+func ErrorStatus(err error) *VerifyStatus {
+	return &VerifyStatus{Result: "ERROR", Message: err.Error()}
+}
+
+func (s *Session) taskNames() []string {
+	return s.Ticket.Options.TaskNames
+}
+
+// HasTask reports whether taskId is one of the tasks of the ticket.
+func (s *Session) HasTask(taskId string) bool {
+	for _, name := range s.taskNames() {
+		if name == taskId {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Session) IsFinalized(taskId string) bool {
+	return s.Finalized[taskId]
+}
+
+// ActiveTask returns the first task that has not been finalized yet, which
+// in sequential mode is the only one the candidate may work on.
+func (s *Session) ActiveTask() string {
+	for _, name := range s.taskNames() {
+		if !s.IsFinalized(name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// NextTask returns the task to move to after taskId: the next task in order
+// that has not been finalized, wrapping around unless the ticket is
+// sequential. It returns "" when no task is left.
+func (s *Session) NextTask(taskId string) string {
+	names := s.taskNames()
+	start := 0
+	for i, name := range names {
+		if name == taskId {
+			start = i + 1
+			break
+		}
+	}
+	for i := 0; i < len(names); i++ {
+		j := start + i
+		if j >= len(names) {
+			if s.Ticket.Options.Sequential {
+				break
+			}
+			j -= len(names)
+		}
+		if names[j] != taskId && !s.IsFinalized(names[j]) {
+			return names[j]
+		}
+	}
+	return ""
+}
+
+// CheckTaskOpen returns an error if the candidate may no longer change
+// the solution of taskId. Only sequential tickets lock tasks once they are
+// submitted or until their turn comes.
+func (s *Session) CheckTaskOpen(taskId string) error {
+	if s.Closed {
+		return ErrTicketClosed
+	}
+	if !s.Ticket.Options.Sequential {
+		return nil
+	}
+	if s.IsFinalized(taskId) {
+		return ErrTaskFinalized
+	}
+	if taskId != s.ActiveTask() {
+		return ErrTaskLocked
+	}
+	return nil
+}
+
+// Finalize records the final submission of taskId and returns the task the
+// candidate continues with, or "" when no task is left. A sequential ticket
+// is closed once every task has been finalized.
+func (s *Session) Finalize(taskId string) string {
+	if s.Finalized == nil {
+		s.Finalized = map[string]bool{}
+	}
+	s.Finalized[taskId] = true
+	next := s.NextTask(taskId)
+	if next == "" {
+		if s.Ticket.Options.Sequential {
+			s.Close(time.Now())
+		}
+		return ""
+	}
+	s.Ticket.Options.CurrentTaskName = next
+	return next
+}
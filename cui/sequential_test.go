@@ -0,0 +1,89 @@
+package cui
+
+import (
+	"testing"
+)
+
+func sequentialSession(sequential bool) (*Session, map[TaskKey]*Task) {
+	tasks := map[TaskKey]*Task{}
+	opts := DefaultOptions()
+	opts.Sequential = sequential
+	ts := []*Task{}
+	for _, name := range []string{"task1", "task2", "task3"} {
+		task := NewTask()
+		task.Id = name
+		tasks[TaskKey{"ticket", name}] = task
+		ts = append(ts, task)
+	}
+	ticket := ticketFromTasks("ticket", ts, opts)
+	return &Session{Ticket: ticket}, tasks
+}
+
+func TestSequentialLocksLaterTasks(t *testing.T) {
+	session, tasks := sequentialSession(true)
+
+	if err := session.CheckTaskOpen("task2"); err != ErrTaskLocked {
+		t.Errorf("expected task2 to be locked, got %v", err)
+	}
+	task, _ := GetTask(session, tasks, &MessageGetTask{Ticket: "ticket", Task: "task3", HumanLang: "en"})
+	if task.Id != "task1" || task.NextTask != "task2" || task.Status != "open" {
+		t.Errorf("expected task1 to be served instead of task3, got %s (next %q, %s)", task.Id, task.NextTask, task.Status)
+	}
+
+	if next := session.Finalize("task1"); next != "task2" {
+		t.Errorf("expected task2 after task1, got %q", next)
+	}
+	if err := session.CheckTaskOpen("task1"); err != ErrTaskFinalized {
+		t.Errorf("expected task1 to be finalized, got %v", err)
+	}
+	if err := session.CheckTaskOpen("task2"); err != nil {
+		t.Errorf("expected task2 to be open, got %v", err)
+	}
+	if session.Ticket.Options.CurrentTaskName != "task2" {
+		t.Errorf("expected current task to move to task2, got %s", session.Ticket.Options.CurrentTaskName)
+	}
+
+	session.Finalize("task2")
+	if next := session.Finalize("task3"); next != "" || !session.Closed {
+		t.Errorf("expected the ticket to close after the last task, got next=%q closed=%v", next, session.Closed)
+	}
+	if err := session.CheckTaskOpen("task3"); err != ErrTicketClosed {
+		t.Errorf("expected closed ticket, got %v", err)
+	}
+	if task, _ := GetTask(session, tasks, &MessageGetTask{Ticket: "ticket", Task: "task3"}); task.Status != "closed" {
+		t.Errorf("expected task3 to be closed, got %s", task.Status)
+	}
+}
+
+func TestGetTaskOfOtherTickets(t *testing.T) {
+	session, tasks := sequentialSession(false)
+	if task, err := GetTask(session, tasks, &MessageGetTask{Ticket: "ticket", Task: "task4"}); err != ErrNoSuchTask {
+		t.Errorf("expected no task4 in the ticket, got %v", task)
+	}
+	if task, err := GetTask(nil, tasks, &MessageGetTask{Ticket: "other", Task: "task1"}); err != ErrNoSuchTask {
+		t.Errorf("expected no task of an unknown ticket, got %v", task)
+	}
+	if len(tasks) != 3 {
+		t.Errorf("expected no task to be added, got %d", len(tasks))
+	}
+}
+
+func TestNonSequentialNextTaskWraps(t *testing.T) {
+	session, _ := sequentialSession(false)
+	if err := session.CheckTaskOpen("task3"); err != nil {
+		t.Errorf("expected every task to be open, got %v", err)
+	}
+	if next := session.Finalize("task3"); next != "task1" {
+		t.Errorf("expected task1 after task3, got %q", next)
+	}
+	if err := session.CheckTaskOpen("task3"); err != nil {
+		t.Errorf("expected task3 to stay open after its final submission, got %v", err)
+	}
+	session.Finalize("task1")
+	if next := session.Finalize("task2"); next != "" || session.Closed {
+		t.Errorf("expected no next task and the ticket to stay open, got next=%q closed=%v", next, session.Closed)
+	}
+	if err := session.CheckTaskOpen("task1"); err != nil {
+		t.Errorf("expected every task to stay open, got %v", err)
+	}
+}
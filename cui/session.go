@@ -0,0 +1,238 @@
+package cui
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/labstack/gommon/log"
+	"github.com/maddyonline/goonj/utils"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// The lifecycle of a session. A session is created with its ticket, opened
+// when the candidate first loads the CUI and started when they start the
+// test. It is closed when the candidate leaves or, for sequential tickets,
+// once every task is finalized, and expires when it is not started in time
+// or its clock runs out.
+const (
+	SESSION_CREATED = "created"
+	SESSION_OPENED  = "opened"
+	SESSION_STARTED = "started"
+	SESSION_CLOSED  = "closed"
+	SESSION_EXPIRED = "expired"
+)
+
+// SESSION_FILE is kept in the work directory as TICKET/session.json, next
+// to the solutions of the ticket.
+const SESSION_FILE = "session.json"
+
+var ErrSessionExpired = errors.New("the session has expired")
+
+// SavedSolution is the last solution saved for a task, in Filename under
+// the directory of the task.
+type SavedSolution struct {
+	ProgLang string `json:"prg_lang"`
+	Filename string `json:"filename"`
+}
+
+// State is the stage of the lifecycle s is in at now. Sessions that are not
+// started within expiry of their creation expire; zero never expires them.
+func (s *Session) State(now time.Time, expiry time.Duration) string {
+	switch {
+	case s.Closed:
+		return SESSION_CLOSED
+	case !s.StartTime.IsZero():
+		if s.Remaining(now) == 0 {
+			return SESSION_EXPIRED
+		}
+		return SESSION_STARTED
+	case expiry > 0 && now.Sub(s.Created) > expiry:
+		return SESSION_EXPIRED
+	case !s.Opened.IsZero():
+		return SESSION_OPENED
+	}
+	return SESSION_CREATED
+}
+
+// Lock locks s against the other requests on it. Hold it across a change
+// of s and the SaveSession that follows, and while reading s.
+func (s *Session) Lock() {
+	s.mu.Lock()
+}
+
+func (s *Session) Unlock() {
+	s.mu.Unlock()
+}
+
+// Open records the first time the CUI of s is loaded and reports whether
+// this was it.
+func (s *Session) Open(now time.Time) bool {
+	if !s.Opened.IsZero() {
+		return false
+	}
+	s.Opened = now
+	return true
+}
+
+// Start starts the clock of s and reports whether it was not running yet.
+// Starting again, from another tab or after a reload, keeps the time the
+// candidate first started.
+func (s *Session) Start(now time.Time, expiry time.Duration) (bool, error) {
+	switch s.State(now, expiry) {
+	case SESSION_CLOSED:
+		return false, ErrTicketClosed
+	case SESSION_STARTED:
+		return false, nil
+	case SESSION_EXPIRED:
+		if !s.StartTime.IsZero() {
+			return false, nil
+		}
+		return false, ErrSessionExpired
+	}
+	s.Open(now)
+	s.StartTime = now
+	return true, nil
+}
+
+// Close closes s at now and reports whether it was still open. The clock
+// stops, and with it the time of the current task.
+func (s *Session) Close(now time.Time) bool {
+	if s.Closed {
+		return false
+	}
+	s.chargeTask(now)
+	s.Closed = true
+	s.ClosedAt = now
+	return true
+}
+
+// SwitchTask charges the time since the last switch to the task the
+// candidate was on and makes taskId the current one.
+func (s *Session) SwitchTask(now time.Time, taskId string) {
+	s.chargeTask(now)
+	s.CurrentTask = taskId
+}
+
+func (s *Session) chargeTask(now time.Time) {
+	elapsed := s.Elapsed(now)
+	if s.CurrentTask != "" && elapsed > s.TaskSince {
+		if s.TaskTime == nil {
+			s.TaskTime = map[string]time.Duration{}
+		}
+		s.TaskTime[s.CurrentTask] += elapsed - s.TaskSince
+	}
+	s.TaskSince = elapsed
+}
+
+// TaskSeconds is the number of seconds spent on each task at now, the
+// current task included.
+func (s *Session) TaskSeconds(now time.Time) map[string]int {
+	seconds := map[string]int{}
+	for taskId, d := range s.TaskTime {
+		seconds[taskId] = int(d / time.Second)
+	}
+	if elapsed := s.Elapsed(now); s.CurrentTask != "" && elapsed > s.TaskSince {
+		seconds[s.CurrentTask] = int((s.TaskTime[s.CurrentTask] + elapsed - s.TaskSince) / time.Second)
+	}
+	return seconds
+}
+
+// UpdateOptions sets the time the CUI shows from the clock of s.
+func (s *Session) UpdateOptions(now time.Time) {
+	s.Ticket.Options.TimeElapsed = int(s.Elapsed(now) / time.Second)
+	s.Ticket.Options.TimeRemaining = s.Remaining(now)
+}
+
+// SaveSolution remembers the file the last solution of taskId in progLang
+// was saved to, and that it is the last solution of taskId.
+func (s *Session) SaveSolution(taskId, progLang, filename string) {
+	saved := SavedSolution{ProgLang: progLang, Filename: filename}
+	if s.Solutions == nil {
+		s.Solutions = map[string]SavedSolution{}
+	}
+	s.Solutions[taskId] = saved
+	if s.LangSolutions == nil {
+		s.LangSolutions = map[string]map[string]SavedSolution{}
+	}
+	if s.LangSolutions[taskId] == nil {
+		s.LangSolutions[taskId] = map[string]SavedSolution{}
+	}
+	s.LangSolutions[taskId][progLang] = saved
+}
+
+// SavedSolutions returns the solutions saved of taskId, one per language,
+// the last one saved last. Sessions saved before solutions were kept per
+// language only have the last one.
+func (s *Session) SavedSolutions(taskId string) []SavedSolution {
+	last, ok := s.Solutions[taskId]
+	saved := []SavedSolution{}
+	langs := []string{}
+	for progLang := range s.LangSolutions[taskId] {
+		if !ok || progLang != last.ProgLang {
+			langs = append(langs, progLang)
+		}
+	}
+	sort.Strings(langs)
+	for _, progLang := range langs {
+		saved = append(saved, s.LangSolutions[taskId][progLang])
+	}
+	if ok {
+		saved = append(saved, last)
+	}
+	return saved
+}
+
+// SolutionFileName is the file the solution of taskId in progLang is saved
+// to. Languages sharing an extension, like c and cpp, get files of their
+// own.
+func SolutionFileName(taskId, progLang string) string {
+	return fmt.Sprintf("%s-%s-%s", taskId, progLang, FileNameForCode(progLang))
+}
+
+// SaveSession writes s to dir/TICKET/session.json. The caller holds the lock
+// of s.
+func SaveSession(dir string, s *Session) error {
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.UpdateFile(filepath.Join(dir, s.Ticket.Id, SESSION_FILE), string(content))
+}
+
+// LoadSessions reads the sessions saved in dir by SaveSession. A file that
+// cannot be read is logged and skipped, so that it does not cost the other
+// sessions.
+func LoadSessions(dir string) ([]*Session, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*", SESSION_FILE))
+	if err != nil {
+		return nil, err
+	}
+	sessions := []*Session{}
+	for _, path := range paths {
+		s, err := loadSession(path)
+		if err != nil {
+			log.Error("Skipping session %s: %v", path, err)
+			continue
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, nil
+}
+
+func loadSession(path string) (*Session, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &Session{}
+	if err := json.Unmarshal(content, s); err != nil {
+		return nil, err
+	}
+	if s.Ticket == nil || s.Ticket.Options == nil {
+		return nil, errors.New("no ticket")
+	}
+	return s, nil
+}
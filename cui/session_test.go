@@ -0,0 +1,150 @@
+package cui
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSessionLifecycle(t *testing.T) {
+	created := time.Date(2016, 1, 1, 10, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return created.Add(time.Duration(minutes) * time.Minute) }
+	expiry := 5 * time.Minute
+	s := &Session{TimeLimit: 3600, Created: created, Ticket: &Ticket{Id: "t", Options: DefaultOptions()}}
+	if state := s.State(at(1), expiry); state != SESSION_CREATED {
+		t.Errorf("expected %s, got %s", SESSION_CREATED, state)
+	}
+	if !s.Open(at(2)) || s.Open(at(3)) {
+		t.Errorf("expected only the first open to count")
+	}
+	if state := s.State(at(3), expiry); state != SESSION_OPENED {
+		t.Errorf("expected %s, got %s", SESSION_OPENED, state)
+	}
+	if started, err := s.Start(at(4), expiry); !started || err != nil {
+		t.Fatalf("expected the session to start, got %v, %v", started, err)
+	}
+	if started, err := s.Start(at(20), expiry); started || err != nil {
+		t.Errorf("expected starting again to do nothing, got %v, %v", started, err)
+	}
+	if !s.StartTime.Equal(at(4)) {
+		t.Errorf("expected the first start time to be kept, got %v", s.StartTime)
+	}
+	s.UpdateOptions(at(14))
+	if s.Ticket.Options.TimeElapsed != 600 || s.Ticket.Options.TimeRemaining != 3000 {
+		t.Errorf("expected 600s elapsed and 3000s remaining, got %d and %d", s.Ticket.Options.TimeElapsed, s.Ticket.Options.TimeRemaining)
+	}
+	if state := s.State(at(14), expiry); state != SESSION_STARTED {
+		t.Errorf("expected %s, got %s", SESSION_STARTED, state)
+	}
+	if state := s.State(at(70), expiry); state != SESSION_EXPIRED {
+		t.Errorf("expected the session to expire when its time is up, got %s", state)
+	}
+	if !s.Close(at(30)) || s.Close(at(40)) {
+		t.Errorf("expected only the first close to count")
+	}
+	if state := s.State(at(70), expiry); state != SESSION_CLOSED {
+		t.Errorf("expected %s, got %s", SESSION_CLOSED, state)
+	}
+	if elapsed := s.Elapsed(at(50)); elapsed != 26*time.Minute {
+		t.Errorf("expected the clock to stop when closed, got %s", elapsed)
+	}
+	if _, err := s.Start(at(50), expiry); err != ErrTicketClosed {
+		t.Errorf("expected starting a closed session to fail, got %v", err)
+	}
+
+	late := &Session{TimeLimit: 3600, Created: created}
+	if _, err := late.Start(at(6), expiry); err != ErrSessionExpired {
+		t.Errorf("expected starting after the expiry to fail, got %v", err)
+	}
+}
+
+func TestTaskTime(t *testing.T) {
+	start := time.Date(2016, 1, 1, 10, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+	s := &Session{TimeLimit: 3600}
+	s.SwitchTask(at(0), "a")
+	s.Start(at(0), 0)
+	s.SwitchTask(at(10), "b")
+	if err := s.ChangeClock(at(12), "ann", CLOCK_PAUSE, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ChangeClock(at(22), "ann", CLOCK_RESUME, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	s.SwitchTask(at(25), "a")
+	want := map[string]int{"a": 660, "b": 300}
+	if got := s.TaskSeconds(at(26)); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	s.Close(at(30))
+	want = map[string]int{"a": 900, "b": 300}
+	if got := s.TaskSeconds(at(40)); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v after closing, got %v", want, got)
+	}
+}
+
+func TestSaveSession(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	start := time.Date(2016, 1, 1, 10, 0, 0, 0, time.UTC)
+	s := &Session{
+		Ticket:    &Ticket{Id: "ticket", Options: DefaultOptions(), Problems: []string{"palindrome@2"}},
+		Created:   start,
+		TimeLimit: 3600,
+	}
+	s.Start(start, 0)
+	s.SwitchTask(start, "palindrome")
+	s.SwitchTask(start.Add(time.Minute), "palindrome")
+	s.SaveSolution("palindrome", "c", "palindrome-c-main.cpp")
+	s.SaveSolution("palindrome", "cpp", "palindrome-cpp-main.cpp")
+	if err := SaveSession(dir, s); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "ticket", SESSION_FILE)); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected the session to be readable by its owner only, got %v", info.Mode())
+	}
+	if tmp, _ := filepath.Glob(filepath.Join(dir, "ticket", ".*")); len(tmp) != 0 {
+		t.Errorf("expected no temporary files left, got %v", tmp)
+	}
+	// A truncated session must not cost the others.
+	if err := os.MkdirAll(filepath.Join(dir, "broken"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "broken", SESSION_FILE), []byte(`{"ticket": {"id": "br`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := LoadSessions(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 {
+		t.Fatalf("expected 1 session, got %d", len(sessions))
+	}
+	got := sessions[0]
+	if !got.StartTime.Equal(s.StartTime) || got.Ticket.Id != "ticket" || !reflect.DeepEqual(got.Ticket.Problems, s.Ticket.Problems) {
+		t.Errorf("expected %+v, got %+v", s, got)
+	}
+	if !reflect.DeepEqual(got.TaskTime, s.TaskTime) || !reflect.DeepEqual(got.Solutions, s.Solutions) {
+		t.Errorf("expected task times %v and solutions %v, got %v and %v", s.TaskTime, s.Solutions, got.TaskTime, got.Solutions)
+	}
+	want := []SavedSolution{{"c", "palindrome-c-main.cpp"}, {"cpp", "palindrome-cpp-main.cpp"}}
+	if saved := got.SavedSolutions("palindrome"); !reflect.DeepEqual(saved, want) {
+		t.Errorf("expected a solution per language, the last one last, got %v", saved)
+	}
+}
+
+func TestSavedSolutionsOfOlderSessions(t *testing.T) {
+	s := &Session{Solutions: map[string]SavedSolution{"task1": {"py3", "task1-main.py"}}}
+	if saved := s.SavedSolutions("task1"); !reflect.DeepEqual(saved, []SavedSolution{{"py3", "task1-main.py"}}) {
+		t.Errorf("expected the last solution saved, got %v", saved)
+	}
+	if SolutionFileName("task1", "c") == SolutionFileName("task1", "cpp") {
+		t.Errorf("expected c and cpp solutions to be saved to different files")
+	}
+}
@@ -0,0 +1,58 @@
+package cui
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// SurveyQuestion is a question of the survey shown when a session ends.
+// Rated questions are answered from 1 to 10, the others with text.
+type SurveyQuestion struct {
+	Name  string
+	Text  string
+	Rated bool
+}
+
+// SURVEY_QUESTIONS are the questions of the survey form in cui.html.
+var SURVEY_QUESTIONS = []SurveyQuestion{
+	{"answer1", "Do you think the test gives a fair assessment of your basic coding skills?", true},
+	{"answer2", "Did you understand the problem descriptions as presented during the test?", true},
+	{"answer3", "Did you feel you had enough time to complete the questions?", true},
+	{"answer4", "How do you rate the environment for ease of use?", true},
+	{"answer5", "If you faced serious problems when solving the test please describe them.", false},
+}
+
+const MAX_SURVEY_ANSWER = 2000
+
+var ErrBadSurvey = errors.New("invalid survey answers")
+
+// Survey holds the answers to SURVEY_QUESTIONS by name.
+type Survey struct {
+	Time    time.Time         `json:"time"`
+	Answers map[string]string `json:"answers"`
+}
+
+// SaveSurvey records the answers the candidate gave, ignoring unknown and
+// empty ones. Answering again replaces the earlier answers.
+func (s *Session) SaveSurvey(now time.Time, answers map[string]string) error {
+	survey := &Survey{Time: now, Answers: map[string]string{}}
+	for _, q := range SURVEY_QUESTIONS {
+		answer := strings.TrimSpace(answers[q.Name])
+		if answer == "" {
+			continue
+		}
+		if q.Rated {
+			if n, err := strconv.Atoi(answer); err != nil || n < 1 || n > 10 {
+				return ErrBadSurvey
+			}
+		} else if utf8.RuneCountInString(answer) > MAX_SURVEY_ANSWER {
+			return ErrBadSurvey
+		}
+		survey.Answers[q.Name] = answer
+	}
+	s.Survey = survey
+	return nil
+}
@@ -0,0 +1,20 @@
+package cui
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSaveSurvey(t *testing.T) {
+	now := time.Date(2016, 1, 1, 11, 0, 0, 0, time.UTC)
+	s := &Session{}
+	if err := s.SaveSurvey(now, map[string]string{"answer1": "11"}); err != ErrBadSurvey {
+		t.Errorf("expected ratings to go up to 10, got %v", err)
+	}
+	if err := s.SaveSurvey(now, map[string]string{"answer1": "9", "answer3": "", "answer5": " slow compiler ", "ticket": "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Survey.Answers) != 2 || s.Survey.Answers["answer5"] != "slow compiler" {
+		t.Errorf("expected the two answers given, got %+v", s.Survey.Answers)
+	}
+}
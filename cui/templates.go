@@ -0,0 +1,178 @@
+package cui
+
+import (
+	"github.com/maddyonline/goonj/problem"
+)
+
+// stdioTemplates read the input from stdin and print the answer; as given
+// they echo every word of the input on its own line.
+var stdioTemplates = map[string]string{
+	"c": `#include <stdio.h>
+
+int main() {
+    char word[1024];
+    while (scanf("%1023s", word) == 1) {
+        printf("%s\n", word);
+    }
+    return 0;
+}
+`,
+	"cpp": `#include <iostream>
+#include <string>
+using namespace std;
+
+int main() {
+    string word;
+    while (cin >> word) {
+        cout << word << endl;
+    }
+    return 0;
+}
+`,
+	"py2": `import sys
+
+for word in sys.stdin.read().split():
+    sys.stdout.write(word + "\n")
+`,
+	"py3": `import sys
+
+for word in sys.stdin.read().split():
+    print(word)
+`,
+	"go": `package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+)
+
+func main() {
+	in := bufio.NewReader(os.Stdin)
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	var word string
+	for {
+		if _, err := fmt.Fscan(in, &word); err != nil {
+			break
+		}
+		fmt.Fprintln(out, word)
+	}
+}
+`,
+	"js": `const words = require('fs').readFileSync(0, 'utf8').split(/\s+/);
+
+words.filter(word => word !== '').forEach(word => console.log(word));
+`,
+}
+
+const pythonFunctionTemplate = `import sys
+
+
+def solution(input):
+    # return the answer to input
+    return ""
+
+
+if __name__ == "__main__":
+    sys.stdout.write(solution(sys.stdin.read()))
+`
+
+// functionTemplates leave reading and printing to main, the candidate only
+// fills in solution, which gets the whole input and returns the answer.
+var functionTemplates = map[string]string{
+	"c": `#include <stdio.h>
+
+const char *solution(const char *input) {
+    /* return the answer to input */
+    return "";
+}
+
+int main() {
+    static char input[1 << 20];
+    size_t n = fread(input, 1, sizeof(input) - 1, stdin);
+    input[n] = '\0';
+    fputs(solution(input), stdout);
+    return 0;
+}
+`,
+	"cpp": `#include <iostream>
+#include <iterator>
+#include <string>
+using namespace std;
+
+string solution(const string &input) {
+    // return the answer to input
+    return "";
+}
+
+int main() {
+    string input((istreambuf_iterator<char>(cin)), istreambuf_iterator<char>());
+    cout << solution(input);
+    return 0;
+}
+`,
+	"py2": pythonFunctionTemplate,
+	"py3": pythonFunctionTemplate,
+	"go": `package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// solution returns the answer to input.
+func solution(input string) string {
+	return ""
+}
+
+func main() {
+	input, _ := ioutil.ReadAll(os.Stdin)
+	fmt.Print(solution(string(input)))
+}
+`,
+	"js": `// solution returns the answer to input.
+function solution(input) {
+    return '';
+}
+
+process.stdout.write(solution(require('fs').readFileSync(0, 'utf8')));
+`,
+}
+
+// SolutionTemplates returns the template of each programming language in
+// the style of a problem, problem.TEMPLATE_STDIO when style is empty.
+func SolutionTemplates(style string) map[string]string {
+	templates := stdioTemplates
+	if style == problem.TEMPLATE_FUNCTION {
+		templates = functionTemplates
+	}
+	copied := map[string]string{}
+	for progLang, template := range templates {
+		copied[progLang] = template
+	}
+	return copied
+}
+
+// SetSolution saves solution as the code of the task in progLang and
+// switches the task to it.
+func (t *Task) SetSolution(progLang, solution string) {
+	if t.Solutions == nil {
+		t.Solutions = map[string]string{}
+	}
+	t.Solutions[progLang] = solution
+	t.SelectProgLang(progLang)
+}
+
+// SelectProgLang switches the task to progLang, showing the code saved in
+// that language or, if there is none yet, its template.
+func (t *Task) SelectProgLang(progLang string) {
+	t.ProgLang = progLang
+	t.SolutionTemplate = t.Templates[progLang]
+	if solution, ok := t.Solutions[progLang]; ok {
+		t.CurrentSolution = solution
+	} else {
+		t.CurrentSolution = t.SolutionTemplate
+	}
+}
@@ -0,0 +1,45 @@
+package cui
+
+import (
+	"github.com/maddyonline/goonj/problem"
+	"testing"
+)
+
+func TestGetTaskKeepsSolutionPerLanguage(t *testing.T) {
+	tasks := map[TaskKey]*Task{}
+	task := NewTask()
+	task.Id = "task1"
+	task.Templates = SolutionTemplates(problem.TEMPLATE_FUNCTION)
+	tasks[TaskKey{"ticket", "task1"}] = task
+	session := &Session{Ticket: ticketFromTasks("ticket", []*Task{task}, DefaultOptions())}
+	get := func(progLang string) *Task {
+		got, _ := GetTask(session, tasks, &MessageGetTask{Ticket: "ticket", Task: "task1", ProgLang: progLang, PreferServerProgLang: true})
+		return got
+	}
+
+	task.SetSolution("cpp", "int main() {}")
+	if got := get("py3"); got.ProgLang != "py3" || got.CurrentSolution != functionTemplates["py3"] || got.SolutionTemplate != functionTemplates["py3"] {
+		t.Errorf("expected the python template, got %q", got.CurrentSolution)
+	}
+	task.SetSolution("py3", "print(1)")
+	if got := get("cpp"); got.CurrentSolution != "int main() {}" || got.SolutionTemplate != functionTemplates["cpp"] {
+		t.Errorf("expected the saved C++ solution, got %q", got.CurrentSolution)
+	}
+	if got := get("py3"); got.CurrentSolution != "print(1)" {
+		t.Errorf("expected the saved python solution, got %q", got.CurrentSolution)
+	}
+	if got, _ := GetTask(session, tasks, &MessageGetTask{Ticket: "ticket", Task: "task1", ProgLang: "go"}); got.ProgLang != "py3" {
+		t.Errorf("expected the language of the task to be kept, got %s", got.ProgLang)
+	}
+}
+
+func TestSolutionTemplatesCoverEveryLanguage(t *testing.T) {
+	for _, style := range []string{"", problem.TEMPLATE_STDIO, problem.TEMPLATE_FUNCTION} {
+		templates := SolutionTemplates(style)
+		for _, progLang := range PROGRAMMING_LANGUAGES {
+			if templates[progLang] == "" {
+				t.Errorf("no %q template for %s", style, progLang)
+			}
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package cui
+
+import (
+	"encoding/json"
+	"github.com/maddyonline/goonj/problem"
+)
+
+// problemDescriptions renders the statement of p in each of its languages
+// the CUI can offer, as listed by opts, with images served from assetURL.
+// It also returns the list of those languages and the example input of the
+// default statement.
+func problemDescriptions(p *problem.Problem, opts *Options, assetURL string) (map[string]string, string, string) {
+	descriptions := map[string]string{}
+	langs := []string{}
+	example := ""
+	for _, lang := range p.StatementLanguages() {
+		if _, ok := opts.HumanLangList[lang]; !ok && lang != problem.DEFAULT_LANGUAGE {
+			continue
+		}
+		statement, _ := p.StatementIn(lang)
+		description, input := RenderStatement(statement, assetURL)
+		if lang == problem.DEFAULT_LANGUAGE {
+			example = input
+		}
+		descriptions[lang] = description
+		langs = append(langs, lang)
+	}
+	list, _ := json.Marshal(langs)
+	return descriptions, string(list), example
+}
+
+// SelectHumanLang shows the description of the task in lang, or in
+// problem.DEFAULT_LANGUAGE when it is not translated to lang. Tasks with a
+// single description show it whatever lang is.
+func (t *Task) SelectHumanLang(lang string) {
+	if len(t.Descriptions) == 0 {
+		t.HumanLang = lang
+		return
+	}
+	description, ok := t.Descriptions[lang]
+	if !ok {
+		lang = problem.DEFAULT_LANGUAGE
+		description = t.Descriptions[lang]
+	}
+	t.HumanLang, t.Description = lang, description
+}
@@ -0,0 +1,31 @@
+package cui
+
+import (
+	"github.com/maddyonline/goonj/problem"
+	"strings"
+	"testing"
+)
+
+func TestGetTaskFallsBackToDefaultLanguage(t *testing.T) {
+	tasks := map[TaskKey]*Task{}
+	p := &problem.Problem{
+		Manifest:     problem.Manifest{Id: "palindrome"},
+		Statement:    "Palindromes",
+		Translations: map[string]string{"cn": "回文", "xx": "unknown to the CUI"},
+	}
+	ticket := NewProblemTicket(tasks, []*problem.Problem{p}, nil)
+	task := tasks[TaskKey{ticket.Id, "palindrome"}]
+	if task.HumanLangList != `["en","cn"]` {
+		t.Errorf("expected the languages the CUI knows, got %s", task.HumanLangList)
+	}
+	get := func(lang string) *Task {
+		task, _ := GetTask(&Session{Ticket: ticket}, tasks, &MessageGetTask{Ticket: ticket.Id, Task: "palindrome", HumanLang: lang})
+		return task
+	}
+	if task := get("cn"); task.HumanLang != "cn" || !strings.Contains(task.Description, "回文") {
+		t.Errorf("expected the Chinese description, got %s %q", task.HumanLang, task.Description)
+	}
+	if task := get("de"); task.HumanLang != "en" || !strings.Contains(task.Description, "Palindromes") {
+		t.Errorf("expected the English description, got %s %q", task.HumanLang, task.Description)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/google/go-github/github"
@@ -10,25 +11,54 @@ import (
 	mw "github.com/labstack/echo/middleware"
 	"github.com/labstack/gommon/log"
 	"github.com/maddyonline/code"
+	"github.com/maddyonline/goonj/config"
 	"github.com/maddyonline/goonj/cui"
+	"github.com/maddyonline/goonj/judge"
+	"github.com/maddyonline/goonj/problem"
+	"github.com/maddyonline/goonj/submission"
 	"github.com/maddyonline/goonj/utils"
+	"github.com/maddyonline/goonj/webhook"
 	"golang.org/x/oauth2"
 	"html/template"
 	"io"
-	"io/ioutil"
+	"mime"
 	"net/http"
 	"os"
-	"os/user"
+	"path"
 	"path/filepath"
+	"strconv"
+	"sync"
 	"time"
 )
 
 var schemaDecoder *schema.Decoder
 
-var Opts struct {
-	Port            string
-	StaticFilesRoot string
-	RunnerPath      string
+var Cfg *config.Config
+
+var (
+	throttle = time.Tick(1 * time.Second)
+)
+
+// initializeConfig adds the flags of the server to flags, parses args and
+// loads and validates the config they name. The config is returned with
+// its validation error, or nil when it could not be loaded.
+func initializeConfig(flags *flag.FlagSet, args []string) (*config.Config, error) {
+	var configFile, port, staticRoot, runnerPath string
+	flags.StringVar(&configFile, "config", "", "Path to TOML config file")
+	flags.StringVar(&port, "port", "", "Port on which server runs")
+	flags.StringVar(&staticRoot, "static", "", "Serve static files from this checkout instead of the embedded copy")
+	flags.StringVar(&runnerPath, "runner", "", "Path to runner binary")
+	flags.Parse(args)
+
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		return nil, err
+	}
+	assignString(&cfg.Server.Port, port, cfg.Server.Port)
+	assignString(&cfg.Server.StaticFilesRoot, staticRoot, cfg.Server.StaticFilesRoot)
+	assignString(&cfg.Runner.Path, runnerPath, cfg.Runner.Path)
+	cfg.Runner.Path, _ = filepath.Abs(cfg.Runner.Path)
+	return cfg, cfg.Validate()
 }
 
 func assignString(v *string, args ...string) {
@@ -40,34 +70,6 @@ func assignString(v *string, args ...string) {
 	}
 }
 
-const ENV_PORT_NAME = "CUI_PORT"
-const ENV_STATIC_FILES_DIR = "CUI_STATIC_FILES_DIR"
-const ENV_RUNNER_PATH = "CUI_RUNNER_PATH"
-
-const DEFAULT_PORT = "3000"
-
-var (
-	throttle = time.Tick(1 * time.Second)
-)
-
-func initializeConfig() {
-	var oldUsage = flag.Usage
-	var newUsage = func() {
-		oldUsage()
-		fmt.Fprintf(os.Stderr, "Alternatively, you may set environment variables %s and %s\n", ENV_PORT_NAME, ENV_STATIC_FILES_DIR)
-	}
-	flag.Usage = newUsage
-
-	flag.StringVar(&Opts.Port, "port", "", "Port on which server runs")
-	flag.StringVar(&Opts.StaticFilesRoot, "static", "", "Path to static directory")
-	flag.StringVar(&Opts.RunnerPath, "runner", "", "Path to runner binary")
-	flag.Parse()
-	assignString(&Opts.Port, Opts.Port, os.Getenv(ENV_PORT_NAME), DEFAULT_PORT)
-	assignString(&Opts.StaticFilesRoot, Opts.StaticFilesRoot, os.Getenv(ENV_STATIC_FILES_DIR), utils.DefaultDir("src/github.com/maddyonline/goonj"))
-	assignString(&Opts.RunnerPath, Opts.RunnerPath, os.Getenv(ENV_RUNNER_PATH), utils.DefaultDir("src/github.com/maddyonline/code"))
-
-}
-
 type UserContext struct {
 	githubClient *github.Client
 }
@@ -89,31 +91,69 @@ func hello(c *echo.Context) error {
 	return c.String(http.StatusOK, "Hello, World!\n")
 }
 
-func loadTemplates(templatesDir string) *Template {
-	t := &Template{
-		// Cached templates
-		templates: template.Must(template.ParseFiles(filepath.Join(templatesDir, "cui.html"))),
-	}
-	return t
-}
-
 var cui_html []byte
 
 var tasks map[cui.TaskKey]*cui.Task
+
+// tasksMu guards tasks, which the handlers and the rejudge queue share.
+var tasksMu sync.Mutex
+
 var cuiSessions map[string]*cui.Session
+
+// sessionsMu guards cuiSessions, which the handlers and the session sweeper
+// share.
+var sessionsMu sync.Mutex
 var toggle bool
 
 var TMP_DIR string
 
-func getTmpWorkDir() (string, error) {
-	u, err := user.Current()
-	if err != nil {
-		return utils.CreateDirIfReqd("goonj-workdir")
+// workDirLock keeps the ticket commands off TMP_DIR while the server runs.
+var workDirLock *os.File
+
+// findTask looks up a task of a ticket in tasks.
+func findTask(ticketId, taskId string) (*cui.Task, bool) {
+	tasksMu.Lock()
+	defer tasksMu.Unlock()
+	task, ok := tasks[cui.TaskKey{TicketId: ticketId, TaskId: taskId}]
+	return task, ok
+}
+
+// lookupSession looks up the session of a ticket in cuiSessions.
+func lookupSession(ticketId string) (*cui.Session, bool) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	session, ok := cuiSessions[ticketId]
+	return session, ok
+}
+
+// addSession adds session to cuiSessions.
+func addSession(session *cui.Session) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	cuiSessions[session.Ticket.Id] = session
+}
+
+// ticketTasks copies the tasks of a ticket out of tasks, for the cui
+// functions that read them while running programs.
+func ticketTasks(ticketId string) map[cui.TaskKey]*cui.Task {
+	tasksMu.Lock()
+	defer tasksMu.Unlock()
+	copied := map[cui.TaskKey]*cui.Task{}
+	for key, task := range tasks {
+		if key.TicketId == ticketId {
+			copied[key] = task
+		}
 	}
-	return utils.CreateDirIfReqd(filepath.Join(u.HomeDir, "goonj-workdir"))
+	return copied
+}
+
+func getTmpWorkDir() (string, error) {
+	return utils.CreateDirIfReqd(Cfg.Storage.WorkDir)
 }
 
-func saveSolution(c *echo.Context) (*cui.Task, *cui.SolutionRequest) {
+// saveSolution stores the solution posted by the CUI. Solutions of unknown
+// tasks are ignored, solutions of tasks that are no longer open are refused.
+func saveSolution(c *echo.Context) (*cui.Task, *cui.SolutionRequest, error) {
 	solnReq := &cui.SolutionRequest{
 		Ticket:    c.Form("ticket"),
 		Task:      c.Form("task"),
@@ -121,50 +161,154 @@ func saveSolution(c *echo.Context) (*cui.Task, *cui.SolutionRequest) {
 		Solution:  c.Form("solution"),
 		TestData0: c.Form("test_data0"),
 	}
+	solnReq.Seed, _ = strconv.ParseInt(c.Form("seed"), 10, 64)
 	log.Info("%s %s: Form: %#v", c.Request().Method, c.Request().URL, solnReq)
-	task, ok := tasks[cui.TaskKey{solnReq.Ticket, solnReq.Task}]
+	task, err := storeSolution(solnReq)
+	if err == cui.ErrNoSuchTask {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, solnReq, err
+	}
+	return task, solnReq, nil
+}
+
+// storeSolution records solnReq as the current solution of its task, writes
+// it to the work directory and archives it.
+func storeSolution(solnReq *cui.SolutionRequest) (*cui.Task, error) {
+	task, ok := findTask(solnReq.Ticket, solnReq.Task)
 	if !ok {
-		return nil, nil
+		return nil, cui.ErrNoSuchTask
+	}
+	session, hasSession := lookupSession(solnReq.Ticket)
+	if hasSession {
+		session.Lock()
+		defer session.Unlock()
+		if err := session.CheckTaskOpen(solnReq.Task); err != nil {
+			log.Info("storeSolution: Refusing solution of %s/%s: %v", solnReq.Ticket, solnReq.Task, err)
+			return nil, err
+		}
 	}
 
-	log.Info("%s %s: Updating task.ProgLang from %s to %s", c.Request().Method, c.Request().URL, task.ProgLang, solnReq.ProgLang)
-	log.Info("%s %s: Updating task.CurrentSolution from %q to %q", c.Request().Method, c.Request().URL, task.CurrentSolution, solnReq.Solution)
+	log.Info("storeSolution: Updating task.ProgLang from %s to %s", task.ProgLang, solnReq.ProgLang)
+	log.Info("storeSolution: Updating task.CurrentSolution from %q to %q", task.CurrentSolution, solnReq.Solution)
 
-	task.ProgLang = solnReq.ProgLang
-	task.CurrentSolution = solnReq.Solution
-	fname := fmt.Sprintf("%s-%s", solnReq.Task, cui.FileNameForCode(solnReq.ProgLang))
+	task.SetSolution(solnReq.ProgLang, solnReq.Solution)
+	fname := cui.SolutionFileName(solnReq.Task, solnReq.ProgLang)
+	if hasSession {
+		session.SaveSolution(solnReq.Task, solnReq.ProgLang, fname)
+		saveSession(session)
+	}
 	filename := fmt.Sprintf("%s/%s/%s/%s", TMP_DIR, solnReq.Ticket, solnReq.Task, fname)
 
 	oldFilename := task.Filename
 
 	func() {
 		// Maybe make it a go-routine?
-		log.Info("%s %s: Writing soln locally to %s", c.Request().Method, c.Request().URL, filename)
+		log.Info("storeSolution: Writing soln locally to %s", filename)
 		err := utils.UpdateFile(filename, solnReq.Solution)
 		if err != nil {
 			panic(err)
 		}
-		log.Info("%s %s: Updating Task.Src to %s", c.Request().Method, c.Request().URL, filename)
+		log.Info("storeSolution: Updating Task.Src to %s", filename)
 		task.Src = filename
 		task.Filename = fname
 	}()
 	func() {
-		log.Info("%s %s: Storing the following solution as gist: %q", c.Request().Method, c.Request().URL, solnReq.Solution)
 		user, ok := userContexts[solnReq.Ticket]
 		log.Info("ticket, user, ok: %s, %v, %v", solnReq.Ticket, user, ok)
+		if !ok || user.githubClient == nil {
+			return
+		}
+		log.Info("storeSolution: Storing the following solution as gist: %q", solnReq.Solution)
 		saveAsGist(user.githubClient, solnReq.Ticket, oldFilename, fname, string(solnReq.Solution))
 	}()
-	return task, solnReq
+	return task, nil
+}
+
+// finalizeTask closes taskId after its final submission and tells the CUI
+// which task comes next. Drafts stay open after being published.
+func finalizeTask(ticketId, taskId string, resp *cui.VerifyStatus) {
+	session, ok := lookupSession(ticketId)
+	if ok && session.Ticket.Draft != nil {
+		return
+	}
+	if task, found := findTask(ticketId, taskId); found && task.Src != "" {
+		if err := storeSubmission(ticketId, task); err != nil {
+			log.Error("Failed to store the submission of %s/%s: %v", ticketId, taskId, err)
+		}
+	}
+	notify(webhook.TaskFinalized, ticketId, taskId)
+	if !ok {
+		return
+	}
+	session.Lock()
+	resp.NextTask = session.Finalize(taskId)
+	log.Info("Finalized task %s of ticket %s, next task: %q", taskId, ticketId, resp.NextTask)
+	saveSession(session)
+	closed := session.Closed
+	session.Unlock()
+	if closed {
+		notify(webhook.TicketClosed, ticketId, "")
+	}
+}
+
+// closeSession closes the ticket of a session that is still open and
+// notifies webhooks with eventType.
+func closeSession(ticketId, eventType string) {
+	session, ok := lookupSession(ticketId)
+	if !ok {
+		return
+	}
+	// The sweeper and the CUI may both close a session whose time is up.
+	session.Lock()
+	closed := session.Close(time.Now())
+	if closed {
+		saveSession(session)
+	}
+	session.Unlock()
+	if closed {
+		notify(eventType, ticketId, "")
+	}
+}
+
+// getTask serves a task of the CUI and charges the time spent on the
+// previous one.
+func getTask(msg *cui.MessageGetTask) (*cui.Task, error) {
+	session, ok := lookupSession(msg.Ticket)
+	if !ok {
+		return nil, cui.ErrNoSuchTask
+	}
+	session.Lock()
+	defer session.Unlock()
+	tasksMu.Lock()
+	task, err := cui.GetTask(session, tasks, msg)
+	tasksMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	session.SwitchTask(time.Now(), task.Id)
+	saveSession(session)
+	return task, nil
 }
 
 func addCuiHandlers(e *echo.Echo) {
 	c := e.Group("/c")
 	c.Post("/_start", func(c *echo.Context) error {
-		session, ok := cuiSessions[c.Form("ticket")]
+		session, ok := lookupSession(c.Form("ticket"))
 		if !ok {
 			return echo.NewHTTPError(http.StatusInternalServerError, "Attempt to start an invalid session")
 		}
-		session.StartTime = time.Now()
+		session.Lock()
+		defer session.Unlock()
+		started, err := session.Start(time.Now(), sessionExpiry())
+		if err != nil {
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+		if started {
+			saveSession(session)
+			notify(webhook.TicketStarted, session.Ticket.Id, "")
+		}
 		return c.String(http.StatusOK, "Started")
 	})
 	c.Post("/_get_task", func(c *echo.Context) error {
@@ -175,13 +319,58 @@ func addCuiHandlers(e *echo.Echo) {
 			HumanLang:            c.Form("human_lang"),
 			PreferServerProgLang: c.Form("prefer_server_prg_lang") == "false",
 		}
-		return c.XML(http.StatusOK, cui.GetTask(tasks, msg))
+		task, err := getTask(msg)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, "No such task")
+		}
+		return c.XML(http.StatusOK, task)
+	})
+	c.Get("/assets/:ticket/:task/:name", func(c *echo.Context) error {
+		task, ok := findTask(c.Param("ticket"), c.Param("task"))
+		if !ok {
+			return echo.NewHTTPError(http.StatusNotFound, "No such task")
+		}
+		content, ok := task.Assets[c.Param("name")]
+		if !ok {
+			return echo.NewHTTPError(http.StatusNotFound, "No such asset")
+		}
+		contentType := mime.TypeByExtension(path.Ext(c.Param("name")))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		c.Response().Header().Set("Content-Type", contentType)
+		c.Response().Header().Set("X-Content-Type-Options", "nosniff")
+		// Assets are shown as images; SVGs opened on their own must not run scripts.
+		c.Response().Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+		c.Response().WriteHeader(http.StatusOK)
+		_, err := c.Response().Write(content)
+		return err
 	})
 	c.Get("/close/:ticket_id", func(c *echo.Context) error {
 		log.Info("Params: ->%s<-, ->%s<-", c.P(0), c.P(1))
+		closeSession(c.Param("ticket_id"), webhook.TicketClosed)
 		return c.Redirect(http.StatusTemporaryRedirect, "/")
 	})
 
+	e.Post("/surveys/_ajax_submit_candidate_survey/:ticket_id/", func(c *echo.Context) error {
+		session, ok := lookupSession(c.Param("ticket_id"))
+		if !ok {
+			return echo.NewHTTPError(http.StatusNotFound, "No valid session found")
+		}
+		c.Request().ParseForm()
+		answers := map[string]string{}
+		for name := range c.Request().Form {
+			answers[name] = c.Request().Form.Get(name)
+		}
+		session.Lock()
+		defer session.Unlock()
+		if err := session.SaveSurvey(time.Now(), answers); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		saveSession(session)
+		return c.String(http.StatusOK, "OK")
+	})
+
 	chk := e.Group("/chk")
 	chk.Post("/clock", func(c *echo.Context) error {
 		c.Request().ParseForm()
@@ -189,7 +378,7 @@ func addCuiHandlers(e *echo.Echo) {
 		schemaDecoder.Decode(clkReq, c.Request().Form)
 		log.Info("Clock Request: %v", clkReq)
 		oldlimit := time.Duration(clkReq.OldTimeLimit) * time.Second
-		resp := cui.GetClock(cuiSessions, clkReq)
+		resp := getClock(clkReq)
 		newlimit := time.Duration(resp.NewTimeLimit) * time.Second
 		log.Info("Clock Request: OldLimit=%s", oldlimit)
 		log.Info("Clock Response: NewLimit=%s", newlimit)
@@ -197,36 +386,68 @@ func addCuiHandlers(e *echo.Echo) {
 	})
 
 	chk.Post("/save", func(c *echo.Context) error {
-		saveSolution(c)
+		if _, _, err := saveSolution(c); err != nil {
+			return echo.NewHTTPError(http.StatusForbidden, err.Error())
+		}
 		return c.String(http.StatusOK, "Finished saving")
 	})
 
 	chk.Post("/verify", func(c *echo.Context) error {
 		c.Form("task")
 		log.Info("/verify: %#v", c.Request().Form)
-		task, solnReq := saveSolution(c)
-		return c.XML(http.StatusOK, cui.GetVerifyStatus(runner, task, solnReq, cui.VERIFY))
+		task, solnReq, err := saveSolution(c)
+		if err != nil {
+			return c.XML(http.StatusOK, cui.ErrorStatus(err))
+		}
+		if status, msg := checkDraft(c, c.Form("ticket")); status != 0 {
+			return c.XML(http.StatusOK, cui.ErrorStatus(errors.New(msg)))
+		}
+		return c.XML(http.StatusOK, verifyStatus(task, solnReq, cui.VERIFY))
 	})
 
 	chk.Post("/judge", func(c *echo.Context) error {
 		c.Form("task")
 		log.Info("/judge: %#v", c.Request().Form)
-		task, solnReq := saveSolution(c)
-		return c.XML(http.StatusOK, cui.GetVerifyStatus(runner, task, solnReq, cui.JUDGE))
+		task, solnReq, err := saveSolution(c)
+		if err != nil {
+			return c.XML(http.StatusOK, cui.ErrorStatus(err))
+		}
+		if status, msg := checkDraft(c, c.Form("ticket")); status != 0 {
+			return c.XML(http.StatusOK, cui.ErrorStatus(errors.New(msg)))
+		}
+		return c.XML(http.StatusOK, verifyStatus(task, solnReq, cui.JUDGE))
 	})
 
 	chk.Post("/final", func(c *echo.Context) error {
 		log.Info("In /final")
 		c.Form("task")
 		log.Info("/final: %#v", c.Request().Form)
-		task, solnReq := saveSolution(c)
-		return c.XML(http.StatusOK, cui.GetVerifyStatus(runner, task, solnReq, cui.FINAL))
+		task, solnReq, err := saveSolution(c)
+		if err != nil {
+			return c.XML(http.StatusOK, cui.ErrorStatus(err))
+		}
+		if status, msg := checkDraft(c, c.Form("ticket")); status != 0 {
+			return c.XML(http.StatusOK, cui.ErrorStatus(errors.New(msg)))
+		}
+		resp := verifyStatus(task, solnReq, cui.FINAL)
+		if task != nil {
+			finalizeTask(solnReq.Ticket, solnReq.Task, resp)
+		}
+		return c.XML(http.StatusOK, resp)
+	})
+
+	chk.Post("/timeout_action", func(c *echo.Context) error {
+		log.Info("/timeout_action: %#v", c.Request().Form)
+		saveSolution(c)
+		// Only the server clock decides that the time is up.
+		expireSession(c.Form("ticket"), time.Now(), 0)
+		return c.XML(http.StatusOK, &cui.VerifyStatus{Result: "OK"})
 	})
 
 	chk.Post("/status", func(c *echo.Context) error {
 		c.Form("task")
 		log.Info("/status: %#v", c.Request().Form)
-		return c.XML(http.StatusOK, cui.GetVerifyStatus(runner, nil, nil, cui.VERIFY))
+		return c.XML(http.StatusOK, cui.GetVerifyStatus(runner, nil, nil, nil, cui.VERIFY))
 	})
 }
 
@@ -283,94 +504,23 @@ func saveAsGist(client *github.Client, key, oldFilename, filename, filecontent s
 	}
 }
 
-func readDotEnv(root string) (map[string]string, error) {
-	env := map[string]string{}
-	read, err := ioutil.ReadFile(filepath.Join(root, ".env"))
-	if err != nil {
-		return map[string]string{}, err
-	}
-	err = json.Unmarshal(read, &env)
-	return env, err
-}
-
 var (
 	userContexts = map[string]*UserContext{}
 	runner       *code.Runner
+	local        *judge.Local
+	webhooks     *webhook.Dispatcher
 )
 
-func main() {
-	initializeConfig()
-	Opts.RunnerPath, _ = filepath.Abs(Opts.RunnerPath)
-	port := Opts.Port
-	staticDir := filepath.Join(Opts.StaticFilesRoot, "static_cui/cui/static/cui")
-	templatesDir := filepath.Join(Opts.StaticFilesRoot, "static_cui/cui/templates")
-	log.Info("Using Port=%s", port)
-	log.Info("Using Static Directory=%s", staticDir)
-	log.Info("Using Templates Directory=%s", templatesDir)
-	log.Info("Using runner=%s", Opts.RunnerPath)
-
-	runner = code.NewRunner(Opts.RunnerPath)
-
-	env, err := readDotEnv(Opts.StaticFilesRoot)
-	if err != nil {
-		log.Fatal("Got error while reading dotenv: %v", err)
-		return
-	} else {
-		log.Info("Read env: %s", env)
-	}
-	THINK_GISTS_KEY, ok := env["THINK_GISTS_KEY"]
-	if !ok {
-		log.Fatal("Need github secret to proceed")
-		return
-	}
-	AUTH0_TOKEN, ok := env["AUTH0_TOKEN"]
-	if !ok {
-		log.Fatal("Need AUTH0 token to proceed")
-		return
-	}
-
-	//initializeGitClient(secret)
-	//saveAsGist(githubClient, "abc.txt", "this is cool")
-	//saveAsGist(githubClient, "abc.txt", "this is fun")
-
-	schemaDecoder = schema.NewDecoder()
-	cuiSessions = map[string]*cui.Session{}
-	tasks = map[cui.TaskKey]*cui.Task{}
-
-	TMP_DIR, err = getTmpWorkDir()
-	if err != nil {
-		log.Fatal("Failed to initialize tmp_dir: %v", err)
-		return
-	}
-
-	// Echo instance
-	e := echo.New()
-	e.Hook(func(w http.ResponseWriter, r *http.Request) {
-		path := r.URL.Path
-		l := len(path) - 1
-		if path != "/" && path[l] == '/' {
-			r.URL.Path = path[:l]
-		}
-	})
-	t := loadTemplates(templatesDir)
-	e.SetRenderer(t)
-
-	// Middleware
-	e.Use(mw.Logger())
-	//e.Use(mw.Recover())
-
-	// Routes
-	e.Index(filepath.Join(Opts.StaticFilesRoot, "client-app/index.html"))
-	e.Static("/static/", filepath.Join(Opts.StaticFilesRoot, "client-app/static"))
-
+// addAuthHandlers registers the Auth0 login flow used by client-app.
+func addAuthHandlers(e *echo.Echo) {
 	// Initial API call
 	e.Get("/secured/ping", func(c *echo.Context) error {
 		user_id := c.Query("user_id")
 		log.Info("user_id: %s", user_id)
-		url := fmt.Sprintf("https://thinkhike.auth0.com/api/v2/users/%s", user_id)
+		url := fmt.Sprintf("https://%s/api/v2/users/%s", Cfg.Auth.Auth0Domain, user_id)
 		client := &http.Client{}
 		req, err := http.NewRequest("GET", url, nil)
-		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", AUTH0_TOKEN))
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", Cfg.Auth.Auth0Token))
 		q := req.URL.Query()
 		q.Add("fields", "identities")
 		req.URL.RawQuery = q.Encode()
@@ -404,50 +554,261 @@ func main() {
 		log.Info("Got: access token: %s", *expected.Data.Identities[0].AccessToken)
 		USER_GH_TOKEN := *expected.Data.Identities[0].AccessToken
 		user := &UserContext{githubClient: NewGitHubClient(USER_GH_TOKEN)}
+		tasksMu.Lock()
 		ticket := cui.NewTicket(tasks, nil)
-		cuiSessions[ticket.Id] = &cui.Session{TimeLimit: 3600, Created: time.Now(), Ticket: ticket}
-		userContexts[ticket.Id] = user
+		tasksMu.Unlock()
+		registerTicket(ticket, user)
 		expected.Ticket = ticket.Id
 		return c.JSON(http.StatusOK, expected)
 	})
+}
+
+// newUserContext returns the context used to archive solutions of an
+// anonymous ticket, which has no GitHub client when archiving is off.
+func newUserContext() *UserContext {
+	if !Cfg.Archive.Enabled {
+		return &UserContext{}
+	}
+	return &UserContext{githubClient: NewGitHubClient(Cfg.Archive.GistsKey)}
+}
+
+func newSession(ticket *cui.Ticket) *cui.Session {
+	return &cui.Session{TimeLimit: Cfg.Limits.TimeLimit, Created: time.Now(), Ticket: ticket}
+}
+
+// sessionExpiry is how long a ticket may wait to be started.
+func sessionExpiry() time.Duration {
+	return time.Duration(Cfg.Limits.SessionExpiry) * time.Second
+}
+
+// saveSession persists session so that its clock survives a restart. The
+// caller holds the lock of session.
+func saveSession(session *cui.Session) {
+	if err := cui.SaveSession(TMP_DIR, session); err != nil {
+		log.Error("Failed to save the session of ticket %s: %v", session.Ticket.Id, err)
+	}
+}
+
+// registerTicket opens a session for a freshly created ticket.
+func registerTicket(ticket *cui.Ticket, user *UserContext) *cui.Session {
+	session := newSession(ticket)
+	session.Lock()
+	saveSession(session)
+	session.Unlock()
+	addSession(session)
+	userContexts[ticket.Id] = user
+	notify(webhook.TicketCreated, ticket.Id, "")
+	return session
+}
+
+// notify emits a lifecycle event of ticketId to the configured webhooks.
+func notify(eventType, ticketId, taskId string) {
+	organisation := ""
+	if session, ok := lookupSession(ticketId); ok {
+		organisation = session.Ticket.Organisation
+	}
+	webhooks.Emit(webhook.NewEvent(eventType, organisation, ticketId, taskId))
+}
+
+// apiListWebhookDeliveries lists the recent attempts to deliver webhooks,
+// optionally only those of a ticket.
+func apiListWebhookDeliveries(c *echo.Context) error {
+	return c.JSON(http.StatusOK, webhooks.Log.Entries(c.Query("ticket")))
+}
+
+func newWebhookDispatcher(cfg *config.Config) (*webhook.Dispatcher, error) {
+	deliveries, err := webhook.NewDeliveryLog(filepath.Join(cfg.Storage.WorkDir, "webhooks.log"))
+	if err != nil {
+		return nil, err
+	}
+	endpoints := []webhook.Endpoint{}
+	for _, hook := range cfg.Webhooks {
+		endpoints = append(endpoints, webhook.Endpoint{
+			Organisation: hook.Organisation,
+			URL:          hook.URL,
+			Secret:       hook.Secret,
+			Events:       hook.Events,
+		})
+	}
+	return webhook.NewDispatcher(endpoints, deliveries), nil
+}
+
+func main() {
+	os.Exit(runCommand(os.Args[1:]))
+}
+
+// serveCommand implements `goonj serve`, the web server, which is also
+// what goonj runs without a command.
+func serveCommand(args []string) int {
+	var err error
+	flags := flag.NewFlagSet("goonj", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: goonj [serve] [flags]\n       goonj help, for the other commands\n\nFlags:\n")
+		flags.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "Alternatively, you may set environment variables %s, %s and %s\n", config.ENV_PORT_NAME, config.ENV_STATIC_FILES_DIR, config.ENV_RUNNER_PATH)
+	}
+	Cfg, err = initializeConfig(flags, args)
+	if err != nil {
+		log.Fatal("%v", err)
+		return 1
+	}
+	port := Cfg.Server.Port
+	log.Info("Using Config File=%s", Cfg.File)
+	log.Info("Using Port=%s", port)
+	if Cfg.Server.StaticFilesRoot == "" {
+		log.Info("Using embedded static files and templates")
+	} else {
+		log.Info("Using Static Files Root=%s", Cfg.Server.StaticFilesRoot)
+	}
+	log.Info("Using runner=%s", Cfg.Runner.Path)
+	log.Info("Auth0 login enabled: %v, gist archive enabled: %v", Cfg.Auth.Enabled, Cfg.Archive.Enabled)
+
+	runner = code.NewRunner(Cfg.Runner.Path)
+
+	//initializeGitClient(secret)
+	//saveAsGist(githubClient, "abc.txt", "this is cool")
+	//saveAsGist(githubClient, "abc.txt", "this is fun")
+
+	schemaDecoder = schema.NewDecoder()
+	cuiSessions = map[string]*cui.Session{}
+	tasks = map[cui.TaskKey]*cui.Task{}
+
+	TMP_DIR, err = getTmpWorkDir()
+	if err != nil {
+		log.Fatal("Failed to initialize tmp_dir: %v", err)
+		return 1
+	}
+	workDirLock, err = lockWorkDir(TMP_DIR)
+	if err != nil {
+		log.Fatal("Failed to lock %s: %v", TMP_DIR, err)
+		return 1
+	}
+
+	// Interactive problems connect two programs, which the runner cannot.
+	local, err = newLocal(Cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize local runner: %v", err)
+		return 1
+	}
+
+	bank, err = problem.NewBank(Cfg.Storage.Bank())
+	if err != nil {
+		log.Fatal("Failed to initialize problem bank: %v", err)
+		return 1
+	}
+	log.Info("Using problem bank=%s", bank.Root)
+
+	submissions = submission.NewStore(TMP_DIR)
+	restoreSessions()
+	go sweepSessions(SWEEP_INTERVAL)
+	rejudgeQueue = submission.NewQueue(newRejudger(submissions))
+
+	webhooks, err = newWebhookDispatcher(Cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize webhooks: %v", err)
+		return 1
+	}
+	log.Info("Using %d webhook endpoints", len(webhooks.Endpoints))
+
+	// Echo instance
+	e := echo.New()
+	e.Hook(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		l := len(path) - 1
+		if path != "/" && path[l] == '/' {
+			r.URL.Path = path[:l]
+		}
+	})
+	assets, err := NewAssets(Cfg.Server.StaticFilesRoot)
+	if err != nil {
+		log.Fatal("Failed to load static files: %v", err)
+		return 1
+	}
+	t, err := assets.LoadTemplates()
+	if err != nil {
+		log.Fatal("Failed to load templates: %v", err)
+		return 1
+	}
+	e.SetRenderer(t)
+
+	// Middleware
+	e.Use(mw.Logger())
+	//e.Use(mw.Recover())
+
+	// Routes
+	e.Get("/", func(c *echo.Context) error {
+		return assets.ServeFile(c.Response(), c.Request(), path.Join(clientAppDir, "index.html"))
+	})
+	e.Get("/static/*", assets.Handler("/static/", path.Join(clientAppDir, "static")))
+
+	if Cfg.Auth.Enabled {
+		addAuthHandlers(e)
+	}
 
 	// Remaining routes
 	e.Get("/hello", hello)
-	e.Static("/static/cui", staticDir)
+	e.Get("/static/cui/*", assets.Handler("/static/cui/", cuiStaticDir))
 	e.Get("/cui/:ticket_id", func(c *echo.Context) error {
 		ticket_id := c.Param("ticket_id")
 		log.Info("Ticket: %s", ticket_id)
-		session, ok := cuiSessions[ticket_id]
+		session, ok := lookupSession(ticket_id)
 		if !ok {
 			return echo.NewHTTPError(http.StatusNotFound, "No valid session found")
 		}
-		if time.Now().Sub(session.Created) > time.Duration(5*time.Minute) {
+		session.Lock()
+		defer session.Unlock()
+		now := time.Now()
+		state := session.State(now, sessionExpiry())
+		if state == cui.SESSION_EXPIRED && session.StartTime.IsZero() {
 			return echo.NewHTTPError(http.StatusNotFound, "Session Expired")
 		}
-		if !session.Started {
-			session.Started = true
+		if session.Open(now) {
+			saveSession(session)
 		}
-		log.Info("Session Started? %v", session.Started)
+		session.UpdateOptions(now)
+		log.Info("Session %s is %s", ticket_id, state)
 		return c.Render(http.StatusOK, "cui.html", map[string]interface{}{"Title": "Goonj", "Ticket": session.Ticket})
 	})
 	e.Get("/cui/new", func(c *echo.Context) error {
-		user := &UserContext{githubClient: NewGitHubClient(THINK_GISTS_KEY)}
-		ticket := cui.NewTicket(tasks, nil)
-		cuiSessions[ticket.Id] = &cui.Session{TimeLimit: 3600, Created: time.Now(), Ticket: ticket}
-		userContexts[ticket.Id] = user
+		if c.Query("org") != "" {
+			if status, msg := checkAdmin(c); status != 0 {
+				return echo.NewHTTPError(status, "org: "+msg)
+			}
+		}
+		ticket, err := newTicket(splitRefs(c.Query("problems")))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		ticket.Organisation = c.Query("org")
+		ticket.Options.Sequential = c.Query("sequential") == "true"
+		registerTicket(ticket, newUserContext())
 		return c.JSON(http.StatusOK, map[string]string{"ticket_id": ticket.Id})
 	})
 
 	e.Get("/cui/load", func(c *echo.Context) error {
-		user := &UserContext{githubClient: NewGitHubClient(THINK_GISTS_KEY)}
+		if c.Query("org") != "" {
+			if status, msg := checkAdmin(c); status != 0 {
+				return echo.NewHTTPError(status, "org: "+msg)
+			}
+		}
+		tasksMu.Lock()
 		ticket := cui.LoadTicket(tasks, nil)
-		cuiSessions[ticket.Id] = &cui.Session{TimeLimit: 3600, Created: time.Now(), Ticket: ticket}
-		userContexts[ticket.Id] = user
+		tasksMu.Unlock()
+		ticket.Organisation = c.Query("org")
+		ticket.Options.Sequential = c.Query("sequential") == "true"
+		registerTicket(ticket, newUserContext())
 		return c.JSON(http.StatusOK, map[string]string{"ticket_id": ticket.Id})
 	})
 
 	addCuiHandlers(e)
+	addAuthoringHandlers(e)
+	addApiHandlers(e)
+	addMirrorHandlers(e)
+	addChatHandlers(e)
+	addIntegrityHandlers(e)
+	addSimilarityHandlers(e)
 
 	// Start server
 	e.Run(fmt.Sprintf(":%s", port))
+	return 0
 }
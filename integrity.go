@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/labstack/echo"
+	"github.com/maddyonline/goonj/config"
+	"github.com/maddyonline/goonj/cui"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type apiEventRequest struct {
+	Type string `json:"type"`
+	Task string `json:"task"`
+	Size int    `json:"size"`
+}
+
+// apiIntegrity is the integrity report of a ticket: its events and whether
+// they exceed the configured thresholds.
+type apiIntegrity struct {
+	TicketId string                `json:"ticket_id"`
+	Summary  *cui.IntegritySummary `json:"summary"`
+	Events   []cui.IntegrityEvent  `json:"events"`
+}
+
+func integrityThresholds(cfg config.IntegrityConfig) cui.IntegrityThresholds {
+	return cui.IntegrityThresholds{
+		MaxPaste:     cfg.MaxPasteChars,
+		MaxPasted:    cfg.MaxPastedChars,
+		MaxBlurs:     cfg.MaxBlurs,
+		MaxAway:      time.Duration(cfg.MaxAwaySec) * time.Second,
+		FlagDevtools: cfg.FlagDevtools,
+	}
+}
+
+func newApiIntegrity(session *cui.Session) *apiIntegrity {
+	session.Lock()
+	defer session.Unlock()
+	events := append([]cui.IntegrityEvent{}, session.Events...)
+	return &apiIntegrity{
+		TicketId: session.Ticket.Id,
+		Summary:  session.IntegritySummary(time.Now(), integrityThresholds(Cfg.Integrity)),
+		Events:   events,
+	}
+}
+
+func recordEvent(session *cui.Session, eventReq *apiEventRequest) (*cui.IntegrityEvent, error) {
+	session.Lock()
+	defer session.Unlock()
+	ev := cui.IntegrityEvent{Type: eventReq.Type, Task: eventReq.Task, Size: eventReq.Size}
+	recorded, err := session.RecordEvent(time.Now(), ev)
+	if err != nil {
+		return nil, err
+	}
+	saveSession(session)
+	return &recorded, nil
+}
+
+func eventStatus(err error) int {
+	if err == cui.ErrTicketClosed {
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+// apiRecordEvent records an integrity event reported by the candidate.
+func apiRecordEvent(c *echo.Context) error {
+	session, err := apiSession(c)
+	if session == nil {
+		return err
+	}
+	eventReq := &apiEventRequest{}
+	if err := json.NewDecoder(c.Request().Body).Decode(eventReq); err != nil {
+		return apiErrorf(c, http.StatusBadRequest, "invalid request body: %v", err)
+	}
+	ev, err := recordEvent(session, eventReq)
+	if err != nil {
+		return apiErrorf(c, eventStatus(err), "%v", err)
+	}
+	return c.JSON(http.StatusCreated, ev)
+}
+
+// apiGetIntegrity returns the integrity report of a ticket.
+func apiGetIntegrity(c *echo.Context) error {
+	session, err := apiSession(c)
+	if session == nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, newApiIntegrity(session))
+}
+
+// addIntegrityHandlers receives the integrity events of the CUI as forms.
+func addIntegrityHandlers(e *echo.Echo) {
+	e.Post("/c/integrity/:ticket", func(c *echo.Context) error {
+		session, ok := lookupSession(c.Param("ticket"))
+		if !ok {
+			return echo.NewHTTPError(http.StatusNotFound, "No valid session found")
+		}
+		size, _ := strconv.Atoi(c.Form("size"))
+		ev, err := recordEvent(session, &apiEventRequest{Type: c.Form("type"), Task: c.Form("task"), Size: size})
+		if err != nil {
+			return c.JSON(eventStatus(err), &apiError{Error: err.Error()})
+		}
+		return c.JSON(http.StatusOK, ev)
+	})
+}
@@ -0,0 +1,162 @@
+package judge
+
+import (
+	"fmt"
+	"github.com/maddyonline/code"
+	"github.com/maddyonline/goonj/problem"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Verdict is a checker's judgement of one output.
+type Verdict struct {
+	OK      bool
+	Message string
+}
+
+// Checker judges the output got of a solution on input, given the output
+// expected from the reference. An error means the checker itself failed.
+type Checker func(input, expected, got string) (*Verdict, error)
+
+func accepted() (*Verdict, error) {
+	return &Verdict{OK: true}, nil
+}
+
+func wrongAnswer(format string, a ...interface{}) (*Verdict, error) {
+	return &Verdict{Message: fmt.Sprintf(format, a...)}, nil
+}
+
+// NewChecker returns the checker selected by cfg. prog is the checker
+// program, used when cfg.Type is program.
+func NewChecker(cfg problem.CheckerConfig, prog *code.Input, run RunFunc) (Checker, error) {
+	switch cfg.Type {
+	case "", problem.CHECKER_EXACT:
+		return exactChecker, nil
+	case problem.CHECKER_TOKENS:
+		return tokenChecker(func(want, got string) bool { return want == got }), nil
+	case problem.CHECKER_CASE:
+		return tokenChecker(strings.EqualFold), nil
+	case problem.CHECKER_WHITESPACE:
+		return whitespaceChecker, nil
+	case problem.CHECKER_FLOAT:
+		if cfg.Tolerance <= 0 {
+			return nil, fmt.Errorf("checker: float tolerance must be positive")
+		}
+		return tokenChecker(floatEqual(cfg.Tolerance)), nil
+	case problem.CHECKER_PROGRAM:
+		if prog == nil {
+			return nil, fmt.Errorf("checker: program is missing")
+		}
+		return programChecker(prog, run), nil
+	}
+	return nil, fmt.Errorf("checker: unknown type %q", cfg.Type)
+}
+
+// ProblemChecker returns the checker of p.
+func ProblemChecker(p *problem.Problem, run RunFunc) (Checker, error) {
+	return NewChecker(p.Manifest.Checker, p.Checker, run)
+}
+
+// exactChecker accepts outputs that only differ in trailing whitespace.
+func exactChecker(input, expected, got string) (*Verdict, error) {
+	if SameOutput(expected, got) {
+		return accepted()
+	}
+	want, have := strings.Split(expected, "\n"), strings.Split(got, "\n")
+	for i := range want {
+		if i >= len(have) || want[i] != have[i] {
+			return wrongAnswer("line %d differs", i+1)
+		}
+	}
+	return wrongAnswer("line %d differs", len(want)+1)
+}
+
+// whitespaceChecker compares lines ignoring the amount of whitespace
+// between words and blank lines at the end.
+func whitespaceChecker(input, expected, got string) (*Verdict, error) {
+	lines := func(s string) []string {
+		ls := strings.Split(strings.TrimRight(s, " \t\r\n"), "\n")
+		for i, l := range ls {
+			ls[i] = strings.Join(strings.Fields(l), " ")
+		}
+		return ls
+	}
+	want, have := lines(expected), lines(got)
+	for i := range want {
+		if i >= len(have) {
+			return wrongAnswer("expected %d lines, got %d", len(want), len(have))
+		}
+		if want[i] != have[i] {
+			return wrongAnswer("line %d differs", i+1)
+		}
+	}
+	if len(have) > len(want) {
+		return wrongAnswer("expected %d lines, got %d", len(want), len(have))
+	}
+	return accepted()
+}
+
+// tokenChecker compares whitespace separated tokens with equal.
+func tokenChecker(equal func(want, got string) bool) Checker {
+	return func(input, expected, got string) (*Verdict, error) {
+		want, have := strings.Fields(expected), strings.Fields(got)
+		if len(want) != len(have) {
+			return wrongAnswer("expected %d tokens, got %d", len(want), len(have))
+		}
+		for i := range want {
+			if !equal(want[i], have[i]) {
+				return wrongAnswer("token %d: expected %q, got %q", i+1, want[i], have[i])
+			}
+		}
+		return accepted()
+	}
+}
+
+// floatEqual compares numbers with an absolute or relative error of at
+// most tolerance, and other tokens exactly.
+func floatEqual(tolerance float64) func(want, got string) bool {
+	return func(want, got string) bool {
+		w, errW := strconv.ParseFloat(want, 64)
+		g, errG := strconv.ParseFloat(got, 64)
+		if errW != nil || errG != nil {
+			return want == got
+		}
+		return w == g || math.Abs(w-g) <= tolerance*math.Max(1, math.Abs(w))
+	}
+}
+
+// checkerFiles are the files a checker program reads the test from. They
+// change with every test, so Local keeps them out of the compiled program
+// and writes them next to each run of the checker instead.
+var checkerFiles = map[string]bool{"input.txt": true, "expected.txt": true, "output.txt": true}
+
+// programChecker runs an author supplied checker, see problem.CheckerConfig.
+func programChecker(prog *code.Input, run RunFunc) Checker {
+	return func(input, expected, got string) (*Verdict, error) {
+		checker := &code.Input{
+			Language: prog.Language,
+			Files: append([]code.File{prog.Files[0]},
+				code.File{Name: "input.txt", Content: input},
+				code.File{Name: "expected.txt", Content: expected},
+				code.File{Name: "output.txt", Content: got},
+			),
+		}
+		out, err := run(checker, "")
+		if err != nil {
+			return nil, fmt.Errorf("checker: %v", err)
+		}
+		lines := strings.SplitN(strings.TrimLeft(out, " \t\r\n"), "\n", 2)
+		message := ""
+		if len(lines) > 1 {
+			message = strings.TrimSpace(lines[1])
+		}
+		switch strings.TrimSpace(lines[0]) {
+		case "OK":
+			return &Verdict{OK: true, Message: message}, nil
+		case "WA":
+			return &Verdict{Message: message}, nil
+		}
+		return nil, fmt.Errorf("checker: expected OK or WA on the first line, got %q", lines[0])
+	}
+}
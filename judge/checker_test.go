@@ -0,0 +1,75 @@
+package judge
+
+import (
+	"github.com/maddyonline/code"
+	"github.com/maddyonline/goonj/problem"
+	"strings"
+	"testing"
+)
+
+func TestBuiltinCheckers(t *testing.T) {
+	for _, tc := range []struct {
+		spec     string
+		expected string
+		got      string
+		ok       bool
+	}{
+		{"exact", "1 2\n", "1 2\n\n", true},
+		{"exact", "1 2\n", "1  2\n", false},
+		{"tokens", "1 2\n3\n", "1\n2 3", true},
+		{"tokens", "1 2 3", "1 2", false},
+		{"whitespace", "a  b\nc\n", "a b \nc", true},
+		{"whitespace", "a b\nc\n", "a b c\n", false},
+		{"case", "YES\n", "yes\n", true},
+		{"case", "YES\n", "no\n", false},
+		{"float 1e-6", "0.333333333 inf\n", "0.3333334 inf\n", true},
+		{"float 1e-6", "1000000\n", "1000000.5\n", true},
+		{"float 1e-6", "0.5\n", "0.6\n", false},
+		{"float 1e-6", "0.5 x\n", "0.5 y\n", false},
+	} {
+		check, err := NewChecker(problem.ParseChecker(tc.spec), nil, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.spec, err)
+		}
+		verdict, err := check("", tc.expected, tc.got)
+		if err != nil || verdict.OK != tc.ok {
+			t.Errorf("%s(%q, %q): got %#v, %v, want ok=%v", tc.spec, tc.expected, tc.got, verdict, err, tc.ok)
+		}
+		if !verdict.OK && verdict.Message == "" {
+			t.Errorf("%s(%q, %q): rejected without a message", tc.spec, tc.expected, tc.got)
+		}
+	}
+}
+
+func TestProgramChecker(t *testing.T) {
+	// The checker accepts any permutation of the expected tokens.
+	run := func(prog *code.Input, stdin string) (string, error) {
+		files := map[string]string{}
+		for _, file := range prog.Files[1:] {
+			files[file.Name] = file.Content
+		}
+		if len(strings.Fields(files["expected.txt"])) != len(strings.Fields(files["output.txt"])) {
+			return "WA\nwrong number of values\n", nil
+		}
+		return "OK\n", nil
+	}
+	p := &problem.Problem{
+		Manifest: problem.Manifest{Checker: problem.CheckerConfig{Type: problem.CHECKER_PROGRAM}},
+		Checker:  problem.NewProgram("checker.py", ""),
+	}
+	check, err := ProblemChecker(p, run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verdict, err := check("3\n", "1 2 3\n", "3 1 2\n"); err != nil || !verdict.OK {
+		t.Errorf("expected a permutation to be accepted, got %#v, %v", verdict, err)
+	}
+	if verdict, err := check("3\n", "1 2 3\n", "3 1\n"); err != nil || verdict.OK || verdict.Message != "wrong number of values" {
+		t.Errorf("expected wrong number of values, got %#v, %v", verdict, err)
+	}
+	broken := func(prog *code.Input, stdin string) (string, error) { return "maybe\n", nil }
+	check, _ = ProblemChecker(p, broken)
+	if _, err := check("", "", ""); err == nil {
+		t.Errorf("expected an error for a checker without a verdict")
+	}
+}
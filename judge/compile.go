@@ -0,0 +1,111 @@
+package judge
+
+import (
+	"fmt"
+	"github.com/maddyonline/code"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	SEVERITY_ERROR   = "error"
+	SEVERITY_WARNING = "warning"
+	SEVERITY_NOTE    = "note"
+)
+
+// Diagnostic is an error or warning a compiler reported. Line and Column
+// count from 1; Column is 0 when the compiler did not give one.
+type Diagnostic struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	pos := fmt.Sprintf("%s:%d", d.File, d.Line)
+	if d.Column > 0 {
+		pos += fmt.Sprintf(":%d", d.Column)
+	}
+	return fmt.Sprintf("%s: %s: %s", pos, d.Severity, d.Message)
+}
+
+var (
+	// gcc and clang: "main.cpp:3:5: error: message", the column optional.
+	gccDiagnostic = regexp.MustCompile(`^(.+?):(\d+):(?:(\d+):)? (?:fatal )?(error|warning|note): (.*)$`)
+	// tsc: "main.ts(3,5): error TS2304: message".
+	tscDiagnostic = regexp.MustCompile(`^(.+?)\((\d+),(\d+)\): (error|warning) (TS\d+: .*)$`)
+	// tsc --pretty: "main.ts:3:5 - error TS2304: message".
+	tscPrettyDiagnostic = regexp.MustCompile(`^(.+?):(\d+):(\d+) - (error|warning) (TS\d+: .*)$`)
+	// go: "./main.go:3:2: message", always an error.
+	goDiagnostic = regexp.MustCompile(`^(.+?\.go):(\d+):(?:(\d+):)? (.*)$`)
+)
+
+// ParseDiagnostics picks the diagnostics out of the output of gcc, clang,
+// go or tsc. Lines in no known format, like the source excerpts gcc
+// prints, are skipped.
+func ParseDiagnostics(output string) []Diagnostic {
+	diagnostics := []Diagnostic{}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		var d *Diagnostic
+		if m := tscDiagnostic.FindStringSubmatch(line); m != nil {
+			d = newDiagnostic(m[1], m[2], m[3], m[4], m[5])
+		} else if m := tscPrettyDiagnostic.FindStringSubmatch(line); m != nil {
+			d = newDiagnostic(m[1], m[2], m[3], m[4], m[5])
+		} else if m := gccDiagnostic.FindStringSubmatch(line); m != nil {
+			d = newDiagnostic(m[1], m[2], m[3], m[4], m[5])
+		} else if m := goDiagnostic.FindStringSubmatch(line); m != nil {
+			d = newDiagnostic(m[1], m[2], m[3], SEVERITY_ERROR, m[4])
+		}
+		if d != nil {
+			diagnostics = append(diagnostics, *d)
+		}
+	}
+	return diagnostics
+}
+
+func newDiagnostic(file, line, column, severity, message string) *Diagnostic {
+	d := &Diagnostic{File: strings.TrimPrefix(file, "./"), Severity: severity, Message: message}
+	d.Line, _ = strconv.Atoi(line)
+	d.Column, _ = strconv.Atoi(column)
+	return d
+}
+
+// Compilation is the outcome of compiling a program. Output is what the
+// compiler printed, warnings included.
+type Compilation struct {
+	OK          bool
+	Output      string
+	Diagnostics []Diagnostic
+}
+
+// Errors counts the diagnostics that are errors.
+func (c *Compilation) Errors() int {
+	n := 0
+	for _, d := range c.Diagnostics {
+		if d.Severity == SEVERITY_ERROR {
+			n++
+		}
+	}
+	return n
+}
+
+// CompileFunc compiles prog without running it. An error means the
+// compiler could not be run, not that prog failed to compile.
+type CompileFunc func(prog *code.Input) (*Compilation, error)
+
+// CompileOnly is a CompileFunc. Interpreted languages always compile.
+func (l *Local) CompileOnly(prog *code.Input) (*Compilation, error) {
+	exe, err := l.Compile(prog)
+	if err != nil {
+		runErr, ok := err.(*RunError)
+		if !ok {
+			return nil, err
+		}
+		return &Compilation{Output: runErr.Stderr, Diagnostics: ParseDiagnostics(runErr.Stderr)}, nil
+	}
+	return &Compilation{OK: true, Output: exe.Output, Diagnostics: ParseDiagnostics(exe.Output)}, nil
+}
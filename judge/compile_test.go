@@ -0,0 +1,56 @@
+package judge
+
+import (
+	"github.com/maddyonline/goonj/problem"
+	"os"
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+func TestParseDiagnostics(t *testing.T) {
+	output := `main.cpp: In function 'int main()':
+main.cpp:4:9: warning: unused variable 'x' [-Wunused-variable]
+    4 |     int x;
+      |         ^
+main.cpp:5:5: error: 'foo' was not declared in this scope
+main.c:7: fatal error: stdio.hh: No such file or directory
+./main.go:3:2: undefined: fmt
+main.ts(2,7): error TS2322: Type 'string' is not assignable to type 'number'.
+main.ts:9:1 - error TS2304: Cannot find name 'x'.
+1 error generated.
+`
+	expected := []Diagnostic{
+		{"main.cpp", 4, 9, SEVERITY_WARNING, "unused variable 'x' [-Wunused-variable]"},
+		{"main.cpp", 5, 5, SEVERITY_ERROR, "'foo' was not declared in this scope"},
+		{"main.c", 7, 0, SEVERITY_ERROR, "stdio.hh: No such file or directory"},
+		{"main.go", 3, 2, SEVERITY_ERROR, "undefined: fmt"},
+		{"main.ts", 2, 7, SEVERITY_ERROR, "TS2322: Type 'string' is not assignable to type 'number'."},
+		{"main.ts", 9, 1, SEVERITY_ERROR, "TS2304: Cannot find name 'x'."},
+	}
+	if got := ParseDiagnostics(output); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestCompileOnly(t *testing.T) {
+	if _, err := exec.LookPath("g++"); err != nil {
+		t.Skip("g++ is not installed")
+	}
+	local := newTestLocal(t)
+	defer os.RemoveAll(local.WorkDir)
+	c, err := local.CompileOnly(problem.NewProgram("main.cpp", "int main() {\n    int x;\n    return 0;\n}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.OK || c.Errors() != 0 || len(c.Diagnostics) == 0 || c.Diagnostics[0].Line != 2 {
+		t.Errorf("expected an unused variable warning on line 2, got %#v", c)
+	}
+	c, err = local.CompileOnly(problem.NewProgram("main.cpp", "int main() {\n    return y;\n}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.OK || c.Errors() != 1 || c.Diagnostics[0].Line != 2 {
+		t.Errorf("expected an error on line 2, got %#v", c)
+	}
+}
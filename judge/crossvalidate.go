@@ -0,0 +1,144 @@
+package judge
+
+import (
+	"fmt"
+	"github.com/maddyonline/code"
+	"github.com/maddyonline/goonj/problem"
+)
+
+// Mismatch is a fixed test on which the reference and brute solutions
+// disagree.
+type Mismatch struct {
+	Test      string
+	Input     string
+	Reference string
+	Brute     string
+	Message   string
+}
+
+// Report is the outcome of cross-validating a problem.
+type Report struct {
+	Tests    int
+	Mismatch *Mismatch
+	Stress   *StressReport
+	// Program is the solution Stress judged, set for interactive problems
+	// where the reference and brute solutions are stress tested in turn.
+	Program string
+	Err     error
+}
+
+func (r *Report) OK() bool {
+	return r.Err == nil && r.Mismatch == nil && (r.Stress == nil || r.Stress.OK())
+}
+
+func (r *Report) String() string {
+	switch {
+	case r.Err != nil:
+		return fmt.Sprintf("Cross-validation failed after %d tests: %v", r.Tests, r.Err)
+	case r.Mismatch != nil:
+		m := r.Mismatch
+		return fmt.Sprintf("Reference and brute disagree on test %s: %s\nInput:\n%s\nReference:\n%s\nBrute:\n%s", m.Test, m.Message, m.Input, m.Reference, m.Brute)
+	case r.Stress != nil && !r.Stress.OK() && r.Program != "":
+		return fmt.Sprintf("The %s solution was stress tested with the interactor. ", r.Program) + r.Stress.String()
+	case r.Stress != nil && !r.Stress.OK():
+		return "The brute solution was checked against the reference. " + r.Stress.String()
+	case r.Stress != nil:
+		return fmt.Sprintf("Cross-validation passed %d tests (seed %d).", r.Tests, r.Stress.Seed)
+	}
+	return fmt.Sprintf("Cross-validation passed %d tests.", r.Tests)
+}
+
+// CrossValidate runs the reference solution of p on its fixed tests and
+// stress tests it on generated inputs, judging the answers of the brute
+// solution with the checker of p when p has one. The checker must also
+// accept the reference answer of each fixed test, which becomes the
+// expected output of the test.
+func CrossValidate(p *problem.Problem, run RunFunc, cfg StressConfig) *Report {
+	if p.Interactive() {
+		return crossValidateInteractive(p, run, cfg)
+	}
+	report := &Report{}
+	check, err := ProblemChecker(p, run)
+	if err != nil {
+		report.Err = err
+		return report
+	}
+	cfg.Checker = check
+	for _, test := range p.Tests {
+		want, err := run(p.Reference, test.Input)
+		if err != nil {
+			report.Err = fmt.Errorf("reference on test %s: %v", test.Name, err)
+			return report
+		}
+		verdict, err := check(test.Input, want, want)
+		if err != nil {
+			report.Err = fmt.Errorf("test %s: %v", test.Name, err)
+			return report
+		}
+		if !verdict.OK {
+			report.Err = fmt.Errorf("the checker rejects the reference answer to test %s: %s", test.Name, verdict.Message)
+			return report
+		}
+		if p.Brute != nil {
+			got, err := run(p.Brute, test.Input)
+			if err != nil {
+				report.Err = fmt.Errorf("brute on test %s: %v", test.Name, err)
+				return report
+			}
+			verdict, err := check(test.Input, want, got)
+			if err != nil {
+				report.Err = fmt.Errorf("test %s: %v", test.Name, err)
+				return report
+			}
+			if !verdict.OK {
+				report.Mismatch = &Mismatch{Test: test.Name, Input: test.Input, Reference: want, Brute: got, Message: verdict.Message}
+				return report
+			}
+		}
+		test.Output = want
+		report.Tests++
+	}
+	report.Stress = Stress(p.Generator, p.Brute, p.Reference, run, cfg)
+	report.Tests += report.Stress.Rounds
+	return report
+}
+
+// crossValidateInteractive requires the interactor to accept the reference
+// and brute solutions on the fixed tests and on generated inputs.
+func crossValidateInteractive(p *problem.Problem, run RunFunc, cfg StressConfig) *Report {
+	report := &Report{}
+	if cfg.Interact == nil {
+		report.Err = ErrNoInteract
+		return report
+	}
+	cfg.QueryLimit = p.QueryLimit
+	names := []string{"reference"}
+	solutions := map[string]*code.Input{"reference": p.Reference}
+	if p.Brute != nil {
+		names = append(names, "brute")
+		solutions["brute"] = p.Brute
+	}
+	for _, test := range p.Tests {
+		for _, name := range names {
+			in, err := cfg.Interact(p.Interactor, solutions[name], test.Input, p.QueryLimit)
+			if err != nil {
+				report.Err = fmt.Errorf("%s on test %s: %v", name, test.Name, err)
+				return report
+			}
+			if !in.OK {
+				report.Err = fmt.Errorf("the interactor rejects the %s solution on test %s: %s\nTranscript:\n%s", name, test.Name, in.Message, in.TranscriptString())
+				return report
+			}
+		}
+		report.Tests++
+	}
+	for _, name := range names {
+		report.Program = name
+		report.Stress = StressInteractive(p.Generator, solutions[name], p.Interactor, run, cfg)
+		report.Tests += report.Stress.Rounds
+		if !report.Stress.OK() {
+			break
+		}
+	}
+	return report
+}
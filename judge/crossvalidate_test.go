@@ -0,0 +1,63 @@
+package judge
+
+import (
+	"github.com/maddyonline/code"
+	"github.com/maddyonline/goonj/problem"
+	"strings"
+	"testing"
+)
+
+// fakeRun runs programs whose source is a Go func of the input, keyed by
+// file name.
+func fakeRun(progs map[string]func(string) string) RunFunc {
+	return func(prog *code.Input, stdin string) (string, error) {
+		filename, _ := problem.Source(prog)
+		return progs[filename](stdin), nil
+	}
+}
+
+func testProblem() *problem.Problem {
+	return &problem.Problem{
+		Manifest:  problem.Manifest{Id: "double"},
+		Statement: "Print twice the input.",
+		Generator: problem.NewProgram("generator.py", ""),
+		Reference: problem.NewProgram("reference.cpp", ""),
+		Brute:     problem.NewProgram("brute.py", ""),
+		Tests:     problem.ParseTests("1\n---\n2"),
+	}
+}
+
+func TestCrossValidateFillsExpectedOutputs(t *testing.T) {
+	p := testProblem()
+	double := func(in string) string { return strings.Repeat(strings.TrimSpace(in), 2) + "\n" }
+	report := CrossValidate(p, fakeRun(map[string]func(string) string{
+		"generator.py":  func(string) string { return "7\n" },
+		"reference.cpp": double,
+		"brute.py":      double,
+	}), StressConfig{Seed: 1, Rounds: 3, MaxSize: 10})
+	if !report.OK() || report.Tests != 5 {
+		t.Fatalf("expected 5 passing tests, got %s", report)
+	}
+	if p.Tests[0].Output != "11\n" || p.Tests[1].Output != "22\n" {
+		t.Errorf("unexpected outputs %q %q", p.Tests[0].Output, p.Tests[1].Output)
+	}
+}
+
+func TestCrossValidateReportsMismatch(t *testing.T) {
+	report := CrossValidate(testProblem(), fakeRun(map[string]func(string) string{
+		"generator.py":  func(string) string { return "7\n" },
+		"reference.cpp": func(in string) string { return in },
+		"brute.py": func(in string) string {
+			if in == "2\n" {
+				return "3\n"
+			}
+			return in
+		},
+	}), StressConfig{Seed: 1, Rounds: 3, MaxSize: 10})
+	if report.OK() || report.Mismatch == nil || report.Mismatch.Test != "02" {
+		t.Fatalf("expected a mismatch on test 02, got %s", report)
+	}
+	if report.Tests != 1 {
+		t.Errorf("expected 1 test to pass before the mismatch, got %d", report.Tests)
+	}
+}
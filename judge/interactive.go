@@ -0,0 +1,192 @@
+package judge
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/maddyonline/code"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+const (
+	FROM_CANDIDATE  = "candidate"
+	FROM_INTERACTOR = "interactor"
+)
+
+var ErrNoInteract = errors.New("interactive problems need a local runner")
+
+// MAX_TRANSCRIPT is the number of lines kept of an interaction.
+const MAX_TRANSCRIPT = 1000
+
+// Exchange is a line one side of an interaction sent to the other.
+type Exchange struct {
+	From string
+	Line string
+}
+
+// Interaction is the outcome of running a solution against an interactor.
+// Queries counts the lines the solution sent.
+type Interaction struct {
+	OK         bool
+	Message    string
+	Queries    int
+	Transcript []Exchange
+	Truncated  bool
+}
+
+// TranscriptString shows the lines of the solution after "> " and those of
+// the interactor after "< ".
+func (in *Interaction) TranscriptString() string {
+	lines := []string{}
+	for _, ex := range in.Transcript {
+		prefix := "< "
+		if ex.From == FROM_CANDIDATE {
+			prefix = "> "
+		}
+		lines = append(lines, prefix+ex.Line)
+	}
+	if in.Truncated {
+		lines = append(lines, "...")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// InteractFunc runs soln against interactor on a test input, stopping the
+// solution once it sent more than queryLimit lines (0 means no limit).
+type InteractFunc func(interactor, soln *code.Input, input string, queryLimit int) (*Interaction, error)
+
+// Interact is an InteractFunc. The interactor is started with the name of
+// a file holding the test input as its only argument, and its stdin and
+// stdout are connected to the stdout and stdin of the solution. It accepts
+// the solution by exiting with status 0; anything it writes on stderr
+// becomes the message of the verdict.
+func (l *Local) Interact(interactor, soln *code.Input, input string, queryLimit int) (*Interaction, error) {
+	iexe, err := l.Compile(interactor)
+	if err != nil {
+		return nil, err
+	}
+	sexe, err := l.Compile(soln)
+	if err != nil {
+		return &Interaction{Message: err.Error()}, nil
+	}
+	f, err := ioutil.TempFile(l.WorkDir, "input")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(input)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), l.Timeout)
+	defer cancel()
+	result, err := interact(ctx, cancel, iexe.TrustedCommand(ctx, f.Name()), sexe.Command(ctx), queryLimit)
+	if err == nil && ctx.Err() == context.DeadlineExceeded && result.Message == "" {
+		result.OK, result.Message = false, fmt.Sprintf("time limit of %s exceeded", l.Timeout)
+	}
+	return result, err
+}
+
+func interact(ctx context.Context, cancel context.CancelFunc, icmd, scmd *exec.Cmd, queryLimit int) (*Interaction, error) {
+	result := &Interaction{}
+	var mu sync.Mutex
+	exceeded := false
+	record := func(from, line string) {
+		if from == FROM_CANDIDATE {
+			result.Queries++
+			exceeded = queryLimit > 0 && result.Queries > queryLimit
+		}
+		if len(result.Transcript) < MAX_TRANSCRIPT {
+			result.Transcript = append(result.Transcript, Exchange{From: from, Line: line})
+		} else {
+			result.Truncated = true
+		}
+	}
+	var istderr, sstderr bytes.Buffer
+	icmd.Stderr, scmd.Stderr = &istderr, &sstderr
+	iIn, err := icmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	iOut, err := icmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	sIn, err := scmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	sOut, err := scmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := icmd.Start(); err != nil {
+		return nil, err
+	}
+	if err := scmd.Start(); err != nil {
+		cancel()
+		icmd.Wait()
+		return nil, err
+	}
+	// forward copies lines from one program to the other, recording them.
+	forward := func(from string, src io.Reader, dst io.WriteCloser) {
+		defer dst.Close()
+		scanner := bufio.NewScanner(src)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			mu.Lock()
+			record(from, scanner.Text())
+			stop := exceeded
+			mu.Unlock()
+			if stop {
+				cancel()
+				return
+			}
+			fmt.Fprintln(dst, scanner.Text())
+		}
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		forward(FROM_CANDIDATE, sOut, iIn)
+	}()
+	go func() {
+		defer wg.Done()
+		forward(FROM_INTERACTOR, iOut, sIn)
+	}()
+	wg.Wait()
+	ierr := icmd.Wait()
+	serr := scmd.Wait()
+
+	message := strings.TrimSpace(istderr.String())
+	switch {
+	case exceeded:
+		result.Message = fmt.Sprintf("query limit of %d exceeded", queryLimit)
+	case ctx.Err() != nil:
+		// Interact reports the time limit.
+	case ierr != nil:
+		if _, ok := ierr.(*exec.ExitError); !ok {
+			return nil, fmt.Errorf("interactor: %v", ierr)
+		}
+		if message == "" {
+			message = "wrong answer"
+		}
+		result.Message = message
+	case serr != nil:
+		result.Message = fmt.Sprintf("runtime error: %v\n%s", serr, sstderr.String())
+	default:
+		result.OK, result.Message = true, message
+	}
+	return result, nil
+}
@@ -0,0 +1,131 @@
+package judge
+
+import (
+	"github.com/maddyonline/goonj/problem"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// guessInteractor holds the number in the input file and answers guesses
+// with <, > or =.
+const guessInteractor = `import sys
+secret = int(open(sys.argv[1]).read())
+while True:
+    line = sys.stdin.readline()
+    if not line:
+        sys.stderr.write("no guess\n")
+        sys.exit(1)
+    guess = int(line)
+    if guess == secret:
+        print("=", flush=True)
+        break
+    print("<" if secret < guess else ">", flush=True)
+`
+
+const binarySearch = `lo, hi = 1, 100
+while True:
+    mid = (lo + hi) // 2
+    print(mid, flush=True)
+    answer = input()
+    if answer == "=":
+        break
+    if answer == "<":
+        hi = mid - 1
+    else:
+        lo = mid + 1
+`
+
+const linearSearch = `for guess in range(1, 101):
+    print(guess, flush=True)
+    if input() == "=":
+        break
+`
+
+func newTestLocal(t *testing.T) *Local {
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 is not installed")
+	}
+	dir, err := ioutil.TempDir("", "goonj-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := NewLocal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return local
+}
+
+func TestInteractRecordsTranscript(t *testing.T) {
+	local := newTestLocal(t)
+	defer os.RemoveAll(local.WorkDir)
+	interactor := problem.NewProgram("interactor.py", guessInteractor)
+	in, err := local.Interact(interactor, problem.NewProgram("main.py", binarySearch), "30\n", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !in.OK {
+		t.Fatalf("expected the search to be accepted, got %q", in.Message)
+	}
+	want := "> 50\n< <\n> 25\n< >\n> 37\n< <\n> 31\n< <\n> 28\n< >\n> 29\n< >\n> 30\n< ="
+	if got := in.TranscriptString(); got != want || in.Queries != 7 {
+		t.Errorf("unexpected transcript after %d queries:\n%s", in.Queries, got)
+	}
+}
+
+func TestInteractEnforcesQueryLimit(t *testing.T) {
+	local := newTestLocal(t)
+	defer os.RemoveAll(local.WorkDir)
+	interactor := problem.NewProgram("interactor.py", guessInteractor)
+	in, err := local.Interact(interactor, problem.NewProgram("main.py", linearSearch), "30\n", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if in.OK || !strings.Contains(in.Message, "query limit of 10") {
+		t.Fatalf("expected the query limit to be exceeded, got %#v", in)
+	}
+	if in.Queries != 11 {
+		t.Errorf("expected the solution to be stopped at query 11, got %d", in.Queries)
+	}
+	// A solution that gives up is judged by the interactor.
+	in, err = local.Interact(interactor, problem.NewProgram("main.py", "print(1)\n"), "30\n", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if in.OK || in.Message != "no guess" {
+		t.Errorf("expected the interactor's verdict, got %#v", in)
+	}
+}
+
+func TestCrossValidateInteractive(t *testing.T) {
+	local := newTestLocal(t)
+	defer os.RemoveAll(local.WorkDir)
+	p := &problem.Problem{
+		Manifest:   problem.Manifest{Id: "guess", Type: problem.TYPE_INTERACTIVE, QueryLimit: 10},
+		Statement:  "Guess the number.",
+		Generator:  problem.NewProgram("generator.py", "import sys\nseed, size = map(int, sys.stdin.read().split())\nprint(seed % size + 1)\n"),
+		Reference:  problem.NewProgram("reference.py", binarySearch),
+		Brute:      problem.NewProgram("brute.py", linearSearch),
+		Interactor: problem.NewProgram("interactor.py", guessInteractor),
+		Tests:      problem.ParseTests("1\n---\n7"),
+	}
+	cfg := StressConfig{Seed: 1, Rounds: 5, MaxSize: 100}
+	if report := CrossValidate(p, local.Run, cfg); report.Err != ErrNoInteract {
+		t.Errorf("expected interactive problems to need an InteractFunc, got %s", report)
+	}
+	cfg.Interact = local.Interact
+	report := CrossValidate(p, local.Run, cfg)
+	if report.OK() || report.Program != "brute" || report.Stress.Failure == nil {
+		t.Fatalf("expected the brute solution to exceed the query limit, got %s", report)
+	}
+	if !strings.Contains(report.String(), "Transcript:") {
+		t.Errorf("report does not show the transcript: %s", report)
+	}
+	p.Brute = nil
+	if report := CrossValidate(p, local.Run, cfg); !report.OK() || report.Tests != 7 {
+		t.Errorf("expected 7 passing tests, got %s", report)
+	}
+}
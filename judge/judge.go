@@ -0,0 +1,61 @@
+// Package judge runs problem programs through the code runner and compares
+// their outputs.
+package judge
+
+import (
+	"fmt"
+	"github.com/maddyonline/code"
+	"github.com/maddyonline/goonj/problem"
+	"strings"
+)
+
+// RunFunc runs prog with stdin and returns what it printed on stdout.
+type RunFunc func(prog *code.Input, stdin string) (string, error)
+
+// RunError reports a program that failed to run or wrote to stderr.
+type RunError struct {
+	Program string
+	Stderr  string
+	Err     error
+}
+
+func (e *RunError) Error() string {
+	if e.Err != nil && e.Stderr != "" {
+		return fmt.Sprintf("%s: %v\n%s", e.Program, e.Err, e.Stderr)
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Program, e.Err)
+	}
+	return fmt.Sprintf("%s: stderr: %s", e.Program, e.Stderr)
+}
+
+var stdinName = code.StdinFile("").Name
+
+// CodeRunner runs programs with runner. Files of prog after the source are
+// passed along to the program, except a stdin file left over from
+// code.MakeInput. Output on stderr is treated as a failure, as the CUI
+// always has.
+func CodeRunner(runner *code.Runner) RunFunc {
+	return func(prog *code.Input, stdin string) (string, error) {
+		filename, source := problem.Source(prog)
+		input := code.MakeInput(prog.Language, filename, source, code.StdinFile(stdin))
+		for _, file := range prog.Files[1:] {
+			if file.Name != stdinName {
+				input.Files = append(input.Files, file)
+			}
+		}
+		out, err := runner.Run(input)
+		if err != nil {
+			return "", &RunError{Program: filename, Err: err}
+		}
+		if out.Stderr != "" {
+			return out.Stdout, &RunError{Program: filename, Stderr: out.Stderr}
+		}
+		return out.Stdout, nil
+	}
+}
+
+// SameOutput compares outputs ignoring trailing whitespace.
+func SameOutput(a, b string) bool {
+	return strings.TrimRight(a, " \t\r\n") == strings.TrimRight(b, " \t\r\n")
+}
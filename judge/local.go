@@ -0,0 +1,295 @@
+package judge
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/maddyonline/code"
+	"github.com/maddyonline/goonj/problem"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Executable is a compiled program ready to be started. Output holds the
+// warnings its compiler printed.
+type Executable struct {
+	Dir    string
+	Argv   []string
+	Output string
+
+	sandbox *Sandbox
+}
+
+// Command returns the command running e with args in its directory, in
+// the sandbox of the Local that compiled it.
+func (e *Executable) Command(ctx context.Context, args ...string) *exec.Cmd {
+	return e.sandbox.command(ctx, e.Dir, false, append(append([]string{}, e.Argv...), args...))
+}
+
+// TrustedCommand is Command for the programs of problem authors, which
+// keep the user of the server.
+func (e *Executable) TrustedCommand(ctx context.Context, args ...string) *exec.Cmd {
+	return e.sandbox.command(ctx, e.Dir, true, append(append([]string{}, e.Argv...), args...))
+}
+
+// Local compiles and runs programs on this machine. Unlike the code runner
+// it can start several programs at once and connect them, which
+// interactive problems need. Programs are compiled and run in Sandbox.
+// The MaxCached programs used last stay compiled.
+type Local struct {
+	WorkDir   string
+	Timeout   time.Duration
+	Sandbox   Sandbox
+	MaxCached int
+
+	mu    sync.Mutex
+	cache map[string]*cached
+	// lru holds the keys of cache, the program used last first.
+	lru *list.List
+}
+
+// cached is a program of the cache of Local, compiled once done is closed.
+type cached struct {
+	done chan struct{}
+	exe  *Executable
+	err  error
+	elem *list.Element
+}
+
+const DEFAULT_TIMEOUT = 10 * time.Second
+
+// DEFAULT_MAX_CACHED is the number of compiled programs Local keeps.
+const DEFAULT_MAX_CACHED = 256
+
+// COMPILE_TIMEOUT bounds the compilation of a program.
+const COMPILE_TIMEOUT = time.Minute
+
+// NewLocal compiles programs in workDir, which sandboxed programs may
+// cross but not list.
+func NewLocal(workDir string) (*Local, error) {
+	if err := os.MkdirAll(workDir, 0711); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(workDir, 0711); err != nil {
+		return nil, err
+	}
+	return &Local{
+		WorkDir:   workDir,
+		Timeout:   DEFAULT_TIMEOUT,
+		Sandbox:   DefaultSandbox,
+		MaxCached: DEFAULT_MAX_CACHED,
+		cache:     map[string]*cached{},
+		lru:       list.New(),
+	}, nil
+}
+
+// compileCommands builds the source in the current directory into the
+// binary "main"; languages without an entry are interpreted.
+var compileCommands = map[string][]string{
+	"cpp": {"g++", "-O2", "-std=c++17", "-Wall", "-o", "main"},
+	"go":  {"go", "build", "-o", "main"},
+}
+
+var interpreters = map[string][]string{
+	"python":     {"python3"},
+	"javascript": {"node"},
+}
+
+// Compile writes prog into a directory of its own and compiles it. Programs
+// are cached by their content, so compiling the same program again is free,
+// and a program is compiled once however many ask for it at the same time.
+// Failed compilations are not kept.
+func (l *Local) Compile(prog *code.Input) (*Executable, error) {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\x00", prog.Language)
+	for _, file := range prog.Files {
+		if file.Name != stdinName {
+			fmt.Fprintf(hash, "%s\x00%s\x00", file.Name, file.Content)
+		}
+	}
+	key := hex.EncodeToString(hash.Sum(nil))[:16]
+	l.mu.Lock()
+	if c, ok := l.cache[key]; ok {
+		l.lru.MoveToFront(c.elem)
+		l.mu.Unlock()
+		<-c.done
+		return c.exe, c.err
+	}
+	c := &cached{done: make(chan struct{})}
+	c.elem = l.lru.PushFront(key)
+	l.cache[key] = c
+	evicted := l.evict()
+	l.mu.Unlock()
+
+	for _, dir := range evicted {
+		os.RemoveAll(dir)
+	}
+	c.exe, c.err = l.build(key, prog)
+	if c.err != nil {
+		l.mu.Lock()
+		if l.cache[key] == c {
+			l.lru.Remove(c.elem)
+			delete(l.cache, key)
+		}
+		l.mu.Unlock()
+	}
+	close(c.done)
+	return c.exe, c.err
+}
+
+// evict drops the programs used least recently beyond MaxCached from the
+// cache. Their directories are moved out of the way at once, so that the
+// same program can be compiled again, and returned to be removed. Programs
+// still compiling stay; a program that is running when evicted keeps
+// running.
+func (l *Local) evict() []string {
+	dirs := []string{}
+	for e := l.lru.Back(); e != nil && l.MaxCached > 0 && l.lru.Len() > l.MaxCached; {
+		prev := e.Prev()
+		key := e.Value.(string)
+		select {
+		case <-l.cache[key].done:
+			l.lru.Remove(e)
+			delete(l.cache, key)
+			dir := filepath.Join(l.WorkDir, key)
+			evicted := fmt.Sprintf("%s.evicted-%d", dir, time.Now().UnixNano())
+			if err := os.Rename(dir, evicted); err == nil {
+				dirs = append(dirs, evicted)
+			}
+		default:
+		}
+		e = prev
+	}
+	return dirs
+}
+
+// build writes prog into the directory of key and compiles it there. The
+// directory is removed if that fails.
+func (l *Local) build(key string, prog *code.Input) (exe *Executable, err error) {
+	filename, _ := problem.Source(prog)
+	dir := filepath.Join(l.WorkDir, key)
+	defer func() {
+		if err != nil {
+			os.RemoveAll(dir)
+		}
+	}()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	for _, file := range prog.Files {
+		if file.Name == stdinName {
+			continue
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, file.Name), []byte(file.Content), 0644); err != nil {
+			return nil, err
+		}
+	}
+	exe = &Executable{Dir: dir, sandbox: &l.Sandbox}
+	if compile, ok := compileCommands[prog.Language]; ok {
+		out, err := l.compile(dir, append(append([]string{}, compile...), filename))
+		if err != nil {
+			return nil, &RunError{Program: filename, Stderr: string(out), Err: fmt.Errorf("compilation failed: %v", err)}
+		}
+		exe.Output = string(out)
+		exe.Argv = []string{filepath.Join(dir, "main")}
+	} else if interpreter, ok := interpreters[prog.Language]; ok {
+		// Checkers run elsewhere, next to the files of the test.
+		exe.Argv = append(append([]string{}, interpreter...), filepath.Join(dir, filename))
+	} else {
+		return nil, fmt.Errorf("%s: unsupported language %q", filename, prog.Language)
+	}
+	return exe, nil
+}
+
+// compile runs the compiler argv in dir within the sandbox. The sandbox
+// user owns dir while compiling, then the server takes it back so that the
+// programs it runs cannot change the binary.
+func (l *Local) compile(dir string, argv []string) ([]byte, error) {
+	if l.Sandbox.UID != 0 {
+		if err := own(dir, l.Sandbox.UID, l.Sandbox.GID); err != nil {
+			return nil, err
+		}
+		defer own(dir, os.Getuid(), os.Getgid())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), COMPILE_TIMEOUT)
+	defer cancel()
+	return l.Sandbox.command(ctx, dir, false, argv).CombinedOutput()
+}
+
+// Run is a RunFunc running programs locally. The files checkers read are
+// not compiled with them: each run of a checker gets a directory of its own
+// holding them, and checkers, written by problem authors, run as the user
+// of the server so that solutions cannot read the expected outputs.
+func (l *Local) Run(prog *code.Input, stdin string) (string, error) {
+	source, data := splitCheckerFiles(prog)
+	exe, err := l.Compile(source)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), l.Timeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exe.Command(ctx)
+	if len(data) > 0 {
+		dir, err := writeFiles(l.WorkDir, data)
+		if err != nil {
+			return "", err
+		}
+		defer os.RemoveAll(dir)
+		cmd = exe.TrustedCommand(ctx)
+		cmd.Dir = dir
+	}
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	filename, _ := problem.Source(prog)
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("time limit of %s exceeded", l.Timeout)
+		}
+		return stdout.String(), &RunError{Program: filename, Stderr: stderr.String(), Err: err}
+	}
+	if stderr.Len() > 0 {
+		return stdout.String(), &RunError{Program: filename, Stderr: stderr.String()}
+	}
+	return stdout.String(), nil
+}
+
+// splitCheckerFiles separates the files checkers read from the sources of
+// prog.
+func splitCheckerFiles(prog *code.Input) (*code.Input, []code.File) {
+	source := *prog
+	source.Files = []code.File{}
+	data := []code.File{}
+	for _, file := range prog.Files {
+		if checkerFiles[file.Name] {
+			data = append(data, file)
+		} else {
+			source.Files = append(source.Files, file)
+		}
+	}
+	return &source, data
+}
+
+// writeFiles writes files into a new directory of dir only the server may
+// read.
+func writeFiles(dir string, files []code.File) (string, error) {
+	tmp, err := ioutil.TempDir(dir, "files")
+	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		if err := ioutil.WriteFile(filepath.Join(tmp, file.Name), []byte(file.Content), 0600); err != nil {
+			os.RemoveAll(tmp)
+			return "", err
+		}
+	}
+	return tmp, nil
+}
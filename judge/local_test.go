@@ -0,0 +1,102 @@
+package judge
+
+import (
+	"github.com/maddyonline/goonj/problem"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestCompileOnceForConcurrentCallers(t *testing.T) {
+	local := newTestLocal(t)
+	defer os.RemoveAll(local.WorkDir)
+	prog := problem.NewProgram("main.py", "print(1)\n")
+	exes := make([]*Executable, 8)
+	var wg sync.WaitGroup
+	for i := range exes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			exe, err := local.Compile(prog)
+			if err != nil {
+				t.Error(err)
+			}
+			exes[i] = exe
+		}(i)
+	}
+	wg.Wait()
+	for _, exe := range exes {
+		if exe != exes[0] {
+			t.Fatalf("expected every caller to get the same program")
+		}
+	}
+	if _, err := local.Compile(problem.NewProgram("main.rb", "puts 1\n")); err == nil {
+		t.Errorf("expected an unsupported language to fail")
+	}
+	if len(local.cache) != 1 {
+		t.Errorf("expected failed compilations not to be cached, got %d programs", len(local.cache))
+	}
+}
+
+func TestCompileEvictsLeastRecentlyUsed(t *testing.T) {
+	local := newTestLocal(t)
+	defer os.RemoveAll(local.WorkDir)
+	local.MaxCached = 2
+	compile := func(source string) *Executable {
+		exe, err := local.Compile(problem.NewProgram("main.py", source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return exe
+	}
+	a, b := compile("print('a')\n"), compile("print('b')\n")
+	if compile("print('a')\n") != a {
+		t.Fatalf("expected a to be cached")
+	}
+	c := compile("print('c')\n")
+	if _, err := os.Stat(b.Dir); !os.IsNotExist(err) {
+		t.Errorf("expected the directory of b to be removed, got %v", err)
+	}
+	for _, exe := range []*Executable{a, c} {
+		if _, err := os.Stat(exe.Dir); err != nil {
+			t.Errorf("expected %s to be kept: %v", exe.Dir, err)
+		}
+	}
+	if again := compile("print('b')\n"); again == b || again.Dir != b.Dir {
+		t.Errorf("expected b to be compiled again in the same directory")
+	}
+	if out, err := local.Run(problem.NewProgram("main.py", "print('b')\n"), ""); err != nil || out != "b\n" {
+		t.Errorf("expected b to run, got %q, %v", out, err)
+	}
+	entries, _ := ioutil.ReadDir(local.WorkDir)
+	if len(entries) != 2 {
+		t.Errorf("expected 2 programs in the work dir, got %d", len(entries))
+	}
+}
+
+func TestRunCompilesCheckerOnce(t *testing.T) {
+	local := newTestLocal(t)
+	defer os.RemoveAll(local.WorkDir)
+	p := &problem.Problem{
+		Manifest: problem.Manifest{Checker: problem.CheckerConfig{Type: problem.CHECKER_PROGRAM}},
+		Checker: problem.NewProgram("checker.py", `want = open("expected.txt").read().split()
+got = open("output.txt").read().split()
+print("OK" if sorted(want) == sorted(got) else "WA\nnot a permutation")
+`),
+	}
+	check, err := ProblemChecker(p, local.Run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verdict, err := check("3\n", "1 2 3\n", "3 1 2\n"); err != nil || !verdict.OK {
+		t.Errorf("expected a permutation to be accepted, got %#v, %v", verdict, err)
+	}
+	if verdict, err := check("2\n", "1 2\n", "1 1\n"); err != nil || verdict.OK || verdict.Message != "not a permutation" {
+		t.Errorf("expected the checker to reject, got %#v, %v", verdict, err)
+	}
+	entries, _ := ioutil.ReadDir(local.WorkDir)
+	if len(local.cache) != 1 || len(entries) != 1 {
+		t.Errorf("expected the checker to be compiled once and its files removed, got %d programs and %d entries", len(local.cache), len(entries))
+	}
+}
@@ -0,0 +1,76 @@
+package judge
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// Sandbox confines the programs Local compiles and runs. Each program gets
+// MemoryMB of data and may write files of up to MaxFileMB; zero leaves a
+// limit unset. When UID is set, solutions are compiled and run as that
+// user, who cannot read or write the files of the server, and MaxProcs
+// limits the processes of that user. With Namespaces programs also start in
+// new network, IPC, UTS and PID namespaces, cut off from the network and
+// from other processes. UID and Namespaces need the server to run as root
+// on Linux.
+type Sandbox struct {
+	MemoryMB   int
+	MaxFileMB  int
+	MaxProcs   int
+	UID, GID   int
+	Namespaces bool
+}
+
+// DefaultSandbox only limits resources, which needs no privileges.
+var DefaultSandbox = Sandbox{MemoryMB: 512, MaxFileMB: 64}
+
+// KILL_DELAY is how long a program killed at its time limit may keep the
+// pipes of its output open.
+const KILL_DELAY = time.Second
+
+// Isolated tells whether solutions are kept away from the files, the
+// network or the processes of the server, not only limited.
+func (s *Sandbox) Isolated() bool {
+	return s.UID != 0 || s.Namespaces
+}
+
+// Check tells whether s can be enforced on this machine.
+func (s *Sandbox) Check() error {
+	if s.UID < 0 || s.GID < 0 || s.MemoryMB < 0 || s.MaxFileMB < 0 || s.MaxProcs < 0 {
+		return fmt.Errorf("sandbox: limits and ids must not be negative")
+	}
+	if s.Isolated() && os.Geteuid() != 0 {
+		return fmt.Errorf("sandbox: running as another user or in namespaces needs root")
+	}
+	return checkSandbox(s)
+}
+
+// command returns the command running argv in dir within s. Programs that
+// are not trusted run as the sandbox user; trusted ones, like interactors,
+// keep the user of the server so that they can read the test input.
+func (s *Sandbox) command(ctx context.Context, dir string, trusted bool, argv []string) *exec.Cmd {
+	argv = s.limit(argv, trusted)
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = dir
+	cmd.WaitDelay = KILL_DELAY
+	if !trusted && s.UID != 0 {
+		// Compilers keep their caches in the home directory.
+		cmd.Env = append(os.Environ(), "HOME="+dir)
+	}
+	s.confine(cmd, trusted)
+	return cmd
+}
+
+// own gives dir and its files to uid and gid.
+func own(dir string, uid, gid int) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, uid, gid)
+	})
+}
@@ -0,0 +1,56 @@
+package judge
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+func checkSandbox(s *Sandbox) error {
+	if s.MemoryMB == 0 && s.MaxFileMB == 0 && s.MaxProcs == 0 {
+		return nil
+	}
+	if _, err := exec.LookPath("prlimit"); err != nil {
+		return fmt.Errorf("sandbox: limits need prlimit from util-linux: %v", err)
+	}
+	return nil
+}
+
+// limit runs argv under prlimit(1) with the limits of s, if any. It uses
+// RLIMIT_DATA rather than RLIMIT_AS, which breaks the runtimes of Go and
+// node that reserve large address ranges up front.
+func (s *Sandbox) limit(argv []string, trusted bool) []string {
+	limits := []string{}
+	if s.MemoryMB > 0 {
+		limits = append(limits, "--data="+strconv.Itoa(s.MemoryMB<<20))
+	}
+	if s.MaxFileMB > 0 {
+		limits = append(limits, "--fsize="+strconv.Itoa(s.MaxFileMB<<20))
+	}
+	// RLIMIT_NPROC counts every process of the user, so it only makes
+	// sense for the sandbox user.
+	if s.MaxProcs > 0 && !trusted && s.UID != 0 {
+		limits = append(limits, "--nproc="+strconv.Itoa(s.MaxProcs))
+	}
+	if len(limits) == 0 {
+		return argv
+	}
+	return append(append(append([]string{"prlimit", "--core=0"}, limits...), "--"), argv...)
+}
+
+// confine starts cmd in a process group of its own, killed as a whole at
+// the time limit, as the sandbox user and in new namespaces if set.
+func (s *Sandbox) confine(cmd *exec.Cmd, trusted bool) {
+	attr := &syscall.SysProcAttr{Setpgid: true}
+	if s.Namespaces {
+		attr.Cloneflags = syscall.CLONE_NEWNET | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS | syscall.CLONE_NEWPID
+	}
+	if !trusted && s.UID != 0 {
+		attr.Credential = &syscall.Credential{Uid: uint32(s.UID), Gid: uint32(s.GID), Groups: []uint32{}}
+	}
+	cmd.SysProcAttr = attr
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,124 @@
+package judge
+
+import (
+	"github.com/maddyonline/goonj/problem"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSandboxLimits(t *testing.T) {
+	local := newTestLocal(t)
+	defer os.RemoveAll(local.WorkDir)
+	if err := local.Sandbox.Check(); err != nil {
+		t.Skip(err)
+	}
+	local.Sandbox.MemoryMB, local.Sandbox.MaxFileMB = 64, 1
+	_, err := local.Run(problem.NewProgram("memory.py", "x = bytearray(256 << 20)\n"), "")
+	if err == nil || !strings.Contains(err.Error(), "MemoryError") {
+		t.Errorf("expected the memory limit to stop the program, got %v", err)
+	}
+	_, err = local.Run(problem.NewProgram("file.py", "open('out', 'wb').write(bytes(2 << 20))\n"), "")
+	if err == nil {
+		t.Errorf("expected the file size limit to stop the program")
+	}
+	out, err := local.Run(problem.NewProgram("ok.py", "print(len(bytearray(16 << 20)))\n"), "")
+	if err != nil || out != "16777216\n" {
+		t.Errorf("expected the program to run within the limits, got %q, %v", out, err)
+	}
+}
+
+// running tells whether process pid is alive, zombies aside.
+func running(pid int) bool {
+	stat, err := ioutil.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(stat[strings.LastIndex(string(stat), ")")+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
+
+func TestSandboxKillsChildrenAtTimeLimit(t *testing.T) {
+	local := newTestLocal(t)
+	defer os.RemoveAll(local.WorkDir)
+	local.Timeout = 500 * time.Millisecond
+	prog := problem.NewProgram("fork.py", `import subprocess, time
+child = subprocess.Popen(["sleep", "30"])
+with open("child.pid", "w") as f:
+    f.write(str(child.pid))
+time.sleep(30)
+`)
+	exe, err := local.Compile(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := local.Run(prog, ""); err == nil || !strings.Contains(err.Error(), "time limit") {
+		t.Fatalf("expected the time limit to be exceeded, got %v", err)
+	}
+	if took := time.Since(start); took > local.Timeout+KILL_DELAY+time.Second {
+		t.Errorf("Run took %s", took)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(exe.Dir, "child.pid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, _ := strconv.Atoi(string(content))
+	for deadline := time.Now().Add(time.Second); running(pid) && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if running(pid) {
+		t.Errorf("child %d of the program survived the time limit", pid)
+	}
+}
+
+func TestSandboxIsolates(t *testing.T) {
+	local := newTestLocal(t)
+	defer os.RemoveAll(local.WorkDir)
+	local.Sandbox.UID, local.Sandbox.GID, local.Sandbox.MaxProcs = 65534, 65534, 64
+	local.Sandbox.Namespaces = true
+	if err := local.Sandbox.Check(); err != nil {
+		t.Skip(err)
+	}
+	secret := filepath.Join(local.WorkDir, "secret")
+	if err := ioutil.WriteFile(secret, []byte("42"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	probe := `import os, socket, sys
+try:
+    open(sys.argv[1] if len(sys.argv) > 1 else %q).read()
+    print("read")
+except OSError:
+    print("no read")
+try:
+    socket.create_connection(("127.0.0.1", 22), timeout=1)
+    print("connected")
+except OSError:
+    print("no network")
+print(os.getuid(), os.getpid())
+`
+	out, err := local.Run(problem.NewProgram("probe.py", strings.Replace(probe, "%q", strconv.Quote(secret), 1)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "no read\nno network\n65534 1\n"; out != want {
+		t.Errorf("expected the program to be isolated, got %q", out)
+	}
+	// Interactors keep the user of the server to read the test input.
+	interactor := problem.NewProgram("interactor.py", guessInteractor)
+	in, err := local.Interact(interactor, problem.NewProgram("main.py", binarySearch), "30\n", 10)
+	if err != nil || !in.OK {
+		t.Fatalf("expected the search to be accepted, got %#v, %v", in, err)
+	}
+	if _, err := exec.LookPath("g++"); err == nil {
+		out, err := local.Run(problem.NewProgram("main.cpp", "#include <cstdio>\nint main() { puts(\"hi\"); }\n"), "")
+		if err != nil || out != "hi\n" {
+			t.Errorf("expected the sandbox user to compile C++, got %q, %v", out, err)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package judge
+
+import (
+	"fmt"
+	"github.com/maddyonline/code"
+	"github.com/maddyonline/goonj/problem"
+	"math"
+	"strings"
+)
+
+// Group is a problem.Group with its tests resolved: fixed tests are looked
+// up and generated ones printed by the generator.
+type Group struct {
+	problem.Group
+	Cases []*problem.Test
+}
+
+// ProblemGroups resolves the test groups of p. The reference solution
+// computes the expected outputs that are missing, except for interactive
+// problems, whose interactor judges solutions without them.
+func ProblemGroups(p *problem.Problem, run RunFunc) ([]*Group, error) {
+	groups := []*Group{}
+	for _, spec := range p.TestGroups() {
+		group := &Group{Group: spec}
+		for _, name := range spec.Tests {
+			test := p.Test(name)
+			if test == nil {
+				return nil, fmt.Errorf("group %s: no test %s", spec.Name, name)
+			}
+			group.Cases = append(group.Cases, &problem.Test{Name: test.Name, Input: test.Input, Output: test.Output})
+		}
+		for seed := 1; seed <= spec.Generated; seed++ {
+			if p.Generator == nil {
+				return nil, fmt.Errorf("group %s: generated tests need a generator", spec.Name)
+			}
+			input, err := run(p.Generator, GeneratorStdin(int64(seed), spec.Size))
+			if err != nil {
+				return nil, fmt.Errorf("generator (seed %d, size %d): %v", seed, spec.Size, err)
+			}
+			group.Cases = append(group.Cases, &problem.Test{Name: fmt.Sprintf("%s-%d", spec.Name, seed), Input: input})
+		}
+		if !p.Interactive() {
+			for _, test := range group.Cases {
+				if test.Output != "" {
+					continue
+				}
+				output, err := run(p.Reference, test.Input)
+				if err != nil {
+					return nil, fmt.Errorf("reference on test %s: %v", test.Name, err)
+				}
+				test.Output = output
+			}
+		}
+		if len(group.Cases) > 0 {
+			groups = append(groups, group)
+		}
+	}
+	return groups, nil
+}
+
+// Evaluator judges a solution on one test. An error means the judging
+// itself failed.
+type Evaluator func(test *problem.Test) (*Verdict, error)
+
+// CompareEvaluator checks the output of soln against the expected output
+// of each test. Solutions that fail to run fail the test.
+func CompareEvaluator(soln *code.Input, run RunFunc, check Checker) Evaluator {
+	return func(test *problem.Test) (*Verdict, error) {
+		got, err := run(soln, test.Input)
+		if err != nil {
+			return &Verdict{Message: err.Error()}, nil
+		}
+		return check(test.Input, test.Output, got)
+	}
+}
+
+// InteractEvaluator lets the interactor judge soln on each test.
+func InteractEvaluator(interact InteractFunc, interactor, soln *code.Input, queryLimit int) Evaluator {
+	return func(test *problem.Test) (*Verdict, error) {
+		in, err := interact(interactor, soln, test.Input, queryLimit)
+		if err != nil {
+			return nil, err
+		}
+		return &Verdict{OK: in.OK, Message: in.Message}, nil
+	}
+}
+
+// ProblemEvaluator judges soln on the tests of p, with the interactor
+// of interactive problems and the checker of the others.
+func ProblemEvaluator(p *problem.Problem, soln *code.Input, run RunFunc, interact InteractFunc) (Evaluator, error) {
+	if p.Interactive() {
+		if interact == nil {
+			return nil, ErrNoInteract
+		}
+		return InteractEvaluator(interact, p.Interactor, soln, p.QueryLimit), nil
+	}
+	check, err := ProblemChecker(p, run)
+	if err != nil {
+		return nil, err
+	}
+	return CompareEvaluator(soln, run, check), nil
+}
+
+type TestResult struct {
+	Test    string `json:"test"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+type GroupScore struct {
+	Name    string       `json:"name"`
+	Weight  int          `json:"weight"`
+	Visible bool         `json:"visible"`
+	Passed  int          `json:"passed"`
+	Total   int          `json:"total"`
+	Results []TestResult `json:"results"`
+}
+
+// Score is the outcome of judging a solution on every test group. Score
+// is out of 100: each group contributes its weight in proportion to the
+// tests passed, or every test counts the same if no group has a weight.
+type Score struct {
+	Score  int          `json:"score"`
+	Groups []GroupScore `json:"groups"`
+}
+
+// ScoreGroups judges a solution on every test of groups with evaluate.
+func ScoreGroups(groups []*Group, evaluate Evaluator) (*Score, error) {
+	score := &Score{Groups: []GroupScore{}}
+	weights, weighted, passed, total := 0, 0.0, 0, 0
+	for _, group := range groups {
+		gs := GroupScore{Name: group.Name, Weight: group.Weight, Visible: group.Visible, Results: []TestResult{}}
+		for _, test := range group.Cases {
+			verdict, err := evaluate(test)
+			if err != nil {
+				return nil, fmt.Errorf("test %s: %v", test.Name, err)
+			}
+			gs.Results = append(gs.Results, TestResult{Test: test.Name, OK: verdict.OK, Message: verdict.Message})
+			gs.Total++
+			if verdict.OK {
+				gs.Passed++
+			}
+		}
+		if gs.Total > 0 {
+			weighted += float64(gs.Weight*gs.Passed) / float64(gs.Total)
+		}
+		weights += gs.Weight
+		passed += gs.Passed
+		total += gs.Total
+		score.Groups = append(score.Groups, gs)
+	}
+	switch {
+	case weights > 0:
+		score.Score = int(math.Round(100 * weighted / float64(weights)))
+	case total > 0:
+		score.Score = 100 * passed / total
+	default:
+		score.Score = 100
+	}
+	return score, nil
+}
+
+// ExamplesOK tells whether the solution passed every visible test.
+func (s *Score) ExamplesOK() bool {
+	for _, gs := range s.Groups {
+		if gs.Visible && gs.Passed < gs.Total {
+			return false
+		}
+	}
+	return true
+}
+
+// Examples shows the results of the visible groups only, as candidates
+// may see them.
+func (s *Score) Examples() string {
+	lines := []string{}
+	for _, gs := range s.Groups {
+		if gs.Visible {
+			lines = append(lines, gs.String())
+		}
+	}
+	if len(lines) == 0 {
+		return "The solution was submitted."
+	}
+	return "The solution was submitted.\n" + strings.Join(lines, "\n")
+}
+
+// String shows the score and the results of every group, for reviewers.
+func (s *Score) String() string {
+	lines := []string{fmt.Sprintf("Score: %d/100", s.Score)}
+	for _, gs := range s.Groups {
+		lines = append(lines, gs.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (gs *GroupScore) String() string {
+	visibility := "hidden"
+	if gs.Visible {
+		visibility = "visible"
+	}
+	lines := []string{fmt.Sprintf("%s (%s, weight %d): %d of %d tests passed", gs.Name, visibility, gs.Weight, gs.Passed, gs.Total)}
+	for _, result := range gs.Results {
+		if !result.OK {
+			lines = append(lines, fmt.Sprintf("  %s: %s", result.Test, result.Message))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,71 @@
+package judge
+
+import (
+	"github.com/maddyonline/goonj/problem"
+	"strings"
+	"testing"
+)
+
+func TestScoreWeighsGroups(t *testing.T) {
+	p := testProblem()
+	p.Tests = problem.ParseTests("1\n---\n2\n---\n3\n---\n40")
+	p.Groups = []problem.Group{
+		{Name: problem.GROUP_EXAMPLES, Visible: true, Tests: []string{"01"}},
+		{Name: problem.GROUP_HIDDEN, Weight: 60, Tests: []string{"02", "03"}, Generated: 2, Size: 9},
+		{Name: problem.GROUP_PERFORMANCE, Weight: 40, Tests: []string{"04"}},
+	}
+	double := func(in string) string { return strings.Repeat(strings.TrimSpace(in), 2) + "\n" }
+	run := fakeRun(map[string]func(string) string{
+		"generator.py":  func(stdin string) string { return strings.Fields(stdin)[0] + "\n" },
+		"reference.cpp": double,
+		// The candidate gets single digits right only.
+		"main.cpp": func(in string) string {
+			if len(strings.TrimSpace(in)) > 1 || in == "3\n" {
+				return "0\n"
+			}
+			return double(in)
+		},
+	})
+	groups, err := ProblemGroups(p, run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 3 || len(groups[1].Cases) != 4 || groups[1].Cases[2].Input != "1\n" || groups[1].Cases[3].Output != "22\n" {
+		t.Fatalf("unexpected groups %#v", groups[1])
+	}
+	score, err := ScoreGroups(groups, CompareEvaluator(problem.NewProgram("main.cpp", ""), run, exactChecker))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 3 of 4 hidden tests and no performance test pass.
+	if score.Score != 45 || !score.ExamplesOK() {
+		t.Errorf("expected a score of 45 with passing examples, got %s", score)
+	}
+	if examples := score.Examples(); strings.Contains(examples, problem.GROUP_HIDDEN) || !strings.Contains(examples, "1 of 1") {
+		t.Errorf("candidates must only see the examples, got %q", examples)
+	}
+	if !strings.Contains(score.String(), "03: line 1 differs") {
+		t.Errorf("reviewers must see the failed hidden tests, got %s", score)
+	}
+}
+
+func TestDefaultGroups(t *testing.T) {
+	p := testProblem()
+	groups, err := ProblemGroups(p, fakeRun(map[string]func(string) string{
+		"generator.py":  func(string) string { return "7\n" },
+		"reference.cpp": func(in string) string { return in },
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 || !groups[0].Visible || groups[0].Cases[0].Name != "01" {
+		t.Fatalf("expected the first test to be the example, got %#v", groups)
+	}
+	if hidden := groups[1]; hidden.Visible || hidden.Weight != 100 || len(hidden.Cases) != 1+problem.DEFAULT_GENERATED {
+		t.Errorf("unexpected hidden group %#v", hidden.Group)
+	}
+	score, err := ScoreGroups(groups, func(test *problem.Test) (*Verdict, error) { return &Verdict{OK: test.Name == "01"}, nil })
+	if err != nil || score.Score != 0 || !score.ExamplesOK() {
+		t.Errorf("examples must not count towards the score, got %v, %v", score, err)
+	}
+}
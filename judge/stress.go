@@ -0,0 +1,232 @@
+package judge
+
+import (
+	"fmt"
+	"github.com/maddyonline/code"
+	"math/rand"
+	"time"
+)
+
+// GeneratorStdin is what a generator reads on stdin: the seed to initialise
+// its random number generator with and a size in 1..MaxSize to scale the
+// input by. A generator that only depends on these prints the same input
+// every time, which is what makes failures reproducible.
+func GeneratorStdin(seed int64, size int) string {
+	return fmt.Sprintf("%d %d\n", seed, size)
+}
+
+type StressConfig struct {
+	// Seed derives the seeds of all rounds; 0 picks a random one. Judging
+	// again with the Seed of a report replays the same rounds.
+	Seed    int64
+	Rounds  int
+	MaxSize int
+	// ShrinkAttempts bounds the generator runs spent looking for a
+	// smaller failing input.
+	ShrinkAttempts int
+	// Checker judges the outputs, exactChecker when nil.
+	Checker Checker
+	// Interact and QueryLimit run interactive problems.
+	Interact   InteractFunc
+	QueryLimit int
+}
+
+var DefaultStress = StressConfig{Rounds: 20, MaxSize: 100, ShrinkAttempts: 16}
+
+// Case is a generated input and the generator stdin that produced it.
+type Case struct {
+	Seed  int64
+	Size  int
+	Input string
+}
+
+// Failure is a case on which the solution disagrees with the reference or
+// fails to run.
+type Failure struct {
+	Case
+	Expected string
+	Got      string
+	// Message explains the checker's verdict.
+	Message string
+	Err     error
+	// Interaction is set for interactive problems.
+	Interaction *Interaction
+	// Original is the first failing case found, set when it was shrunk.
+	Original *Case
+}
+
+type StressReport struct {
+	Seed    int64
+	Rounds  int
+	Failure *Failure
+	// Err reports a failure of the generator or the reference solution.
+	Err error
+}
+
+func (r *StressReport) OK() bool {
+	return r.Err == nil && r.Failure == nil
+}
+
+func (r *StressReport) String() string {
+	if r.Err != nil {
+		return fmt.Sprintf("Stress testing stopped after %d rounds (seed %d): %v", r.Rounds, r.Seed, r.Err)
+	}
+	if r.Failure == nil {
+		return fmt.Sprintf("Passed %d generated tests (seed %d).", r.Rounds, r.Seed)
+	}
+	f := r.Failure
+	s := fmt.Sprintf("Failed generated test %d (seed %d). The generator prints the input below when given %q.", r.Rounds+1, r.Seed, GeneratorStdin(f.Seed, f.Size))
+	if f.Original != nil {
+		s += fmt.Sprintf(" It was shrunk from size %d to %d.", f.Original.Size, f.Size)
+	}
+	if f.Interaction != nil {
+		return s + fmt.Sprintf("\nInput:\n%s\nVerdict: %s\nTranscript:\n%s", f.Input, f.Message, f.Interaction.TranscriptString())
+	}
+	s += fmt.Sprintf("\nInput:\n%s\nExpected:\n%s\n", f.Input, f.Expected)
+	if f.Err != nil {
+		return s + fmt.Sprintf("Error:\n%v", f.Err)
+	}
+	s += fmt.Sprintf("Got:\n%s", f.Got)
+	if f.Message != "" {
+		s += fmt.Sprintf("\nChecker: %s", f.Message)
+	}
+	return s
+}
+
+type stress struct {
+	gen *code.Input
+	run RunFunc
+	// evaluate judges the solution on a generated case.
+	evaluate func(c Case) (*Failure, error)
+}
+
+// try judges the solution on the input generated for seed and size.
+func (s *stress) try(seed int64, size int) (*Failure, error) {
+	input, err := s.run(s.gen, GeneratorStdin(seed, size))
+	if err != nil {
+		return nil, fmt.Errorf("generator (seed %d, size %d): %v", seed, size, err)
+	}
+	return s.evaluate(Case{Seed: seed, Size: size, Input: input})
+}
+
+// compare evaluates soln by checking its output against the reference.
+func compare(soln, ref *code.Input, run RunFunc, check Checker) func(c Case) (*Failure, error) {
+	return func(c Case) (*Failure, error) {
+		want, err := run(ref, c.Input)
+		if err != nil {
+			return nil, fmt.Errorf("reference (seed %d, size %d): %v", c.Seed, c.Size, err)
+		}
+		if soln == nil {
+			return nil, nil
+		}
+		got, err := run(soln, c.Input)
+		if err != nil {
+			return &Failure{Case: c, Expected: want, Err: err}, nil
+		}
+		verdict, err := check(c.Input, want, got)
+		if err != nil {
+			return nil, fmt.Errorf("seed %d, size %d: %v", c.Seed, c.Size, err)
+		}
+		if !verdict.OK {
+			return &Failure{Case: c, Expected: want, Got: got, Message: verdict.Message}, nil
+		}
+		return nil, nil
+	}
+}
+
+// interactWith evaluates soln by running it against the interactor.
+func interactWith(soln, interactor *code.Input, cfg StressConfig) func(c Case) (*Failure, error) {
+	return func(c Case) (*Failure, error) {
+		in, err := cfg.Interact(interactor, soln, c.Input, cfg.QueryLimit)
+		if err != nil {
+			return nil, fmt.Errorf("interactor (seed %d, size %d): %v", c.Seed, c.Size, err)
+		}
+		if !in.OK {
+			return &Failure{Case: c, Message: in.Message, Interaction: in}, nil
+		}
+		return nil, nil
+	}
+}
+
+// shrink binary searches for the smallest size that still fails, as long
+// as attempts last. At each size it tries the failing seed and then one
+// derived from it, and it keeps the shortest failing input found.
+func (s *stress) shrink(failure *Failure, attempts int) *Failure {
+	original := failure.Case
+	seeds := rand.New(rand.NewSource(original.Seed))
+	passing, failing := 0, original.Size
+	for failing-passing > 1 && attempts > 0 {
+		size := (passing + failing) / 2
+		var smaller *Failure
+		for _, seed := range []int64{original.Seed, seeds.Int63()} {
+			if attempts == 0 {
+				break
+			}
+			attempts--
+			if f, err := s.try(seed, size); err == nil && f != nil {
+				smaller = f
+				break
+			}
+		}
+		if smaller == nil {
+			passing = size
+			continue
+		}
+		failing = size
+		if len(smaller.Input) < len(failure.Input) {
+			failure = smaller
+		}
+	}
+	if failure.Case != original {
+		failure.Original = &original
+	}
+	return failure
+}
+
+func roundSize(round int, cfg StressConfig) int {
+	if cfg.Rounds <= 1 || cfg.MaxSize <= 1 {
+		return cfg.MaxSize
+	}
+	return 1 + (cfg.MaxSize-1)*round/(cfg.Rounds-1)
+}
+
+// Stress compares soln with the reference ref on inputs printed by gen,
+// growing the size from 1 to cfg.MaxSize over cfg.Rounds rounds. It stops
+// at the first failure and shrinks it. With a nil soln only the generator
+// and reference are checked.
+func Stress(gen, soln, ref *code.Input, run RunFunc, cfg StressConfig) *StressReport {
+	if cfg.Checker == nil {
+		cfg.Checker = exactChecker
+	}
+	return stressTest(&stress{gen: gen, run: run, evaluate: compare(soln, ref, run, cfg.Checker)}, cfg)
+}
+
+// StressInteractive is Stress for interactive problems: the generated
+// inputs are given to the interactor, which judges soln.
+func StressInteractive(gen, soln, interactor *code.Input, run RunFunc, cfg StressConfig) *StressReport {
+	if cfg.Interact == nil {
+		return &StressReport{Seed: cfg.Seed, Err: ErrNoInteract}
+	}
+	return stressTest(&stress{gen: gen, run: run, evaluate: interactWith(soln, interactor, cfg)}, cfg)
+}
+
+func stressTest(s *stress, cfg StressConfig) *StressReport {
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+	report := &StressReport{Seed: cfg.Seed}
+	seeds := rand.New(rand.NewSource(cfg.Seed))
+	for round := 0; round < cfg.Rounds; round++ {
+		failure, err := s.try(seeds.Int63(), roundSize(round, cfg))
+		if err != nil {
+			report.Err = err
+			return report
+		}
+		if failure != nil {
+			report.Failure = s.shrink(failure, cfg.ShrinkAttempts)
+			return report
+		}
+		report.Rounds++
+	}
+	return report
+}
@@ -0,0 +1,57 @@
+package judge
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// randomString is a generator printing size random letters of seed.
+func randomString(stdin string) string {
+	var seed int64
+	var size int
+	fmt.Sscan(stdin, &seed, &size)
+	r := rand.New(rand.NewSource(seed))
+	b := make([]byte, size)
+	for i := range b {
+		b[i] = byte('a' + r.Intn(3))
+	}
+	return string(b) + "\n"
+}
+
+func TestStressShrinksAndReplays(t *testing.T) {
+	upper := func(in string) string { return strings.ToUpper(in) }
+	// The candidate forgets the last letter of long strings.
+	buggy := func(in string) string {
+		if len(in) > 5 {
+			in = in[:len(in)-2] + "\n"
+		}
+		return strings.ToUpper(in)
+	}
+	run := fakeRun(map[string]func(string) string{
+		"generator.py":  randomString,
+		"reference.cpp": upper,
+		"brute.py":      buggy,
+	})
+	p := testProblem()
+	cfg := StressConfig{Seed: 42, Rounds: 10, MaxSize: 64, ShrinkAttempts: 16}
+	report := Stress(p.Generator, p.Brute, p.Reference, run, cfg)
+	if report.OK() || report.Failure == nil {
+		t.Fatalf("expected a failure, got %s", report)
+	}
+	f := report.Failure
+	if f.Original == nil || len(f.Input) >= len(f.Original.Input) {
+		t.Errorf("expected the failure to be shrunk, got %#v", f)
+	}
+	if got := randomString(GeneratorStdin(f.Seed, f.Size)); got != f.Input {
+		t.Errorf("generator stdin %q does not reproduce %q", GeneratorStdin(f.Seed, f.Size), f.Input)
+	}
+	again := Stress(p.Generator, p.Brute, p.Reference, run, cfg)
+	if again.Rounds != report.Rounds || again.Failure.Input != f.Input {
+		t.Errorf("seed %d did not replay the same failure: %s", cfg.Seed, again)
+	}
+	if !strings.Contains(report.String(), "seed 42") {
+		t.Errorf("report does not show its seed: %s", report)
+	}
+}
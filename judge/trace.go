@@ -0,0 +1,121 @@
+package judge
+
+import (
+	"fmt"
+	"github.com/maddyonline/code"
+	"github.com/maddyonline/goonj/problem"
+	"strings"
+	"time"
+)
+
+// Trace is what a solution did on one test. Input, Expected, Got and Diff
+// are only kept for failed tests; Got is empty for interactive problems,
+// whose interactor keeps the conversation.
+type Trace struct {
+	Group    string        `json:"group"`
+	Test     string        `json:"test"`
+	OK       bool          `json:"ok"`
+	Message  string        `json:"message,omitempty"`
+	Time     time.Duration `json:"-"`
+	TimeMs   int64         `json:"time_ms"`
+	Input    string        `json:"input,omitempty"`
+	Expected string        `json:"expected,omitempty"`
+	Got      string        `json:"got,omitempty"`
+	Diff     string        `json:"diff,omitempty"`
+}
+
+// TraceGroups scores soln on groups with ScoreGroups, like a final
+// submission, and traces each test. newEvaluator makes the evaluator from
+// a RunFunc that times the runs of soln, ProblemEvaluator for instance.
+// Tests that do not run soln through it are timed as a whole.
+func TraceGroups(groups []*Group, soln *code.Input, run RunFunc, newEvaluator func(RunFunc) (Evaluator, error)) (*Score, []*Trace, error) {
+	var got string
+	var took time.Duration
+	ran := false
+	timed := func(prog *code.Input, stdin string) (string, error) {
+		if prog != soln {
+			return run(prog, stdin)
+		}
+		start := time.Now()
+		out, err := run(prog, stdin)
+		got, took, ran = out, time.Since(start), true
+		return out, err
+	}
+	evaluate, err := newEvaluator(timed)
+	if err != nil {
+		return nil, nil, err
+	}
+	traces := []*Trace{}
+	traced := func(test *problem.Test) (*Verdict, error) {
+		got, took, ran = "", 0, false
+		start := time.Now()
+		verdict, err := evaluate(test)
+		if err != nil {
+			return nil, err
+		}
+		if !ran {
+			took = time.Since(start)
+		}
+		trace := &Trace{Test: test.Name, OK: verdict.OK, Message: verdict.Message, Time: took, TimeMs: int64(took / time.Millisecond)}
+		if !verdict.OK {
+			trace.Input, trace.Expected, trace.Got = test.Input, test.Output, got
+			if ran && test.Output != "" {
+				trace.Diff = Diff(test.Output, got)
+			}
+		}
+		traces = append(traces, trace)
+		return verdict, nil
+	}
+	score, err := ScoreGroups(groups, traced)
+	if err != nil {
+		return nil, traces, err
+	}
+	// The tests were judged in the order of the results.
+	i := 0
+	for _, gs := range score.Groups {
+		for range gs.Results {
+			traces[i].Group = gs.Name
+			i++
+		}
+	}
+	return score, traces, nil
+}
+
+// DIFF_CONTEXT is the number of equal lines Diff shows before the first
+// difference.
+const DIFF_CONTEXT = 2
+
+// Diff shows the first line where got differs from expected, after the
+// lines before it. Trailing whitespace at the end is ignored, as by
+// SameOutput.
+func Diff(expected, got string) string {
+	if SameOutput(expected, got) {
+		return ""
+	}
+	want := strings.Split(strings.TrimRight(expected, " \t\r\n"), "\n")
+	have := strings.Split(strings.TrimRight(got, " \t\r\n"), "\n")
+	if strings.TrimRight(got, " \t\r\n") == "" {
+		have = []string{}
+	}
+	i := 0
+	for i < len(want) && i < len(have) && want[i] == have[i] {
+		i++
+	}
+	lines := []string{fmt.Sprintf("@@ line %d @@", i+1)}
+	for j := i - DIFF_CONTEXT; j < i; j++ {
+		if j >= 0 {
+			lines = append(lines, "  "+want[j])
+		}
+	}
+	if i < len(want) {
+		lines = append(lines, "- "+want[i])
+	} else {
+		lines = append(lines, "- (end of output)")
+	}
+	if i < len(have) {
+		lines = append(lines, "+ "+have[i])
+	} else {
+		lines = append(lines, "+ (end of output)")
+	}
+	return strings.Join(lines, "\n")
+}
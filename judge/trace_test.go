@@ -0,0 +1,83 @@
+package judge
+
+import (
+	"github.com/maddyonline/code"
+	"github.com/maddyonline/goonj/problem"
+	"strings"
+	"testing"
+)
+
+func TestTraceGroups(t *testing.T) {
+	p := testProblem()
+	p.Groups = []problem.Group{
+		{Name: "examples", Visible: true, Tests: []string{"01"}},
+		{Name: "hidden", Weight: 100, Tests: []string{"02"}},
+	}
+	p.Tests = problem.ParseTests("1\n---\n2 2 2")
+	soln := problem.NewProgram("soln.py", "")
+	run := fakeRun(map[string]func(string) string{
+		"reference.cpp": func(in string) string { return strings.Replace(in, " ", "\n", -1) },
+		"soln.py": func(in string) string {
+			return strings.Replace(strings.Replace(in, " ", "\n", -1), "2\n2\n2", "2\n2\n3", 1)
+		},
+	})
+	groups, err := ProblemGroups(p, run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	score, traces, err := TraceGroups(groups, soln, run, func(run RunFunc) (Evaluator, error) {
+		return ProblemEvaluator(p, soln, run, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score.Score != 0 || len(traces) != 2 {
+		t.Fatalf("expected 2 traces and score 0, got %v, %d traces", score, len(traces))
+	}
+	if ok := traces[0]; !ok.OK || ok.Group != "examples" || ok.Input != "" {
+		t.Errorf("expected test 01 to pass without details, got %+v", ok)
+	}
+	failed := traces[1]
+	if failed.OK || failed.Group != "hidden" || failed.Got != "2\n2\n3\n" || failed.Message != "line 3 differs" {
+		t.Errorf("expected test 02 to fail, got %+v", failed)
+	}
+	if want := "@@ line 3 @@\n  2\n  2\n- 2\n+ 3"; failed.Diff != want {
+		t.Errorf("expected diff\n%s\ngot\n%s", want, failed.Diff)
+	}
+}
+
+func TestTraceGroupsTimesInteractions(t *testing.T) {
+	p := testProblem()
+	p.Type, p.Interactor = problem.TYPE_INTERACTIVE, problem.NewProgram("interactor.py", "")
+	p.Groups = []problem.Group{{Name: "hidden", Weight: 100, Tests: []string{"01", "02"}}}
+	interact := func(interactor, soln *code.Input, input string, queryLimit int) (*Interaction, error) {
+		return &Interaction{OK: input == "1\n", Message: "wrong guess"}, nil
+	}
+	groups, err := ProblemGroups(p, fakeRun(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, traces, err := TraceGroups(groups, p.Brute, fakeRun(nil), func(run RunFunc) (Evaluator, error) {
+		return ProblemEvaluator(p, p.Brute, run, interact)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(traces) != 2 || !traces[0].OK || traces[1].OK || traces[1].Message != "wrong guess" || traces[1].Diff != "" {
+		t.Errorf("unexpected traces %+v %+v", traces[0], traces[1])
+	}
+}
+
+func TestDiff(t *testing.T) {
+	for _, c := range []struct{ expected, got, diff string }{
+		{"1\n2\n", "1\n2  \n\n", ""},
+		{"1\n2\n", "1\n", "@@ line 2 @@\n  1\n- 2\n+ (end of output)"},
+		{"1\n", "1\n2\n", "@@ line 2 @@\n  1\n- (end of output)\n+ 2"},
+		{"a\nb\nc\nd\n", "a\nb\nc\nx\n", "@@ line 4 @@\n  b\n  c\n- d\n+ x"},
+		{"a\n", "", "@@ line 1 @@\n- a\n+ (end of output)"},
+	} {
+		if diff := Diff(c.expected, c.got); diff != c.diff {
+			t.Errorf("Diff(%q, %q): expected\n%s\ngot\n%s", c.expected, c.got, c.diff, diff)
+		}
+	}
+}
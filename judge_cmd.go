@@ -0,0 +1,199 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/maddyonline/code"
+	"github.com/maddyonline/goonj/config"
+	"github.com/maddyonline/goonj/cui"
+	"github.com/maddyonline/goonj/judge"
+	"github.com/maddyonline/goonj/problem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// judgeResult is what `goonj judge -json` prints.
+type judgeResult struct {
+	Problem     string         `json:"problem"`
+	Solution    string         `json:"solution"`
+	Language    string         `json:"language"`
+	Compilation string         `json:"compilation,omitempty"`
+	Compiled    bool           `json:"compiled"`
+	Score       *judge.Score   `json:"score,omitempty"`
+	Tests       []*judge.Trace `json:"tests"`
+	Stress      *judgeStress   `json:"stress,omitempty"`
+	OK          bool           `json:"ok"`
+}
+
+type judgeStress struct {
+	Seed    int64  `json:"seed"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message"`
+}
+
+// solutionLanguage returns the runner language of the solution in filename,
+// given as in the CUI (py3, js...) or as the runner names it, or guessed
+// from filename when lang is empty.
+func solutionLanguage(lang, filename string) string {
+	if lang == "" {
+		return problem.LanguageForFile(filename)
+	}
+	if language := cui.LanguageForRunner(lang); language != "" {
+		return language
+	}
+	if cui.LanguageFromRunner(lang) != "" {
+		return lang
+	}
+	return ""
+}
+
+// judgeCommand implements `goonj judge`, which judges a solution on a
+// problem directory as a final submission is judged, then stress tests it
+// as the judge button of the CUI does, and shows what it did on each test.
+func judgeCommand(args []string) int {
+	flags := flag.NewFlagSet("judge", flag.ExitOnError)
+	configFile := flags.String("config", "", "Path to TOML config file")
+	dir := flags.String("task", "", "Problem directory to judge on")
+	lang := flags.String("lang", "", "Language of the solution (cpp, go, py3, js...), from its extension by default")
+	seed := flags.Int64("seed", 0, "Seed of the stress test, random when 0")
+	stress := flags.Bool("stress", true, "Stress test the solution on generated inputs too")
+	timeLimit := flags.Duration("time-limit", judge.DEFAULT_TIMEOUT, "Time the solution may take on each interaction")
+	asJSON := flags.Bool("json", false, "Print the result as JSON")
+	flags.Parse(args)
+	if *dir == "" || flags.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: goonj judge [-config file] -task dir [-lang cpp] [-seed n] [-stress=false] [-time-limit 10s] [-json] solution\n")
+		return 2
+	}
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	p, err := problem.Load(*dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	file := flags.Arg(0)
+	language := solutionLanguage(*lang, file)
+	if language == "" {
+		fmt.Fprintf(os.Stderr, "Unknown language of %s, set it with -lang.\n", file)
+		return 2
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	filename := filepath.Base(file)
+	soln := code.MakeInput(language, filename, string(content), code.StdinFile(""))
+
+	local, err := newLocal(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	local.Timeout = *timeLimit
+	run := judge.CodeRunner(code.NewRunner(cfg.Runner.Path))
+	var interact judge.InteractFunc
+	if p.Interactive() {
+		interact = local.Interact
+	}
+
+	result := &judgeResult{Problem: p.Id, Solution: file, Language: language, Tests: []*judge.Trace{}}
+	compilation, err := local.CompileOnly(soln)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	status, _ := cui.CompileStatus(compilation, filename)
+	result.Compiled, result.Compilation = compilation.OK, status.Message
+	if compilation.OK {
+		groups, err := judge.ProblemGroups(p, run)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		result.Score, result.Tests, err = judge.TraceGroups(groups, soln, run, func(run judge.RunFunc) (judge.Evaluator, error) {
+			return judge.ProblemEvaluator(p, soln, run, interact)
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		if *stress && p.Generator != nil {
+			report, err := cui.StressSolution(p, soln, run, interact, *seed)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				return 1
+			}
+			result.Stress = &judgeStress{Seed: report.Seed, OK: report.OK(), Message: report.String()}
+		}
+		result.OK = true
+		for _, trace := range result.Tests {
+			result.OK = result.OK && trace.OK
+		}
+		if result.Stress != nil {
+			result.OK = result.OK && result.Stress.OK
+		}
+	}
+
+	if *asJSON {
+		if rc := printJSON(result); rc != 0 {
+			return rc
+		}
+	} else {
+		printJudgeResult(result)
+	}
+	if !result.OK {
+		return 1
+	}
+	return 0
+}
+
+// printJudgeResult prints a line per test, the score and the stress test,
+// then the input and the difference of the first failed test.
+func printJudgeResult(result *judgeResult) {
+	fmt.Printf("Judging %s (%s) on %s\n", result.Solution, result.Language, result.Problem)
+	if !result.Compiled || strings.Contains(result.Compilation, "\n") {
+		fmt.Println(result.Compilation)
+	}
+	if !result.Compiled {
+		return
+	}
+	var failed *judge.Trace
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, trace := range result.Tests {
+		verdict := "ok"
+		if !trace.OK {
+			verdict = "FAIL"
+			if failed == nil {
+				failed = trace
+			}
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%dms\t%s\n", trace.Group, trace.Test, verdict, trace.TimeMs, trace.Message)
+	}
+	w.Flush()
+	fmt.Printf("Score: %d/100\n", result.Score.Score)
+	if result.Stress != nil {
+		fmt.Println(result.Stress.Message)
+	}
+	if failed == nil {
+		return
+	}
+	fmt.Printf("\nFirst failed test: %s (%s)\nInput:\n%s", failed.Test, failed.Group, withNewline(failed.Input))
+	if failed.Diff != "" {
+		fmt.Printf("Diff (- expected, + got):\n%s\n", failed.Diff)
+	}
+}
+
+func withNewline(s string) string {
+	if s == "" || strings.HasSuffix(s, "\n") {
+		return s
+	}
+	return s + "\n"
+}
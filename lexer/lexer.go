@@ -0,0 +1,175 @@
+// Package lexer splits source code into lexemes good enough to highlight
+// it and to compare solutions, without parsing it.
+package lexer
+
+import (
+	"strings"
+)
+
+// Kinds of lexemes.
+const (
+	KEYWORD = "keyword"
+	IDENT   = "ident"
+	NUMBER  = "number"
+	STRING  = "string"
+	COMMENT = "comment"
+	// PREPROC is a C or C++ preprocessor line.
+	PREPROC = "preproc"
+	PUNCT   = "punct"
+	SPACE   = "space"
+)
+
+// Lexeme is a piece of a source file and the line it starts on, from 1.
+type Lexeme struct {
+	Kind string
+	Text string
+	Line int
+}
+
+// Families of languages sharing lexical rules.
+const (
+	FAMILY_C      = "c"
+	FAMILY_GO     = "go"
+	FAMILY_JS     = "js"
+	FAMILY_PYTHON = "python"
+)
+
+// Family maps the runner and CUI names of a language to the lexical rules
+// it follows.
+func Family(lang string) string {
+	switch lang {
+	case "go":
+		return FAMILY_GO
+	case "js", "javascript":
+		return FAMILY_JS
+	case "python", "py", "py2", "py3":
+		return FAMILY_PYTHON
+	}
+	return FAMILY_C
+}
+
+func words(s string) map[string]bool {
+	set := map[string]bool{}
+	for _, w := range strings.Fields(s) {
+		set[w] = true
+	}
+	return set
+}
+
+var keywords = map[string]map[string]bool{
+	FAMILY_C: words(`auto bool break case catch char class const continue default delete do double else
+		enum extern false float for friend goto if inline int long namespace new nullptr operator private
+		protected public return short signed sizeof static struct switch template this throw true try
+		typedef typename union unsigned using virtual void volatile while`),
+	FAMILY_GO: words(`break case chan const continue default defer else fallthrough for func go goto if
+		import interface map package range return select struct switch type var bool byte error float32
+		float64 int int32 int64 rune string uint uint32 uint64 nil true false`),
+	FAMILY_JS: words(`break case catch class const continue debugger default delete do else export
+		extends false finally for function if import in instanceof let new null return super switch this
+		throw true try typeof undefined var void while with yield`),
+	FAMILY_PYTHON: words(`False None True and as assert break class continue def del elif else except
+		finally for from global if import in is lambda nonlocal not or pass raise return try while with
+		yield`),
+}
+
+func isLetter(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || c >= 0x80
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+// end returns the index in rest just after the lexeme starting it, of the
+// given kind.
+func end(fam string, rest string, atLineStart bool) (string, int) {
+	c := rest[0]
+	lineEnd := func() int {
+		if i := strings.IndexByte(rest, '\n'); i >= 0 {
+			return i
+		}
+		return len(rest)
+	}
+	closing := func(from int, delim string) int {
+		if i := strings.Index(rest[from:], delim); i >= 0 {
+			return from + i + len(delim)
+		}
+		return len(rest)
+	}
+	switch {
+	case isSpace(c):
+		j := 1
+		for j < len(rest) && isSpace(rest[j]) {
+			j++
+		}
+		return SPACE, j
+	case fam == FAMILY_PYTHON && c == '#', fam != FAMILY_PYTHON && strings.HasPrefix(rest, "//"):
+		return COMMENT, lineEnd()
+	case fam == FAMILY_C && c == '#' && atLineStart:
+		return PREPROC, lineEnd()
+	case fam != FAMILY_PYTHON && strings.HasPrefix(rest, "/*"):
+		return COMMENT, closing(2, "*/")
+	case fam == FAMILY_PYTHON && (strings.HasPrefix(rest, `"""`) || strings.HasPrefix(rest, "'''")):
+		return STRING, closing(3, rest[:3])
+	case c == '"' || c == '\'' || (c == '`' && fam != FAMILY_C && fam != FAMILY_PYTHON):
+		// Unterminated strings end with their line.
+		j := 1
+		for j < len(rest) && rest[j] != c {
+			if rest[j] == '\\' && c != '`' {
+				j++
+			} else if rest[j] == '\n' && c != '`' {
+				return STRING, j
+			}
+			j++
+		}
+		if j < len(rest) {
+			j++
+		}
+		if j > len(rest) {
+			j = len(rest)
+		}
+		return STRING, j
+	case isDigit(c) || (c == '.' && len(rest) > 1 && isDigit(rest[1])):
+		j := 1
+		for j < len(rest) && (isLetter(rest[j]) || isDigit(rest[j]) || rest[j] == '.') {
+			j++
+		}
+		return NUMBER, j
+	case isLetter(c):
+		j := 1
+		for j < len(rest) && (isLetter(rest[j]) || isDigit(rest[j])) {
+			j++
+		}
+		if keywords[fam][rest[:j]] {
+			return KEYWORD, j
+		}
+		return IDENT, j
+	}
+	return PUNCT, 1
+}
+
+// Lex splits src, written in lang, into lexemes. Their texts put together
+// are src.
+func Lex(lang, src string) []Lexeme {
+	fam := Family(lang)
+	lexemes := []Lexeme{}
+	line := 1
+	atLineStart := true
+	for i := 0; i < len(src); {
+		kind, n := end(fam, src[i:], atLineStart)
+		text := src[i : i+n]
+		lexemes = append(lexemes, Lexeme{kind, text, line})
+		line += strings.Count(text, "\n")
+		if kind == SPACE {
+			atLineStart = atLineStart || strings.Contains(text, "\n")
+		} else {
+			atLineStart = false
+		}
+		i += n
+	}
+	return lexemes
+}
@@ -0,0 +1,41 @@
+package lexer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLex(t *testing.T) {
+	src := "#include <cstdio>\n  #define N 10\nint main() { // entry\n  printf(\"%d\\n\", N); /* done */\n  return 0; }\n"
+	lexemes := Lex("cpp", src)
+	text := ""
+	kinds := map[string][]string{}
+	for _, lx := range lexemes {
+		text += lx.Text
+		if lx.Kind != SPACE {
+			kinds[lx.Kind] = append(kinds[lx.Kind], lx.Text)
+		}
+	}
+	if text != src {
+		t.Errorf("expected the lexemes to make up the source, got %q", text)
+	}
+	for kind, want := range map[string]string{
+		PREPROC: "#include <cstdio>|#define N 10",
+		KEYWORD: "int|return",
+		COMMENT: "// entry|/* done */",
+		STRING:  `"%d\n"`,
+		NUMBER:  "0",
+	} {
+		if got := strings.Join(kinds[kind], "|"); got != want {
+			t.Errorf("%s: expected %q, got %q", kind, want, got)
+		}
+	}
+	if last := lexemes[len(lexemes)-2]; last.Text != "}" || last.Line != 5 {
+		t.Errorf("expected } on line 5, got %+v", last)
+	}
+
+	py := Lex("python", "s = 'it\\'s' # quote\n")
+	if py[4].Kind != STRING || py[4].Text != `'it\'s'` || py[6].Kind != COMMENT {
+		t.Errorf("wrong python lexemes %+v", py)
+	}
+}
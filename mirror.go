@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"github.com/maddyonline/goonj/cui"
+	"github.com/maddyonline/goonj/mirror"
+	"github.com/maddyonline/goonj/utils"
+	"golang.org/x/net/websocket"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// MIRROR_WRITE_TIMEOUT and MIRROR_QUEUE drop observers too slow to keep up
+// with the editor: a write may take MIRROR_WRITE_TIMEOUT, and MIRROR_QUEUE
+// messages may wait for it.
+const (
+	MIRROR_WRITE_TIMEOUT = 10 * time.Second
+	MIRROR_QUEUE         = 256
+)
+
+var (
+	mirrors = mirror.NewHub()
+
+	errMirrorClosed = errors.New("mirror: connection closed")
+	errMirrorSlow   = errors.New("mirror: connection too slow")
+)
+
+// wsConn sends mirror messages over a WebSocket. Send queues them for
+// write, so that a slow connection never holds up the hub.
+type wsConn struct {
+	ws        *websocket.Conn
+	out       chan *mirror.Message
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newWsConn(ws *websocket.Conn) *wsConn {
+	c := &wsConn{ws: ws, out: make(chan *mirror.Message, MIRROR_QUEUE), done: make(chan struct{})}
+	go c.write()
+	return c
+}
+
+func (c *wsConn) Send(msg *mirror.Message) error {
+	queued := *msg
+	select {
+	case <-c.done:
+		return errMirrorClosed
+	default:
+	}
+	select {
+	case c.out <- &queued:
+		return nil
+	default:
+		return errMirrorSlow
+	}
+}
+
+func (c *wsConn) write() {
+	for {
+		select {
+		case msg := <-c.out:
+			c.ws.SetWriteDeadline(time.Now().Add(MIRROR_WRITE_TIMEOUT))
+			if err := websocket.JSON.Send(c.ws, msg); err != nil {
+				c.Close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *wsConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.ws.Close()
+	})
+	return nil
+}
+
+// apiObserverLink is the page where interviewers watch a ticket live.
+type apiObserverLink struct {
+	TicketId string `json:"ticket_id"`
+	URL      string `json:"url"`
+}
+
+// apiCreateObserverLink returns the link to the observer page of a ticket,
+// creating the token that authorizes it on first use.
+func apiCreateObserverLink(c *echo.Context) error {
+	session, err := apiSession(c)
+	if session == nil {
+		return err
+	}
+	session.Lock()
+	defer session.Unlock()
+	ticket := session.Ticket
+	if ticket.ObserverToken == "" {
+		ticket.ObserverToken = utils.RandId()
+		saveSession(session)
+	}
+	link := "/observe/" + ticket.Id + "?token=" + url.QueryEscape(ticket.ObserverToken)
+	return c.JSON(http.StatusOK, &apiObserverLink{TicketId: ticket.Id, URL: link})
+}
+
+// observedSession returns the session an observer request is authorized
+// to watch, or nil.
+func observedSession(c *echo.Context) *cui.Session {
+	session, ok := lookupSession(c.Param("ticket"))
+	if !ok {
+		return nil
+	}
+	session.Lock()
+	token := session.Ticket.ObserverToken
+	session.Unlock()
+	if token == "" || subtle.ConstantTimeCompare([]byte(c.Query("token")), []byte(token)) != 1 {
+		return nil
+	}
+	return session
+}
+
+// mirrorCandidate receives the editor of the candidate of a ticket.
+func mirrorCandidate(c *echo.Context) error {
+	ticketId := c.Param("ticket")
+	session, ok := lookupSession(ticketId)
+	if ok {
+		session.Lock()
+		ok = !session.Closed
+		session.Unlock()
+	}
+	if !ok {
+		return websocket.JSON.Send(c.Socket(), &mirror.Message{Type: mirror.MSG_ERROR, Text: "no open ticket " + ticketId})
+	}
+	conn := newWsConn(c.Socket())
+	defer conn.Close()
+	mirrors.Connect(ticketId, conn)
+	defer mirrors.Disconnect(ticketId, conn)
+	for {
+		msg := &mirror.Message{}
+		if err := websocket.JSON.Receive(conn.ws, msg); err != nil {
+			log.Info("Mirror of ticket %s disconnected: %v", ticketId, err)
+			return nil
+		}
+		if err := mirrors.Receive(ticketId, conn, msg); err != nil {
+			log.Info("Mirror of ticket %s: %v", ticketId, err)
+		}
+	}
+}
+
+// mirrorObserver sends the editor of a ticket to an interviewer.
+func mirrorObserver(c *echo.Context) error {
+	ticketId := c.Param("ticket")
+	if observedSession(c) == nil {
+		return websocket.JSON.Send(c.Socket(), &mirror.Message{Type: mirror.MSG_ERROR, Text: "not allowed to observe ticket " + ticketId})
+	}
+	conn := newWsConn(c.Socket())
+	defer conn.Close()
+	if err := mirrors.Observe(ticketId, conn); err != nil {
+		return nil
+	}
+	defer mirrors.Disconnect(ticketId, conn)
+	// Observers only listen; reading notices when they leave.
+	for {
+		msg := &mirror.Message{}
+		if err := websocket.JSON.Receive(conn.ws, msg); err != nil {
+			return nil
+		}
+	}
+}
+
+func addMirrorHandlers(e *echo.Echo) {
+	e.WebSocket("/c/mirror/:ticket", mirrorCandidate)
+	e.WebSocket("/observe/:ticket/ws", mirrorObserver)
+	e.Get("/observe/:ticket", func(c *echo.Context) error {
+		if observedSession(c) == nil {
+			return echo.NewHTTPError(http.StatusForbidden, "Not allowed to observe this ticket")
+		}
+		return c.Render(http.StatusOK, "observe.html", map[string]interface{}{
+			"Title":    "Goonj observer",
+			"TicketId": c.Param("ticket"),
+			"Socket":   "/observe/" + c.Param("ticket") + "/ws?token=" + url.QueryEscape(c.Query("token")),
+		})
+	})
+}
@@ -0,0 +1,241 @@
+// Package mirror streams the editor of a candidate to the interviewers
+// watching a live interview.
+//
+// The CUI of a ticket connects as its candidate and sends a snapshot of the
+// editor when it connects, then every change as a numbered delta. The hub
+// applies the deltas to its own copy of the document and forwards them to
+// the observers of the ticket, who get the whole document when they join.
+// A delta that does not follow the last one, as after a reconnection, makes
+// the hub ask the candidate for a new snapshot.
+package mirror
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Message types. The candidate sends snapshots, deltas and cursors and is
+// sent resyncs; observers are sent the rest and presence changes.
+const (
+	MSG_SNAPSHOT = "snapshot"
+	MSG_DELTA    = "delta"
+	MSG_CURSOR   = "cursor"
+	MSG_RESYNC   = "resync"
+	MSG_PRESENCE = "presence"
+	MSG_ERROR    = "error"
+)
+
+// Delta actions.
+const (
+	DELTA_INSERT = "insert"
+	DELTA_REMOVE = "remove"
+)
+
+var (
+	ErrBadDelta       = errors.New("the delta does not fit the document")
+	ErrUnknownMessage = errors.New("unknown message type")
+)
+
+// Position is a row and a column in UTF-16 code units, as the editor
+// counts them.
+type Position struct {
+	Row    int `json:"row"`
+	Column int `json:"column"`
+}
+
+// Delta inserts Text at Start, or removes the text between Start and End.
+type Delta struct {
+	Action string   `json:"action"`
+	Start  Position `json:"start"`
+	End    Position `json:"end"`
+	Text   string   `json:"text,omitempty"`
+}
+
+type Message struct {
+	Type     string    `json:"type"`
+	Seq      int       `json:"seq"`
+	Task     string    `json:"task,omitempty"`
+	ProgLang string    `json:"prg_lang,omitempty"`
+	Text     string    `json:"text,omitempty"`
+	Delta    *Delta    `json:"delta,omitempty"`
+	Cursor   *Position `json:"cursor,omitempty"`
+	// Online tells observers whether the candidate is connected.
+	Online bool `json:"online"`
+}
+
+// offset is the byte offset of pos in text.
+func offset(text string, pos Position) (int, error) {
+	if pos.Row < 0 || pos.Column < 0 {
+		return 0, ErrBadDelta
+	}
+	lines := strings.Split(text, "\n")
+	if pos.Row >= len(lines) {
+		return 0, ErrBadDelta
+	}
+	n := 0
+	for _, line := range lines[:pos.Row] {
+		n += len(line) + 1
+	}
+	units := 0
+	for i, r := range lines[pos.Row] {
+		if units == pos.Column {
+			return n + i, nil
+		}
+		if units += len(utf16.Encode([]rune{r})); units > pos.Column {
+			return 0, ErrBadDelta
+		}
+	}
+	if units != pos.Column {
+		return 0, ErrBadDelta
+	}
+	return n + len(lines[pos.Row]), nil
+}
+
+// Apply returns text changed by d.
+func (d *Delta) Apply(text string) (string, error) {
+	start, err := offset(text, d.Start)
+	if err != nil {
+		return "", err
+	}
+	switch d.Action {
+	case DELTA_INSERT:
+		if !utf8.ValidString(d.Text) {
+			return "", ErrBadDelta
+		}
+		return text[:start] + d.Text + text[start:], nil
+	case DELTA_REMOVE:
+		end, err := offset(text, d.End)
+		if err != nil || end < start {
+			return "", ErrBadDelta
+		}
+		return text[:start] + text[end:], nil
+	}
+	return "", ErrBadDelta
+}
+
+// Conn is a connection to a candidate or an observer. The hub sends while
+// holding its lock, so Send must not block: a connection that cannot keep
+// up returns an error instead.
+type Conn interface {
+	Send(msg *Message) error
+	Close() error
+}
+
+type room struct {
+	doc       Message
+	candidate Conn
+	observers map[Conn]bool
+}
+
+// Hub keeps the document of every ticket being mirrored and the
+// connections watching it.
+type Hub struct {
+	mu    sync.Mutex
+	rooms map[string]*room
+}
+
+func NewHub() *Hub {
+	return &Hub{rooms: map[string]*room{}}
+}
+
+func (h *Hub) room(ticketId string) *room {
+	r, ok := h.rooms[ticketId]
+	if !ok {
+		r = &room{doc: Message{Type: MSG_SNAPSHOT}, observers: map[Conn]bool{}}
+		h.rooms[ticketId] = r
+	}
+	return r
+}
+
+// broadcast sends msg to the observers of r and drops those that fail.
+func (r *room) broadcast(msg *Message) {
+	msg.Online = r.candidate != nil
+	for conn := range r.observers {
+		if err := conn.Send(msg); err != nil {
+			delete(r.observers, conn)
+			conn.Close()
+		}
+	}
+}
+
+// Connect makes conn the candidate of ticketId. A candidate reconnecting
+// from a new connection replaces the old one.
+func (h *Hub) Connect(ticketId string, conn Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r := h.room(ticketId)
+	if r.candidate != nil && r.candidate != conn {
+		r.candidate.Close()
+	}
+	r.candidate = conn
+	r.broadcast(&Message{Type: MSG_PRESENCE})
+}
+
+// Disconnect forgets conn, be it the candidate or an observer of ticketId,
+// and the document once nobody is left.
+func (h *Hub) Disconnect(ticketId string, conn Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r, ok := h.rooms[ticketId]
+	if !ok {
+		return
+	}
+	delete(r.observers, conn)
+	if r.candidate == conn {
+		r.candidate = nil
+		r.broadcast(&Message{Type: MSG_PRESENCE})
+	}
+	if r.candidate == nil && len(r.observers) == 0 {
+		delete(h.rooms, ticketId)
+	}
+}
+
+// Observe adds conn to the observers of ticketId and sends it the document.
+func (h *Hub) Observe(ticketId string, conn Conn) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r := h.room(ticketId)
+	snapshot := r.doc
+	snapshot.Online = r.candidate != nil
+	if err := conn.Send(&snapshot); err != nil {
+		return err
+	}
+	r.observers[conn] = true
+	return nil
+}
+
+// Receive handles msg from the candidate conn of ticketId. Messages of a
+// replaced candidate are ignored.
+func (h *Hub) Receive(ticketId string, conn Conn, msg *Message) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r, ok := h.rooms[ticketId]
+	if !ok || r.candidate != conn {
+		return nil
+	}
+	switch msg.Type {
+	case MSG_SNAPSHOT:
+		r.doc = Message{Type: MSG_SNAPSHOT, Seq: msg.Seq, Task: msg.Task, ProgLang: msg.ProgLang, Text: msg.Text, Cursor: msg.Cursor}
+		snapshot := r.doc
+		r.broadcast(&snapshot)
+	case MSG_DELTA:
+		if msg.Delta == nil || msg.Seq != r.doc.Seq+1 {
+			return conn.Send(&Message{Type: MSG_RESYNC, Seq: r.doc.Seq})
+		}
+		text, err := msg.Delta.Apply(r.doc.Text)
+		if err != nil {
+			return conn.Send(&Message{Type: MSG_RESYNC, Seq: r.doc.Seq})
+		}
+		r.doc.Text, r.doc.Seq = text, msg.Seq
+		r.broadcast(&Message{Type: MSG_DELTA, Seq: msg.Seq, Task: r.doc.Task, Delta: msg.Delta})
+	case MSG_CURSOR:
+		r.doc.Cursor = msg.Cursor
+		r.broadcast(&Message{Type: MSG_CURSOR, Seq: r.doc.Seq, Cursor: msg.Cursor})
+	default:
+		return ErrUnknownMessage
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package mirror
+
+import (
+	"testing"
+)
+
+type fakeConn struct {
+	sent   []*Message
+	closed bool
+}
+
+func (c *fakeConn) Send(msg *Message) error {
+	copied := *msg
+	c.sent = append(c.sent, &copied)
+	return nil
+}
+
+func (c *fakeConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func (c *fakeConn) last() *Message {
+	if len(c.sent) == 0 {
+		return nil
+	}
+	return c.sent[len(c.sent)-1]
+}
+
+// snapshot returns the document of ticketId as a new observer sees it.
+func snapshot(h *Hub, ticketId string) *Message {
+	conn := &fakeConn{}
+	h.Observe(ticketId, conn)
+	h.Disconnect(ticketId, conn)
+	return conn.last()
+}
+
+func TestApplyDelta(t *testing.T) {
+	tests := []struct {
+		text  string
+		delta Delta
+		want  string
+	}{
+		{"", Delta{Action: DELTA_INSERT, Text: "int main"}, "int main"},
+		{"ab\ncd", Delta{Action: DELTA_INSERT, Start: Position{1, 1}, Text: "x\ny"}, "ab\ncx\nyd"},
+		{"ab\ncd", Delta{Action: DELTA_INSERT, Start: Position{0, 2}, Text: "\n"}, "ab\n\ncd"},
+		{"ab\ncd\nef", Delta{Action: DELTA_REMOVE, Start: Position{0, 1}, End: Position{2, 1}}, "af"},
+		{"ab\ncd", Delta{Action: DELTA_REMOVE, Start: Position{1, 0}, End: Position{1, 2}}, "ab\n"},
+		// Columns count UTF-16 code units: the emoji takes two.
+		{"é😀x", Delta{Action: DELTA_INSERT, Start: Position{0, 3}, Text: "!"}, "é😀!x"},
+	}
+	for _, test := range tests {
+		got, err := test.delta.Apply(test.text)
+		if err != nil {
+			t.Errorf("%q %+v: %v", test.text, test.delta, err)
+		} else if got != test.want {
+			t.Errorf("%q %+v: expected %q, got %q", test.text, test.delta, test.want, got)
+		}
+	}
+	for _, delta := range []Delta{
+		{Action: DELTA_INSERT, Start: Position{1, 0}},
+		{Action: DELTA_INSERT, Start: Position{0, 5}},
+		{Action: DELTA_INSERT, Start: Position{0, 2}},
+		{Action: DELTA_REMOVE, Start: Position{0, 3}, End: Position{0, 1}},
+		{Action: "replace"},
+	} {
+		if _, err := delta.Apply("é😀x"); err != ErrBadDelta {
+			t.Errorf("%+v: expected ErrBadDelta, got %v", delta, err)
+		}
+	}
+}
+
+func TestHub(t *testing.T) {
+	h := NewHub()
+	candidate, observer := &fakeConn{}, &fakeConn{}
+	h.Connect("t", candidate)
+	if err := h.Receive("t", candidate, &Message{Type: MSG_SNAPSHOT, Seq: 1, Task: "task1", ProgLang: "cpp", Text: "ab"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Observe("t", observer); err != nil {
+		t.Fatal(err)
+	}
+	if got := observer.last(); got.Type != MSG_SNAPSHOT || got.Text != "ab" || got.Task != "task1" || !got.Online {
+		t.Errorf("expected the document on joining, got %+v", got)
+	}
+
+	h.Receive("t", candidate, &Message{Type: MSG_DELTA, Seq: 2, Delta: &Delta{Action: DELTA_INSERT, Start: Position{0, 2}, Text: "c"}})
+	if got := observer.last(); got.Type != MSG_DELTA || got.Seq != 2 || got.Delta.Text != "c" {
+		t.Errorf("expected the delta to be forwarded, got %+v", got)
+	}
+	if got := snapshot(h, "t"); got.Text != "abc" || got.Seq != 2 {
+		t.Errorf("expected abc at 2, got %q at %d", got.Text, got.Seq)
+	}
+
+	// A lost delta makes the hub ask for a snapshot and ignore the rest.
+	h.Receive("t", candidate, &Message{Type: MSG_DELTA, Seq: 4, Delta: &Delta{Action: DELTA_INSERT, Text: "x"}})
+	if got := candidate.last(); got == nil || got.Type != MSG_RESYNC || got.Seq != 2 {
+		t.Errorf("expected a resync, got %+v", got)
+	}
+	if got := snapshot(h, "t"); got.Text != "abc" {
+		t.Errorf("expected the document to be unchanged, got %q", got.Text)
+	}
+
+	// A reconnecting candidate replaces the old connection.
+	reconnected := &fakeConn{}
+	h.Connect("t", reconnected)
+	if !candidate.closed {
+		t.Errorf("expected the old connection to be closed")
+	}
+	h.Receive("t", candidate, &Message{Type: MSG_SNAPSHOT, Seq: 9, Text: "stale"})
+	h.Receive("t", reconnected, &Message{Type: MSG_SNAPSHOT, Seq: 5, Task: "task1", Text: "abcd"})
+	if got := snapshot(h, "t"); got.Text != "abcd" || got.Seq != 5 {
+		t.Errorf("expected the snapshot of the new connection, got %q at %d", got.Text, got.Seq)
+	}
+	h.Disconnect("t", candidate)
+	if got := observer.last(); !got.Online {
+		t.Errorf("expected the candidate to stay online, got %+v", got)
+	}
+	h.Disconnect("t", reconnected)
+	if got := observer.last(); got.Type != MSG_PRESENCE || got.Online {
+		t.Errorf("expected the candidate to go offline, got %+v", got)
+	}
+
+	late := &fakeConn{}
+	h.Observe("t", late)
+	if got := late.last(); got.Text != "abcd" || got.Online {
+		t.Errorf("expected the last document offline, got %+v", got)
+	}
+
+	// The document goes once nobody is left.
+	h.Disconnect("t", observer)
+	h.Disconnect("t", late)
+	if len(h.rooms) != 0 {
+		t.Errorf("expected no rooms left, got %d", len(h.rooms))
+	}
+	h.Receive("t", candidate, &Message{Type: MSG_SNAPSHOT, Seq: 1, Text: "stale"})
+	if len(h.rooms) != 0 {
+		t.Errorf("expected messages of a gone candidate to open no room, got %d", len(h.rooms))
+	}
+}
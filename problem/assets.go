@@ -0,0 +1,82 @@
+package problem
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+var (
+	validAsset = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+	assetLink  = regexp.MustCompile(`!\[[^\]]*\]\(` + ASSETS_DIR + `/([^)\s]+)`)
+)
+
+func readAssets(dir string) (map[string][]byte, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return map[string][]byte{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	assets := map[string][]byte{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		assets[entry.Name()] = content
+	}
+	return assets, nil
+}
+
+func (p *Problem) saveAssets(dir string) error {
+	if len(p.Assets) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for name, content := range p.Assets {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateAssets flags assets with names unfit for URLs and images the
+// statement or its translations link to that are not in assets/.
+func (p *Problem) validateAssets() []string {
+	problems := []string{}
+	names := []string{}
+	for name := range p.Assets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !validAsset.MatchString(name) {
+			problems = append(problems, fmt.Sprintf("asset %q: names must be letters, digits, ., - and _", name))
+		}
+	}
+	missing := map[string]bool{}
+	for _, lang := range p.StatementLanguages() {
+		statement := p.Statement
+		if lang != DEFAULT_LANGUAGE {
+			statement = p.Translations[lang]
+		}
+		for _, m := range assetLink.FindAllStringSubmatch(statement, -1) {
+			if _, ok := p.Assets[m[1]]; !ok && !missing[m[1]] {
+				missing[m[1]] = true
+				problems = append(problems, fmt.Sprintf("%s links to the missing asset %s", statementFile(lang), m[1]))
+			}
+		}
+	}
+	return problems
+}
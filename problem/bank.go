@@ -0,0 +1,149 @@
+package problem
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Bank keeps every published version of every problem under Root, as
+// Root/ID/vN. Published versions are never modified.
+type Bank struct {
+	Root string
+	mu   sync.Mutex
+}
+
+func NewBank(root string) (*Bank, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &Bank{Root: root}, nil
+}
+
+// ParseRef splits a problem reference "id" or "id@version". Version 0 means
+// the latest version.
+func ParseRef(ref string) (string, int, error) {
+	parts := strings.SplitN(ref, "@", 2)
+	if len(parts) == 1 {
+		return ref, 0, nil
+	}
+	version, err := strconv.Atoi(parts[1])
+	if err != nil || version < 1 {
+		return "", 0, fmt.Errorf("problem: invalid version in %q", ref)
+	}
+	return parts[0], version, nil
+}
+
+func (b *Bank) dir(id string, version int) string {
+	return filepath.Join(b.Root, id, fmt.Sprintf("v%d", version))
+}
+
+// Versions returns the published versions of id in ascending order.
+func (b *Bank) Versions(id string) ([]int, error) {
+	if !validId.MatchString(id) {
+		return nil, fmt.Errorf("problem: invalid id %q", id)
+	}
+	entries, err := ioutil.ReadDir(filepath.Join(b.Root, id))
+	if os.IsNotExist(err) {
+		return []int{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	versions := []int{}
+	for _, entry := range entries {
+		if version, err := strconv.Atoi(strings.TrimPrefix(entry.Name(), "v")); err == nil && entry.IsDir() {
+			versions = append(versions, version)
+		}
+	}
+	sort.Ints(versions)
+	return versions, nil
+}
+
+// Get loads a published version of id, the latest one if version is 0.
+func (b *Bank) Get(id string, version int) (*Problem, error) {
+	if version == 0 {
+		versions, err := b.Versions(id)
+		if err != nil {
+			return nil, err
+		}
+		if len(versions) == 0 {
+			return nil, fmt.Errorf("problem: %s has not been published", id)
+		}
+		version = versions[len(versions)-1]
+	}
+	if !validId.MatchString(id) {
+		return nil, fmt.Errorf("problem: invalid id %q", id)
+	}
+	return Load(b.dir(id, version))
+}
+
+// Lookup loads the problem named by a reference as accepted by ParseRef.
+func (b *Bank) Lookup(ref string) (*Problem, error) {
+	id, version, err := ParseRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	return b.Get(id, version)
+}
+
+// List returns the manifest of the latest version of every problem.
+func (b *Bank) List() ([]Manifest, error) {
+	entries, err := ioutil.ReadDir(b.Root)
+	if err != nil {
+		return nil, err
+	}
+	manifests := []Manifest{}
+	for _, entry := range entries {
+		if !entry.IsDir() || !validId.MatchString(entry.Name()) {
+			continue
+		}
+		p, err := b.Get(entry.Name(), 0)
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, p.Manifest)
+	}
+	return manifests, nil
+}
+
+// Publish stores p as the next version of its problem and returns that
+// version. p must have been cross-validated so its tests carry outputs.
+func (b *Bank) Publish(p *Problem) (int, error) {
+	if err := p.Validate(); err != nil {
+		return 0, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	versions, err := b.Versions(p.Id)
+	if err != nil {
+		return 0, err
+	}
+	version := 1
+	if len(versions) > 0 {
+		version = versions[len(versions)-1] + 1
+	}
+	if err := os.MkdirAll(filepath.Join(b.Root, p.Id), 0755); err != nil {
+		return 0, err
+	}
+	tmp, err := ioutil.TempDir(filepath.Join(b.Root, p.Id), ".publish")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(tmp)
+	published := *p
+	published.Version = version
+	if err := published.Save(tmp); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, b.dir(p.Id, version)); err != nil {
+		return 0, err
+	}
+	p.Version = version
+	return version, nil
+}
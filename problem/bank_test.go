@@ -0,0 +1,176 @@
+package problem
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testProblem() *Problem {
+	return &Problem{
+		Manifest:  Manifest{Id: "palindrome", Title: "Palindromes"},
+		Statement: "Can the string be permuted into a palindrome?",
+		Generator: NewProgram("generator.py", "print('ab')\n"),
+		Reference: NewProgram("reference.cpp", "int main() {}\n"),
+		Tests:     ParseTests("appease\n---\nappeal\n"),
+	}
+}
+
+func TestPublishKeepsEveryVersion(t *testing.T) {
+	root, err := ioutil.TempDir("", "goonj-bank")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	bank, err := NewBank(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := testProblem()
+	p.Tests[0].Output = "1\n"
+	if version, err := bank.Publish(p); err != nil || version != 1 {
+		t.Fatalf("first publish: version %d, err %v", version, err)
+	}
+	p.Statement = "Updated statement"
+	if version, err := bank.Publish(p); err != nil || version != 2 {
+		t.Fatalf("second publish: version %d, err %v", version, err)
+	}
+	if versions, _ := bank.Versions("palindrome"); !reflect.DeepEqual(versions, []int{1, 2}) {
+		t.Errorf("expected versions [1 2], got %v", versions)
+	}
+	first, err := bank.Lookup("palindrome@1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Version != 1 || first.Statement != testProblem().Statement {
+		t.Errorf("version 1 changed: %#v", first.Manifest)
+	}
+	if len(first.Tests) != 2 || first.Tests[0].Name != "01" || first.Tests[0].Input != "appease\n" || first.Tests[0].Output != "1\n" {
+		t.Errorf("unexpected tests: %#v %#v", first.Tests[0], first.Tests[1])
+	}
+	if _, source := Source(first.Generator); source != "print('ab')\n" || first.Generator.Language != "python" {
+		t.Errorf("unexpected generator: %#v", first.Generator)
+	}
+	latest, err := bank.Lookup("palindrome")
+	if err != nil || latest.Version != 2 || latest.Statement != "Updated statement" {
+		t.Errorf("expected version 2 to be the latest, got %#v, %v", latest, err)
+	}
+	if manifests, err := bank.List(); err != nil || len(manifests) != 1 || manifests[0].Version != 2 {
+		t.Errorf("unexpected list: %#v, %v", manifests, err)
+	}
+}
+
+func TestValidateListsEveryProblem(t *testing.T) {
+	p := &Problem{
+		Manifest:  Manifest{Id: "Bad Id"},
+		Reference: NewProgram("reference.rb", "puts 1"),
+	}
+	err := p.Validate()
+	if err == nil {
+		t.Fatal("expected an invalid problem")
+	}
+	for _, want := range []string{"id", "statement", "generator is missing", "unsupported language of reference.rb"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in %v", want, err)
+		}
+	}
+}
+
+func TestValidateGroups(t *testing.T) {
+	p := testProblem()
+	p.Groups = []Group{
+		{Name: GROUP_EXAMPLES, Visible: true, Tests: []string{"01"}},
+		{Name: GROUP_HIDDEN, Weight: 100, Tests: []string{"02", "03"}},
+		{Name: GROUP_HIDDEN, Weight: -1, Generated: 5},
+	}
+	err := p.Validate()
+	if err == nil {
+		t.Fatal("expected invalid groups")
+	}
+	for _, want := range []string{"no test 03", "listed twice", "weight must not be negative", "need a size"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in %v", want, err)
+		}
+	}
+	p.Groups = p.Groups[:1]
+	if err := p.Validate(); err != nil {
+		t.Errorf("expected valid groups, got %v", err)
+	}
+}
+
+func TestTranslations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goonj-problem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := testProblem()
+	p.Statement = "# Palindromes\n\n## Input\n"
+	p.Languages = []string{"en", "cn", "de"}
+	p.Translations = map[string]string{"cn": "# 回文\n"}
+	err = p.Validate()
+	if err == nil {
+		t.Fatal("expected incomplete translations")
+	}
+	for _, want := range []string{"statement.de.md is missing", "statement.cn.md has 1 sections, statement.md has 2"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in %v", want, err)
+		}
+	}
+
+	p.Languages = []string{"cn"}
+	p.Translations["cn"] = "# 回文\n\n## 输入\n"
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Translations, p.Translations) || !reflect.DeepEqual(loaded.StatementLanguages(), []string{"en", "cn"}) {
+		t.Errorf("translations were not kept: %#v", loaded.Translations)
+	}
+	if statement, lang := loaded.StatementIn("de"); lang != DEFAULT_LANGUAGE || statement != p.Statement {
+		t.Errorf("expected the English statement for de, got %s", lang)
+	}
+	if _, lang := loaded.StatementIn("cn"); lang != "cn" {
+		t.Errorf("expected the Chinese statement, got %s", lang)
+	}
+}
+
+func TestAssets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goonj-problem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := testProblem()
+	p.Statement = "![tree](assets/tree.png) ![graph](assets/graph.svg)"
+	p.Assets = map[string][]byte{"tree.png": []byte("png"), "bad name.png": []byte("png")}
+	err = p.Validate()
+	if err == nil {
+		t.Fatal("expected invalid assets")
+	}
+	for _, want := range []string{`asset "bad name.png"`, "statement.md links to the missing asset graph.svg"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in %v", want, err)
+		}
+	}
+	p.Statement = "![tree](assets/tree.png)"
+	delete(p.Assets, "bad name.png")
+	if err := p.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.Validate(); err != nil || !reflect.DeepEqual(loaded.Assets, p.Assets) {
+		t.Errorf("assets were not kept: %v, %v", loaded.Assets, err)
+	}
+}
@@ -0,0 +1,109 @@
+package problem
+
+import (
+	"fmt"
+)
+
+// Names of the groups problems get when problem.toml lists none.
+const (
+	GROUP_EXAMPLES    = "examples"
+	GROUP_HIDDEN      = "hidden"
+	GROUP_PERFORMANCE = "performance"
+)
+
+// Group is a named set of tests scored together, listed in problem.toml as
+//
+//	[[groups]]
+//	name = "performance"
+//	weight = 30
+//	tests = ["07", "08"]
+//	generated = 5
+//	size = 100
+//
+// Tests names fixed tests; Generated adds that many inputs printed by the
+// generator for the given size, with seeds 1, 2, ... so every candidate
+// gets the same ones. Visible groups are the examples candidates see the
+// results of; the others are hidden. A task scores the weights of its
+// groups in proportion to the tests passed.
+type Group struct {
+	Name      string   `toml:"name" json:"name"`
+	Weight    int      `toml:"weight" json:"weight"`
+	Visible   bool     `toml:"visible,omitempty" json:"visible,omitempty"`
+	Tests     []string `toml:"tests,omitempty" json:"tests,omitempty"`
+	Generated int      `toml:"generated,omitempty" json:"generated,omitempty"`
+	Size      int      `toml:"size,omitempty" json:"size,omitempty"`
+}
+
+// DEFAULT_GENERATED and DEFAULT_SIZE shape the hidden group of problems
+// without groups.
+const (
+	DEFAULT_GENERATED = 10
+	DEFAULT_SIZE      = 100
+)
+
+// DefaultGroups shows the first of tests as the example and hides the
+// others, together with generated tests that carry the whole weight.
+func DefaultGroups(tests []*Test) []Group {
+	groups := []Group{}
+	hidden := Group{Name: GROUP_HIDDEN, Weight: 100, Generated: DEFAULT_GENERATED, Size: DEFAULT_SIZE}
+	for i, test := range tests {
+		if i == 0 {
+			groups = append(groups, Group{Name: GROUP_EXAMPLES, Visible: true, Tests: []string{test.Name}})
+		} else {
+			hidden.Tests = append(hidden.Tests, test.Name)
+		}
+	}
+	return append(groups, hidden)
+}
+
+// TestGroups returns the groups of p, DefaultGroups if it lists none.
+func (p *Problem) TestGroups() []Group {
+	if len(p.Groups) == 0 {
+		return DefaultGroups(p.Tests)
+	}
+	return p.Groups
+}
+
+// Test returns the fixed test called name, nil if there is none.
+func (p *Problem) Test(name string) *Test {
+	for _, test := range p.Tests {
+		if test.Name == name {
+			return test
+		}
+	}
+	return nil
+}
+
+// validateGroups lists the problems of the groups of p.
+func (p *Problem) validateGroups() []string {
+	problems := []string{}
+	seen := map[string]bool{}
+	for i, group := range p.Groups {
+		name := group.Name
+		switch {
+		case name == "":
+			name = fmt.Sprintf("%d", i+1)
+			problems = append(problems, fmt.Sprintf("group %s has no name", name))
+		case seen[name]:
+			problems = append(problems, fmt.Sprintf("group %s is listed twice", name))
+		}
+		seen[name] = true
+		if group.Weight < 0 {
+			problems = append(problems, fmt.Sprintf("group %s: weight must not be negative", name))
+		}
+		for _, test := range group.Tests {
+			if p.Test(test) == nil {
+				problems = append(problems, fmt.Sprintf("group %s: no test %s", name, test))
+			}
+		}
+		if group.Generated < 0 {
+			problems = append(problems, fmt.Sprintf("group %s: generated must not be negative", name))
+		} else if group.Generated > 0 && group.Size < 1 {
+			problems = append(problems, fmt.Sprintf("group %s: generated tests need a size of at least 1", name))
+		}
+		if len(group.Tests) == 0 && group.Generated <= 0 {
+			problems = append(problems, fmt.Sprintf("group %s has no tests", name))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,436 @@
+// Package problem defines problem packages, the directories authors edit
+// and publish, and the Bank that keeps every published version.
+//
+// A problem package looks like
+//
+//	problem.toml      id, title and the program files below
+//	statement.md      the task description in markdown
+//	statement.cn.md   optional translations of it, see DEFAULT_LANGUAGE
+//	generator.cpp     prints a random test input
+//	reference.cpp     the reference solution
+//	brute.py          optional independent solution used to cross-validate
+//	checker.cpp       optional program judging outputs, see CheckerConfig
+//	interactor.cpp    talks to solutions of interactive problems
+//	tests/NAME.in     fixed test inputs, with NAME.out written on publish
+//	assets/           images the statement links to as assets/NAME
+//	wrong/            optional known-wrong solutions the tests must catch
+//
+// problem.toml may also group the tests for scoring, see Group, and pick
+// the style of the solution templates candidates start from.
+//
+// Programs may be written in any language the runner supports; the
+// language is taken from the file extension.
+package problem
+
+import (
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/maddyonline/code"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	MANIFEST_FILE  = "problem.toml"
+	STATEMENT_FILE = "statement.md"
+	TESTS_DIR      = "tests"
+	ASSETS_DIR     = "assets"
+	WRONG_DIR      = "wrong"
+)
+
+// Checkers compare the output of a solution with the expected output.
+const (
+	CHECKER_EXACT      = "exact"
+	CHECKER_TOKENS     = "tokens"
+	CHECKER_WHITESPACE = "whitespace"
+	CHECKER_CASE       = "case"
+	CHECKER_FLOAT      = "float"
+	CHECKER_PROGRAM    = "program"
+)
+
+var Checkers = []string{CHECKER_EXACT, CHECKER_TOKENS, CHECKER_WHITESPACE, CHECKER_CASE, CHECKER_FLOAT, CHECKER_PROGRAM}
+
+// CheckerConfig selects the checker of a problem, exact comparison when
+// Type is empty. A checker program finds the test input, expected output
+// and candidate output in the files input.txt, expected.txt and output.txt
+// and prints OK or WA on its first line, followed by a message.
+type CheckerConfig struct {
+	Type      string  `toml:"type,omitempty"`
+	Tolerance float64 `toml:"tolerance,omitempty"`
+	Program   string  `toml:"program,omitempty"`
+}
+
+// ParseChecker reads a built-in checker written as its name, followed by
+// the tolerance for float, like "float 1e-6".
+func ParseChecker(spec string) CheckerConfig {
+	fields := strings.Fields(spec)
+	if len(fields) == 0 {
+		return CheckerConfig{}
+	}
+	cfg := CheckerConfig{Type: fields[0]}
+	if cfg.Type == CHECKER_FLOAT {
+		cfg.Tolerance = 1e-6
+		if len(fields) > 1 {
+			cfg.Tolerance, _ = strconv.ParseFloat(fields[1], 64)
+		}
+	}
+	return cfg
+}
+
+// FormatChecker is the inverse of ParseChecker.
+func FormatChecker(cfg CheckerConfig) string {
+	switch cfg.Type {
+	case "":
+		return CHECKER_EXACT
+	case CHECKER_FLOAT:
+		return fmt.Sprintf("%s %g", cfg.Type, cfg.Tolerance)
+	}
+	return cfg.Type
+}
+
+// Solution templates either read the input and print the answer in main,
+// or only ask candidates to fill in a function that gets the input.
+const (
+	TEMPLATE_STDIO    = "stdio"
+	TEMPLATE_FUNCTION = "function"
+)
+
+// TYPE_INTERACTIVE problems have no expected outputs. Solutions talk to
+// the interactor, which is given the test input and judges them.
+const TYPE_INTERACTIVE = "interactive"
+
+// Manifest is the content of problem.toml.
+type Manifest struct {
+	Id        string `toml:"id"`
+	Title     string `toml:"title"`
+	Version   int    `toml:"version"`
+	Type      string `toml:"type,omitempty"`
+	Template  string `toml:"template,omitempty"`
+	Generator string `toml:"generator"`
+	Reference string `toml:"reference"`
+	Brute     string `toml:"brute,omitempty"`
+	// Languages are the human languages the statement must be translated
+	// to before the problem is published.
+	Languages []string `toml:"languages,omitempty"`
+	// Interactor and QueryLimit are used by interactive problems; a
+	// QueryLimit of 0 does not limit the lines a solution may send.
+	Interactor string        `toml:"interactor,omitempty"`
+	QueryLimit int           `toml:"query_limit,omitempty"`
+	Checker    CheckerConfig `toml:"checker"`
+	Groups     []Group       `toml:"groups,omitempty"`
+}
+
+type Test struct {
+	Name   string
+	Input  string
+	Output string
+}
+
+type Problem struct {
+	Manifest
+	Statement string
+	// Translations of Statement by human language.
+	Translations map[string]string
+	// Assets are the files in assets/ by name.
+	Assets     map[string][]byte
+	Generator  *code.Input
+	Reference  *code.Input
+	Brute      *code.Input
+	Checker    *code.Input
+	Interactor *code.Input
+	// Wrong are known-wrong solutions from wrong/, which must fail a test.
+	Wrong []*code.Input
+	Tests []*Test
+}
+
+func (p *Problem) Interactive() bool {
+	return p.Type == TYPE_INTERACTIVE
+}
+
+var validId = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// LanguageForFile returns the runner language of a program file.
+func LanguageForFile(filename string) string {
+	return map[string]string{
+		".c":   "cpp",
+		".cc":  "cpp",
+		".cpp": "cpp",
+		".go":  "go",
+		".js":  "javascript",
+		".py":  "python",
+	}[filepath.Ext(filename)]
+}
+
+// NewProgram wraps source as a program for the runner.
+func NewProgram(filename, source string) *code.Input {
+	return &code.Input{
+		Language: LanguageForFile(filename),
+		Files:    []code.File{{Name: filename, Content: source}},
+	}
+}
+
+// Source returns the file name and source of a program.
+func Source(prog *code.Input) (string, string) {
+	if prog == nil || len(prog.Files) < 1 {
+		return "", ""
+	}
+	return prog.Files[0].Name, prog.Files[0].Content
+}
+
+// Validate reports every structural problem of p at once.
+func (p *Problem) Validate() error {
+	problems := []string{}
+	if !validId.MatchString(p.Id) {
+		problems = append(problems, fmt.Sprintf("id %q must be lower case letters, digits, - and _", p.Id))
+	}
+	if strings.TrimSpace(p.Statement) == "" {
+		problems = append(problems, "statement is empty")
+	}
+	for _, prog := range []struct {
+		name string
+		prog *code.Input
+	}{{"generator", p.Generator}, {"reference", p.Reference}} {
+		filename, source := Source(prog.prog)
+		if strings.TrimSpace(source) == "" {
+			problems = append(problems, fmt.Sprintf("%s is missing", prog.name))
+		} else if LanguageForFile(filename) == "" {
+			problems = append(problems, fmt.Sprintf("%s: unsupported language of %s", prog.name, filename))
+		}
+	}
+	if filename, _ := Source(p.Brute); p.Brute != nil && LanguageForFile(filename) == "" {
+		problems = append(problems, fmt.Sprintf("brute: unsupported language of %s", filename))
+	}
+	switch checker := p.Manifest.Checker; checker.Type {
+	case "", CHECKER_EXACT, CHECKER_TOKENS, CHECKER_WHITESPACE, CHECKER_CASE:
+	case CHECKER_FLOAT:
+		if checker.Tolerance <= 0 {
+			problems = append(problems, "checker: float tolerance must be positive")
+		}
+	case CHECKER_PROGRAM:
+		if filename, _ := Source(p.Checker); p.Checker == nil {
+			problems = append(problems, "checker program is missing")
+		} else if LanguageForFile(filename) == "" {
+			problems = append(problems, fmt.Sprintf("checker: unsupported language of %s", filename))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("checker: unknown type %q, expected one of %s", checker.Type, strings.Join(Checkers, ", ")))
+	}
+	switch p.Type {
+	case "":
+	case TYPE_INTERACTIVE:
+		if filename, _ := Source(p.Interactor); p.Interactor == nil {
+			problems = append(problems, "interactor is missing")
+		} else if LanguageForFile(filename) == "" {
+			problems = append(problems, fmt.Sprintf("interactor: unsupported language of %s", filename))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unknown type %q", p.Type))
+	}
+	switch p.Template {
+	case "", TEMPLATE_STDIO, TEMPLATE_FUNCTION:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown template %q, expected %s or %s", p.Template, TEMPLATE_STDIO, TEMPLATE_FUNCTION))
+	}
+	if p.QueryLimit < 0 {
+		problems = append(problems, "query_limit must not be negative")
+	}
+	problems = append(problems, p.validateGroups()...)
+	problems = append(problems, p.validateTranslations()...)
+	problems = append(problems, p.validateAssets()...)
+	for _, prog := range p.Wrong {
+		if filename, _ := Source(prog); LanguageForFile(filename) == "" {
+			problems = append(problems, fmt.Sprintf("%s: unsupported language of %s", WRONG_DIR, filename))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("problem %s: %s", p.Id, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func readProgram(dir, filename string) (*code.Input, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dir, filename))
+	if err != nil {
+		return nil, err
+	}
+	return NewProgram(filename, string(content)), nil
+}
+
+// Load reads the problem package in dir.
+func Load(dir string) (*Problem, error) {
+	p := &Problem{}
+	if _, err := toml.DecodeFile(filepath.Join(dir, MANIFEST_FILE), &p.Manifest); err != nil {
+		return nil, fmt.Errorf("problem: reading %s: %v", dir, err)
+	}
+	statement, err := ioutil.ReadFile(filepath.Join(dir, STATEMENT_FILE))
+	if err != nil {
+		return nil, fmt.Errorf("problem: %v", err)
+	}
+	p.Statement = string(statement)
+	if p.Translations, err = readTranslations(dir); err != nil {
+		return nil, fmt.Errorf("problem: %v", err)
+	}
+	if p.Generator, err = readProgram(dir, p.Manifest.Generator); err != nil {
+		return nil, fmt.Errorf("problem: %v", err)
+	}
+	if p.Reference, err = readProgram(dir, p.Manifest.Reference); err != nil {
+		return nil, fmt.Errorf("problem: %v", err)
+	}
+	if p.Brute, err = readProgram(dir, p.Manifest.Brute); err != nil {
+		return nil, fmt.Errorf("problem: %v", err)
+	}
+	if p.Checker, err = readProgram(dir, p.Manifest.Checker.Program); err != nil {
+		return nil, fmt.Errorf("problem: %v", err)
+	}
+	if p.Interactor, err = readProgram(dir, p.Manifest.Interactor); err != nil {
+		return nil, fmt.Errorf("problem: %v", err)
+	}
+	if p.Tests, err = readTests(filepath.Join(dir, TESTS_DIR)); err != nil {
+		return nil, fmt.Errorf("problem: %v", err)
+	}
+	if p.Assets, err = readAssets(filepath.Join(dir, ASSETS_DIR)); err != nil {
+		return nil, fmt.Errorf("problem: %v", err)
+	}
+	if p.Wrong, err = readWrong(filepath.Join(dir, WRONG_DIR)); err != nil {
+		return nil, fmt.Errorf("problem: %v", err)
+	}
+	return p, nil
+}
+
+// readWrong reads the known-wrong solutions in dir, sorted by name.
+func readWrong(dir string) ([]*code.Input, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	wrong := []*code.Input{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		prog, err := readProgram(dir, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		wrong = append(wrong, prog)
+	}
+	return wrong, nil
+}
+
+func readTests(dir string) ([]*Test, error) {
+	inputs, err := filepath.Glob(filepath.Join(dir, "*.in"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(inputs)
+	tests := []*Test{}
+	for _, in := range inputs {
+		input, err := ioutil.ReadFile(in)
+		if err != nil {
+			return nil, err
+		}
+		test := &Test{Name: strings.TrimSuffix(filepath.Base(in), ".in"), Input: string(input)}
+		output, err := ioutil.ReadFile(strings.TrimSuffix(in, ".in") + ".out")
+		if err == nil {
+			test.Output = string(output)
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		tests = append(tests, test)
+	}
+	return tests, nil
+}
+
+// Save writes p as a problem package into dir, which is created if needed.
+func (p *Problem) Save(dir string) error {
+	if err := os.MkdirAll(filepath.Join(dir, TESTS_DIR), 0755); err != nil {
+		return err
+	}
+	p.Manifest.Generator, _ = Source(p.Generator)
+	p.Manifest.Reference, _ = Source(p.Reference)
+	p.Manifest.Brute, _ = Source(p.Brute)
+	p.Manifest.Checker.Program, _ = Source(p.Checker)
+	p.Manifest.Interactor, _ = Source(p.Interactor)
+	f, err := os.Create(filepath.Join(dir, MANIFEST_FILE))
+	if err != nil {
+		return err
+	}
+	if err := toml.NewEncoder(f).Encode(&p.Manifest); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	files := map[string]string{STATEMENT_FILE: p.Statement}
+	for lang, translation := range p.Translations {
+		if lang != DEFAULT_LANGUAGE {
+			files[statementFile(lang)] = translation
+		}
+	}
+	for _, prog := range []*code.Input{p.Generator, p.Reference, p.Brute, p.Checker, p.Interactor} {
+		if filename, source := Source(prog); filename != "" {
+			files[filename] = source
+		}
+	}
+	if len(p.Wrong) > 0 {
+		if err := os.MkdirAll(filepath.Join(dir, WRONG_DIR), 0755); err != nil {
+			return err
+		}
+	}
+	for _, prog := range p.Wrong {
+		filename, source := Source(prog)
+		files[filepath.Join(WRONG_DIR, filename)] = source
+	}
+	for _, test := range p.Tests {
+		files[filepath.Join(TESTS_DIR, test.Name+".in")] = test.Input
+		if test.Output != "" {
+			files[filepath.Join(TESTS_DIR, test.Name+".out")] = test.Output
+		}
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	return p.saveAssets(filepath.Join(dir, ASSETS_DIR))
+}
+
+// TESTS_SEPARATOR separates test inputs when all tests of a problem are
+// edited as a single text, as in the authoring CUI.
+const TESTS_SEPARATOR = "\n---\n"
+
+// FormatTests joins the inputs of tests for editing.
+func FormatTests(tests []*Test) string {
+	inputs := []string{}
+	for _, test := range tests {
+		inputs = append(inputs, strings.TrimRight(test.Input, "\n"))
+	}
+	return strings.Join(inputs, TESTS_SEPARATOR)
+}
+
+// ParseTests splits text edited in the CUI into numbered tests.
+func ParseTests(text string) []*Test {
+	tests := []*Test{}
+	for _, input := range strings.Split(strings.Replace(text, "\r\n", "\n", -1), TESTS_SEPARATOR) {
+		if strings.TrimSpace(input) == "" {
+			continue
+		}
+		tests = append(tests, &Test{
+			Name:  fmt.Sprintf("%02d", len(tests)+1),
+			Input: strings.TrimRight(input, "\n") + "\n",
+		})
+	}
+	return tests
+}
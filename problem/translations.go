@@ -0,0 +1,99 @@
+package problem
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DEFAULT_LANGUAGE is the human language of statement.md. Translations are
+// kept next to it as statement.LANG.md, like statement.cn.md.
+const DEFAULT_LANGUAGE = "en"
+
+var validLanguage = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z]+)?$`)
+
+func statementFile(lang string) string {
+	if lang == DEFAULT_LANGUAGE {
+		return STATEMENT_FILE
+	}
+	return fmt.Sprintf("statement.%s.md", lang)
+}
+
+// readTranslations reads the statement.LANG.md files in dir.
+func readTranslations(dir string) (map[string]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "statement.*.md"))
+	if err != nil {
+		return nil, err
+	}
+	translations := map[string]string{}
+	for _, file := range files {
+		lang := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), "statement."), ".md")
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		translations[lang] = string(content)
+	}
+	return translations, nil
+}
+
+// StatementLanguages lists the human languages p has a statement in, the
+// default one first.
+func (p *Problem) StatementLanguages() []string {
+	langs := []string{}
+	for lang := range p.Translations {
+		if lang != DEFAULT_LANGUAGE {
+			langs = append(langs, lang)
+		}
+	}
+	sort.Strings(langs)
+	return append([]string{DEFAULT_LANGUAGE}, langs...)
+}
+
+// StatementIn returns the statement of p in lang and the language it is
+// actually in, the default one when there is no translation to lang.
+func (p *Problem) StatementIn(lang string) (string, string) {
+	if translation, ok := p.Translations[lang]; ok && lang != DEFAULT_LANGUAGE && strings.TrimSpace(translation) != "" {
+		return translation, lang
+	}
+	return p.Statement, DEFAULT_LANGUAGE
+}
+
+func countHeadings(markdown string) int {
+	n := 0
+	for _, line := range strings.Split(markdown, "\n") {
+		if strings.HasPrefix(line, "#") {
+			n++
+		}
+	}
+	return n
+}
+
+// validateTranslations flags the languages problem.toml promises but has
+// no statement in, and translations missing sections of statement.md.
+func (p *Problem) validateTranslations() []string {
+	problems := []string{}
+	for _, lang := range p.Manifest.Languages {
+		if !validLanguage.MatchString(lang) {
+			problems = append(problems, fmt.Sprintf("languages: invalid language %q", lang))
+		} else if _, ok := p.Translations[lang]; !ok && lang != DEFAULT_LANGUAGE {
+			problems = append(problems, fmt.Sprintf("%s is missing", statementFile(lang)))
+		}
+	}
+	want := countHeadings(p.Statement)
+	for _, lang := range p.StatementLanguages()[1:] {
+		translation := p.Translations[lang]
+		switch {
+		case !validLanguage.MatchString(lang):
+			problems = append(problems, fmt.Sprintf("%s: invalid language %q", statementFile(lang), lang))
+		case strings.TrimSpace(translation) == "":
+			problems = append(problems, fmt.Sprintf("%s is empty", statementFile(lang)))
+		case countHeadings(translation) != want:
+			problems = append(problems, fmt.Sprintf("%s has %d sections, %s has %d", statementFile(lang), countHeadings(translation), STATEMENT_FILE, want))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/labstack/echo"
+	"github.com/maddyonline/goonj/cui"
+	"github.com/maddyonline/goonj/judge"
+	"github.com/maddyonline/goonj/submission"
+	"net/http"
+	"time"
+)
+
+var (
+	submissions  *submission.Store
+	rejudgeQueue *submission.Queue
+)
+
+// storeSubmission records the final submission of task with its score, so
+// that it can be judged again later.
+func storeSubmission(ticketId string, task *cui.Task) error {
+	score := task.GetScore()
+	sub := &submission.Submission{
+		TicketId:  ticketId,
+		TaskId:    task.Id,
+		Language:  cui.LanguageForRunner(task.ProgLang),
+		Filename:  task.Filename,
+		Finalized: time.Now().UTC(),
+		Score:     score,
+		History:   []submission.Verdict{},
+	}
+	if task.Problem != nil {
+		sub.ProblemId, sub.Version = task.Problem.Id, task.Problem.Version
+	}
+	if score != nil {
+		sub.History = append(sub.History, submission.Verdict{Time: sub.Finalized, Version: sub.Version, NewScore: score.Score})
+	}
+	return submissions.Save(sub)
+}
+
+// newRejudger judges the submissions in store again and updates the scores
+// of the tasks the server holds.
+func newRejudger(store *submission.Store) *submission.Rejudger {
+	return &submission.Rejudger{
+		Store:    store,
+		Bank:     bank,
+		Run:      judge.CodeRunner(runner),
+		Interact: local.Interact,
+		Rejudged: func(sub *submission.Submission) {
+			if task, ok := findTask(sub.TicketId, sub.TaskId); ok {
+				task.SetScore(sub.Score)
+			}
+		},
+	}
+}
+
+// apiAdmin only lets requests through that carry the admin token.
+func apiAdmin(handler echo.HandlerFunc) echo.HandlerFunc {
+	return func(c *echo.Context) error {
+		if status, msg := checkAdmin(c); status != 0 {
+			return apiErrorf(c, status, "%s", msg)
+		}
+		return handler(c)
+	}
+}
+
+// checkAdmin returns the status and message to refuse c with unless it
+// carries the admin token, 0 if it does.
+func checkAdmin(c *echo.Context) (int, string) {
+	token := Cfg.Admin.Token
+	if token == "" {
+		return http.StatusForbidden, "the admin API is disabled, set admin.token to enable it"
+	}
+	auth := c.Request().Header.Get("Authorization")
+	if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+token)) != 1 {
+		return http.StatusUnauthorized, "invalid admin token"
+	}
+	return 0, ""
+}
+
+// apiRejudgeRequest names the ticket or the task whose final submissions
+// are judged again.
+type apiRejudgeRequest struct {
+	TicketId string `json:"ticket_id"`
+	TaskId   string `json:"task_id"`
+}
+
+func apiListSubmissions(c *echo.Context) error {
+	subs, err := submissions.List(c.Query("ticket"), c.Query("task"))
+	if err != nil {
+		return apiErrorf(c, http.StatusInternalServerError, "%v", err)
+	}
+	return c.JSON(http.StatusOK, subs)
+}
+
+func apiRejudge(c *echo.Context) error {
+	req := &apiRejudgeRequest{}
+	if err := json.NewDecoder(c.Request().Body).Decode(req); err != nil {
+		return apiErrorf(c, http.StatusBadRequest, "invalid request body: %v", err)
+	}
+	if req.TicketId == "" && req.TaskId == "" {
+		return apiErrorf(c, http.StatusBadRequest, "ticket_id or task_id is required")
+	}
+	return c.JSON(http.StatusAccepted, rejudgeQueue.Submit(req.TicketId, req.TaskId))
+}
+
+func apiGetRejudge(c *echo.Context) error {
+	job := rejudgeQueue.Get(c.Param("job"))
+	if job == nil {
+		return apiErrorf(c, http.StatusNotFound, "no rejudge job %q", c.Param("job"))
+	}
+	return c.JSON(http.StatusOK, job)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/maddyonline/code"
+	"github.com/maddyonline/goonj/config"
+	"github.com/maddyonline/goonj/judge"
+	"github.com/maddyonline/goonj/problem"
+	"github.com/maddyonline/goonj/submission"
+	"os"
+)
+
+// rejudgeCommand implements `goonj rejudge`, which judges the stored final
+// submissions of a ticket or task again and prints their old and new
+// scores. Unlike the admin API it works without a running server.
+func rejudgeCommand(args []string) int {
+	flags := flag.NewFlagSet("rejudge", flag.ExitOnError)
+	configFile := flags.String("config", "", "Path to TOML config file")
+	ticketId := flags.String("ticket", "", "Rejudge the submissions of this ticket")
+	taskId := flags.String("task", "", "Rejudge the submissions of this task in every ticket")
+	flags.Parse(args)
+	if *ticketId == "" && *taskId == "" {
+		fmt.Fprintf(os.Stderr, "Usage: goonj rejudge [-config file] (-ticket id | -task id)\n")
+		return 2
+	}
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	bank, err := problem.NewBank(cfg.Storage.Bank())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	local, err := newLocal(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	rejudger := &submission.Rejudger{
+		Store:    submission.NewStore(cfg.Storage.WorkDir),
+		Bank:     bank,
+		Run:      judge.CodeRunner(code.NewRunner(cfg.Runner.Path)),
+		Interact: local.Interact,
+	}
+	results, err := rejudger.RejudgeAll(*ticketId, *taskId)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	failed := 0
+	for _, result := range results {
+		switch {
+		case result.Err != "":
+			failed++
+			fmt.Printf("%s/%s: %s\n", result.TicketId, result.TaskId, result.Err)
+		case result.Verdict.Err != "":
+			failed++
+			fmt.Printf("%s/%s: score %d kept, %s\n", result.TicketId, result.TaskId, result.Verdict.OldScore, result.Verdict.Err)
+		default:
+			fmt.Printf("%s/%s: %d -> %d (version %d)\n", result.TicketId, result.TaskId, result.Verdict.OldScore, result.Verdict.NewScore, result.Verdict.Version)
+		}
+	}
+	fmt.Printf("Rejudged %d submissions, %d failed.\n", len(results), failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,70 @@
+package report
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSV_HEADER names the columns of WriteCSV. Scores lists task=score pairs,
+// with "-" for the tasks not judged.
+var CSV_HEADER = []string{
+	"ticket_id", "organisation", "state", "created", "started", "closed",
+	"elapsed_sec", "tasks", "score", "max_score", "scores", "flagged",
+}
+
+func csvTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// csvCell keeps spreadsheets from reading value, which may come from the
+// candidate, as a formula.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// WriteCSV writes a line per report, after CSV_HEADER.
+func WriteCSV(w io.Writer, reports []*Report) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(CSV_HEADER); err != nil {
+		return err
+	}
+	for _, r := range reports {
+		score, max := r.Score()
+		scores := []string{}
+		for _, task := range r.Tasks {
+			taskScore := "-"
+			if task.Score != nil {
+				taskScore = strconv.Itoa(task.Score.Score)
+			}
+			scores = append(scores, fmt.Sprintf("%s=%s", task.Id, taskScore))
+		}
+		flagged := ""
+		if r.Integrity != nil {
+			flagged = strconv.FormatBool(r.Integrity.Flagged)
+		}
+		record := []string{
+			r.TicketId, r.Organisation, r.State,
+			csvTime(r.Created), csvTime(r.Started), csvTime(r.Closed),
+			strconv.Itoa(r.ElapsedSec), strconv.Itoa(len(r.Tasks)),
+			strconv.Itoa(score), strconv.Itoa(max), strings.Join(scores, " "), flagged,
+		}
+		for i, value := range record {
+			record[i] = csvCell(value)
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,86 @@
+package report
+
+import (
+	"bytes"
+	"github.com/maddyonline/goonj/lexer"
+	"html/template"
+	"io"
+)
+
+// highlight renders code as HTML with a span around each lexeme worth a
+// color.
+func highlight(lang, code string) template.HTML {
+	var buf bytes.Buffer
+	for _, lx := range lexer.Lex(lang, code) {
+		switch lx.Kind {
+		case lexer.KEYWORD, lexer.STRING, lexer.NUMBER, lexer.COMMENT, lexer.PREPROC:
+			buf.WriteString(`<span class="` + lx.Kind + `">`)
+			template.HTMLEscape(&buf, []byte(lx.Text))
+			buf.WriteString(`</span>`)
+		default:
+			template.HTMLEscape(&buf, []byte(lx.Text))
+		}
+	}
+	return template.HTML(buf.String())
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"highlight": highlight,
+	"time":      formatTime,
+	"duration":  formatDuration,
+	"group":     groupText,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Report of ticket {{.TicketId}}</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; color: #222; max-width: 960px; margin: 24px auto; padding: 0 16px; }
+h1 { font-size: 22px; } h2 { font-size: 18px; border-bottom: 1px solid #ccc; padding-bottom: 4px; margin-top: 32px; }
+table.facts td { padding: 2px 16px 2px 0; vertical-align: top; }
+pre.code { background: #f7f7f7; border: 1px solid #ddd; padding: 8px; overflow-x: auto; font-size: 12px; }
+.keyword { color: #0033b3; font-weight: bold; } .string { color: #067d17; } .number { color: #1750eb; }
+.comment { color: #8c8c8c; font-style: italic; } .preproc { color: #9e880d; }
+.failed { color: #a33; } .flagged { color: #a33; font-weight: bold; }
+.chat-interviewer .chat-from { color: #3b5c7a; }
+@media print { pre.code { white-space: pre-wrap; } }
+</style>
+</head>
+<body>
+<h1>Ticket {{.TicketId}}</h1>
+<table class="facts">
+<tr><td>Organisation</td><td>{{if .Organisation}}{{.Organisation}}{{else}}-{{end}}</td></tr>
+<tr><td>State</td><td>{{.State}}</td></tr>
+<tr><td>Created</td><td>{{time .Created}}</td></tr>
+<tr><td>Started</td><td>{{time .Started}}</td></tr>
+<tr><td>Closed</td><td>{{time .Closed}}</td></tr>
+<tr><td>Time used</td><td>{{duration .ElapsedSec}} of {{duration .TimeLimitSec}}</td></tr>
+<tr><td>Score</td><td>{{.ScoreText}}</td></tr>
+{{with .Integrity}}<tr><td>Integrity</td><td>{{if .Flagged}}<span class="flagged">flagged for review</span>{{range .Reasons}}<br>{{.}}{{end}}{{else}}nothing unusual{{end}}</td></tr>{{end}}
+</table>
+{{range .Tasks}}
+<h2>Task {{.Id}}{{if .Problem}} ({{.Problem}}){{end}}</h2>
+<table class="facts">
+<tr><td>Language</td><td>{{if .Language}}{{.Language}}{{else}}-{{end}}</td></tr>
+<tr><td>Time spent</td><td>{{duration .TimeSec}}</td></tr>
+<tr><td>Submitted</td><td>{{time .Finalized}}</td></tr>
+<tr><td>Score</td><td>{{.ScoreText}}</td></tr>
+{{with .Score}}{{range .Groups}}<tr><td></td><td>{{group .}}{{range .Results}}{{if not .OK}}<br><span class="failed">{{.Test}} failed{{if .Message}}: {{.Message}}{{end}}</span>{{end}}{{end}}</td></tr>
+{{end}}{{end}}</table>
+{{if .Code}}<pre class="code">{{highlight .Language .Code}}</pre>{{else}}<p>No solution was saved.</p>{{end}}
+{{end}}
+{{if .Survey}}<h2>Survey</h2>
+<dl>{{range .Survey}}<dt>{{.Question}}</dt><dd>{{.Answer}}</dd>{{end}}</dl>
+{{end}}
+{{if .Chat}}<h2>Chat</h2>
+{{range .Chat}}<p class="chat-{{.From}}"><span class="chat-from">{{time .Time}} {{if .Author}}{{.Author}}{{else}}{{.From}}{{end}}:</span> {{.Text}}</p>
+{{end}}{{end}}
+<p><small>Generated {{time .Generated}}</small></p>
+</body>
+</html>
+`))
+
+// WriteHTML writes r as a single HTML page with no external resources.
+func WriteHTML(w io.Writer, r *Report) error {
+	return htmlTemplate.Execute(w, r)
+}
@@ -0,0 +1,298 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/maddyonline/goonj/lexer"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// The PDF is written by hand with the standard fonts every reader has, so
+// reports need no external tool. Lines are wrapped by counting characters.
+const (
+	PAGE_WIDTH  = 595 // A4, in points
+	PAGE_HEIGHT = 842
+	PAGE_MARGIN = 50
+
+	textChars = 95
+	codeChars = 100
+)
+
+const (
+	fontText = "/F1"
+	fontBold = "/F2"
+	fontCode = "/F3"
+)
+
+var pdfFonts = []struct{ name, base string }{
+	{fontText, "Helvetica"},
+	{fontBold, "Helvetica-Bold"},
+	{fontCode, "Courier"},
+}
+
+type color [3]float64
+
+var (
+	black = color{0.13, 0.13, 0.13}
+	grey  = color{0.55, 0.55, 0.55}
+	red   = color{0.64, 0.2, 0.2}
+
+	// codeColors match the classes of the HTML report.
+	codeColors = map[string]color{
+		lexer.KEYWORD: {0, 0.2, 0.7},
+		lexer.STRING:  {0.02, 0.49, 0.09},
+		lexer.NUMBER:  {0.09, 0.31, 0.92},
+		lexer.COMMENT: grey,
+		lexer.PREPROC: {0.62, 0.53, 0.05},
+	}
+)
+
+type pdfSpan struct {
+	font  string
+	color color
+	text  string
+}
+
+// pdfWriter lays out lines of spans from the top of the page down,
+// starting a new page when one is full.
+type pdfWriter struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+func (p *pdfWriter) newPage() {
+	p.pages = append(p.pages, &bytes.Buffer{})
+	p.y = PAGE_HEIGHT - PAGE_MARGIN
+}
+
+// pdfString encodes s for the standard fonts, which only know Latin-1.
+func pdfString(s string) string {
+	var buf bytes.Buffer
+	buf.WriteByte('(')
+	for _, r := range strings.Replace(s, "\t", "    ", -1) {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r == '\r' || r == '\n':
+		case r < 0x20 || r > 0xff || (r >= 0x7f && r < 0xa0):
+			buf.WriteByte('?')
+		default:
+			buf.WriteByte(byte(r))
+		}
+	}
+	buf.WriteByte(')')
+	return buf.String()
+}
+
+func (p *pdfWriter) line(size float64, spans ...pdfSpan) {
+	height := size * 1.35
+	if len(p.pages) == 0 || p.y-height < PAGE_MARGIN {
+		p.newPage()
+	}
+	p.y -= height
+	page := p.pages[len(p.pages)-1]
+	fmt.Fprintf(page, "BT %d %.2f Td\n", PAGE_MARGIN, p.y)
+	for _, span := range spans {
+		fmt.Fprintf(page, "%s %.1f Tf %.2f %.2f %.2f rg %s Tj\n", span.font, size, span.color[0], span.color[1], span.color[2], pdfString(span.text))
+	}
+	page.WriteString("ET\n")
+}
+
+func (p *pdfWriter) space(size float64) {
+	p.y -= size
+}
+
+// wrap splits text into lines of at most width characters, at spaces when
+// it can.
+func wrap(text string, width int) []string {
+	lines := []string{}
+	for _, para := range strings.Split(text, "\n") {
+		for utf8.RuneCountInString(para) > width {
+			runes := []rune(para)
+			cut := width
+			if i := strings.LastIndex(string(runes[:width]), " "); i > 0 {
+				cut = utf8.RuneCountInString(string(runes[:width])[:i])
+			}
+			lines = append(lines, string(runes[:cut]))
+			para = strings.TrimLeft(string(runes[cut:]), " ")
+		}
+		lines = append(lines, para)
+	}
+	return lines
+}
+
+func (p *pdfWriter) text(size float64, font string, c color, text string) {
+	for _, line := range wrap(text, int(textChars*10/size)) {
+		p.line(size, pdfSpan{font, c, line})
+	}
+}
+
+func (p *pdfWriter) fact(name, value string) {
+	p.text(10, fontText, black, name+": "+value)
+}
+
+// code writes src highlighted, one line of spans per source line, wrapped
+// at codeChars.
+func (p *pdfWriter) code(lang, src string) {
+	spans := []pdfSpan{}
+	width := 0
+	flush := func() {
+		p.line(8, spans...)
+		spans, width = []pdfSpan{}, 0
+	}
+	for _, lx := range lexer.Lex(lang, strings.TrimRight(src, "\n")) {
+		c, ok := codeColors[lx.Kind]
+		if !ok {
+			c = black
+		}
+		for i, part := range strings.Split(lx.Text, "\n") {
+			if i > 0 {
+				flush()
+			}
+			part = strings.Replace(part, "\t", "    ", -1)
+			for utf8.RuneCountInString(part) > codeChars-width {
+				runes := []rune(part)
+				spans = append(spans, pdfSpan{fontCode, c, string(runes[:codeChars-width])})
+				part = string(runes[codeChars-width:])
+				flush()
+			}
+			if part != "" {
+				spans = append(spans, pdfSpan{fontCode, c, part})
+				width += utf8.RuneCountInString(part)
+			}
+		}
+	}
+	flush()
+}
+
+// WritePDF writes r as a PDF document.
+func WritePDF(w io.Writer, r *Report) error {
+	p := &pdfWriter{}
+	p.text(16, fontBold, black, "Ticket "+r.TicketId)
+	p.space(6)
+	organisation := r.Organisation
+	if organisation == "" {
+		organisation = "-"
+	}
+	p.fact("Organisation", organisation)
+	p.fact("State", r.State)
+	p.fact("Created", formatTime(r.Created))
+	p.fact("Started", formatTime(r.Started))
+	p.fact("Closed", formatTime(r.Closed))
+	p.fact("Time used", formatDuration(r.ElapsedSec)+" of "+formatDuration(r.TimeLimitSec))
+	p.fact("Score", r.ScoreText())
+	if r.Integrity != nil {
+		if r.Integrity.Flagged {
+			p.text(10, fontBold, red, "Integrity: flagged for review")
+			for _, reason := range r.Integrity.Reasons {
+				p.text(10, fontText, red, "  "+reason)
+			}
+		} else {
+			p.fact("Integrity", "nothing unusual")
+		}
+	}
+	for _, task := range r.Tasks {
+		p.space(12)
+		title := "Task " + task.Id
+		if task.Problem != "" {
+			title += " (" + task.Problem + ")"
+		}
+		p.text(13, fontBold, black, title)
+		language := task.Language
+		if language == "" {
+			language = "-"
+		}
+		p.fact("Language", language)
+		p.fact("Time spent", formatDuration(task.TimeSec))
+		p.fact("Submitted", formatTime(task.Finalized))
+		p.fact("Score", task.ScoreText())
+		if task.Score != nil {
+			for _, g := range task.Score.Groups {
+				p.text(10, fontText, black, "  "+groupText(g))
+				for _, result := range g.Results {
+					if !result.OK {
+						msg := "    " + result.Test + " failed"
+						if result.Message != "" {
+							msg += ": " + result.Message
+						}
+						p.text(10, fontText, red, msg)
+					}
+				}
+			}
+		}
+		p.space(4)
+		if task.Code == "" {
+			p.text(10, fontText, grey, "No solution was saved.")
+		} else {
+			p.code(task.Language, task.Code)
+		}
+	}
+	if len(r.Survey) > 0 {
+		p.space(12)
+		p.text(13, fontBold, black, "Survey")
+		for _, answer := range r.Survey {
+			p.text(10, fontBold, black, answer.Question)
+			p.text(10, fontText, black, answer.Answer)
+		}
+	}
+	if len(r.Chat) > 0 {
+		p.space(12)
+		p.text(13, fontBold, black, "Chat")
+		for _, msg := range r.Chat {
+			author := msg.Author
+			if author == "" {
+				author = msg.From
+			}
+			p.text(10, fontText, black, formatTime(msg.Time)+" "+author+": "+msg.Text)
+		}
+	}
+	p.space(12)
+	p.text(8, fontText, grey, "Generated "+formatTime(r.Generated))
+	return p.writeTo(w)
+}
+
+// writeTo writes the catalog, the page tree, the fonts and the pages, and
+// the cross-reference table of their offsets.
+func (p *pdfWriter) writeTo(w io.Writer) error {
+	var out bytes.Buffer
+	offsets := []int{}
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1 and 2 are the catalog and the page tree, then come the
+	// fonts and a page and its content for each page.
+	firstPage := 3 + len(pdfFonts)
+	kids := []string{}
+	for i := range p.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", firstPage+2*i))
+	}
+	fonts := []string{}
+	for i, font := range pdfFonts {
+		fonts = append(fonts, fmt.Sprintf("%s %d 0 R", font.name, 3+i))
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	for _, font := range pdfFonts {
+		object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", font.base))
+	}
+	for i, page := range p.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << %s >> >> /Contents %d 0 R >>",
+			PAGE_WIDTH, PAGE_HEIGHT, strings.Join(fonts, " "), firstPage+2*i+1))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	_, err := w.Write(out.Bytes())
+	return err
+}
@@ -0,0 +1,108 @@
+// Package report renders what a candidate did in a ticket for hiring
+// managers: as a self-contained HTML page, as a PDF, and as a CSV line
+// per ticket.
+package report
+
+import (
+	"fmt"
+	"github.com/maddyonline/goonj/cui"
+	"github.com/maddyonline/goonj/judge"
+	"time"
+)
+
+// Report is everything known about a ticket. Zero times are unknown.
+type Report struct {
+	TicketId     string
+	Organisation string
+	State        string
+	Created      time.Time
+	Started      time.Time
+	Closed       time.Time
+	TimeLimitSec int
+	ElapsedSec   int
+	Tasks        []*Task
+	Survey       []SurveyAnswer
+	Chat         []cui.ChatMessage
+	Integrity    *cui.IntegritySummary
+	Generated    time.Time
+}
+
+// Task is a task of the ticket and the last solution of the candidate:
+// the final submission if there is one, else the last solution saved.
+// Score is nil until the task is judged.
+type Task struct {
+	Id string
+	// Problem is the bank reference ("id@version") of the task, if any.
+	Problem   string
+	Language  string
+	Code      string
+	TimeSec   int
+	Finalized time.Time
+	Score     *judge.Score
+}
+
+type SurveyAnswer struct {
+	Question string
+	Answer   string
+}
+
+// Score sums the scores of the tasks, each out of 100.
+func (r *Report) Score() (score, max int) {
+	for _, task := range r.Tasks {
+		if task.Score != nil {
+			score += task.Score.Score
+		}
+		max += 100
+	}
+	return score, max
+}
+
+// SurveyAnswers lists the answers of survey in the order of the questions.
+func SurveyAnswers(survey *cui.Survey) []SurveyAnswer {
+	answers := []SurveyAnswer{}
+	if survey == nil {
+		return answers
+	}
+	for _, q := range cui.SURVEY_QUESTIONS {
+		if answer, ok := survey.Answers[q.Name]; ok {
+			if q.Rated {
+				answer += " / 10"
+			}
+			answers = append(answers, SurveyAnswer{q.Text, answer})
+		}
+	}
+	return answers
+}
+
+// ScoreText is the total score of the tasks.
+func (r *Report) ScoreText() string {
+	score, max := r.Score()
+	return fmt.Sprintf("%d / %d", score, max)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format("2006-01-02 15:04 UTC")
+}
+
+func formatDuration(sec int) string {
+	return fmt.Sprintf("%d:%02d", sec/60, sec%60)
+}
+
+// ScoreText is the score of the task, or says it is not judged.
+func (t *Task) ScoreText() string {
+	if t.Score == nil {
+		return "not judged"
+	}
+	return fmt.Sprintf("%d / 100", t.Score.Score)
+}
+
+func groupText(g judge.GroupScore) string {
+	weight := ""
+	if g.Weight > 0 {
+		weight = fmt.Sprintf(", weight %d", g.Weight)
+	}
+	return fmt.Sprintf("%s: %d of %d tests passed%s", g.Name, g.Passed, g.Total, weight)
+}
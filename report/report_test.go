@@ -0,0 +1,133 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"github.com/maddyonline/goonj/cui"
+	"github.com/maddyonline/goonj/judge"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sample() *Report {
+	created := time.Date(2016, 3, 1, 9, 0, 0, 0, time.UTC)
+	return &Report{
+		TicketId:     "TICKET",
+		Organisation: "acme",
+		State:        cui.SESSION_CLOSED,
+		Created:      created,
+		Started:      created.Add(time.Minute),
+		Closed:       created.Add(time.Hour),
+		TimeLimitSec: 3600,
+		ElapsedSec:   3540,
+		Tasks: []*Task{
+			{
+				Id:       "palindrome",
+				Problem:  "palindrome@2",
+				Language: "cpp",
+				Code:     "#include <cstdio>\nint main() {\n\tputs(\"(yes)\"); // <done>\n}\n",
+				TimeSec:  1800,
+				Score: &judge.Score{Score: 60, Groups: []judge.GroupScore{
+					{Name: "hidden", Weight: 100, Passed: 3, Total: 5, Results: []judge.TestResult{
+						{Test: "04", OK: false, Message: "expected NO"},
+					}},
+				}},
+			},
+			{Id: "sum"},
+		},
+		Survey:    []SurveyAnswer{{"Did you have enough time?", "7 / 10"}},
+		Chat:      []cui.ChatMessage{{Seq: 1, Time: created, From: cui.CHAT_INTERVIEWER, Author: "ann", Text: "Good luck <3"}},
+		Integrity: &cui.IntegritySummary{Flagged: true, Reasons: []string{"opened the developer tools"}},
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteHTML(&buf, sample()); err != nil {
+		t.Fatal(err)
+	}
+	html := buf.String()
+	for _, want := range []string{
+		`<span class="keyword">int</span>`,
+		`<span class="preproc">#include &lt;cstdio&gt;</span>`,
+		`<span class="comment">// &lt;done&gt;</span>`,
+		"hidden: 3 of 5 tests passed, weight 100",
+		"04 failed: expected NO",
+		"60 / 200",
+		"not judged",
+		"Good luck &lt;3",
+		"opened the developer tools",
+		"7 / 10",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("expected %q in the report", want)
+		}
+	}
+	if strings.Contains(html, "src=") || strings.Contains(html, "href=") {
+		t.Errorf("expected a self-contained report")
+	}
+}
+
+func TestWritePDF(t *testing.T) {
+	r := sample()
+	r.Tasks[1].Code = strings.Repeat("x = 1\n", 200)
+	var buf bytes.Buffer
+	if err := WritePDF(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	pdf := buf.String()
+	if !strings.HasPrefix(pdf, "%PDF-1.4") || !strings.HasSuffix(pdf, "%%EOF\n") {
+		t.Fatalf("not a PDF: %q", pdf[:20])
+	}
+	if !strings.Contains(pdf, `(puts) Tj`) || !strings.Contains(pdf, `("\(yes\)") Tj`) {
+		t.Errorf("expected the code, escaped")
+	}
+	if count := regexp.MustCompile(`/Count (\d+)`).FindStringSubmatch(pdf); count == nil || count[1] == "1" {
+		t.Errorf("expected the long solution to take more pages, got %v", count)
+	}
+	// The cross-reference table points at each object.
+	xref := regexp.MustCompile(`startxref\n(\d+)`).FindStringSubmatch(pdf)
+	offset, _ := strconv.Atoi(xref[1])
+	if !strings.HasPrefix(pdf[offset:], "xref") {
+		t.Fatalf("startxref points at %q", pdf[offset:offset+10])
+	}
+	for i, m := range regexp.MustCompile(`(\d{10}) 00000 n`).FindAllStringSubmatch(pdf, -1) {
+		at, _ := strconv.Atoi(m[1])
+		if want := strconv.Itoa(i+1) + " 0 obj"; !strings.HasPrefix(pdf[at:], want) {
+			t.Errorf("object %d: offset %d points at %q", i+1, at, pdf[at:at+10])
+		}
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, []*Report{sample()}); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join(CSV_HEADER, ",") + "\n" +
+		"TICKET,acme,closed,2016-03-01T09:00:00Z,2016-03-01T09:01:00Z,2016-03-01T10:00:00Z,3540,2,60,200,palindrome=60 sum=-,true\n"
+	if buf.String() != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, buf.String())
+	}
+}
+
+func TestWriteCSVNeutralisesFormulas(t *testing.T) {
+	for _, org := range []string{"=HYPERLINK(\"http://evil\")", "+1", "-1", "@SUM(A1)"} {
+		r := sample()
+		r.Organisation = org
+		var buf bytes.Buffer
+		if err := WriteCSV(&buf, []*Report{r}); err != nil {
+			t.Fatal(err)
+		}
+		records, err := csv.NewReader(&buf).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := records[1][1]; got != "'"+org {
+			t.Errorf("expected %q to be quoted, got %q", org, got)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/labstack/echo"
+	"github.com/maddyonline/goonj/config"
+	"github.com/maddyonline/goonj/cui"
+	"github.com/maddyonline/goonj/report"
+	"github.com/maddyonline/goonj/submission"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const DATE_FORMAT = "2006-01-02"
+
+// reportSource reads what reports need from a work directory, so they can
+// be made by the server and by the CLI alike.
+type reportSource struct {
+	workDir    string
+	store      *submission.Store
+	thresholds cui.IntegrityThresholds
+	expiry     time.Duration
+}
+
+func serverReports() *reportSource {
+	return &reportSource{TMP_DIR, submissions, integrityThresholds(Cfg.Integrity), sessionExpiry()}
+}
+
+// problemRef returns the bank reference of taskId among those of ticket.
+func problemRef(ticket *cui.Ticket, taskId string) string {
+	for _, ref := range ticket.Problems {
+		if ref == taskId || strings.HasPrefix(ref, taskId+"@") {
+			return ref
+		}
+	}
+	return ""
+}
+
+// ticketReport gathers the report of session at now. The code of each task
+// is its final submission, or the last solution saved before the session
+// ended.
+func (src *reportSource) ticketReport(session *cui.Session, now time.Time) *report.Report {
+	session.Lock()
+	defer session.Unlock()
+	ticket := session.Ticket
+	r := &report.Report{
+		TicketId:     ticket.Id,
+		Organisation: ticket.Organisation,
+		State:        session.State(now, src.expiry),
+		Created:      session.Created,
+		Started:      session.StartTime,
+		TimeLimitSec: session.TimeLimit + session.Extension,
+		ElapsedSec:   int(session.Elapsed(now) / time.Second),
+		Tasks:        []*report.Task{},
+		Survey:       report.SurveyAnswers(session.Survey),
+		Chat:         session.Chat,
+		Integrity:    session.IntegritySummary(now, src.thresholds),
+		Generated:    now,
+	}
+	if session.Closed {
+		r.Closed = session.ClosedAt
+	}
+	if ticket.Options == nil {
+		return r
+	}
+	taskTime := session.TaskSeconds(now)
+	for _, taskId := range ticket.Options.TaskNames {
+		task := &report.Task{Id: taskId, Problem: problemRef(ticket, taskId), TimeSec: taskTime[taskId]}
+		if sub, err := src.store.Load(ticket.Id, taskId); err == nil {
+			task.Language, task.Score, task.Finalized = sub.Language, sub.Score, sub.Finalized
+			if input, err := src.store.Solution(sub); err == nil && len(input.Files) > 0 {
+				task.Code = input.Files[0].Content
+			}
+		} else if saved, ok := session.Solutions[taskId]; ok {
+			task.Language = saved.ProgLang
+			if content, err := ioutil.ReadFile(filepath.Join(src.workDir, ticket.Id, taskId, saved.Filename)); err == nil {
+				task.Code = string(content)
+			}
+		}
+		r.Tasks = append(r.Tasks, task)
+	}
+	return r
+}
+
+// ticketReports gathers the reports of the candidate sessions created from
+// from until to, the oldest first. Zero times leave the range open.
+func (src *reportSource) ticketReports(sessions []*cui.Session, from, to, now time.Time) []*report.Report {
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Created.Before(sessions[j].Created)
+	})
+	reports := []*report.Report{}
+	for _, session := range sessions {
+		if session.Ticket.Draft != nil || session.Created.Before(from) || (!to.IsZero() && !session.Created.Before(to)) {
+			continue
+		}
+		reports = append(reports, src.ticketReport(session, now))
+	}
+	return reports
+}
+
+// parseDateRange parses the dates from and to (YYYY-MM-DD, both included)
+// into a range of times. Empty dates leave the range open.
+func parseDateRange(from, to string) (time.Time, time.Time, error) {
+	var start, end time.Time
+	var err error
+	if from != "" {
+		if start, err = time.Parse(DATE_FORMAT, from); err != nil {
+			return start, end, fmt.Errorf("from: %q is not a YYYY-MM-DD date", from)
+		}
+	}
+	if to != "" {
+		if end, err = time.Parse(DATE_FORMAT, to); err != nil {
+			return start, end, fmt.Errorf("to: %q is not a YYYY-MM-DD date", to)
+		}
+		end = end.AddDate(0, 0, 1)
+	}
+	return start, end, nil
+}
+
+// writeReport writes the report of a ticket as html or pdf.
+func writeReport(w io.Writer, r *report.Report, format string) error {
+	switch format {
+	case "", "html":
+		return report.WriteHTML(w, r)
+	case "pdf":
+		return report.WritePDF(w, r)
+	}
+	return fmt.Errorf("unknown report format %q, use html or pdf", format)
+}
+
+func sendFile(c *echo.Context, contentType, filename string, content []byte) error {
+	c.Response().Header().Set("Content-Type", contentType)
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Response().WriteHeader(http.StatusOK)
+	_, err := c.Response().Write(content)
+	return err
+}
+
+// apiGetReport returns the report of a ticket, as HTML or with
+// ?format=pdf as PDF.
+func apiGetReport(c *echo.Context) error {
+	session, err := apiSession(c)
+	if session == nil {
+		return err
+	}
+	format := c.Query("format")
+	var buf bytes.Buffer
+	if err := writeReport(&buf, serverReports().ticketReport(session, time.Now()), format); err != nil {
+		return apiErrorf(c, http.StatusBadRequest, "%v", err)
+	}
+	if format == "pdf" {
+		return sendFile(c, "application/pdf", session.Ticket.Id+".pdf", buf.Bytes())
+	}
+	return sendFile(c, "text/html; charset=utf-8", session.Ticket.Id+".html", buf.Bytes())
+}
+
+// apiGetTicketsCSV returns a CSV line per ticket created in the date range
+// given by ?from= and ?to=.
+func apiGetTicketsCSV(c *echo.Context) error {
+	from, to, err := parseDateRange(c.Query("from"), c.Query("to"))
+	if err != nil {
+		return apiErrorf(c, http.StatusBadRequest, "%v", err)
+	}
+	sessions := allSessions()
+	var buf bytes.Buffer
+	if err := report.WriteCSV(&buf, serverReports().ticketReports(sessions, from, to, time.Now())); err != nil {
+		return apiErrorf(c, http.StatusInternalServerError, "%v", err)
+	}
+	return sendFile(c, "text/csv; charset=utf-8", "tickets.csv", buf.Bytes())
+}
+
+// reportCommand implements `goonj report`, which writes the report of a
+// ticket, or the CSV of the tickets created in a date range, from the work
+// directory without a running server.
+func reportCommand(args []string) int {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	configFile := flags.String("config", "", "Path to TOML config file")
+	ticketId := flags.String("ticket", "", "Report on this ticket")
+	format := flags.String("format", "html", "Format of the ticket report, html or pdf")
+	from := flags.String("from", "", "CSV of the tickets created from this date, YYYY-MM-DD")
+	to := flags.String("to", "", "CSV of the tickets created until this date, YYYY-MM-DD")
+	output := flags.String("o", "", "Write to this file rather than to stdout")
+	flags.Parse(args)
+	csv := *from != "" || *to != ""
+	if (*ticketId == "") == !csv {
+		fmt.Fprintf(os.Stderr, "Usage: goonj report [-config file] [-o file] (-ticket id [-format html|pdf] | -from date -to date)\n")
+		return 2
+	}
+	start, end, err := parseDateRange(*from, *to)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	sessions, err := cui.LoadSessions(cfg.Storage.WorkDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	src := &reportSource{
+		workDir:    cfg.Storage.WorkDir,
+		store:      submission.NewStore(cfg.Storage.WorkDir),
+		thresholds: integrityThresholds(cfg.Integrity),
+		expiry:     time.Duration(cfg.Limits.SessionExpiry) * time.Second,
+	}
+	var buf bytes.Buffer
+	if csv {
+		err = report.WriteCSV(&buf, src.ticketReports(sessions, start, end, time.Now()))
+	} else {
+		session := findSession(sessions, *ticketId)
+		if session == nil {
+			fmt.Fprintf(os.Stderr, "no ticket %q in %s\n", *ticketId, cfg.Storage.WorkDir)
+			return 1
+		}
+		err = writeReport(&buf, src.ticketReport(session, time.Now()), *format)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if *output == "" {
+		_, err = os.Stdout.Write(buf.Bytes())
+	} else {
+		err = ioutil.WriteFile(*output, buf.Bytes(), 0644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"github.com/maddyonline/goonj/config"
+	"github.com/maddyonline/goonj/judge"
+	"github.com/maddyonline/goonj/problem"
+	"os"
+	"os/user"
+	"strconv"
+)
+
+// newSandbox resolves the sandbox of cfg and checks that it can be
+// enforced on this machine.
+func newSandbox(cfg *config.Config) (judge.Sandbox, error) {
+	sb := judge.Sandbox{
+		MemoryMB:   cfg.Sandbox.MemoryMB,
+		MaxFileMB:  cfg.Sandbox.MaxFileMB,
+		MaxProcs:   cfg.Sandbox.MaxProcs,
+		Namespaces: cfg.Sandbox.Namespaces,
+	}
+	if cfg.Sandbox.User != "" {
+		u, err := user.Lookup(cfg.Sandbox.User)
+		if err != nil {
+			return sb, fmt.Errorf("sandbox.user: %v", err)
+		}
+		if sb.UID, err = strconv.Atoi(u.Uid); err == nil {
+			sb.GID, err = strconv.Atoi(u.Gid)
+		}
+		if err != nil {
+			return sb, fmt.Errorf("sandbox.user: %s has no numeric ids", cfg.Sandbox.User)
+		}
+		if sb.UID == 0 {
+			return sb, fmt.Errorf("sandbox.user: %s is root", cfg.Sandbox.User)
+		}
+	}
+	return sb, sb.Check()
+}
+
+// newLocal returns the local runner of cfg in its sandbox. Programs that
+// run as the sandbox user must not read the work dir, so only the server
+// may enter it then.
+func newLocal(cfg *config.Config) (*judge.Local, error) {
+	sb, err := newSandbox(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if sb.UID != 0 {
+		if err := os.MkdirAll(cfg.Storage.WorkDir, 0700); err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(cfg.Storage.WorkDir, 0700); err != nil {
+			return nil, err
+		}
+	}
+	local, err := judge.NewLocal(cfg.Sandbox.RunDir(cfg.Storage.WorkDir))
+	if err != nil {
+		return nil, err
+	}
+	local.Sandbox = sb
+	return local, nil
+}
+
+// checkInteractive refuses tickets of interactive problems unless the
+// sandbox of cfg isolates candidates' programs, which run on the server.
+func checkInteractive(cfg *config.Config, problems []*problem.Problem) error {
+	if cfg.Sandbox.Isolated() {
+		return nil
+	}
+	for _, p := range problems {
+		if p.Interactive() {
+			return fmt.Errorf("problem %s is interactive, which needs sandbox.user or sandbox.namespaces to be set", p.Id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"github.com/labstack/gommon/log"
+	"github.com/maddyonline/goonj/cui"
+	"github.com/maddyonline/goonj/webhook"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+)
+
+// restoreSessions brings back the sessions saved in the work directory,
+// with their clocks, the tasks of their problems and the last solutions
+// saved. Drafts are not restored.
+func restoreSessions() {
+	sessions, err := cui.LoadSessions(TMP_DIR)
+	if err != nil {
+		log.Error("Failed to load sessions: %v", err)
+		return
+	}
+	for _, session := range sessions {
+		ticketId := session.Ticket.Id
+		if session.Ticket.Draft != nil {
+			log.Info("Not restoring draft %s", ticketId)
+			continue
+		}
+		added, err := restoreTasks(session.Ticket)
+		if err != nil {
+			log.Error("Failed to restore ticket %s: %v", ticketId, err)
+			continue
+		}
+		for _, task := range added {
+			restoreSolution(session, task)
+		}
+		addSession(session)
+		userContexts[ticketId] = newUserContext()
+	}
+	log.Info("Restored %d sessions", len(allSessions()))
+}
+
+// restoreTasks adds the tasks of ticket back to tasks, from the problem bank
+// or as the default ticket was made.
+func restoreTasks(ticket *cui.Ticket) ([]*cui.Task, error) {
+	if len(ticket.Problems) == 0 {
+		tasksMu.Lock()
+		defer tasksMu.Unlock()
+		return cui.AddTicketTasks(tasks, ticket), nil
+	}
+	problems, err := lookupProblems(bank, ticket.Problems)
+	if err != nil {
+		return nil, err
+	}
+	tasksMu.Lock()
+	defer tasksMu.Unlock()
+	return cui.AddProblemTasks(tasks, ticket.Id, problems, ticket.Options), nil
+}
+
+// restoreSolution loads the solutions saved for task in each language, the
+// last one saved current, and the score of its final submission.
+func restoreSolution(session *cui.Session, task *cui.Task) {
+	ticketId := session.Ticket.Id
+	for _, saved := range session.SavedSolutions(task.Id) {
+		src := filepath.Join(TMP_DIR, ticketId, task.Id, saved.Filename)
+		content, err := ioutil.ReadFile(src)
+		if err != nil {
+			log.Error("Failed to restore the %s solution of %s/%s: %v", saved.ProgLang, ticketId, task.Id, err)
+			continue
+		}
+		task.SetSolution(saved.ProgLang, string(content))
+		task.Src, task.Filename = src, saved.Filename
+	}
+	if sub, err := submissions.Load(ticketId, task.Id); err == nil {
+		task.SetScore(sub.Score)
+	}
+}
+
+// SWEEP_INTERVAL is how often sweepSessions looks for sessions whose time is
+// up, and TIMEOUT_GRACE how long after that the CUI has to save the last
+// solution with /chk/timeout_action before the server closes the session.
+const (
+	SWEEP_INTERVAL = 30 * time.Second
+	TIMEOUT_GRACE  = time.Minute
+)
+
+// allSessions returns the sessions of every ticket.
+func allSessions() []*cui.Session {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	sessions := []*cui.Session{}
+	for _, session := range cuiSessions {
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+// getClock answers a clock request of the CUI or the API and closes the
+// session if its time is up.
+func getClock(clkReq *cui.ClockRequest) *cui.ClockResponse {
+	session, ok := lookupSession(clkReq.TicketId)
+	if !ok {
+		return cui.GetClock(nil, clkReq)
+	}
+	session.Lock()
+	resp := cui.GetClock(session, clkReq)
+	session.Unlock()
+	expireSession(clkReq.TicketId, time.Now(), TIMEOUT_GRACE)
+	return resp
+}
+
+// expireSession closes the session of ticketId if its time was up grace
+// before now and sends ticket.timed_out, once.
+func expireSession(ticketId string, now time.Time, grace time.Duration) {
+	session, ok := lookupSession(ticketId)
+	if !ok {
+		return
+	}
+	session.Lock()
+	closed := session.TimedOut(now, grace) && session.Close(now)
+	if closed {
+		saveSession(session)
+	}
+	session.Unlock()
+	if closed {
+		notify(webhook.TicketTimedOut, ticketId, "")
+	}
+}
+
+// sweepSessions expires sessions every interval, so that ticket.timed_out
+// is sent even when the candidate has left the CUI.
+func sweepSessions(interval time.Duration) {
+	for now := range time.Tick(interval) {
+		for _, session := range allSessions() {
+			expireSession(session.Ticket.Id, now, TIMEOUT_GRACE)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"github.com/maddyonline/goonj/config"
+	"github.com/maddyonline/goonj/cui"
+	"github.com/maddyonline/goonj/submission"
+	"github.com/maddyonline/goonj/webhook"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRestoreDefaultTicket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	Cfg, TMP_DIR = config.Default(), dir
+	submissions = submission.NewStore(dir)
+	tasks, cuiSessions = map[cui.TaskKey]*cui.Task{}, map[string]*cui.Session{}
+
+	ticket := cui.NewTicket(tasks, nil)
+	taskId := ticket.Options.TaskNames[0]
+	started := time.Now().Add(-10 * time.Minute).Round(time.Second)
+	session := &cui.Session{TimeLimit: 3600, Created: started, StartTime: started, Ticket: ticket}
+	if err := os.MkdirAll(filepath.Join(dir, ticket.Id, taskId), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, progLang := range []string{"cpp", "c"} {
+		fname := cui.SolutionFileName(taskId, progLang)
+		if err := ioutil.WriteFile(filepath.Join(dir, ticket.Id, taskId, fname), []byte("// "+progLang+"\nint main() {}\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		session.SaveSolution(taskId, progLang, fname)
+	}
+	if err := cui.SaveSession(dir, session); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks, cuiSessions = map[cui.TaskKey]*cui.Task{}, map[string]*cui.Session{}
+	restoreSessions()
+	restored, ok := cuiSessions[ticket.Id]
+	if !ok {
+		t.Fatalf("expected ticket %s to be restored", ticket.Id)
+	}
+	if !restored.StartTime.Equal(started) {
+		t.Errorf("expected the clock to start at %v, got %v", started, restored.StartTime)
+	}
+	task, ok := tasks[cui.TaskKey{TicketId: ticket.Id, TaskId: taskId}]
+	if !ok {
+		t.Fatalf("expected task %s to be restored", taskId)
+	}
+	if task.ProgLang != "c" || task.CurrentSolution != "// c\nint main() {}\n" {
+		t.Errorf("expected the last solution saved, got %q in %s", task.CurrentSolution, task.ProgLang)
+	}
+	if task.Solutions["cpp"] != "// cpp\nint main() {}\n" {
+		t.Errorf("expected the C++ solution to be restored too, got %q", task.Solutions["cpp"])
+	}
+}
+
+func TestExpireSessionSendsTimedOutOnce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	deliveries, _ := webhook.NewDeliveryLog("")
+	webhooks = webhook.NewDispatcher([]webhook.Endpoint{{URL: server.URL, Events: []string{webhook.TicketTimedOut}}}, deliveries)
+	Cfg, TMP_DIR = config.Default(), dir
+	tasks, cuiSessions = map[cui.TaskKey]*cui.Task{}, map[string]*cui.Session{}
+
+	ticket := cui.NewTicket(tasks, nil)
+	started := time.Now().Add(-time.Hour - TIMEOUT_GRACE)
+	addSession(&cui.Session{TimeLimit: 3600, Created: started, StartTime: started, Ticket: ticket})
+	expireSession(ticket.Id, time.Now(), TIMEOUT_GRACE)
+	expireSession(ticket.Id, time.Now(), TIMEOUT_GRACE)
+	closeSession(ticket.Id, webhook.TicketTimedOut)
+	webhooks.Wait()
+
+	if session, _ := lookupSession(ticket.Id); !session.Closed {
+		t.Errorf("expected the session to be closed once its time is up")
+	}
+	if sent := deliveries.Entries(ticket.Id); len(sent) != 1 || sent[0].EventType != webhook.TicketTimedOut {
+		t.Errorf("expected a single %s event, got %#v", webhook.TicketTimedOut, sent)
+	}
+}
+
+// TestConcurrentSessionRequests is meant to run with -race: the CUI and the
+// API change and save the same session at once.
+func TestConcurrentSessionRequests(t *testing.T) {
+	_, ticket, dir := newTestServer(t)
+	defer os.RemoveAll(dir)
+	session, _ := lookupSession(ticket.Id)
+	taskIds := ticket.Options.TaskNames
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		taskId := taskIds[i%len(taskIds)]
+		wg.Add(4)
+		go func() {
+			defer wg.Done()
+			getTask(&cui.MessageGetTask{Ticket: ticket.Id, Task: taskId, ProgLang: "c"})
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := storeSolution(&cui.SolutionRequest{Ticket: ticket.Id, Task: taskId, ProgLang: "c", Solution: "int main() {}\n"}); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			newApiTicket(session)
+		}()
+		go func() {
+			defer wg.Done()
+			recordEvent(session, &apiEventRequest{Type: "paste", Task: taskId, Size: 10})
+		}()
+	}
+	wg.Wait()
+
+	restored, err := cui.LoadSessions(dir)
+	if err != nil || len(restored) != 1 {
+		t.Fatalf("expected the session to be saved, got %d sessions: %v", len(restored), err)
+	}
+	if len(restored[0].Solutions) != len(taskIds) {
+		t.Errorf("expected a saved solution for each task, got %#v", restored[0].Solutions)
+	}
+}
+
+func TestTimeoutActionChecksClock(t *testing.T) {
+	e, ticket, dir := newTestServer(t)
+	defer os.RemoveAll(dir)
+	session, _ := lookupSession(ticket.Id)
+	taskId := ticket.Options.TaskNames[0]
+	form := url.Values{"ticket": {ticket.Id}, "task": {taskId}, "prg_lang": {"c"}, "solution": {"int main() {}\n"}}
+
+	session.Start(time.Now(), 0)
+	if rec := postForm(e, "/chk/timeout_action", form); rec.Code != http.StatusOK || session.Closed {
+		t.Errorf("expected the solution to be saved and the ticket to stay open, got %d, closed=%v", rec.Code, session.Closed)
+	}
+	if len(session.SavedSolutions(taskId)) != 1 {
+		t.Errorf("expected the solution to be saved, got %v", session.SavedSolutions(taskId))
+	}
+	session.StartTime = time.Now().Add(-time.Duration(session.TimeLimit) * time.Second)
+	if postForm(e, "/chk/timeout_action", form); !session.Closed {
+		t.Errorf("expected the ticket to close once its time is up")
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/labstack/echo"
+	"github.com/maddyonline/goonj/config"
+	"github.com/maddyonline/goonj/cui"
+	"github.com/maddyonline/goonj/problem"
+	"github.com/maddyonline/goonj/similarity"
+	"github.com/maddyonline/goonj/submission"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DEFAULT_SIMILARITY is the share of fingerprints two submissions must
+// have in common to be reported.
+const DEFAULT_SIMILARITY = 0.5
+
+type apiSimilarSource struct {
+	TicketId string `json:"ticket_id"`
+	Language string `json:"language"`
+	Source   string `json:"source"`
+}
+
+// apiSimilarPair is a pair of suspiciously similar submissions with the
+// lines of A found in B.
+type apiSimilarPair struct {
+	A          apiSimilarSource   `json:"a"`
+	B          apiSimilarSource   `json:"b"`
+	Similarity float64            `json:"similarity"`
+	Matches    []similarity.Match `json:"matches"`
+}
+
+// apiSimilarityReport compares the final submissions of a task. Skipped
+// lists the submissions whose solution could not be read.
+type apiSimilarityReport struct {
+	TaskId      string           `json:"task_id"`
+	Threshold   float64          `json:"threshold"`
+	Submissions int              `json:"submissions"`
+	Skipped     []string         `json:"skipped,omitempty"`
+	Pairs       []apiSimilarPair `json:"pairs"`
+}
+
+// similarityReport compares the final submissions of taskId with each
+// other, disregarding the solution templates candidates start from.
+func similarityReport(store *submission.Store, taskId string, threshold float64) (*apiSimilarityReport, error) {
+	subs, err := store.List("", taskId)
+	if err != nil {
+		return nil, err
+	}
+	detector := similarity.NewDetector(similarity.DEFAULT_K, similarity.DEFAULT_W)
+	for _, style := range []string{problem.TEMPLATE_STDIO, problem.TEMPLATE_FUNCTION} {
+		for progLang, template := range cui.SolutionTemplates(style) {
+			detector.Ignore(progLang, template)
+		}
+	}
+	report := &apiSimilarityReport{TaskId: taskId, Threshold: threshold, Pairs: []apiSimilarPair{}}
+	sources := map[string]apiSimilarSource{}
+	for _, sub := range subs {
+		input, err := store.Solution(sub)
+		if err != nil {
+			report.Skipped = append(report.Skipped, err.Error())
+			continue
+		}
+		src := input.Files[0].Content
+		detector.Add(sub.TicketId, sub.Language, src)
+		sources[sub.TicketId] = apiSimilarSource{TicketId: sub.TicketId, Language: sub.Language, Source: src}
+		report.Submissions++
+	}
+	for _, pair := range detector.Pairs(threshold) {
+		report.Pairs = append(report.Pairs, apiSimilarPair{
+			A:          sources[pair.A],
+			B:          sources[pair.B],
+			Similarity: pair.Similarity,
+			Matches:    pair.Matches,
+		})
+	}
+	return report, nil
+}
+
+func parseThreshold(s string) (float64, error) {
+	if s == "" {
+		return DEFAULT_SIMILARITY, nil
+	}
+	threshold, err := strconv.ParseFloat(s, 64)
+	if err != nil || threshold < 0 || threshold > 1 {
+		return 0, fmt.Errorf("threshold must be a number between 0 and 1, got %q", s)
+	}
+	return threshold, nil
+}
+
+func apiGetSimilarity(c *echo.Context) error {
+	taskId := c.Query("task")
+	if taskId == "" {
+		return apiErrorf(c, http.StatusBadRequest, "task is required")
+	}
+	threshold, err := parseThreshold(c.Query("threshold"))
+	if err != nil {
+		return apiErrorf(c, http.StatusBadRequest, "%v", err)
+	}
+	report, err := similarityReport(submissions, taskId, threshold)
+	if err != nil {
+		return apiErrorf(c, http.StatusInternalServerError, "%v", err)
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+func formatMatches(matches []similarity.Match) string {
+	regions := []string{}
+	for _, m := range matches {
+		regions = append(regions, fmt.Sprintf("%d-%d ~ %d-%d", m.A.StartLine, m.A.EndLine, m.B.StartLine, m.B.EndLine))
+	}
+	return strings.Join(regions, ", ")
+}
+
+// similarityCommand implements `goonj similarity`, which prints the
+// suspiciously similar final submissions of a task.
+func similarityCommand(args []string) int {
+	flags := flag.NewFlagSet("similarity", flag.ExitOnError)
+	configFile := flags.String("config", "", "Path to TOML config file")
+	taskId := flags.String("task", "", "Compare the submissions of this task")
+	thresholdFlag := flags.String("threshold", "", "Report pairs at least this similar, from 0 to 1 (default 0.5)")
+	asJSON := flags.Bool("json", false, "Print the report as JSON, with the sources")
+	flags.Parse(args)
+	if *taskId == "" {
+		fmt.Fprintf(os.Stderr, "Usage: goonj similarity [-config file] [-threshold 0.5] [-json] -task id\n")
+		return 2
+	}
+	threshold, err := parseThreshold(*thresholdFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	report, err := similarityReport(submission.NewStore(cfg.Storage.WorkDir), *taskId, threshold)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if *asJSON {
+		out, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		fmt.Println(string(out))
+		return 0
+	}
+	for _, skipped := range report.Skipped {
+		fmt.Printf("skipped %s\n", skipped)
+	}
+	for _, pair := range report.Pairs {
+		fmt.Printf("%s %s %3.0f%% lines %s\n", pair.A.TicketId, pair.B.TicketId, pair.Similarity*100, formatMatches(pair.Matches))
+	}
+	fmt.Printf("Compared %d submissions of %s, %d pairs at least %.0f%% similar.\n", report.Submissions, *taskId, len(report.Pairs), threshold*100)
+	return 0
+}
+
+// addSimilarityHandlers serves the admin page showing similar submissions.
+// The page asks for the admin token and reads the report from the API.
+func addSimilarityHandlers(e *echo.Echo) {
+	e.Get("/admin/similarity", func(c *echo.Context) error {
+		return c.Render(http.StatusOK, "similarity.html", map[string]interface{}{
+			"Title": "Goonj: similar submissions",
+			"API":   API_PREFIX + "/admin/similarity",
+		})
+	})
+}
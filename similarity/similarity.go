@@ -0,0 +1,224 @@
+// Package similarity finds solutions that look copied from each other.
+//
+// Sources are tokenized with identifiers, numbers and strings normalized,
+// hashed as k-grams of tokens and winnowed: of every window of W
+// consecutive hashes the smallest is kept as a fingerprint. Any run of at
+// least K+W-1 tokens two sources share yields a shared fingerprint, while
+// shorter coincidences are mostly ignored. The similarity of two sources is
+// the share of the fingerprints of the smaller one found in the other.
+package similarity
+
+import (
+	"github.com/maddyonline/goonj/lexer"
+	"hash/fnv"
+	"sort"
+)
+
+// Defaults suited to solutions of a few dozen lines.
+const (
+	DEFAULT_K = 8
+	DEFAULT_W = 6
+)
+
+// Region is a range of lines of a source, from 1.
+type Region struct {
+	StartLine int `json:"start_line"`
+	EndLine   int `json:"end_line"`
+}
+
+// Match is a region of the first source of a pair found in the second.
+type Match struct {
+	A Region `json:"a"`
+	B Region `json:"b"`
+}
+
+// Pair is the similarity of two sources.
+type Pair struct {
+	A          string  `json:"a"`
+	B          string  `json:"b"`
+	Similarity float64 `json:"similarity"`
+	Matches    []Match `json:"matches"`
+}
+
+type document struct {
+	id     string
+	family string
+	tokens []Token
+	// prints maps the fingerprints to the first token of their k-gram.
+	prints map[uint64]int
+}
+
+// Detector compares sources of the same language with each other.
+type Detector struct {
+	K, W   int
+	ignore map[uint64]bool
+	docs   []*document
+}
+
+func NewDetector(k, w int) *Detector {
+	if k <= 0 {
+		k = DEFAULT_K
+	}
+	if w <= 0 {
+		w = DEFAULT_W
+	}
+	return &Detector{K: k, W: w, ignore: map[uint64]bool{}}
+}
+
+func hashTokens(tokens []Token) uint64 {
+	h := fnv.New64a()
+	for _, t := range tokens {
+		h.Write([]byte(t.Text))
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+// fingerprints winnows the k-gram hashes of tokens, keeping the rightmost
+// smallest hash of each window.
+func (d *Detector) fingerprints(tokens []Token) map[uint64]int {
+	prints := map[uint64]int{}
+	if len(tokens) < d.K {
+		return prints
+	}
+	hashes := make([]uint64, len(tokens)-d.K+1)
+	for i := range hashes {
+		hashes[i] = hashTokens(tokens[i : i+d.K])
+	}
+	w := d.W
+	if w > len(hashes) {
+		w = len(hashes)
+	}
+	last := -1
+	for start := 0; start+w <= len(hashes); start++ {
+		min := start
+		for i := start; i < start+w; i++ {
+			if hashes[i] <= hashes[min] {
+				min = i
+			}
+		}
+		if min == last {
+			continue
+		}
+		last = min
+		if _, seen := prints[hashes[min]]; !seen {
+			prints[hashes[min]] = min
+		}
+	}
+	return prints
+}
+
+// Ignore makes the detector disregard what sources share with src, like
+// the solution template every candidate starts from.
+func (d *Detector) Ignore(lang, src string) {
+	for h := range d.fingerprints(Tokenize(lang, src)) {
+		d.ignore[h] = true
+	}
+}
+
+// Add adds the source id, written in lang, to those compared.
+func (d *Detector) Add(id, lang, src string) {
+	tokens := Tokenize(lang, src)
+	prints := d.fingerprints(tokens)
+	for h := range prints {
+		if d.ignore[h] {
+			delete(prints, h)
+		}
+	}
+	d.docs = append(d.docs, &document{id: id, family: lexer.Family(lang), tokens: tokens, prints: prints})
+}
+
+// Compare returns the similarity of the sources added as a and b, or nil
+// if one of them is unknown.
+func (d *Detector) Compare(a, b string) *Pair {
+	var docA, docB *document
+	for _, doc := range d.docs {
+		if doc.id == a {
+			docA = doc
+		}
+		if doc.id == b {
+			docB = doc
+		}
+	}
+	if docA == nil || docB == nil {
+		return nil
+	}
+	return d.compare(docA, docB)
+}
+
+// anchor is a fingerprint found at token A of one source and B of another.
+type anchor struct{ a, b int }
+
+func (d *Detector) compare(a, b *document) *Pair {
+	pair := &Pair{A: a.id, B: b.id, Matches: []Match{}}
+	anchors := []anchor{}
+	for h, posA := range a.prints {
+		if posB, ok := b.prints[h]; ok {
+			anchors = append(anchors, anchor{posA, posB})
+		}
+	}
+	smaller := len(a.prints)
+	if len(b.prints) < smaller {
+		smaller = len(b.prints)
+	}
+	if smaller == 0 || len(anchors) == 0 {
+		return pair
+	}
+	pair.Similarity = float64(len(anchors)) / float64(smaller)
+
+	// Anchors whose k-grams overlap or touch in both sources belong to
+	// the same copied region.
+	sort.Slice(anchors, func(i, j int) bool {
+		if anchors[i].a != anchors[j].a {
+			return anchors[i].a < anchors[j].a
+		}
+		return anchors[i].b < anchors[j].b
+	})
+	type span struct{ a0, a1, b0, b1 int }
+	spans := []span{}
+	for _, an := range anchors {
+		if n := len(spans); n > 0 {
+			s := &spans[n-1]
+			if an.a <= s.a1+d.K && an.b >= s.b0-d.K && an.b <= s.b1+d.K {
+				if an.a > s.a1 {
+					s.a1 = an.a
+				}
+				if an.b < s.b0 {
+					s.b0 = an.b
+				}
+				if an.b > s.b1 {
+					s.b1 = an.b
+				}
+				continue
+			}
+		}
+		spans = append(spans, span{an.a, an.a, an.b, an.b})
+	}
+	for _, s := range spans {
+		pair.Matches = append(pair.Matches, Match{
+			A: Region{a.tokens[s.a0].Line, a.tokens[s.a1+d.K-1].Line},
+			B: Region{b.tokens[s.b0].Line, b.tokens[s.b1+d.K-1].Line},
+		})
+	}
+	return pair
+}
+
+// Pairs compares every two sources of the same language and returns the
+// pairs at least threshold similar, the most similar first.
+func (d *Detector) Pairs(threshold float64) []*Pair {
+	pairs := []*Pair{}
+	for i, a := range d.docs {
+		for _, b := range d.docs[i+1:] {
+			if a.family != b.family {
+				continue
+			}
+			if pair := d.compare(a, b); pair.Similarity > 0 && pair.Similarity >= threshold {
+				pairs = append(pairs, pair)
+			}
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].Similarity > pairs[j].Similarity
+	})
+	return pairs
+}
@@ -0,0 +1,136 @@
+package similarity
+
+import (
+	"reflect"
+	"testing"
+)
+
+func texts(tokens []Token) []string {
+	out := []string{}
+	for _, t := range tokens {
+		out = append(out, t.Text)
+	}
+	return out
+}
+
+func TestTokenize(t *testing.T) {
+	src := "#include <iostream>\n// count\nint main() {\n  long total = 42; /* sum\n */ s = \"a\\\"b\";\n}\n"
+	got := Tokenize("cpp", src)
+	want := []string{"int", "V", "(", ")", "{", "long", "V", "=", "N", ";", "V", "=", "S", ";", "}"}
+	if !reflect.DeepEqual(texts(got), want) {
+		t.Errorf("expected %v, got %v", want, texts(got))
+	}
+	if got[0].Line != 3 || got[10].Line != 5 || got[14].Line != 6 {
+		t.Errorf("wrong lines: %+v", got)
+	}
+
+	py := "# read\ndef solve(xs):\n    '''doc'''\n    return len(xs) + 1.5\n"
+	want = []string{"def", "V", "(", "V", ")", ":", "S", "return", "V", "(", "V", ")", "+", "N"}
+	if got := texts(Tokenize("python", py)); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+const original = `#include <iostream>
+#include <string>
+using namespace std;
+
+int count_odd(const string &s) {
+    int counts[26] = {0};
+    for (char c : s) counts[c - 'a']++;
+    int odd = 0;
+    for (int i = 0; i < 26; i++) {
+        if (counts[i] % 2 == 1) odd++;
+    }
+    return odd;
+}
+
+int main() {
+    string s;
+    while (cin >> s) {
+        cout << (count_odd(s) <= 1 ? "YES" : "NO") << endl;
+    }
+}
+`
+
+// renamed is original with other names, comments and layout.
+const renamed = `#include <bits/stdc++.h>
+using namespace std;
+// my own solution
+int oddLetters(const string &word)
+{
+    int freq[26] = {0};
+    for (char ch : word) freq[ch - 'a']++;
+    int result = 0;
+    for (int k = 0; k < 26; k++)
+    {
+        if (freq[k] % 2 == 1) result++;
+    }
+    return result;
+}
+
+int main()
+{
+    string word;
+    while (cin >> word)
+    {
+        cout << (oddLetters(word) <= 1 ? "Yes" : "No") << endl;
+    }
+}
+`
+
+const different = `#include <iostream>
+#include <map>
+using namespace std;
+int main() {
+    string s;
+    while (cin >> s) {
+        map<char, int> m;
+        for (size_t i = 0; i < s.size(); ++i) m[s[i]] ^= 1;
+        int n = 0;
+        for (auto &kv : m) n += kv.second;
+        if (n > 1) cout << "NO" << endl; else cout << "YES" << endl;
+    }
+    return 0;
+}
+`
+
+func TestPairs(t *testing.T) {
+	d := NewDetector(0, 0)
+	d.Add("original", "cpp", original)
+	d.Add("renamed", "c", renamed)
+	d.Add("different", "cpp", different)
+	d.Add("python", "python", "def main():\n    pass\n")
+
+	pairs := d.Pairs(0.5)
+	if len(pairs) != 1 || pairs[0].A != "original" || pairs[0].B != "renamed" {
+		t.Fatalf("expected only original and renamed to be similar, got %+v", pairs)
+	}
+	if pairs[0].Similarity < 0.9 {
+		t.Errorf("expected renaming not to hide the copy, got %.2f", pairs[0].Similarity)
+	}
+	if len(pairs[0].Matches) == 0 {
+		t.Fatalf("expected matching regions")
+	}
+	first := pairs[0].Matches[0]
+	if first.A.StartLine != 3 || first.B.StartLine != 2 || first.A.EndLine < 17 || first.B.EndLine < 20 {
+		t.Errorf("expected the copy to span the whole program, got %+v", first)
+	}
+	if p := d.Compare("original", "different"); p.Similarity > 0.3 {
+		t.Errorf("expected different solutions to differ, got %.2f", p.Similarity)
+	}
+	if p := d.Compare("original", "nobody"); p != nil {
+		t.Errorf("expected no pair for unknown sources, got %+v", p)
+	}
+}
+
+func TestIgnore(t *testing.T) {
+	template := "#include <iostream>\nusing namespace std;\nint main() {\n  string s;\n  while(cin >> s) {\n    cout << s.size() << endl;\n  }\n}\n"
+	d := NewDetector(0, 0)
+	d.Ignore("cpp", template)
+	d.Add("a", "cpp", template)
+	d.Add("b", "cpp", template)
+	if pairs := d.Pairs(0); len(pairs) != 0 {
+		t.Errorf("expected the untouched templates to be ignored, got %+v", pairs)
+	}
+}
@@ -0,0 +1,41 @@
+package similarity
+
+import (
+	"github.com/maddyonline/goonj/lexer"
+)
+
+// Normalized token texts. Identifiers, numbers and strings are replaced by
+// their kind so renaming variables or changing constants does not hide a
+// copy; keywords and punctuation are kept.
+const (
+	TOKEN_IDENT  = "V"
+	TOKEN_NUMBER = "N"
+	TOKEN_STRING = "S"
+)
+
+// Token is a normalized token of a source file and the line it starts on.
+type Token struct {
+	Text string
+	Line int
+}
+
+// Tokenize splits src, written in lang, into normalized tokens, dropping
+// whitespace, comments and, in C and C++, preprocessor lines.
+func Tokenize(lang, src string) []Token {
+	tokens := []Token{}
+	for _, lx := range lexer.Lex(lang, src) {
+		text := lx.Text
+		switch lx.Kind {
+		case lexer.SPACE, lexer.COMMENT, lexer.PREPROC:
+			continue
+		case lexer.IDENT:
+			text = TOKEN_IDENT
+		case lexer.NUMBER:
+			text = TOKEN_NUMBER
+		case lexer.STRING:
+			text = TOKEN_STRING
+		}
+		tokens = append(tokens, Token{text, lx.Line})
+	}
+	return tokens
+}
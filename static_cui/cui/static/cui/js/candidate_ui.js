@@ -452,12 +452,26 @@ function CandidateUi(options)
         );
     };
 
+    self.showAnnotations = function(xml) {
+        var annotations = [];
+        $(xml).find('extra > annotation').each(function() {
+            annotations.push({
+                row: parseInt($(this).find('row').text(), 10),
+                column: parseInt($(this).find('column').text(), 10),
+                type: $(this).find('type').text(),
+                text: $(this).find('text').text()
+            });
+        });
+        self.editor.setAnnotations(annotations);
+    };
+
     self.verifyActionSuccess = function(xml) {
         var verification_ok = false;
         var _message = xmlNodeValue(xml,'response > message');
         if (_message) {
             Console.msg(_message);
         } else {
+            self.showAnnotations(xml);
             var _compile = xmlNodeValue(xml,'compile > ok');
 
             var _compile_msg = (
@@ -932,6 +946,9 @@ function CandidateUi(options)
         self.task.saved_solution = current_solution;
 
         $('#task_description').html(task_description);
+        if (window.MathJax && MathJax.typesetPromise) {
+            MathJax.typesetPromise([$('#task_description').get(0)]);
+        }
         if (!self.options.demo && !self.options.cert) self.simpleCopyProtection();
 
         $('#current_prg_lang').val(prg_lang);
@@ -972,6 +989,8 @@ function CandidateUi(options)
         }
         self.editor.setValue(current_solution);
         self.editor.clearHistory();
+        if (self.mirror)
+            self.mirror.snapshot();
         $('#example_input').val(example_input);
 
         var show_test_cases = (task_status == 'open' && prg_lang != 'sql' && !TestCases.limitReached());
@@ -1214,6 +1233,9 @@ function CandidateUi(options)
         $(window).on('focus',function() { window_focus_tracker.turnOn(); });
         $(window).on('blur',function() { window_focus_tracker.turnOff(); });
         self.trackers.push(window_focus_tracker);
+        $(window).on('focus',function() { self.reportEvent('focus'); });
+        $(window).on('blur',function() { self.reportEvent('blur'); });
+        self.watchDevtools();
 
         // tracking keypresses
         var key_tracker = new TimeTracker('keypress', self.options.time_elapsed_sec);
@@ -1225,6 +1247,7 @@ function CandidateUi(options)
         self.editor.onPasteEvent(function(e) {
             var data = e.text;
             if (self.editor.last_copy===data) return;
+            self.reportEvent('paste', data.length);
             self.editor.last_paste=data;
             setTimeout(function() {
                 var last_paste = $.trim(self.editor.last_paste);
@@ -1249,6 +1272,32 @@ function CandidateUi(options)
         });
     };
 
+    // reportEvent sends an integrity event (paste, blur, focus or devtools)
+    // for reviewers; failures are only logged.
+    self.reportEvent = function(type, size) {
+        $.ajax({
+            type: 'POST',
+            url: self.options.urls['integrity'] + self.options.ticket_id,
+            data: {type: type, task: self.task.name, size: size || 0}
+        }).fail(function(xhr) {
+            Log.error("integrity event " + type + " failed", xhr.status);
+        });
+    };
+
+    // watchDevtools reports the developer tools being opened, guessed from
+    // the gap between the outer and inner size of a docked panel.
+    self.watchDevtools = function() {
+        var open = false;
+        var check = function() {
+            var docked = window.outerWidth - window.innerWidth > 160 ||
+                window.outerHeight - window.innerHeight > 160;
+            if (docked && !open) self.reportEvent('devtools');
+            open = docked;
+        };
+        $(window).on('resize', check);
+        check();
+    };
+
     self.addPlugin = function (plugin) {
         if (self.plugins.indexOf(plugin) !== -1) {
             throw new Error("Trying to load previously loaded plugin");
@@ -1343,6 +1392,11 @@ function CandidateUi(options)
 
     self.initTask = function() {
         Clock.init(self.options.ticket_id, self.options.urls['clock'], self.options.time_remaining_sec, self.options.time_elapsed_sec);
+        if (self.options.urls['mirror'] && window.WebSocket) {
+            self.mirror = Mirror(self.options.urls['mirror'] + self.options.ticket_id, self.editor, function() {
+                return {task: self.task.name, prg_lang: self.task.prg_lang};
+            });
+        }
 
         self.reloadTask();
         if (self.options.save_often)
@@ -1377,8 +1431,8 @@ function CandidateUi(options)
         if (!self.options.demo && !self.options.cert) self.setupTrackers();
         TestCases.init();
 
-        if (self.options.show_chat)
-            self.chat = Chat(self.options.support_email);
+        if (self.options.show_chat && self.options.urls['chat'])
+            self.chat = Chat(self.options.urls['chat'] + self.options.ticket_id, self.options.support_email);
         //size editor and task description pane properly
         self.updatePageLayout();
 
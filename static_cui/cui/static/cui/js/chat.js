@@ -21,72 +21,164 @@
 */
 
 /* global Log, Console */
-/* global olark */
-/* global ui */
 
-// Olark-based chat for CUI.
-// Requires the standard Olark code to be loaded.
+// Chat between the candidate and the interviewer, served by the CUI server
+// itself. Messages are posted to url and long-polled from it; the server
+// keeps them in the transcript of the ticket.
 
-function Chat(support_email) {
+var CHAT_POLL_TIMEOUT = 35*1000;
+var CHAT_RETRY_PERIOD = 5*1000;
+
+function Chat(url, support_email) {
     var self = {
         available: false,
         expanded: false,
         shown: false,
         support_email: support_email,
+        url: url,
+        seq: 0,
+        unread: 0,
+        closed: false,
     };
 
+    var $chat = $('#chat');
+    var $messages = $chat.find('.chat-messages');
+    var $input = $chat.find('input[name=text]');
+
     self.init = function() {
-        olark('api.chat.onOperatorsAvailable', function() { self.available = true; });
-        olark('api.chat.onOperatorsAway', function() { self.available = false; });
-        olark('api.box.onExpand', function() { self.expanded = true; });
-        olark('api.box.onShrink', function() { self.expanded = false; });
-        olark('api.box.onShow', function() { self.shown = true; });
-        olark('api.box.onHide', function() { self.shown = false; });
-
-        olark('api.visitor.updateCustomFields', {
-            report_url: window.location.host + '/tickets/' + ui.options.ticket_id
+        $chat.find('.chat-header').click(function() {
+            if (self.expanded)
+                self.shrink();
+            else
+                self.expand();
         });
+        $chat.find('.chat-form').submit(function(e) {
+            e.preventDefault();
+            var text = $.trim($input.val());
+            if (text !== '')
+                self.send(text);
+        });
+        self.show();
+        self.poll();
     };
 
-    // Wait until the chat window is loaded and expanded, then execute onReady.
-    self.waitUntilReady = function(onReady, onFailure) {
-        var n_tries = 15, interval = 300;
-        function poll() {
-            if (self.shown && self.expanded)
-                onReady();
-            else if (n_tries-- > 0)
-                setTimeout(poll, interval);
-            else
-                onFailure();
-        }
+    self.show = function() {
+        $chat.show();
+        self.shown = true;
+    };
+
+    self.expand = function() {
+        $chat.addClass('expanded');
+        self.expanded = true;
+        self.unread = 0;
+        self.updateUnread();
+        $messages.scrollTop($messages.prop('scrollHeight'));
+    };
+
+    self.shrink = function() {
+        $chat.removeClass('expanded');
+        self.expanded = false;
+    };
+
+    self.updateUnread = function() {
+        $chat.find('.chat-unread').text(self.unread > 0 ? '(' + self.unread + ')' : '');
+    };
+
+    self.render = function(msg) {
+        var who = msg.from == 'candidate' ? 'You' : (msg.author || 'Interviewer');
+        var $msg = $('<div class="chat-message">').addClass('chat-' + msg.from);
+        $msg.append($('<span class="chat-author">').text(who + ': '));
+        $msg.append($('<span class="chat-text">').text(msg.text));
+        $messages.append($msg);
+        $messages.scrollTop($messages.prop('scrollHeight'));
+    };
+
+    self.receive = function(messages) {
+        $.each(messages, function(i, msg) {
+            if (msg.seq <= self.seq)
+                return;
+            self.seq = msg.seq;
+            self.render(msg);
+            if (msg.from != 'candidate' && !self.expanded) {
+                self.unread++;
+                self.updateUnread();
+                self.pulse();
+            }
+        });
+    };
 
-        poll();
+    self.poll = function() {
+        $.ajax({
+            url: self.url,
+            data: {after: self.seq},
+            dataType: 'json',
+            timeout: CHAT_POLL_TIMEOUT,
+            success: function(data) {
+                self.available = true;
+                self.receive(data.messages);
+                if (data.closed) {
+                    self.closed = true;
+                    $input.prop('disabled', true);
+                    return;
+                }
+                setTimeout(self.poll, 0);
+            },
+            error: function() {
+                setTimeout(self.poll, CHAT_RETRY_PERIOD);
+            }
+        });
+    };
+
+    self.send = function(text) {
+        $.ajax({
+            url: self.url,
+            type: 'POST',
+            data: {text: text},
+            dataType: 'json',
+            success: function(msg) {
+                $input.val('');
+                self.receive([msg]);
+            },
+            error: function(xhr) {
+                var reason = xhr.statusText;
+                try {
+                    reason = JSON.parse(xhr.responseText).error || reason;
+                } catch (e) {}
+                Console.msg_error("Your message could not be sent: " + $('<span>').text(reason).html());
+            }
+        });
     };
 
     self.pulse = function() {
-        $('#habla_window_div').animate({
-            'transform': 'scale(1.2)'
+        $chat.find('.chat-header').animate({
+            'transform': 'scale(1.1)'
         }, 200).animate({
             'transform': 'scale(1)'
         }, 200);
     };
 
     self.fail = function(err) {
-        Console.msg_error("Sorry, loading the chat failed.<br>" +
-                          "If you require assistance, please contact " +
-                          "<a href='mailto:" + self.support_email +
-                          "' target=_blank>" + self.support_email + "</a>.");
+        var msg = "Sorry, the chat is not available right now.";
+        if (self.support_email)
+            msg += "<br>If you require assistance, please contact " +
+                   "<a href='mailto:" + self.support_email +
+                   "' target=_blank>" + self.support_email + "</a>.";
+        Console.msg_error(msg);
         Log.error("couldn't load candidate chat", err);
     };
 
-    // DWIM: show Olark chat and attract user's attention.
+    // Show the chat, open it and attract the user's attention.
     self.activate = function() {
+        if (self.closed) {
+            self.fail('the ticket is closed');
+            return;
+        }
         if (!self.shown)
-            olark('api.box.show');
+            self.show();
         if (!self.expanded)
-            olark('api.box.expand');
-
-        self.waitUntilReady(self.pulse, self.fail);
+            self.expand();
+        $input.focus();
+        self.pulse();
     };
 
     self.init();
@@ -79,6 +79,14 @@ function Editor() {
     self.setNoNewLines = function() {};
     self.setReadOnlyRegions = function() {};
     self.enforceReadOnlyRegions = function() {};
+    self.setAnnotations = function(annotations) {};
+    self.getText = function() {
+        return $('#solution').val();
+    };
+    self.onDelta = function(f) {};
+    self.applyDelta = function(delta) {};
+    self.setCursor = function(position) {};
+    self.onCursorEvent = function(f) {};
 
     return self;
 }
@@ -188,6 +196,42 @@ function AceEditor() {
         self.ace.on('change', f);
     };
 
+    // annotations are {row, column, type, text} with 0-based rows and columns
+    self.setAnnotations = function(annotations) {
+        self.ace.getSession().setAnnotations(annotations);
+    };
+
+    // Deltas are {action: 'insert'|'remove', start, end, text} whatever the
+    // version of Ace; see mirror.js.
+    self.getText = function() {
+        return self.ace.getValue();
+    };
+    self.onDelta = function(f) {
+        self.ace.getSession().getDocument().on('change', function(e) {
+            var d = e.data;
+            var insert = d.action.indexOf('insert') === 0;
+            var text = d.lines ? d.lines.join('\n') + '\n' : d.text;
+            f({action: insert ? 'insert' : 'remove', start: d.range.start, end: d.range.end,
+               text: insert ? text : undefined});
+        });
+    };
+    self.applyDelta = function(delta) {
+        var doc = self.ace.getSession().getDocument();
+        if (delta.action == 'insert')
+            doc.insert(delta.start, delta.text);
+        else
+            doc.remove(new self.Range(delta.start.row, delta.start.column, delta.end.row, delta.end.column));
+    };
+    self.setCursor = function(position) {
+        self.ace.moveCursorToPosition(position);
+        self.ace.clearSelection();
+    };
+    self.onCursorEvent = function(f) {
+        self.ace.getSession().getSelection().on('changeCursor', function() {
+            f(self.ace.getCursorPosition());
+        });
+    };
+
     /* Input Restriction */
     self.markers = [];
     self.readOnlyRanges = [];
@@ -0,0 +1,117 @@
+/* global Log */
+
+// Live mirroring of the candidate's editor to interviewers, see the mirror
+// package of the server. The candidate sends a snapshot of the editor when
+// it connects and when the server asks for one, and numbered deltas in
+// between. Both sides reconnect with exponential backoff.
+
+var MIRROR_MIN_RETRY = 1000;
+var MIRROR_MAX_RETRY = 30*1000;
+var MIRROR_CURSOR_PERIOD = 250;
+
+function mirrorSocketUrl(path) {
+    var scheme = window.location.protocol == 'https:' ? 'wss://' : 'ws://';
+    return scheme + window.location.host + path;
+}
+
+function MirrorSocket(url, onopen, onmessage) {
+    var self = {socket: null, retry: MIRROR_MIN_RETRY, stopped: false};
+
+    self.send = function(msg) {
+        if (self.socket && self.socket.readyState === 1)
+            self.socket.send(JSON.stringify(msg));
+    };
+
+    self.connect = function() {
+        var socket = new WebSocket(url);
+        self.socket = socket;
+        socket.onopen = function() {
+            self.retry = MIRROR_MIN_RETRY;
+            onopen();
+        };
+        socket.onmessage = function(e) {
+            var msg = JSON.parse(e.data);
+            if (msg.type == 'error') {
+                Log.error('mirror', msg.text);
+                self.stopped = true;
+                return;
+            }
+            onmessage(msg);
+        };
+        socket.onclose = function() {
+            if (self.socket !== socket || self.stopped)
+                return;
+            self.socket = null;
+            setTimeout(self.connect, self.retry);
+            self.retry = Math.min(self.retry * 2, MIRROR_MAX_RETRY);
+        };
+    };
+
+    return self;
+}
+
+// Mirror streams editor to the server. state() returns the current task
+// and programming language.
+function Mirror(url, editor, state) {
+    var self = {seq: 0, cursor: null};
+
+    self.snapshot = function() {
+        var s = state();
+        self.seq += 1;
+        self.socket.send({type: 'snapshot', seq: self.seq, task: s.task, prg_lang: s.prg_lang,
+                          text: editor.getText(), cursor: self.cursor});
+    };
+
+    self.socket = MirrorSocket(mirrorSocketUrl(url), self.snapshot, function(msg) {
+        if (msg.type == 'resync')
+            self.snapshot();
+    });
+
+    editor.onDelta(function(delta) {
+        self.seq += 1;
+        self.socket.send({type: 'delta', seq: self.seq, delta: delta});
+    });
+
+    var cursorTimer = null;
+    editor.onCursorEvent(function(position) {
+        self.cursor = position;
+        if (cursorTimer === null) {
+            cursorTimer = setTimeout(function() {
+                cursorTimer = null;
+                self.socket.send({type: 'cursor', seq: self.seq, cursor: self.cursor});
+            }, MIRROR_CURSOR_PERIOD);
+        }
+    });
+
+    self.socket.connect();
+    return self;
+}
+
+// MirrorObserver shows the mirrored editor in a read-only editor and calls
+// status with the latest message and the task being shown.
+function MirrorObserver(url, editor, status) {
+    var self = {task: null, prg_lang: null};
+
+    self.socket = MirrorSocket(mirrorSocketUrl(url), function() {}, function(msg) {
+        switch (msg.type) {
+        case 'snapshot':
+            self.task = msg.task;
+            self.prg_lang = msg.prg_lang;
+            editor.setPrgLang(msg.prg_lang);
+            editor.setValue(msg.text || '');
+            if (msg.cursor)
+                editor.setCursor(msg.cursor);
+            break;
+        case 'delta':
+            editor.applyDelta(msg.delta);
+            break;
+        case 'cursor':
+            editor.setCursor(msg.cursor);
+            break;
+        }
+        status(msg, self);
+    });
+
+    self.socket.connect();
+    return self;
+}
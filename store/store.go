@@ -0,0 +1,188 @@
+// Package store upgrades the work directory written by older versions of
+// goonj, so that the sessions and submissions it holds load as the current
+// version expects.
+//
+// The version of the work directory is kept in store.json. Each migration
+// brings it one version up; running them again does no harm.
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/maddyonline/goonj/cui"
+	"github.com/maddyonline/goonj/problem"
+	"github.com/maddyonline/goonj/submission"
+	"github.com/maddyonline/goonj/utils"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const VERSION_FILE = "store.json"
+
+type versionFile struct {
+	Version int `json:"version"`
+}
+
+// migration upgrades the store in dir by one version and returns the
+// changes it made, or would make when dryRun is set.
+type migration struct {
+	summary string
+	apply   func(dir string, dryRun bool) ([]string, error)
+}
+
+var migrations = []migration{
+	{"add the CUI urls and options of new features to sessions", migrateSessionOptions},
+	{"set the language and history of submissions", migrateSubmissions},
+}
+
+// VERSION is the version of the store written by this version of goonj.
+var VERSION = len(migrations)
+
+// Result is what Migrate did to a store.
+type Result struct {
+	From    int
+	To      int
+	Changes []string
+}
+
+// Version reads the version of the store in dir, 0 for stores written
+// before versions were kept.
+func Version(dir string) (int, error) {
+	content, err := ioutil.ReadFile(filepath.Join(dir, VERSION_FILE))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	v := &versionFile{}
+	if err := json.Unmarshal(content, v); err != nil {
+		return 0, fmt.Errorf("store: %s: %v", VERSION_FILE, err)
+	}
+	return v.Version, nil
+}
+
+// Migrate brings the store in dir up to VERSION. With dryRun it reports the
+// changes without making them.
+func Migrate(dir string, dryRun bool) (*Result, error) {
+	from, err := Version(dir)
+	if err != nil {
+		return nil, err
+	}
+	if from > VERSION {
+		return nil, fmt.Errorf("store: version %d is newer than this goonj, which knows version %d", from, VERSION)
+	}
+	result := &Result{From: from, To: from, Changes: []string{}}
+	for i := from; i < VERSION; i++ {
+		changes, err := migrations[i].apply(dir, dryRun)
+		if err != nil {
+			return result, fmt.Errorf("store: migrating to version %d: %v", i+1, err)
+		}
+		result.Changes = append(result.Changes, changes...)
+		if !dryRun {
+			content, _ := json.Marshal(&versionFile{Version: i + 1})
+			if err := utils.UpdateFile(filepath.Join(dir, VERSION_FILE), string(content)); err != nil {
+				return result, err
+			}
+		}
+		result.To = i + 1
+	}
+	return result, nil
+}
+
+// migrateSessionOptions adds the urls the CUI gained since a session was
+// saved, and shows the chat, which defaults to shown, unless the session
+// says otherwise.
+func migrateSessionOptions(dir string, dryRun bool) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*", cui.SESSION_FILE))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	defaults := cui.DefaultOptions()
+	changes := []string{}
+	for _, path := range paths {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return changes, err
+		}
+		raw := struct {
+			Ticket struct {
+				Options map[string]json.RawMessage `json:"options"`
+			} `json:"ticket"`
+		}{}
+		session := &cui.Session{}
+		if err := json.Unmarshal(content, &raw); err != nil {
+			return changes, fmt.Errorf("%s: %v", path, err)
+		}
+		if err := json.Unmarshal(content, session); err != nil {
+			return changes, fmt.Errorf("%s: %v", path, err)
+		}
+		if session.Ticket == nil || session.Ticket.Options == nil {
+			continue
+		}
+		opts := session.Ticket.Options
+		added := []string{}
+		if opts.Urls == nil {
+			opts.Urls = map[string]string{}
+		}
+		for name, url := range defaults.Urls {
+			if _, ok := opts.Urls[name]; !ok {
+				opts.Urls[name] = strings.Replace(url, "TICKET_ID", session.Ticket.Id, -1)
+				added = append(added, "urls."+name)
+			}
+		}
+		sort.Strings(added)
+		if _, ok := raw.Ticket.Options["show_chat"]; !ok {
+			opts.ShowChat = defaults.ShowChat
+			added = append(added, "show_chat")
+		}
+		if len(added) == 0 {
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("%s: added %s", session.Ticket.Id, strings.Join(added, ", ")))
+		if !dryRun {
+			if err := cui.SaveSession(dir, session); err != nil {
+				return changes, err
+			}
+		}
+	}
+	return changes, nil
+}
+
+// migrateSubmissions sets the language of submissions saved without one
+// from the name of their solution, and starts their history.
+func migrateSubmissions(dir string, dryRun bool) ([]string, error) {
+	store := submission.NewStore(dir)
+	subs, err := store.List("", "")
+	if err != nil {
+		return nil, err
+	}
+	changes := []string{}
+	for _, sub := range subs {
+		set := []string{}
+		if sub.Language == "" {
+			if sub.Language = problem.LanguageForFile(sub.Filename); sub.Language == "" {
+				return changes, fmt.Errorf("submission %s/%s: unknown language of %s", sub.TicketId, sub.TaskId, sub.Filename)
+			}
+			set = append(set, "language "+sub.Language)
+		}
+		if sub.History == nil {
+			sub.History = []submission.Verdict{}
+			set = append(set, "history")
+		}
+		if len(set) == 0 {
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("%s/%s: set %s", sub.TicketId, sub.TaskId, strings.Join(set, ", ")))
+		if !dryRun {
+			if err := store.Save(sub); err != nil {
+				return changes, err
+			}
+		}
+	}
+	return changes, nil
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"github.com/maddyonline/goonj/cui"
+	"github.com/maddyonline/goonj/submission"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// An old session: the CUI had neither the mirror, the chat nor integrity
+// events, and show_chat did not exist.
+const OLD_SESSION = `{
+  "ticket": {
+    "id": "OLD",
+    "options": {
+      "ticket_id": "OLD",
+      "task_names": ["upper"],
+      "urls": {"close": "/c/close/OLD", "submit_survey": "/surveys/_ajax_submit_candidate_survey/OLD/"}
+    }
+  },
+  "time_limit_sec": 3600
+}`
+
+const OLD_SUBMISSION = `{"ticket_id": "OLD", "task_id": "upper", "filename": "upper-main.cpp", "score": null}`
+
+func writeFile(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goonj-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, "OLD", cui.SESSION_FILE), OLD_SESSION)
+	writeFile(t, filepath.Join(dir, "OLD", "upper", submission.SUBMISSION_FILE), OLD_SUBMISSION)
+
+	result, err := Migrate(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.From != 0 || result.To != VERSION || len(result.Changes) != 2 {
+		t.Fatalf("expected a session and a submission to change, got %+v", result)
+	}
+	if v, _ := Version(dir); v != 0 {
+		t.Errorf("a dry run must not change the store, got version %d", v)
+	}
+
+	if _, err := Migrate(dir, false); err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := cui.LoadSessions(dir)
+	if err != nil || len(sessions) != 1 {
+		t.Fatalf("expected the session, got %v, %v", sessions, err)
+	}
+	opts := sessions[0].Ticket.Options
+	if !opts.ShowChat || opts.Urls["chat"] != "/c/chat/" || opts.Urls["close"] != "/c/close/OLD" {
+		t.Errorf("expected the chat and its url, got %v %v", opts.ShowChat, opts.Urls)
+	}
+	sub, err := submission.NewStore(dir).Load("OLD", "upper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.Language != "cpp" || sub.History == nil {
+		t.Errorf("expected the language and history to be set, got %+v", sub)
+	}
+
+	if v, _ := Version(dir); v != VERSION {
+		t.Errorf("expected version %d, got %d", VERSION, v)
+	}
+	if result, err := Migrate(dir, false); err != nil || len(result.Changes) != 0 {
+		t.Errorf("expected nothing left to migrate, got %+v, %v", result, err)
+	}
+}
+
+func TestMigrateKeepsHiddenChat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goonj-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, "T", cui.SESSION_FILE), `{"ticket": {"id": "T", "options": {"show_chat": false, "urls": {}}}}`)
+	if _, err := Migrate(dir, false); err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := cui.LoadSessions(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts := sessions[0].Ticket.Options; opts.ShowChat || opts.Urls["integrity"] != "/c/integrity/" {
+		t.Errorf("expected the chat hidden and the urls added, got %v %v", opts.ShowChat, opts.Urls)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/maddyonline/goonj/config"
+	"github.com/maddyonline/goonj/store"
+	"os"
+)
+
+// storeCommand implements `goonj store`.
+func storeCommand(args []string) int {
+	return dispatch("goonj store", []command{
+		{"migrate", "upgrade the work directory to this version of goonj", storeMigrateCommand},
+	}, args)
+}
+
+func storeMigrateCommand(args []string) int {
+	flags := flag.NewFlagSet("store migrate", flag.ExitOnError)
+	configFile := flags.String("config", "", "Path to TOML config file")
+	dryRun := flags.Bool("dry-run", false, "Print the changes without making them")
+	flags.Parse(args)
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	result, err := store.Migrate(cfg.Storage.WorkDir, *dryRun)
+	if result != nil {
+		for _, change := range result.Changes {
+			fmt.Println(change)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	switch {
+	case result.From == result.To:
+		fmt.Printf("The store in %s is up to date (version %d).\n", cfg.Storage.WorkDir, result.To)
+	case *dryRun:
+		fmt.Printf("Would migrate the store in %s from version %d to %d, %d changes.\n", cfg.Storage.WorkDir, result.From, result.To, len(result.Changes))
+	default:
+		fmt.Printf("Migrated the store in %s from version %d to %d, %d changes.\n", cfg.Storage.WorkDir, result.From, result.To, len(result.Changes))
+	}
+	return 0
+}
@@ -0,0 +1,90 @@
+package submission
+
+import (
+	"github.com/labstack/gommon/log"
+	"github.com/maddyonline/goonj/utils"
+	"sync"
+	"time"
+)
+
+const (
+	JOB_QUEUED  = "queued"
+	JOB_RUNNING = "running"
+	JOB_DONE    = "done"
+	JOB_FAILED  = "failed"
+)
+
+// Job is a rejudge request waiting in or processed by a Queue.
+type Job struct {
+	Id       string    `json:"id"`
+	TicketId string    `json:"ticket_id,omitempty"`
+	TaskId   string    `json:"task_id,omitempty"`
+	Status   string    `json:"status"`
+	Created  time.Time `json:"created"`
+	Finished time.Time `json:"finished,omitempty"`
+	Results  []Result  `json:"results"`
+	Err      string    `json:"error,omitempty"`
+}
+
+// Queue rejudges submissions in the background, one job at a time, so
+// rejudging a whole problem does not hold up candidates.
+type Queue struct {
+	rejudger *Rejudger
+	pending  chan *Job
+	mu       sync.Mutex
+	jobs     map[string]*Job
+}
+
+// QUEUE_SIZE is the number of jobs that may wait before Submit blocks.
+const QUEUE_SIZE = 100
+
+// NewQueue starts a queue processing jobs with r.
+func NewQueue(r *Rejudger) *Queue {
+	q := &Queue{rejudger: r, pending: make(chan *Job, QUEUE_SIZE), jobs: map[string]*Job{}}
+	go q.work()
+	return q
+}
+
+// Submit queues the rejudging of the submissions of ticketId or taskId.
+func (q *Queue) Submit(ticketId, taskId string) *Job {
+	job := &Job{Id: utils.RandId(), TicketId: ticketId, TaskId: taskId, Status: JOB_QUEUED, Created: time.Now().UTC(), Results: []Result{}}
+	q.mu.Lock()
+	q.jobs[job.Id] = job
+	q.mu.Unlock()
+	q.pending <- job
+	return q.Get(job.Id)
+}
+
+// Get returns a copy of the job with id, nil if there is none.
+func (q *Queue) Get(id string) *Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return nil
+	}
+	snapshot := *job
+	return &snapshot
+}
+
+func (q *Queue) locked(f func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	f()
+}
+
+func (q *Queue) work() {
+	for job := range q.pending {
+		q.locked(func() { job.Status = JOB_RUNNING })
+		results, err := q.rejudger.RejudgeAll(job.TicketId, job.TaskId)
+		q.locked(func() {
+			job.Finished = time.Now().UTC()
+			if err != nil {
+				job.Status, job.Err = JOB_FAILED, err.Error()
+			} else {
+				job.Status, job.Results = JOB_DONE, results
+			}
+		})
+		log.Info("Rejudge job %s finished with %d results, err=%v", job.Id, len(results), err)
+	}
+}
@@ -0,0 +1,106 @@
+package submission
+
+import (
+	"errors"
+	"fmt"
+	"github.com/labstack/gommon/log"
+	"github.com/maddyonline/goonj/judge"
+	"github.com/maddyonline/goonj/problem"
+	"time"
+)
+
+var ErrNoProblem = errors.New("the task does not come from the problem bank")
+
+// Rejudger judges stored submissions again on the latest published version
+// of their problem.
+type Rejudger struct {
+	Store    *Store
+	Bank     *problem.Bank
+	Run      judge.RunFunc
+	Interact judge.InteractFunc
+	// Rejudged, when set, is called with every submission judged again,
+	// so that the server can update the tasks it holds.
+	Rejudged func(sub *Submission)
+}
+
+// Rejudge scores sub on the current tests of its problem and adds the
+// verdict to its history. Failures to judge are recorded in the history
+// too, leaving the score as it was.
+func (r *Rejudger) Rejudge(sub *Submission) (*Verdict, error) {
+	if sub.ProblemId == "" {
+		return nil, ErrNoProblem
+	}
+	verdict := &Verdict{Time: time.Now().UTC()}
+	if sub.Score != nil {
+		verdict.OldScore = sub.Score.Score
+	}
+	verdict.NewScore = verdict.OldScore
+	score, version, err := r.score(sub)
+	verdict.Version = version
+	if err != nil {
+		verdict.Err = err.Error()
+	} else {
+		verdict.NewScore = score.Score
+		sub.Score = score
+		sub.Version = version
+	}
+	sub.History = append(sub.History, *verdict)
+	if err := r.Store.Save(sub); err != nil {
+		return nil, err
+	}
+	log.Info("Rejudged %s/%s on %s version %d: %d -> %d %s", sub.TicketId, sub.TaskId, sub.ProblemId, version, verdict.OldScore, verdict.NewScore, verdict.Err)
+	if r.Rejudged != nil {
+		r.Rejudged(sub)
+	}
+	return verdict, nil
+}
+
+func (r *Rejudger) score(sub *Submission) (*judge.Score, int, error) {
+	p, err := r.Bank.Get(sub.ProblemId, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	soln, err := r.Store.Solution(sub)
+	if err != nil {
+		return nil, p.Version, err
+	}
+	groups, err := judge.ProblemGroups(p, r.Run)
+	if err != nil {
+		return nil, p.Version, err
+	}
+	evaluate, err := judge.ProblemEvaluator(p, soln, r.Run, r.Interact)
+	if err != nil {
+		return nil, p.Version, err
+	}
+	score, err := judge.ScoreGroups(groups, evaluate)
+	return score, p.Version, err
+}
+
+// Result is the outcome of judging one submission again.
+type Result struct {
+	TicketId string   `json:"ticket_id"`
+	TaskId   string   `json:"task_id"`
+	Verdict  *Verdict `json:"verdict,omitempty"`
+	Err      string   `json:"error,omitempty"`
+}
+
+// RejudgeAll judges again the submissions of ticketId, or of taskId in
+// every ticket, and reports each of them.
+func (r *Rejudger) RejudgeAll(ticketId, taskId string) ([]Result, error) {
+	if ticketId == "" && taskId == "" {
+		return nil, fmt.Errorf("rejudge: a ticket or task id is required")
+	}
+	subs, err := r.Store.List(ticketId, taskId)
+	if err != nil {
+		return nil, err
+	}
+	results := []Result{}
+	for _, sub := range subs {
+		result := Result{TicketId: sub.TicketId, TaskId: sub.TaskId}
+		if result.Verdict, err = r.Rejudge(sub); err != nil {
+			result.Err = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,133 @@
+// Package submission keeps the final submissions of candidates and judges
+// them again when the tests or checker of their problem change.
+//
+// Each submission lives in the work directory next to the solution file
+// the server stored, as TICKET/TASK/submission.json, together with the
+// history of its verdicts.
+package submission
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/maddyonline/code"
+	"github.com/maddyonline/goonj/judge"
+	"github.com/maddyonline/goonj/utils"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const SUBMISSION_FILE = "submission.json"
+
+// Verdict is one judgement of a submission. Version is the version of the
+// problem whose tests were used; OldScore is the score it replaced.
+type Verdict struct {
+	Time     time.Time `json:"time"`
+	Version  int       `json:"version,omitempty"`
+	OldScore int       `json:"old_score"`
+	NewScore int       `json:"new_score"`
+	Err      string    `json:"error,omitempty"`
+}
+
+// Submission is a final solution of a task. ProblemId is empty for tasks
+// that do not come from the problem bank, which cannot be judged again.
+type Submission struct {
+	TicketId  string `json:"ticket_id"`
+	TaskId    string `json:"task_id"`
+	ProblemId string `json:"problem_id,omitempty"`
+	Version   int    `json:"version,omitempty"`
+	// Language is the runner language of the solution in Filename.
+	Language  string       `json:"language"`
+	Filename  string       `json:"filename"`
+	Finalized time.Time    `json:"finalized"`
+	Score     *judge.Score `json:"score"`
+	History   []Verdict    `json:"history"`
+}
+
+// Store reads and writes submissions under Dir.
+type Store struct {
+	Dir string
+	mu  sync.Mutex
+}
+
+func NewStore(dir string) *Store {
+	return &Store{Dir: dir}
+}
+
+func (s *Store) path(ticketId, taskId string) string {
+	return filepath.Join(s.Dir, ticketId, taskId, SUBMISSION_FILE)
+}
+
+func (s *Store) Save(sub *Submission) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	content, err := json.MarshalIndent(sub, "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.UpdateFile(s.path(sub.TicketId, sub.TaskId), string(content))
+}
+
+func (s *Store) Load(ticketId, taskId string) (*Submission, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return readSubmission(s.path(ticketId, taskId))
+}
+
+func readSubmission(path string) (*Submission, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sub := &Submission{}
+	if err := json.Unmarshal(content, sub); err != nil {
+		return nil, fmt.Errorf("submission: %s: %v", path, err)
+	}
+	return sub, nil
+}
+
+// List returns the submissions of ticketId, or of taskId in any ticket,
+// ordered by ticket and task. Empty ids match everything.
+func (s *Store) List(ticketId, taskId string) ([]*Submission, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pattern := s.path("*", "*")
+	if ticketId != "" || taskId != "" {
+		match := func(id string) string {
+			if id == "" {
+				return "*"
+			}
+			return id
+		}
+		pattern = s.path(match(ticketId), match(taskId))
+	}
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	subs := []*Submission{}
+	for _, path := range paths {
+		sub, err := readSubmission(path)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+// Solution reads the solution of sub.
+func (s *Store) Solution(sub *Submission) (*code.Input, error) {
+	content, err := ioutil.ReadFile(filepath.Join(s.Dir, sub.TicketId, sub.TaskId, sub.Filename))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("submission %s/%s: the solution %s is missing", sub.TicketId, sub.TaskId, sub.Filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return code.MakeInput(sub.Language, sub.Filename, string(content), code.StdinFile("")), nil
+}
@@ -0,0 +1,87 @@
+package submission
+
+import (
+	"github.com/maddyonline/code"
+	"github.com/maddyonline/goonj/judge"
+	"github.com/maddyonline/goonj/problem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// upperRun runs a reference that upper-cases its input and a candidate
+// solution that only gets inputs without "b" right.
+func upperRun(prog *code.Input, stdin string) (string, error) {
+	filename, _ := problem.Source(prog)
+	switch {
+	case filename == "reference.py", !strings.Contains(stdin, "b"):
+		return strings.ToUpper(stdin), nil
+	}
+	return stdin, nil
+}
+
+func TestRejudgeRecordsHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goonj-submissions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bank, err := problem.NewBank(filepath.Join(dir, "bank"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &problem.Problem{
+		Manifest:  problem.Manifest{Id: "upper", Groups: []problem.Group{{Name: problem.GROUP_HIDDEN, Weight: 100, Tests: []string{"01"}}}},
+		Statement: "Upper-case the input.",
+		Generator: problem.NewProgram("generator.py", "print(1)\n"),
+		Reference: problem.NewProgram("reference.py", "print(input().upper())\n"),
+		Tests:     problem.ParseTests("aa"),
+	}
+	if _, err := bank.Publish(p); err != nil {
+		t.Fatal(err)
+	}
+	store := NewStore(dir)
+	for _, ticket := range []string{"t1", "t2"} {
+		sub := &Submission{TicketId: ticket, TaskId: "upper", ProblemId: "upper", Version: 1, Language: "cpp", Filename: "upper-main.cpp", Score: &judge.Score{Score: 100}}
+		if err := store.Save(sub); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, ticket, "upper", sub.Filename), []byte("int main() {}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if subs, err := store.List("t2", ""); err != nil || len(subs) != 1 || subs[0].TicketId != "t2" {
+		t.Fatalf("expected the submission of t2, got %v, %v", subs, err)
+	}
+
+	// The fixed test gains a case the solution gets wrong.
+	p.Tests = problem.ParseTests("aa\n---\nab")
+	p.Groups[0].Tests = []string{"01", "02"}
+	if _, err := bank.Publish(p); err != nil {
+		t.Fatal(err)
+	}
+	rejudged := 0
+	r := &Rejudger{Store: store, Bank: bank, Run: upperRun, Rejudged: func(*Submission) { rejudged++ }}
+	results, err := r.RejudgeAll("", "upper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || rejudged != 2 {
+		t.Fatalf("expected both tickets to be rejudged, got %#v", results)
+	}
+	if v := results[0].Verdict; v == nil || v.OldScore != 100 || v.NewScore != 50 || v.Version != 2 {
+		t.Errorf("expected 100 -> 50 on version 2, got %#v", results[0])
+	}
+	sub, err := store.Load("t1", "upper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.Score.Score != 50 || sub.Version != 2 || len(sub.History) != 1 {
+		t.Errorf("the stored submission was not updated: %#v", sub)
+	}
+	if _, err := r.RejudgeAll("", ""); err == nil {
+		t.Error("expected a ticket or task id to be required")
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/maddyonline/goonj/submission"
+	"io/ioutil"
+	"os"
+)
+
+// exportedSubmission is a submission with the source of its solution.
+type exportedSubmission struct {
+	*submission.Submission
+	Source string `json:"source"`
+}
+
+// submissionCommand implements `goonj submission`.
+func submissionCommand(args []string) int {
+	return dispatch("goonj submission", []command{
+		{"export", "write the final submissions and their sources as JSON", submissionExportCommand},
+	}, args)
+}
+
+func submissionExportCommand(args []string) int {
+	flags := flag.NewFlagSet("submission export", flag.ExitOnError)
+	configFile := flags.String("config", "", "Path to TOML config file")
+	ticketId := flags.String("ticket", "", "Export the submissions of this ticket")
+	taskId := flags.String("task", "", "Export the submissions of this task in every ticket")
+	output := flags.String("o", "", "Write to this file rather than to stdout")
+	flags.Parse(args)
+
+	_, _, store, err := openLocal(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	subs, err := store.List(*ticketId, *taskId)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	exported := []exportedSubmission{}
+	for _, sub := range subs {
+		input, err := store.Solution(sub)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		exported = append(exported, exportedSubmission{sub, input.Files[0].Content})
+	}
+	out, err := json.MarshalIndent(exported, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	out = append(out, '\n')
+	if *output == "" {
+		_, err = os.Stdout.Write(out)
+	} else {
+		err = ioutil.WriteFile(*output, out, 0644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if *output != "" {
+		fmt.Printf("Exported %d submissions to %s.\n", len(exported), *output)
+	}
+	return 0
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/maddyonline/code"
+	"github.com/maddyonline/goonj/config"
+	"github.com/maddyonline/goonj/cui"
+	"github.com/maddyonline/goonj/judge"
+	"github.com/maddyonline/goonj/problem"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// taskCommand implements `goonj task`, which manages the problems of the
+// bank that the tasks of tickets are created from.
+func taskCommand(args []string) int {
+	return dispatch("goonj task", []command{
+		{"import", "validate a problem directory and publish it to the bank", taskImportCommand},
+		{"validate", "check a problem directory before it goes live", taskValidateCommand},
+		{"list", "list the problems of the bank", taskListCommand},
+	}, args)
+}
+
+// reviewLocal reviews p with the runner of cfg, compiling the solution
+// templates on this machine as the server does.
+func reviewLocal(cfg *config.Config, p *problem.Problem, seed int64, timeLimit time.Duration) (*cui.Review, error) {
+	local, err := newLocal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return cui.ReviewProblem(p, cui.ReviewConfig{
+		Run:       judge.CodeRunner(code.NewRunner(cfg.Runner.Path)),
+		Interact:  local.Interact,
+		Compile:   local.CompileOnly,
+		Seed:      seed,
+		TimeLimit: timeLimit,
+	}), nil
+}
+
+// printReview prints a line per check of review, with the details of the
+// failed checks, or of all of them when verbose.
+func printReview(review *cui.Review, verbose bool) {
+	fmt.Printf("Problem %s (seed %d)\n", review.ProblemId, review.Seed)
+	for _, c := range review.Checks {
+		result := "ok"
+		switch {
+		case c.Skipped:
+			result = "skipped"
+		case !c.OK:
+			result = "FAILED"
+		}
+		fmt.Printf("  %-17s %s\n", c.Name, result)
+		if !c.OK || verbose {
+			for _, detail := range c.Details {
+				fmt.Printf("      %s\n", strings.Replace(detail, "\n", "\n      ", -1))
+			}
+		}
+	}
+}
+
+func taskImportCommand(args []string) int {
+	flags := flag.NewFlagSet("task import", flag.ExitOnError)
+	configFile := flags.String("config", "", "Path to TOML config file")
+	timeLimit := flags.Duration("time-limit", judge.DEFAULT_TIMEOUT, "Time the reference solution may take on each test")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: goonj task import [-config file] [-time-limit 10s] dir\n")
+		return 2
+	}
+
+	cfg, bank, _, err := openLocal(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	p, err := problem.Load(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	review, err := reviewLocal(cfg, p, 0, *timeLimit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if !review.OK {
+		printReview(review, false)
+		fmt.Fprintf(os.Stderr, "Not importing %s, it failed validation.\n", p.Id)
+		return 1
+	}
+	version, err := bank.Publish(p)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	fmt.Printf("Published %s@%d.\n", p.Id, version)
+	return 0
+}
+
+// taskValidateCommand implements `goonj task validate`, which reviews a
+// problem package before it goes live and prints the report, as JSON for
+// the problem review process with -json.
+func taskValidateCommand(args []string) int {
+	flags := flag.NewFlagSet("task validate", flag.ExitOnError)
+	configFile := flags.String("config", "", "Path to TOML config file")
+	seed := flags.Int64("seed", 0, "Seed of the generated inputs, random when 0")
+	timeLimit := flags.Duration("time-limit", judge.DEFAULT_TIMEOUT, "Time the reference solution may take on each test")
+	asJSON := flags.Bool("json", false, "Print the report as JSON")
+	verbose := flags.Bool("v", false, "Print the details of the checks that passed too")
+	output := flags.String("o", "", "Also write the JSON report to this file")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: goonj task validate [-config file] [-seed n] [-time-limit 10s] [-json] [-v] [-o report.json] dir\n")
+		return 2
+	}
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	p, err := problem.Load(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	review, err := reviewLocal(cfg, p, *seed, *timeLimit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if *output != "" {
+		out, err := json.MarshalIndent(review, "", "  ")
+		if err == nil {
+			err = ioutil.WriteFile(*output, append(out, '\n'), 0644)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+	}
+	if *asJSON {
+		if rc := printJSON(review); rc != 0 {
+			return rc
+		}
+	} else {
+		printReview(review, *verbose)
+	}
+	if !review.OK {
+		return 1
+	}
+	return 0
+}
+
+func taskListCommand(args []string) int {
+	flags := flag.NewFlagSet("task list", flag.ExitOnError)
+	configFile := flags.String("config", "", "Path to TOML config file")
+	flags.Parse(args)
+
+	_, bank, _, err := openLocal(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	manifests, err := bank.List()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "PROBLEM\tVERSION\tTYPE\tTITLE\n")
+	for _, m := range manifests {
+		kind := m.Type
+		if kind == "" {
+			kind = "batch"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", m.Id, m.Version, kind, m.Title)
+	}
+	w.Flush()
+	return 0
+}
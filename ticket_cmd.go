@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/maddyonline/goonj/config"
+	"github.com/maddyonline/goonj/cui"
+	"github.com/maddyonline/goonj/problem"
+	"github.com/maddyonline/goonj/utils"
+	"github.com/maddyonline/goonj/webhook"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// WORK_DIR_LOCK is the file in the work directory locked by lockWorkDir.
+const WORK_DIR_LOCK = "goonj.lock"
+
+var errWorkDirLocked = errors.New("a server is running on the work directory; stop it first, or create tickets with POST /api/v1/tickets")
+
+// ticketCommand implements `goonj ticket`. Tickets are created and closed
+// in the work directory, which a running server would not notice, so these
+// refuse to run while the server holds the work directory.
+func ticketCommand(args []string) int {
+	return dispatch("goonj ticket", []command{
+		{"create", "create a ticket from problems of the bank", ticketCreateCommand},
+		{"list", "list the tickets", ticketListCommand},
+		{"show", "show a ticket and its scores", ticketShowCommand},
+		{"close", "close a ticket", ticketCloseCommand},
+	}, args)
+}
+
+func findSession(sessions []*cui.Session, ticketId string) *cui.Session {
+	for _, session := range sessions {
+		if session.Ticket.Id == ticketId {
+			return session
+		}
+	}
+	return nil
+}
+
+// loadSession loads the session of ticketId from the work directory of cfg.
+func loadSession(cfg *config.Config, ticketId string) (*cui.Session, error) {
+	sessions, err := cui.LoadSessions(cfg.Storage.WorkDir)
+	if err != nil {
+		return nil, err
+	}
+	session := findSession(sessions, ticketId)
+	if session == nil {
+		return nil, fmt.Errorf("no ticket %q in %s", ticketId, cfg.Storage.WorkDir)
+	}
+	return session, nil
+}
+
+// openTickets loads the config to change the tickets of its work directory
+// with, and locks the directory against a server starting meanwhile.
+func openTickets(configFile string) (*config.Config, *os.File, error) {
+	cfg, err := config.Load(configFile)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	dir, err := utils.CreateDirIfReqd(cfg.Storage.WorkDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	lock, err := lockWorkDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, lock, nil
+}
+
+// emitTicketEvent sends eventType of session to the webhooks of cfg, as the
+// server does, and waits for it to be delivered.
+func emitTicketEvent(cfg *config.Config, eventType string, session *cui.Session) error {
+	webhooks, err := newWebhookDispatcher(cfg)
+	if err != nil {
+		return err
+	}
+	webhooks.Emit(webhook.NewEvent(eventType, session.Ticket.Organisation, session.Ticket.Id, ""))
+	webhooks.Wait()
+	return nil
+}
+
+func cliExpiry(cfg *config.Config) time.Duration {
+	return time.Duration(cfg.Limits.SessionExpiry) * time.Second
+}
+
+func printJSON(v interface{}) int {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	fmt.Println(string(out))
+	return 0
+}
+
+func ticketCreateCommand(args []string) int {
+	flags := flag.NewFlagSet("ticket create", flag.ExitOnError)
+	configFile := flags.String("config", "", "Path to TOML config file")
+	organisation := flags.String("organisation", "", "Organisation the ticket is for")
+	sequential := flags.Bool("sequential", false, "Make the candidate solve the tasks in order")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: goonj ticket create [-config file] [-organisation name] [-sequential] problem[@version]...\n")
+		return 2
+	}
+
+	cfg, lock, err := openTickets(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	defer lock.Close()
+	bank, err := problem.NewBank(cfg.Storage.Bank())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	problems, err := lookupProblems(bank, flags.Args())
+	if err == nil {
+		err = checkInteractive(cfg, problems)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	ticket := cui.NewProblemTicket(map[cui.TaskKey]*cui.Task{}, problems, nil)
+	ticket.Organisation = *organisation
+	ticket.Options.Sequential = *sequential
+	session := &cui.Session{TimeLimit: cfg.Limits.TimeLimit, Created: time.Now(), Ticket: ticket}
+	if err := cui.SaveSession(cfg.Storage.WorkDir, session); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	fmt.Printf("%s\t/cui/%s\n", ticket.Id, ticket.Id)
+	if err := emitTicketEvent(cfg, webhook.TicketCreated, session); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func ticketListCommand(args []string) int {
+	flags := flag.NewFlagSet("ticket list", flag.ExitOnError)
+	configFile := flags.String("config", "", "Path to TOML config file")
+	state := flags.String("state", "", "List only the tickets in this state: created, opened, started, closed or expired")
+	asJSON := flags.Bool("json", false, "Print the tickets as JSON, as the API does")
+	flags.Parse(args)
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	sessions, err := cui.LoadSessions(cfg.Storage.WorkDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Created.Before(sessions[j].Created)
+	})
+	now := time.Now()
+	tickets := []*apiTicket{}
+	created := []time.Time{}
+	for _, session := range sessions {
+		ticket := apiTicketAt(session, now, cliExpiry(cfg))
+		if *state == "" || ticket.State == *state {
+			tickets = append(tickets, ticket)
+			created = append(created, session.Created)
+		}
+	}
+	if *asJSON {
+		return printJSON(tickets)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "TICKET\tSTATE\tCREATED\tORGANISATION\tTASKS\n")
+	for i, ticket := range tickets {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", ticket.Id, ticket.State, created[i].Format("2006-01-02 15:04"), ticket.Organisation, strings.Join(ticket.Options.TaskNames, " "))
+	}
+	w.Flush()
+	return 0
+}
+
+func ticketShowCommand(args []string) int {
+	flags := flag.NewFlagSet("ticket show", flag.ExitOnError)
+	configFile := flags.String("config", "", "Path to TOML config file")
+	asJSON := flags.Bool("json", false, "Print the ticket as JSON, as the API does")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: goonj ticket show [-config file] [-json] ticket\n")
+		return 2
+	}
+
+	cfg, _, store, err := openLocal(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	session, err := loadSession(cfg, flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	now := time.Now()
+	if *asJSON {
+		return printJSON(apiTicketAt(session, now, cliExpiry(cfg)))
+	}
+	src := &reportSource{cfg.Storage.WorkDir, store, integrityThresholds(cfg.Integrity), cliExpiry(cfg)}
+	r := src.ticketReport(session, now)
+	fmt.Printf("Ticket %s, %s\n", r.TicketId, r.State)
+	if r.Organisation != "" {
+		fmt.Printf("  organisation: %s\n", r.Organisation)
+	}
+	fmt.Printf("  created: %s\n", r.Created.Format(time.RFC3339))
+	if !r.Started.IsZero() {
+		fmt.Printf("  started: %s\n", r.Started.Format(time.RFC3339))
+	}
+	if !r.Closed.IsZero() {
+		fmt.Printf("  closed: %s\n", r.Closed.Format(time.RFC3339))
+	}
+	fmt.Printf("  time: %ds of %ds\n", r.ElapsedSec, r.TimeLimitSec)
+	fmt.Printf("  score: %s\n", r.ScoreText())
+	for _, task := range r.Tasks {
+		score := "not judged"
+		if task.Score != nil {
+			score = fmt.Sprintf("score %d", task.Score.Score)
+		}
+		if task.Language != "" {
+			score = task.Language + ", " + score
+		}
+		fmt.Printf("  task %s (%s): %s, %ds\n", task.Id, task.Problem, score, task.TimeSec)
+	}
+	if r.Integrity.Flagged {
+		fmt.Printf("  flagged: %s\n", strings.Join(r.Integrity.Reasons, "; "))
+	}
+	return 0
+}
+
+func ticketCloseCommand(args []string) int {
+	flags := flag.NewFlagSet("ticket close", flag.ExitOnError)
+	configFile := flags.String("config", "", "Path to TOML config file")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: goonj ticket close [-config file] ticket\n")
+		return 2
+	}
+
+	cfg, lock, err := openTickets(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	defer lock.Close()
+	session, err := loadSession(cfg, flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if !session.Close(time.Now()) {
+		fmt.Printf("Ticket %s was already closed.\n", session.Ticket.Id)
+		return 0
+	}
+	if err := cui.SaveSession(cfg.Storage.WorkDir, session); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	fmt.Printf("Closed ticket %s.\n", session.Ticket.Id)
+	if err := emitTicketEvent(cfg, webhook.TicketClosed, session); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	return 0
+}
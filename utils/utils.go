@@ -37,6 +37,9 @@ func CreateDirIfReqd(dir string) (string, error) {
 	return dirAbsPath, err
 }
 
+// UpdateFile replaces file with val, readable by its owner only. It writes
+// a temporary file next to it and renames it, so that a crash never leaves
+// file truncated.
 func UpdateFile(file, val string) error {
 	dir := filepath.Dir(file)
 	log.Info("creating dir %s", dir)
@@ -44,8 +47,21 @@ func UpdateFile(file, val string) error {
 	if err != nil {
 		return err
 	}
-	ioutil.WriteFile(filepath.Join(dir, filepath.Base(file)), []byte(val), 0777)
-	return nil
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(file))
+	if err != nil {
+		return err
+	}
+	_, err = tmp.WriteString(val)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(dir, filepath.Base(file)))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
 }
 
 func DefaultDir(path string) string {
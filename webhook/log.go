@@ -0,0 +1,94 @@
+package webhook
+
+import (
+	"encoding/json"
+	"github.com/labstack/gommon/log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Delivery records a single attempt to deliver an event.
+type Delivery struct {
+	EventId    string    `json:"event_id"`
+	EventType  string    `json:"event_type"`
+	TicketId   string    `json:"ticket_id"`
+	URL        string    `json:"url"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code"`
+	Delivered  bool      `json:"delivered"`
+	Error      string    `json:"error,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// DeliveryLog keeps the most recent delivery attempts in memory and, when
+// created with a file name, appends every attempt to it as a JSON line.
+type DeliveryLog struct {
+	mu      sync.Mutex
+	file    *os.File
+	entries []*Delivery
+	max     int
+}
+
+func NewDeliveryLog(filename string) (*DeliveryLog, error) {
+	l := &DeliveryLog{max: 1000}
+	if filename == "" {
+		return l, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	l.file = f
+	return l, nil
+}
+
+func (l *DeliveryLog) Add(d *Delivery) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, d)
+	if len(l.entries) > l.max {
+		l.entries = l.entries[len(l.entries)-l.max:]
+	}
+	if l.file == nil {
+		return
+	}
+	line, err := json.Marshal(d)
+	if err != nil {
+		log.Error("webhook: encoding delivery: %v", err)
+		return
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		log.Error("webhook: writing delivery log: %v", err)
+	}
+}
+
+// Entries returns the recorded attempts, optionally only those of ticketId.
+func (l *DeliveryLog) Entries(ticketId string) []*Delivery {
+	entries := []*Delivery{}
+	if l == nil {
+		return entries
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, d := range l.entries {
+		if ticketId == "" || d.TicketId == ticketId {
+			entries = append(entries, d)
+		}
+	}
+	return entries
+}
+
+func (l *DeliveryLog) Close() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
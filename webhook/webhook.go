@@ -0,0 +1,201 @@
+// Package webhook delivers ticket lifecycle events to the HTTP endpoints
+// organisations register in the config file.
+//
+// Every payload is signed with the endpoint secret; the receiver recomputes
+// HMAC-SHA256 over the request body and compares it with the
+// X-Goonj-Signature header. Failed deliveries are retried with exponential
+// backoff and every attempt is recorded in a DeliveryLog.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/gommon/log"
+	"github.com/maddyonline/goonj/utils"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	TicketCreated  = "ticket.created"
+	TicketStarted  = "ticket.started"
+	TaskFinalized  = "task.finalized"
+	TicketClosed   = "ticket.closed"
+	TicketTimedOut = "ticket.timed_out"
+)
+
+var Events = []string{TicketCreated, TicketStarted, TaskFinalized, TicketClosed, TicketTimedOut}
+
+func IsKnownEvent(name string) bool {
+	for _, ev := range Events {
+		if ev == name {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	SIGNATURE_HEADER = "X-Goonj-Signature"
+	EVENT_HEADER     = "X-Goonj-Event"
+	DELIVERY_HEADER  = "X-Goonj-Delivery"
+)
+
+type Event struct {
+	Id           string    `json:"id"`
+	Type         string    `json:"type"`
+	Time         time.Time `json:"time"`
+	Organisation string    `json:"organisation"`
+	TicketId     string    `json:"ticket_id"`
+	TaskId       string    `json:"task_id,omitempty"`
+}
+
+func NewEvent(eventType, organisation, ticketId, taskId string) *Event {
+	return &Event{
+		Id:           utils.RandId(),
+		Type:         eventType,
+		Time:         time.Now().UTC(),
+		Organisation: organisation,
+		TicketId:     ticketId,
+		TaskId:       taskId,
+	}
+}
+
+// Endpoint is a receiver registered by an organisation. An empty
+// Organisation receives the events of every organisation and an empty
+// Events list subscribes to all events.
+type Endpoint struct {
+	Organisation string
+	URL          string
+	Secret       string
+	Events       []string
+}
+
+func (ep *Endpoint) Wants(ev *Event) bool {
+	if ep.Organisation != "" && ep.Organisation != ev.Organisation {
+		return false
+	}
+	if len(ep.Events) == 0 {
+		return true
+	}
+	for _, name := range ep.Events {
+		if name == ev.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign returns the value of the signature header for body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is a valid signature of body.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+type Dispatcher struct {
+	Endpoints   []Endpoint
+	Log         *DeliveryLog
+	Client      *http.Client
+	MaxAttempts int
+	Backoff     time.Duration
+
+	pending sync.WaitGroup
+}
+
+func NewDispatcher(endpoints []Endpoint, deliveryLog *DeliveryLog) *Dispatcher {
+	return &Dispatcher{
+		Endpoints:   endpoints,
+		Log:         deliveryLog,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts: 5,
+		Backoff:     2 * time.Second,
+	}
+}
+
+// Emit sends ev to every interested endpoint in the background.
+func (d *Dispatcher) Emit(ev *Event) {
+	if d == nil {
+		return
+	}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		log.Error("webhook: encoding event %s: %v", ev.Id, err)
+		return
+	}
+	for i := range d.Endpoints {
+		ep := &d.Endpoints[i]
+		if !ep.Wants(ev) {
+			continue
+		}
+		d.pending.Add(1)
+		go d.deliver(ep, ev, body, 1)
+	}
+}
+
+// Wait blocks until every emitted event has been delivered or has
+// exhausted its attempts.
+func (d *Dispatcher) Wait() {
+	d.pending.Wait()
+}
+
+func (d *Dispatcher) deliver(ep *Endpoint, ev *Event, body []byte, attempt int) {
+	status, err := d.post(ep, ev, body)
+	delivered := err == nil && status >= 200 && status < 300
+	entry := &Delivery{
+		EventId:    ev.Id,
+		EventType:  ev.Type,
+		TicketId:   ev.TicketId,
+		URL:        ep.URL,
+		Attempt:    attempt,
+		StatusCode: status,
+		Delivered:  delivered,
+		Time:       time.Now().UTC(),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	d.Log.Add(entry)
+	if delivered || attempt >= d.MaxAttempts {
+		if !delivered {
+			log.Error("webhook: giving up on %s for event %s after %d attempts", ep.URL, ev.Id, attempt)
+		}
+		d.pending.Done()
+		return
+	}
+	delay := d.Backoff << uint(attempt-1)
+	log.Info("webhook: delivery of %s to %s failed (status=%d, err=%v), retrying in %s", ev.Id, ep.URL, status, err, delay)
+	time.AfterFunc(delay, func() {
+		d.deliver(ep, ev, body, attempt+1)
+	})
+}
+
+func (d *Dispatcher) post(ep *Endpoint, ev *Event, body []byte) (int, error) {
+	req, err := http.NewRequest("POST", ep.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EVENT_HEADER, ev.Type)
+	req.Header.Set(DELIVERY_HEADER, ev.Id)
+	req.Header.Set(SIGNATURE_HEADER, Sign(ep.Secret, body))
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
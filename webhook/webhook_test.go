@@ -0,0 +1,101 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	events   []*Event
+	bad      int
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !Verify("s3cret", body, req.Header.Get(SIGNATURE_HEADER)) {
+		r.bad++
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.failures > 0 {
+		r.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	ev := &Event{}
+	json.Unmarshal(body, ev)
+	r.events = append(r.events, ev)
+}
+
+func newTestDispatcher(url string) *Dispatcher {
+	deliveries, _ := NewDeliveryLog("")
+	d := NewDispatcher([]Endpoint{
+		{Organisation: "acme", URL: url, Secret: "s3cret", Events: []string{TicketCreated, TaskFinalized}},
+	}, deliveries)
+	d.Backoff = time.Millisecond
+	return d
+}
+
+func TestDeliverySignedAndFiltered(t *testing.T) {
+	r := &receiver{}
+	server := httptest.NewServer(r)
+	defer server.Close()
+	d := newTestDispatcher(server.URL)
+
+	d.Emit(NewEvent(TicketCreated, "acme", "ticket1", ""))
+	d.Emit(NewEvent(TicketStarted, "acme", "ticket1", ""))
+	d.Emit(NewEvent(TicketCreated, "other", "ticket2", ""))
+	d.Wait()
+
+	if r.bad != 0 {
+		t.Errorf("receiver rejected %d signatures", r.bad)
+	}
+	if len(r.events) != 1 || r.events[0].Type != TicketCreated || r.events[0].TicketId != "ticket1" {
+		t.Errorf("unexpected events received: %#v", r.events)
+	}
+}
+
+func TestDeliveryRetriedWithBackoff(t *testing.T) {
+	r := &receiver{failures: 2}
+	server := httptest.NewServer(r)
+	defer server.Close()
+	d := newTestDispatcher(server.URL)
+
+	d.Emit(NewEvent(TaskFinalized, "acme", "ticket1", "task1"))
+	d.Wait()
+
+	if len(r.events) != 1 || r.events[0].TaskId != "task1" {
+		t.Fatalf("expected the event to arrive after retries, got %#v", r.events)
+	}
+	entries := d.Log.Entries("ticket1")
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 logged attempts, got %d", len(entries))
+	}
+	if entries[0].Delivered || entries[0].StatusCode != http.StatusServiceUnavailable || !entries[2].Delivered || entries[2].Attempt != 3 {
+		t.Errorf("unexpected delivery log: %#v %#v %#v", entries[0], entries[1], entries[2])
+	}
+}
+
+func TestDeliveryGivesUp(t *testing.T) {
+	r := &receiver{failures: 100}
+	server := httptest.NewServer(r)
+	defer server.Close()
+	d := newTestDispatcher(server.URL)
+	d.MaxAttempts = 3
+
+	d.Emit(NewEvent(TicketCreated, "acme", "ticket1", ""))
+	d.Wait()
+
+	if entries := d.Log.Entries(""); len(entries) != 3 || entries[2].Delivered {
+		t.Errorf("expected 3 failed attempts, got %#v", entries)
+	}
+}
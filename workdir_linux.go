@@ -0,0 +1,25 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// lockWorkDir takes the lock of the work directory dir, which the server
+// holds while it runs and the commands that change tickets while they do.
+// Closing the file releases it, as does exiting.
+func lockWorkDir(dir string) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(dir, WORK_DIR_LOCK), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, errWorkDirLocked
+		}
+		return nil, err
+	}
+	return f, nil
+}
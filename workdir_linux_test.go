@@ -0,0 +1,29 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestLockWorkDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "workdir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	server, err := lockWorkDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lockWorkDir(dir); err != errWorkDirLocked {
+		t.Errorf("expected the work directory to be locked, got %v", err)
+	}
+	server.Close()
+	lock, err := lockWorkDir(dir)
+	if err != nil {
+		t.Errorf("expected the lock to be released, got %v", err)
+	} else {
+		lock.Close()
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// lockWorkDir only creates the lock file: running servers are detected on
+// Linux only.
+func lockWorkDir(dir string) (*os.File, error) {
+	return os.OpenFile(filepath.Join(dir, WORK_DIR_LOCK), os.O_CREATE|os.O_RDWR, 0600)
+}